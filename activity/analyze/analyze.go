@@ -0,0 +1,217 @@
+package analyze
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/activity"
+	"github.com/bzimmer/gravl/activity/strava"
+	"github.com/bzimmer/gravl/analysis"
+	"github.com/bzimmer/gravl/track"
+)
+
+// result is the analysis of an activity
+type result struct {
+	Source string `json:"source"`
+	*analysis.Analysis
+}
+
+// ConfigFlags specify the athlete's thresholds and the parameters of the analysis
+func ConfigFlags() []cli.Flag {
+	cfg := analysis.DefaultConfig()
+	durations := make([]int64, len(cfg.Durations))
+	for i, d := range cfg.Durations {
+		durations[i] = int64(d)
+	}
+	return []cli.Flag{
+		&cli.Float64Flag{
+			Name:  "ftp",
+			Usage: "Functional threshold power in watts, required for power zones, intensity factor, and TSS",
+		},
+		&cli.Float64Flag{
+			Name:  "max-hr",
+			Usage: "Maximum heart rate in beats per minute, required for heart rate zones",
+		},
+		&cli.Float64SliceFlag{
+			Name:  "power-zones",
+			Value: cli.NewFloat64Slice(cfg.PowerZones...),
+			Usage: "Upper bound of each power zone but the last as a fraction of FTP",
+		},
+		&cli.Float64SliceFlag{
+			Name:  "hr-zones",
+			Value: cli.NewFloat64Slice(cfg.HeartRateZones...),
+			Usage: "Upper bound of each heart rate zone but the last as a fraction of maximum heart rate",
+		},
+		&cli.Int64SliceFlag{
+			Name:  "durations",
+			Value: cli.NewInt64Slice(durations...),
+			Usage: "Durations in seconds of the mean-max power curve",
+		},
+		&cli.Float64Flag{
+			Name:  "climb-gain",
+			Value: cfg.ClimbGain,
+			Usage: "Minimum elevation gain in meters of a climb",
+		},
+		&cli.Float64Flag{
+			Name:  "climb-grade",
+			Value: cfg.ClimbGrade,
+			Usage: "Minimum average grade in percent of a climb",
+		},
+	}
+}
+
+// Config returns the analysis configuration from the flags
+func Config(c *cli.Context) *analysis.Config {
+	cfg := analysis.DefaultConfig()
+	cfg.FTP = c.Float64("ftp")
+	cfg.MaxHeartRate = c.Float64("max-hr")
+	cfg.PowerZones = c.Float64Slice("power-zones")
+	cfg.HeartRateZones = c.Float64Slice("hr-zones")
+	cfg.Durations = cfg.Durations[:0]
+	for _, d := range c.Int64Slice("durations") {
+		cfg.Durations = append(cfg.Durations, int(d))
+	}
+	cfg.ClimbGain = c.Float64("climb-gain")
+	cfg.ClimbGrade = c.Float64("climb-grade")
+	return cfg
+}
+
+// Files returns the activity files for the argument, directories are walked for files with
+// a FIT, GPX, or TCX extension while files are returned regardless of extension
+func Files(fs afero.Fs, name string) ([]string, error) {
+	var paths []string
+	err := afero.Walk(fs, name, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if _, err = track.ToFormat(filepath.Ext(path)); path != name && err != nil {
+			return nil //nolint:nilerr // not an activity file
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	return paths, err
+}
+
+// Decode the activity file
+func Decode(fs afero.Fs, path string) (*track.Track, error) {
+	fp, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	return track.Decode(fp)
+}
+
+// Tracks decodes the activity files of the arguments and calls fn with each track started in the
+// date range, a zero time leaves that end of the range open
+func Tracks(
+	c *cli.Context, before, after time.Time, fn func(path string, trk *track.Track, summary *track.Summary) error) error {
+	fs := gravl.Runtime(c).Fs
+	for _, arg := range c.Args().Slice() {
+		paths, err := Files(fs, arg)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			var trk *track.Track
+			if trk, err = Decode(fs, path); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			summary := trk.Summarize()
+			if (!after.IsZero() && summary.Start.Before(after)) || (!before.IsZero() && summary.Start.After(before)) {
+				continue
+			}
+			if err = fn(path, trk, summary); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func encode(c *cli.Context, source string, s *analysis.Streams, cfg *analysis.Config) error {
+	res, err := analysis.Analyze(s, cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	log.Info().Str("source", source).Int("duration", res.Duration).Msg(c.Command.Name)
+	return gravl.Runtime(c).Encoder.Encode(&result{Source: source, Analysis: res})
+}
+
+func analyze(c *cli.Context) error {
+	if c.NArg() == 0 {
+		log.Warn().Msg("no args specified; exiting")
+		return nil
+	}
+	cfg := Config(c)
+	rt := gravl.Runtime(c)
+	switch from := c.String("from"); from {
+	case "":
+		return Tracks(c, time.Time{}, time.Time{}, func(path string, trk *track.Track, _ *track.Summary) error {
+			rt.Metrics.IncrCounter([]string{c.Command.Name, "file"}, 1)
+			return encode(c, path, analysis.FromTrack(trk), cfg)
+		})
+	case strava.Provider:
+		for _, arg := range c.Args().Slice() {
+			id, err := strconv.ParseInt(arg, 0, 64)
+			if err != nil {
+				return err
+			}
+			s, err := strava.Streams(c, id)
+			if err != nil {
+				return err
+			}
+			rt.Metrics.IncrCounter([]string{c.Command.Name, strava.Provider}, 1)
+			if err = encode(c, arg, s, cfg); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.New("unsupported source: " + from)
+	}
+	return nil
+}
+
+// flags returns the flags common to all sources of streams followed by the flags
+func flags(flags ...[]cli.Flag) []cli.Flag {
+	x := []cli.Flag{
+		&cli.StringFlag{
+			Name:  "from",
+			Usage: "Source of the streams, either local files if not specified or `strava`",
+		},
+	}
+	for _, q := range append(flags, strava.AuthFlags(), activity.RateLimitFlags(), activity.RetryFlags()) {
+		x = append(x, q...)
+	}
+	return x
+}
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:     "analyze",
+		Category: "activity",
+		Usage:    "Analyze the streams of activities",
+		Description: "Compute the mean-max power curve, normalized power, intensity factor, TSS, time in power and " +
+			"heart rate zones, aerobic decoupling, and the VAM of each climb from the streams of FIT, GPX, and TCX " +
+			"files or, with `--from strava`, the streams of Strava activities",
+		ArgsUsage: "{FILE | DIRECTORY | ACTIVITY_ID} ...",
+		Flags:     flags(ConfigFlags()),
+		Action:    analyze,
+		Subcommands: []*cli.Command{
+			loadCommand(),
+		},
+	}
+}
@@ -0,0 +1,99 @@
+package analyze_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/activity/analyze"
+	"github.com/bzimmer/gravl/internal"
+	"github.com/bzimmer/gravl/track"
+)
+
+func command(_ *testing.T, _ string) *cli.Command {
+	return analyze.Command()
+}
+
+// ride writes a FIT file of a ten minute ride
+func ride(path string) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		start := time.Date(2021, time.October, 1, 8, 0, 0, 0, time.UTC)
+		trk := &track.Track{Format: track.FormatFIT}
+		for i := range 600 {
+			trk.Points = append(trk.Points, &track.Point{
+				Time:      start.Add(time.Duration(i) * time.Second),
+				Power:     float64(150 + i%60),
+				HeartRate: 140,
+				Distance:  float64(i * 8),
+				Elevation: 100 + float64(i)/10,
+				Channels:  track.ChannelPower | track.ChannelHeartRate | track.ChannelDistance | track.ChannelElevation,
+			})
+		}
+		var buf bytes.Buffer
+		if err := track.EncodeFIT(&buf, trk); err != nil {
+			return err
+		}
+		return afero.WriteFile(gravl.Runtime(c).Fs, path, buf.Bytes(), 0o644)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	tests := []*internal.Harness{
+		{
+			Name:   "file",
+			Args:   []string{"gravl", "analyze", "--ftp", "250", "--max-hr", "185", "/rides/ride.fit"},
+			Before: ride("/rides/ride.fit"),
+			Counters: map[string]int{
+				"gravl.analyze.file": 1,
+			},
+		},
+		{
+			Name: "directory",
+			Args: []string{"gravl", "analyze", "/rides"},
+			Before: func(c *cli.Context) error {
+				if err := ride("/rides/morning.fit")(c); err != nil {
+					return err
+				}
+				if err := ride("/rides/evening.fit")(c); err != nil {
+					return err
+				}
+				return afero.WriteFile(gravl.Runtime(c).Fs, "/rides/notes.txt", []byte("tired legs"), 0o644)
+			},
+			Counters: map[string]int{
+				"gravl.analyze.file": 2,
+			},
+		},
+		{
+			Name: "invalid file",
+			Args: []string{"gravl", "analyze", "/rides/ride.fit"},
+			Before: func(c *cli.Context) error {
+				return afero.WriteFile(gravl.Runtime(c).Fs, "/rides/ride.fit", []byte("not a ride"), 0o644)
+			},
+			Err: "/rides/ride.fit: unknown format",
+		},
+		{
+			Name: "missing file",
+			Args: []string{"gravl", "analyze", "/rides/ride.fit"},
+			Err:  "file does not exist",
+		},
+		{
+			Name: "unsupported source",
+			Args: []string{"gravl", "analyze", "--from", "zwift", "12345"},
+			Err:  "unsupported source: zwift",
+		},
+		{
+			Name: "no args",
+			Args: []string{"gravl", "analyze"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			internal.Run(t, tt, nil, command)
+		})
+	}
+}
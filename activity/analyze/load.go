@@ -0,0 +1,142 @@
+package analyze
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/activity"
+	"github.com/bzimmer/gravl/activity/strava"
+	"github.com/bzimmer/gravl/analysis"
+	"github.com/bzimmer/gravl/track"
+)
+
+// days is the length of the default date range
+const days = 90
+
+func loadFlags() []cli.Flag {
+	cfg := analysis.DefaultConfig()
+	return append([]cli.Flag{
+		&cli.Float64Flag{
+			Name:  "threshold-hr",
+			Usage: "Threshold heart rate in beats per minute for estimating TSS from heart rate (default: 90% of --max-hr)",
+		},
+		&cli.Float64Flag{
+			Name:  "intensity",
+			Value: cfg.Intensity,
+			Usage: "Intensity factor assumed when estimating TSS from duration",
+		},
+		&cli.IntFlag{
+			Name:  "fitness-days",
+			Value: cfg.FitnessDays,
+			Usage: "Time constant in days of the chronic training load (fitness)",
+		},
+		&cli.IntFlag{
+			Name:  "fatigue-days",
+			Value: cfg.FatigueDays,
+			Usage: "Time constant in days of the acute training load (fatigue)",
+		},
+	}, activity.DateRangeFlags()...)
+}
+
+// daterange returns the date range of the flags, defaulting to the last 90 days
+func daterange(c *cli.Context) (time.Time, time.Time, error) {
+	before, after, err := activity.DateRange(c, activity.NaturalParse, activity.AraddonParse)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if before.IsZero() {
+		before = time.Now()
+	}
+	if after.IsZero() {
+		after = before.AddDate(0, 0, -days)
+	}
+	if after.After(before) {
+		return time.Time{}, time.Time{}, errors.New("invalid date range")
+	}
+	return before.In(time.Local), after.In(time.Local), nil
+}
+
+// stress returns the training stress of the activity files in the date range
+func stress(c *cli.Context, before, after time.Time, cfg *analysis.Config) ([]*analysis.Stress, error) {
+	met := gravl.Runtime(c).Metrics
+	var res []*analysis.Stress
+	err := Tracks(c, before, after, func(path string, trk *track.Track, summary *track.Summary) error {
+		a, err := analysis.Analyze(analysis.FromTrack(trk), cfg)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		s := a.Stress(summary.Start, cfg)
+		met.IncrCounter([]string{"file", "stress", s.Method}, 1)
+		log.Info().
+			Time("date", summary.Start).
+			Str("path", path).
+			Float64("tss", s.TSS).
+			Str("method", s.Method).
+			Msg("stress")
+		res = append(res, s)
+		return nil
+	})
+	return res, err
+}
+
+func load(c *cli.Context) error {
+	before, after, err := daterange(c)
+	if err != nil {
+		return err
+	}
+	cfg := Config(c)
+	cfg.ThresholdHeartRate = c.Float64("threshold-hr")
+	cfg.Intensity = c.Float64("intensity")
+	cfg.FitnessDays = c.Int("fitness-days")
+	cfg.FatigueDays = c.Int("fatigue-days")
+	if cfg.FitnessDays <= 0 || cfg.FatigueDays <= 0 {
+		return errors.New("fitness and fatigue days must be positive")
+	}
+	var res []*analysis.Stress
+	switch from := c.String("from"); from {
+	case "":
+		if c.NArg() == 0 {
+			log.Warn().Msg("no args specified; exiting")
+			return nil
+		}
+		res, err = stress(c, before, after, cfg)
+	case strava.Provider:
+		res, err = strava.Stress(c, before, after, cfg)
+	default:
+		return errors.New("unsupported source: " + from)
+	}
+	if err != nil {
+		return err
+	}
+	enc := gravl.Runtime(c).Encoder
+	met := gravl.Runtime(c).Metrics
+	met.IncrCounter([]string{c.Command.Name, "activity"}, float32(len(res)))
+	for _, x := range analysis.TrainingLoad(res, after, before, cfg) {
+		met.IncrCounter([]string{c.Command.Name, "day"}, 1)
+		if err = enc.Encode(x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "load",
+		Usage: "Compute the daily training load",
+		Description: "Compute the daily training stress of the activities in the date range over their moving time, from normalized power " +
+			"if available, otherwise from average heart rate, otherwise from duration, and the resulting chronic " +
+			"training load (fitness), acute training load (fatigue), and training stress balance (form). The " +
+			"activities are read from FIT, GPX, and TCX files, such as an archive created by `qp sync`, or, with " +
+			"`--from strava`, queried from Strava. The date range defaults to the last 90 days; the load prior to " +
+			"the range is assumed to be zero so start well before the days of interest.",
+		ArgsUsage: "{FILE | DIRECTORY} ...",
+		Flags:     flags(ConfigFlags(), loadFlags()),
+		Action:    load,
+	}
+}
@@ -0,0 +1,62 @@
+package analyze_test
+
+import (
+	"testing"
+
+	"github.com/bzimmer/gravl/internal"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []*internal.Harness{
+		{
+			Name:   "power",
+			Args:   []string{"gravl", "analyze", "load", "--ftp", "250", "--after", "2021-09-01", "--before", "2021-10-15", "/rides"},
+			Before: ride("/rides/ride.fit"),
+			Counters: map[string]int{
+				"gravl.load.activity":     1,
+				"gravl.file.stress.power": 1,
+			},
+		},
+		{
+			Name:   "heart rate",
+			Args:   []string{"gravl", "analyze", "load", "--max-hr", "185", "--after", "2021-09-01", "--before", "2021-10-15", "/rides"},
+			Before: ride("/rides/ride.fit"),
+			Counters: map[string]int{
+				"gravl.file.stress.heartrate": 1,
+			},
+		},
+		{
+			Name:   "outside the date range",
+			Args:   []string{"gravl", "analyze", "load", "--after", "2021-10-05", "--before", "2021-10-15", "/rides"},
+			Before: ride("/rides/ride.fit"),
+			Counters: map[string]int{
+				"gravl.load.day": 11,
+			},
+		},
+		{
+			Name: "invalid date range",
+			Args: []string{"gravl", "analyze", "load", "--after", "2021-10-15", "--before", "2021-10-05", "/rides"},
+			Err:  "invalid date range",
+		},
+		{
+			Name: "invalid fitness days",
+			Args: []string{"gravl", "analyze", "load", "--fitness-days", "0", "/rides"},
+			Err:  "fitness and fatigue days must be positive",
+		},
+		{
+			Name: "unsupported source",
+			Args: []string{"gravl", "analyze", "load", "--from", "zwift"},
+			Err:  "unsupported source: zwift",
+		},
+		{
+			Name: "no args",
+			Args: []string{"gravl", "analyze", "load"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			internal.Run(t, tt, nil, command)
+		})
+	}
+}
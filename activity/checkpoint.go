@@ -0,0 +1,184 @@
+package activity
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+)
+
+const metricCheckpoint = "checkpoint"
+
+// Failure is an item which failed during a checkpointed run
+type Failure struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// key identifies an item of a provider
+type key struct {
+	provider string
+	id       string
+}
+
+// entry is a line of the checkpoint journal, the latest entry of an item is its outcome
+type entry struct {
+	Provider  string    `json:"provider"`
+	ID        string    `json:"id"`
+	Completed time.Time `json:"completed,omitzero"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// checkpoint persists the outcome of each item of a bulk operation by appending an entry
+// to the journal as each item completes or fails
+type checkpoint struct {
+	fp      afero.File
+	enc     *json.Encoder
+	entries map[key]*entry
+}
+
+// loadCheckpoint replays the journal at `path`, a final line without a newline is the
+// remains of an interrupted write and is truncated rather than treated as corruption
+func loadCheckpoint(fs afero.Fs, path string) (*checkpoint, error) {
+	cp := &checkpoint{entries: make(map[key]*entry)}
+	data, err := afero.ReadFile(fs, path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	var size int
+	for len(data) > size {
+		line := data[size:]
+		n := bytes.IndexByte(line, '\n')
+		if n < 0 {
+			log.Warn().Str("path", path).Int("offset", size).Msg("truncating partial checkpoint entry")
+			break
+		}
+		line = line[:n]
+		size += n + 1
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		e := new(entry)
+		if err = json.Unmarshal(line, e); err != nil {
+			return nil, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+		}
+		cp.entries[key{provider: e.Provider, id: e.ID}] = e
+	}
+	if err = fs.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	if cp.fp, err = fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600); err != nil {
+		return nil, err
+	}
+	if size < len(data) {
+		if err = cp.fp.Truncate(int64(size)); err == nil {
+			_, err = cp.fp.Seek(0, io.SeekEnd)
+		}
+		if err != nil {
+			cp.fp.Close()
+			return nil, err
+		}
+	}
+	cp.enc = json.NewEncoder(cp.fp)
+	return cp, nil
+}
+
+// completed returns true if the item completed in a previous run
+func (cp *checkpoint) completed(provider, id string) bool {
+	e, ok := cp.entries[key{provider: provider, id: id}]
+	return ok && e.Error == ""
+}
+
+// record the outcome of the item by appending it to the journal
+func (cp *checkpoint) record(provider, id string, err error) error {
+	e := &entry{Provider: provider, ID: id}
+	switch err {
+	case nil:
+		e.Completed = time.Now().UTC()
+	default:
+		e.Error = err.Error()
+	}
+	cp.entries[key{provider: provider, id: id}] = e
+	return cp.enc.Encode(e)
+}
+
+func (cp *checkpoint) Close() error {
+	return cp.fp.Close()
+}
+
+// CheckpointFlag supports resuming a bulk operation
+func CheckpointFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name: "checkpoint",
+		Usage: `File recording completed and failed ids; if specified, ids completed by a previous
+run are skipped and a failure does not stop the run`,
+	}
+}
+
+// Checkpoint calls `f` for each id of the provider
+//
+// Without the `checkpoint` flag the first error is returned. With it, the outcome of each
+// id is persisted as it happens, ids of the provider completed by a previous run are skipped,
+// and failures are collected rather than returned so the remaining ids are still attempted.
+// Once all ids are processed each failure is encoded and an error summarizing the failures
+// is returned.
+func Checkpoint(c *cli.Context, provider string, ids []string, f func(id string) error) error {
+	path := c.String("checkpoint")
+	if path == "" {
+		for _, id := range ids {
+			if err := f(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	cp, err := loadCheckpoint(gravl.Runtime(c).Fs, path)
+	if err != nil {
+		return err
+	}
+	defer cp.Close()
+	met := gravl.Runtime(c).Metrics
+	var failures []*Failure
+	for _, id := range ids {
+		if cp.completed(provider, id) {
+			met.IncrCounter([]string{metricCheckpoint, "skipped"}, 1)
+			log.Debug().Str("id", id).Msg("skipping completed")
+			continue
+		}
+		ferr := f(id)
+		if err = c.Context.Err(); err != nil {
+			// interrupted, the id is attempted again on the next run
+			return err
+		}
+		if err = cp.record(provider, id, ferr); err != nil {
+			return err
+		}
+		if ferr != nil {
+			met.IncrCounter([]string{metricCheckpoint, "failed"}, 1)
+			log.Error().Err(ferr).Str("id", id).Msg(metricCheckpoint)
+			failures = append(failures, &Failure{ID: id, Error: ferr.Error()})
+			continue
+		}
+		met.IncrCounter([]string{metricCheckpoint, "completed"}, 1)
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	enc := gravl.Runtime(c).Encoder
+	for _, failure := range failures {
+		if err = enc.Encode(failure); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("%d of %d failed, see %s", len(failures), len(ids), path)
+}
@@ -0,0 +1,198 @@
+package activity_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/activity"
+	"github.com/bzimmer/gravl/internal"
+)
+
+const checkpointPath = "/backfill/checkpoint.json"
+
+type state struct {
+	Completed map[string]time.Time
+	Failed    map[string]string
+}
+
+// readCheckpoint replays the journal, the latest entry of an id is its outcome
+func readCheckpoint(t *testing.T, c *cli.Context) *state {
+	a := assert.New(t)
+	fp, err := gravl.Runtime(c).Fs.Open(checkpointPath)
+	a.NoError(err)
+	defer fp.Close()
+	s := &state{Completed: make(map[string]time.Time), Failed: make(map[string]string)}
+	dec := json.NewDecoder(fp)
+	for dec.More() {
+		var e struct {
+			Provider  string    `json:"provider"`
+			ID        string    `json:"id"`
+			Completed time.Time `json:"completed"`
+			Error     string    `json:"error"`
+		}
+		a.NoError(dec.Decode(&e))
+		a.Equal("test", e.Provider)
+		delete(s.Completed, e.ID)
+		delete(s.Failed, e.ID)
+		switch e.Error {
+		case "":
+			s.Completed[e.ID] = e.Completed
+		default:
+			s.Failed[e.ID] = e.Error
+		}
+	}
+	return s
+}
+
+func TestCheckpoint(t *testing.T) {
+	a := assert.New(t)
+	// fails each id in `failing`, counting the calls in `attempted`
+	action := func(attempted *[]string, failing ...string) cli.ActionFunc {
+		return func(c *cli.Context) error {
+			return activity.Checkpoint(c, "test", c.Args().Slice(), func(id string) error {
+				*attempted = append(*attempted, id)
+				for _, x := range failing {
+					if x == id {
+						return errors.New("service unavailable")
+					}
+				}
+				return nil
+			})
+		}
+	}
+	var attempted []string
+	tests := []*internal.Harness{
+		{
+			Name: "without checkpoint",
+			Args: []string{"gravl", "without checkpoint", "1", "2", "3"},
+			Before: func(_ *cli.Context) error {
+				attempted = nil
+				return nil
+			},
+			Action: action(&attempted, "2"),
+			After: func(_ *cli.Context) error {
+				a.Equal([]string{"1", "2"}, attempted)
+				return nil
+			},
+			Err: "service unavailable",
+		},
+		{
+			Name: "continue past failures",
+			Args: []string{"gravl", "continue past failures", "--checkpoint", checkpointPath, "1", "2", "3"},
+			Before: func(_ *cli.Context) error {
+				attempted = nil
+				return nil
+			},
+			Action: action(&attempted, "2"),
+			Counters: map[string]int{
+				"gravl.checkpoint.completed": 2,
+				"gravl.checkpoint.failed":    1,
+			},
+			After: func(c *cli.Context) error {
+				a.Equal([]string{"1", "2", "3"}, attempted)
+				s := readCheckpoint(t, c)
+				a.Len(s.Completed, 2)
+				a.Equal(map[string]string{"2": "service unavailable"}, s.Failed)
+				return nil
+			},
+			Err: "1 of 3 failed, see " + checkpointPath,
+		},
+		{
+			Name: "resume",
+			Args: []string{"gravl", "resume", "--checkpoint", checkpointPath, "1", "2", "3"},
+			Before: func(c *cli.Context) error {
+				attempted = nil
+				data := `{"provider":"test","id":"1","completed":"2021-10-01T08:00:00Z"}
+{"provider":"test","id":"2","error":"service unavailable"}
+`
+				return afero.WriteFile(gravl.Runtime(c).Fs, checkpointPath, []byte(data), 0o600)
+			},
+			Action: action(&attempted),
+			Counters: map[string]int{
+				"gravl.checkpoint.skipped":   1,
+				"gravl.checkpoint.completed": 2,
+			},
+			After: func(c *cli.Context) error {
+				a.Equal([]string{"2", "3"}, attempted)
+				s := readCheckpoint(t, c)
+				a.Len(s.Completed, 3)
+				a.Empty(s.Failed)
+				return nil
+			},
+		},
+		{
+			Name: "keyed by provider",
+			Args: []string{"gravl", "keyed by provider", "--checkpoint", checkpointPath, "1", "2"},
+			Before: func(c *cli.Context) error {
+				attempted = nil
+				data := `{"provider":"test","id":"1","completed":"2021-10-01T08:00:00Z"}
+{"provider":"other","id":"2","completed":"2021-10-01T08:00:00Z"}
+`
+				return afero.WriteFile(gravl.Runtime(c).Fs, checkpointPath, []byte(data), 0o600)
+			},
+			Action: action(&attempted),
+			Counters: map[string]int{
+				"gravl.checkpoint.skipped":   1,
+				"gravl.checkpoint.completed": 1,
+			},
+			After: func(_ *cli.Context) error {
+				a.Equal([]string{"2"}, attempted)
+				return nil
+			},
+		},
+		{
+			Name: "truncated entry",
+			Args: []string{"gravl", "truncated entry", "--checkpoint", checkpointPath, "1", "2"},
+			Before: func(c *cli.Context) error {
+				attempted = nil
+				data := `{"provider":"test","id":"1","completed":"2021-10-01T08:00:00Z"}
+{"provider":"test","id":"2","comp`
+				return afero.WriteFile(gravl.Runtime(c).Fs, checkpointPath, []byte(data), 0o600)
+			},
+			Action: action(&attempted),
+			Counters: map[string]int{
+				"gravl.checkpoint.skipped":   1,
+				"gravl.checkpoint.completed": 1,
+			},
+			After: func(c *cli.Context) error {
+				a.Equal([]string{"2"}, attempted)
+				s := readCheckpoint(t, c)
+				a.Len(s.Completed, 2)
+				a.Empty(s.Failed)
+				return nil
+			},
+		},
+		{
+			Name: "invalid checkpoint",
+			Args: []string{"gravl", "invalid checkpoint", "--checkpoint", checkpointPath, "1"},
+			Before: func(c *cli.Context) error {
+				data := `{
+{"provider":"test","id":"1","completed":"2021-10-01T08:00:00Z"}
+`
+				return afero.WriteFile(gravl.Runtime(c).Fs, checkpointPath, []byte(data), 0o600)
+			},
+			Action: action(&attempted),
+			Err:    "invalid checkpoint " + checkpointPath,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			command := func(_ *testing.T, _ string) *cli.Command {
+				return &cli.Command{
+					Name:   tt.Name,
+					Flags:  []cli.Flag{activity.CheckpointFlag()},
+					Action: tt.Action,
+				}
+			}
+			internal.Run(t, tt, nil, command)
+		})
+	}
+}
@@ -4,12 +4,12 @@ import (
 	"context"
 	"strconv"
 	"sync"
-	"time"
 
 	api "github.com/bzimmer/activity"
 	"github.com/bzimmer/activity/cyclinganalytics"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/oauth2"
 	"golang.org/x/time/rate"
 
 	"github.com/bzimmer/gravl"
@@ -57,13 +57,32 @@ func activities(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	f, err := activity.Filter[*cyclinganalytics.Ride](c)
+	if err != nil {
+		return err
+	}
+	g, err := activity.Attributer[*cyclinganalytics.Ride](c)
+	if err != nil {
+		return err
+	}
 	met := gravl.Runtime(c).Metrics
 	met.IncrCounter([]string{Provider, c.Command.Name}, 1)
 	enc := gravl.Runtime(c).Encoder
 	metKey := []string{Provider, metricActivity}
 	for _, ride := range rides {
+		var ok bool
+		if ok, err = f(ctx, ride); err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		var ext any
+		if ext, err = g(ctx, ride); err != nil {
+			return err
+		}
 		met.IncrCounter(metKey, 1)
-		if err = enc.Encode(ride); err != nil {
+		if err = enc.Encode(ext); err != nil {
 			return err
 		}
 	}
@@ -72,18 +91,20 @@ func activities(c *cli.Context) error {
 
 func activitiesCommand() *cli.Command {
 	return &cli.Command{
-		Name:        "activities",
-		Aliases:     []string{"A"},
-		Usage:       "Query activities for the authenticated athlete",
-		Description: "Query the CyclingAnalytics API for a list of rides for the authenticated athlete",
-		Flags: []cli.Flag{
+		Name:    "activities",
+		Aliases: []string{"A"},
+		Usage:   "Query activities for the authenticated athlete",
+		Description: "Query the CyclingAnalytics API for a list of rides for the authenticated athlete. " +
+			activity.Environment[*cyclinganalytics.Ride](
+				"Distances are in kilometers, speeds in kilometers per hour, climbing in meters, and durations in seconds."),
+		Flags: append([]cli.Flag{
 			&cli.IntFlag{
 				Name:    "count",
 				Aliases: []string{"N"},
 				Value:   0,
 				Usage:   "The number of activities to query from CA (the number returned will be <= N)",
 			},
-		},
+		}, activity.EvalFlags()...),
 		Action: activities,
 	}
 }
@@ -150,11 +171,19 @@ func oauthCommand() *cli.Command {
 
 func Before(c *cli.Context) error {
 	before.Do(func() {
+		tok := activity.Token(c, Provider, &oauth2.Token{
+			AccessToken:  c.String("cyclinganalytics-access-token"),
+			RefreshToken: c.String("cyclinganalytics-refresh-token"),
+		}, "cyclinganalytics-access-token", "cyclinganalytics-refresh-token")
+		cfg := &oauth2.Config{
+			ClientID:     c.String("cyclinganalytics-client-id"),
+			ClientSecret: c.String("cyclinganalytics-client-secret"),
+			Endpoint:     cyclinganalytics.Endpoint(),
+		}
 		var client *cyclinganalytics.Client
 		client, errBefore = cyclinganalytics.NewClient(
-			cyclinganalytics.WithTokenCredentials(
-				c.String("cyclinganalytics-access-token"), c.String("cyclinganalytics-refresh-token"), time.Time{}),
-			cyclinganalytics.WithAutoRefresh(c.Context),
+			cyclinganalytics.WithTokenCredentials(tok.AccessToken, tok.RefreshToken, tok.Expiry),
+			cyclinganalytics.WithHTTPClient(activity.HTTPClient(c, Provider, cfg, tok)),
 			cyclinganalytics.WithHTTPTracing(c.Bool("http-tracing")),
 			cyclinganalytics.WithRateLimiter(rate.NewLimiter(
 				rate.Every(c.Duration("rate-limit")), c.Int("rate-burst"))))
@@ -176,7 +205,7 @@ func Command() *cli.Command {
 		Category:    metricActivity,
 		Usage:       "Query CyclingAnalytics",
 		Description: "Operations supported by the CyclingAnalytics API",
-		Flags:       append(AuthFlags(), activity.RateLimitFlags()...),
+		Flags:       append(append(AuthFlags(), activity.RateLimitFlags()...), activity.RetryFlags()...),
 		Before:      Before,
 		Subcommands: []*cli.Command{
 			activitiesCommand(),
@@ -154,6 +154,14 @@ func TestActivities(t *testing.T) {
 				"gravl.cyclinganalytics.activities": 1,
 			},
 		},
+		{
+			Name: "filtered rides",
+			Args: []string{"gravl", "cyclinganalytics", "activities", "--filter", ".ID < 2000"},
+			Counters: map[string]int{
+				"gravl.cyclinganalytics.activity":   2,
+				"gravl.cyclinganalytics.activities": 1,
+			},
+		},
 	}
 	for _, tt := range tests {
 		tt := tt
@@ -0,0 +1,121 @@
+package activity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/config"
+	"github.com/bzimmer/gravl/eval"
+)
+
+// EvalFlags support filtering activities and extracting attributes with expressions
+func EvalFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "filter",
+			Aliases: []string{"f"},
+			Usage:   "Expression for filtering activities to remove",
+		},
+		&cli.StringSliceFlag{
+			Name:    "attribute",
+			Aliases: []string{"B"},
+			Usage:   "Evaluate the expression on an activity and return only those results",
+		},
+		&cli.StringFlag{
+			Name:  config.QueryFlag,
+			Usage: "Name of a query in the config file supplying values for flags not otherwise specified",
+		},
+	}
+}
+
+// AggregateFlags support grouping activities and computing aggregate values for each group
+func AggregateFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "group-by",
+			Usage: "Expression evaluated on each activity to determine its group, eg 'isoweek(.StartDateLocal)'",
+		},
+		&cli.StringFlag{
+			Name: "aggregate",
+			Usage: "Comma separated aggregates computed for each group, eg 'sum(.Distance), max(.ElevationGain), count()'; " +
+				"the functions count, sum, min, max, and avg are supported",
+		},
+	}
+}
+
+// Aggregator returns the aggregator for the `group-by` and `aggregate` flags or nil if neither was specified
+func Aggregator[T any](c *cli.Context) (eval.Aggregator, error) {
+	if !c.IsSet("group-by") && !c.IsSet("aggregate") {
+		//nolint:nilnil // no aggregation
+		return nil, nil
+	}
+	if c.IsSet("attribute") {
+		return nil, errors.New("attributes cannot be combined with group-by or aggregate")
+	}
+	var act T
+	return gravl.Runtime(c).Aggregator(c.String("group-by"), c.String("aggregate"), act)
+}
+
+// Environment documents the expression environment for activities of type T, `units` describes
+// the units of the fields as reported by the provider
+func Environment[T any](units string) string {
+	var act T
+	return fmt.Sprintf("Expressions are evaluated against each activity (%T) with the fields: %s. %s "+
+		"The functions `miles`, `km`, `feet`, `mph`, `kph`, `pace`, `pacemi`, `hms`, and `F` convert units "+
+		"from meters, meters per second, and seconds, `distance`, `near`, `bbox`, and `polygon` test "+
+		"[lat, lng] points, `isoweek`, `weekday`, `weekend`, and `month` operate on times, and `imatches` "+
+		"performs case insensitive regular expression matching.",
+		act, strings.Join(eval.Fields(act), ", "), units)
+}
+
+func evaluator[T any](c *cli.Context, q string) (eval.Evaluator, error) {
+	if q == "" {
+		//nolint:nilnil // no evaluation
+		return nil, nil
+	}
+	var act T
+	ev, err := gravl.Runtime(c).Evaluator(q, act)
+	if err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// Filter returns a function evaluating the `filter` expression on an activity, all
+// activities pass if no expression was specified
+func Filter[T any](c *cli.Context) (func(ctx context.Context, act T) (bool, error), error) {
+	ev, err := evaluator[T](c, c.String("filter"))
+	if err != nil {
+		return nil, err
+	}
+	if ev == nil {
+		return func(_ context.Context, _ T) (bool, error) { return true, nil }, nil
+	}
+	return func(ctx context.Context, act T) (bool, error) { return ev.Bool(ctx, act) }, nil
+}
+
+// Attributer returns a function evaluating the `attribute` expressions on an activity resulting
+// in an array of values, the activity itself is returned if no expression was specified
+func Attributer[T any](c *cli.Context) (func(ctx context.Context, act T) (any, error), error) {
+	var q string
+	attributes := c.StringSlice("attribute")
+	if len(attributes) > 0 {
+		q = "[" + strings.Join(attributes, ", ") + "]"
+	}
+	ev, err := evaluator[T](c, q)
+	if err != nil {
+		return nil, err
+	}
+	if ev == nil {
+		return func(_ context.Context, act T) (any, error) { return act, nil }, nil
+	}
+	if col, ok := gravl.Runtime(c).Encoder.(gravl.Columnar); ok {
+		col.Columns(attributes)
+	}
+	return func(ctx context.Context, act T) (any, error) { return ev.Eval(ctx, act) }, nil
+}
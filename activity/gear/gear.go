@@ -0,0 +1,273 @@
+package gear
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/activity"
+	"github.com/bzimmer/gravl/activity/analyze"
+	"github.com/bzimmer/gravl/activity/strava"
+	"github.com/bzimmer/gravl/config"
+	"github.com/bzimmer/gravl/eval"
+	"github.com/bzimmer/gravl/maintenance"
+	"github.com/bzimmer/gravl/track"
+)
+
+// gear returns the gear section of the config file
+func gear(c *cli.Context) (*config.Gear, error) {
+	cfg, err := config.Read(gravl.Runtime(c).Fs, c.Path("config"))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Gear == nil {
+		return &config.Gear{}, nil
+	}
+	return cfg.Gear, nil
+}
+
+// files returns the activity files started in the date range
+func files(c *cli.Context, before, after time.Time) ([]*maintenance.Activity, error) {
+	met := gravl.Runtime(c).Metrics
+	var res []*maintenance.Activity
+	err := analyze.Tracks(c, before, after, func(path string, _ *track.Track, summary *track.Summary) error {
+		met.IncrCounter([]string{c.Command.Name, "file"}, 1)
+		res = append(res, &maintenance.Activity{
+			ID:        path,
+			Source:    "file",
+			Name:      summary.Name,
+			Sport:     summary.Sport,
+			Device:    summary.Device,
+			Start:     summary.Start,
+			Distance:  summary.Distance,
+			Elevation: summary.ElevationGain,
+			Duration:  summary.Duration,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// assign the gear of the first matching rule to each activity without a gear id
+func assign(c *cli.Context, acts []*maintenance.Activity, rules []*config.Rule) error {
+	evs := make([]eval.Evaluator, len(rules))
+	for i, rule := range rules {
+		if rule.Gear == "" || rule.Filter == "" {
+			return fmt.Errorf("gear rule %d: gear and filter are required", i+1)
+		}
+		ev, err := gravl.Runtime(c).Evaluator(rule.Filter, (*maintenance.Activity)(nil))
+		if err != nil {
+			return fmt.Errorf("gear rule %d: %w", i+1, err)
+		}
+		evs[i] = ev
+	}
+	met := gravl.Runtime(c).Metrics
+	for _, act := range acts {
+		if act.GearID != "" {
+			continue
+		}
+		for i, ev := range evs {
+			ok, err := ev.Bool(c.Context, act)
+			if err != nil {
+				return fmt.Errorf("gear rule %d: %w", i+1, err)
+			}
+			if ok {
+				met.IncrCounter([]string{c.Command.Name, "rule"}, 1)
+				act.GearID = rules[i].Gear
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// activities returns the activities in the date range passing the filter with gear assigned by the rules
+func activities(c *cli.Context, cfg *config.Gear, before, after time.Time) ([]*maintenance.Activity, error) {
+	var acts []*maintenance.Activity
+	var err error
+	switch from := c.String("from"); from {
+	case "":
+		acts, err = files(c, before, after)
+	case strava.Provider:
+		acts, err = strava.Gear(c, before, after)
+	default:
+		return nil, errors.New("unsupported source: " + from)
+	}
+	if err != nil {
+		return nil, err
+	}
+	f, err := activity.Filter[*maintenance.Activity](c)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*maintenance.Activity, 0, len(acts))
+	for _, act := range acts {
+		ok, err := f(c.Context, act)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			res = append(res, act)
+		}
+	}
+	if err = assign(c, res, cfg.Rules); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// daterange returns the date range of the flags, the range is unbounded if not specified
+func daterange(c *cli.Context) (time.Time, time.Time, error) {
+	before, after, err := activity.DateRange(c, activity.NaturalParse, activity.AraddonParse)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if before.IsZero() {
+		before = time.Now()
+	}
+	if after.After(before) {
+		return time.Time{}, time.Time{}, errors.New("invalid date range")
+	}
+	return before, after, nil
+}
+
+func noargs(c *cli.Context) bool {
+	if c.String("from") == "" && c.NArg() == 0 {
+		log.Warn().Msg("no args specified; exiting")
+		return true
+	}
+	return false
+}
+
+func usage(c *cli.Context) error {
+	if noargs(c) {
+		return nil
+	}
+	cfg, err := gear(c)
+	if err != nil {
+		return err
+	}
+	before, after, err := daterange(c)
+	if err != nil {
+		return err
+	}
+	acts, err := activities(c, cfg, before, after)
+	if err != nil {
+		return err
+	}
+	enc := gravl.Runtime(c).Encoder
+	met := gravl.Runtime(c).Metrics
+	for _, u := range maintenance.Totals(acts, cfg.Bikes) {
+		met.IncrCounter([]string{c.Command.Name, "gear"}, 1)
+		if err = enc.Encode(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func service(c *cli.Context) error {
+	if noargs(c) {
+		return nil
+	}
+	cfg, err := gear(c)
+	if err != nil {
+		return err
+	}
+	// the usage of a component is measured from its last service so `--after` does not apply
+	before, _, err := daterange(c)
+	if err != nil {
+		return err
+	}
+	acts, err := activities(c, cfg, before, maintenance.Serviced(cfg.Bikes))
+	if err != nil {
+		return err
+	}
+	enc := gravl.Runtime(c).Encoder
+	met := gravl.Runtime(c).Metrics
+	for _, s := range maintenance.Services(acts, cfg.Bikes) {
+		if s.Due {
+			met.IncrCounter([]string{c.Command.Name, "due"}, 1)
+			log.Warn().Str("gear", s.Gear).Str("component", s.Component).Float64("used", s.Used).Msg("service due")
+		} else if c.Bool("due") {
+			continue
+		}
+		if err = enc.Encode(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func flags(flags ...cli.Flag) []cli.Flag {
+	x := append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  "from",
+			Usage: "Source of the activities, either local files if not specified or `strava`",
+		},
+		&cli.StringFlag{
+			Name:  "filter",
+			Usage: "Expression selecting the activities to include, eg '.Sport == \"Ride\"'",
+		},
+	}, flags...)
+	for _, q := range [][]cli.Flag{
+		strava.AuthFlags(), activity.RateLimitFlags(), activity.RetryFlags(),
+	} {
+		x = append(x, q...)
+	}
+	return x
+}
+
+// environment documents the expression environment of the filter and rules
+func environment() string {
+	return activity.Environment[*maintenance.Activity](
+		"Distance and Elevation are in meters and Duration is the moving time in seconds.")
+}
+
+func serviceCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "service",
+		Usage: "Report the usage of each component since its last service",
+		Description: "Report the distance or time each component has been used since its last service and the " +
+			"remaining distance or time until its next service. The components and their service intervals, eg " +
+			"`every: 3000km`, `2000mi`, or `100h`, are read from the `gear` section of the config file. The " +
+			"activities since the earliest service are read. " + environment(),
+		ArgsUsage: "{FILE | DIRECTORY} ...",
+		Flags: flags(
+			&cli.StringFlag{
+				Name:  "before",
+				Usage: "Return results before the time specified",
+			},
+			&cli.BoolFlag{
+				Name:  "due",
+				Usage: "Report only the components due for service",
+			}),
+		Action: service,
+	}
+}
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:     "gear",
+		Category: "activity",
+		Usage:    "Total the usage of each gear",
+		Description: "Total the distance, time, and elevation gain of each gear over the date range. Activities " +
+			"without a gear id, such as RideWithGPS and Hammerhead rides, are assigned the gear of the first " +
+			"matching rule in the `gear` section of the config file. The activities are read from FIT, GPX, and " +
+			"TCX files, such as an archive created by `qp sync`, or, with `--from strava`, queried from Strava. " +
+			environment(),
+		ArgsUsage: "{FILE | DIRECTORY} ...",
+		Flags:     flags(activity.DateRangeFlags()...),
+		Action:    usage,
+		Subcommands: []*cli.Command{
+			serviceCommand(),
+		},
+	}
+}
@@ -0,0 +1,187 @@
+package gear_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/activity/gear"
+	"github.com/bzimmer/gravl/internal"
+	"github.com/bzimmer/gravl/track"
+)
+
+const path = "/gravl/config.yaml"
+
+const cfg = `
+gear:
+  bikes:
+    - id: b1
+      name: Gravel
+      components:
+        - name: chain
+          every: 20km
+        - name: tires
+          every: 5km
+          serviced: 2021-09-15
+    - id: b2
+      name: Road
+      components:
+        - name: chain
+          every: 3000km
+  rules:
+    - gear: b1
+      filter: .ID contains "/hammerhead/"
+`
+
+func command(_ *testing.T, _ string) *cli.Command {
+	return gear.Command()
+}
+
+// ride writes a FIT file of a ten minute ride of twelve kilometers
+func ride(path string, start time.Time) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		trk := &track.Track{Format: track.FormatFIT}
+		for i := range 600 {
+			trk.Points = append(trk.Points, &track.Point{
+				Time:      start.Add(time.Duration(i) * time.Second),
+				Distance:  float64(i * 20),
+				Elevation: 100 + float64(i)/10,
+				Channels:  track.ChannelDistance | track.ChannelElevation,
+			})
+		}
+		var buf bytes.Buffer
+		if err := track.EncodeFIT(&buf, trk); err != nil {
+			return err
+		}
+		return afero.WriteFile(gravl.Runtime(c).Fs, path, buf.Bytes(), 0o644)
+	}
+}
+
+func config(config string) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		return afero.WriteFile(gravl.Runtime(c).Fs, path, []byte(config), 0o600)
+	}
+}
+
+func rides(config cli.BeforeFunc) cli.BeforeFunc {
+	return gravl.Befores(
+		config,
+		ride("/rides/hammerhead/1-morning.fit", time.Date(2021, time.September, 1, 8, 0, 0, 0, time.UTC)),
+		ride("/rides/hammerhead/2-evening.fit", time.Date(2021, time.October, 1, 8, 0, 0, 0, time.UTC)),
+		ride("/rides/rwgps/3-commute.fit", time.Date(2021, time.October, 2, 8, 0, 0, 0, time.UTC)),
+	)
+}
+
+func TestGear(t *testing.T) {
+	tests := []*internal.Harness{
+		{
+			Name:   "usage",
+			Args:   []string{"gravl", "--config", path, "gear", "/rides"},
+			Before: rides(config(cfg)),
+			Counters: map[string]int{
+				"gravl.gear.file": 3,
+				"gravl.gear.rule": 2,
+				"gravl.gear.gear": 2,
+			},
+		},
+		{
+			Name:   "usage in the date range",
+			Args:   []string{"gravl", "--config", path, "gear", "--after", "2021-09-15", "/rides"},
+			Before: rides(config(cfg)),
+			Counters: map[string]int{
+				"gravl.gear.file": 2,
+				"gravl.gear.rule": 1,
+			},
+		},
+		{
+			Name:   "filter",
+			Args:   []string{"gravl", "--config", path, "gear", "--filter", `.ID contains "rwgps"`, "/rides"},
+			Before: rides(config(cfg)),
+			Counters: map[string]int{
+				"gravl.gear.gear": 1,
+			},
+		},
+		{
+			Name:   "service",
+			Args:   []string{"gravl", "--config", path, "gear", "service", "/rides"},
+			Before: rides(config(cfg)),
+			Counters: map[string]int{
+				"gravl.service.file": 3,
+				"gravl.service.due":  2,
+			},
+		},
+		{
+			Name:   "service due",
+			Args:   []string{"gravl", "--config", path, "gear", "service", "--due", "/rides"},
+			Before: rides(config(cfg)),
+			Counters: map[string]int{
+				"gravl.service.due": 2,
+			},
+		},
+		{
+			Name:   "service before",
+			Args:   []string{"gravl", "--config", path, "gear", "service", "--before", "2021-09-15", "/rides"},
+			Before: rides(config(cfg)),
+			Counters: map[string]int{
+				"gravl.service.file": 1,
+			},
+		},
+		{
+			Name:   "service after",
+			Args:   []string{"gravl", "--config", path, "gear", "service", "--after", "2021-09-15", "/rides"},
+			Before: rides(config(cfg)),
+			Err:    "flag provided but not defined: -after",
+		},
+		{
+			Name:   "service without config",
+			Args:   []string{"gravl", "--config", path, "gear", "service", "/rides"},
+			Before: rides(config("")),
+			Counters: map[string]int{
+				"gravl.service.file": 3,
+			},
+		},
+		{
+			Name:   "invalid rule",
+			Args:   []string{"gravl", "--config", path, "gear", "/rides"},
+			Before: rides(config("gear: {rules: [{gear: b1}]}")),
+			Err:    "gear rule 1: gear and filter are required",
+		},
+		{
+			Name:   "invalid interval",
+			Args:   []string{"gravl", "--config", path, "gear", "/rides"},
+			Before: config("gear: {bikes: [{id: b1, components: [{name: chain, every: 10}]}]}"),
+			Err:    "invalid config " + path,
+		},
+		{
+			Name: "missing config",
+			Args: []string{"gravl", "--config", path, "gear", "/rides"},
+			Err:  path,
+		},
+		{
+			Name:   "invalid date range",
+			Args:   []string{"gravl", "--config", path, "gear", "--after", "2021-10-15", "--before", "2021-10-05", "/rides"},
+			Before: config(cfg),
+			Err:    "invalid date range",
+		},
+		{
+			Name:   "unsupported source",
+			Args:   []string{"gravl", "--config", path, "gear", "--from", "zwift"},
+			Before: config(cfg),
+			Err:    "unsupported source: zwift",
+		},
+		{
+			Name: "no args",
+			Args: []string{"gravl", "gear"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			internal.Run(t, tt, nil, command)
+		})
+	}
+}
@@ -12,10 +12,12 @@ import (
 	"github.com/bzimmer/activity/hammerhead"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/oauth2"
 	"golang.org/x/time/rate"
 
 	"github.com/bzimmer/gravl"
 	"github.com/bzimmer/gravl/activity"
+	"github.com/bzimmer/gravl/auth"
 )
 
 const (
@@ -37,10 +39,7 @@ func refresh(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	cacheDir := c.String("token-cache")
-	if cacheErr := saveCachedToken(gravl.Runtime(c).Fs, token, cacheDir); cacheErr != nil {
-		log.Warn().Err(cacheErr).Msg("failed to cache refreshed hammerhead token")
-	}
+	activity.SaveToken(c, Provider, token)
 	return gravl.Runtime(c).Encoder.Encode(token)
 }
 
@@ -61,17 +60,36 @@ func activities(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	f, err := activity.Filter[*hammerhead.ActivitySummary](c)
+	if err != nil {
+		return err
+	}
+	g, err := activity.Attributer[*hammerhead.ActivitySummary](c)
+	if err != nil {
+		return err
+	}
 	enc := gravl.Runtime(c).Encoder
 	met := gravl.Runtime(c).Metrics
 	met.IncrCounter([]string{Provider, c.Command.Name}, 1)
 	for i, act := range acts {
+		var ok bool
+		if ok, err = f(ctx, act); err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		var ext any
+		if ext, err = g(ctx, act); err != nil {
+			return err
+		}
 		met.IncrCounter([]string{Provider, metricActivity}, 1)
 		log.Info().
 			Time("date", act.CreatedAt).
 			Str("id", act.ID).
 			Str("name", act.Name).
 			Msg(c.Command.Name)
-		if err = enc.Encode([]any{i, act}); err != nil {
+		if err = enc.Encode([]any{i, ext}); err != nil {
 			return err
 		}
 	}
@@ -80,11 +98,12 @@ func activities(c *cli.Context) error {
 
 func activitiesCommand() *cli.Command {
 	return &cli.Command{
-		Name:        "activities",
-		Aliases:     []string{"A"},
-		Usage:       "Query activities for the authenticated athlete",
-		Description: "Query the Hammerhead API for a list of activities for the authenticated athlete",
-		Flags: []cli.Flag{
+		Name:    "activities",
+		Aliases: []string{"A"},
+		Usage:   "Query activities for the authenticated athlete",
+		Description: "Query the Hammerhead API for a list of activities for the authenticated athlete. " +
+			activity.Environment[*hammerhead.ActivitySummary]("Distance is in meters and Duration in seconds."),
+		Flags: append([]cli.Flag{
 			&cli.IntFlag{
 				Name:    "count",
 				Aliases: []string{"N"},
@@ -95,7 +114,7 @@ func activitiesCommand() *cli.Command {
 				Name:  "start-date",
 				Usage: "Return activities on or after this date (YYYY-MM-DD)",
 			},
-		},
+		}, activity.EvalFlags()...),
 		Action: activities,
 	}
 }
@@ -173,7 +192,8 @@ func fileCommand() *cli.Command {
 		Description: "Download the original FIT file for a specific Hammerhead activity by its ID. " +
 			"With a single ACTIVITY_ID and no --output, streams to stdout. " +
 			"With a single ACTIVITY_ID and --output FILE, writes to FILE. " +
-			"With multiple ACTIVITY_IDs, writes each to its own file; --output sets the destination directory.",
+			"With multiple ACTIVITY_IDs, writes each to its own file; --output sets the destination directory. " +
+			"With --checkpoint FILE, a rerun resumes after the IDs already downloaded and failures do not stop the run.",
 		ArgsUsage: "ACTIVITY_ID (...)",
 		Flags: []cli.Flag{
 			&cli.BoolFlag{
@@ -188,6 +208,7 @@ func fileCommand() *cli.Command {
 				Value:   "",
 				Usage:   "For a single ID: the filename to write; for multiple IDs: the directory to write files into",
 			},
+			activity.CheckpointFlag(),
 		},
 		Action: func(c *cli.Context) error {
 			client := gravl.Runtime(c).Hammerhead
@@ -204,25 +225,18 @@ func fileCommand() *cli.Command {
 					}
 				}
 			}
-			for i := 0; i < args.Len(); i++ {
-				err := func() error {
-					ctx, cancel := context.WithTimeout(c.Context, c.Duration("timeout"))
-					defer cancel()
-					id := args.Get(i)
-					f, err := client.Activities.File(ctx, id)
-					if err != nil {
-						return err
-					}
-					defer f.Close()
-					log.Info().Str("id", id).Str("filename", f.Filename).Msg(c.Command.Name)
-					gravl.Runtime(c).Metrics.IncrCounter([]string{Provider, c.Command.Name}, 1)
-					return writeFile(c, f, dir)
-				}()
+			return activity.Checkpoint(c, Provider, args.Slice(), func(id string) error {
+				ctx, cancel := context.WithTimeout(c.Context, c.Duration("timeout"))
+				defer cancel()
+				f, err := client.Activities.File(ctx, id)
 				if err != nil {
 					return err
 				}
-			}
-			return nil
+				defer f.Close()
+				log.Info().Str("id", id).Str("filename", f.Filename).Msg(c.Command.Name)
+				gravl.Runtime(c).Metrics.IncrCounter([]string{Provider, c.Command.Name}, 1)
+				return writeFile(c, f, dir)
+			})
 		},
 	}
 }
@@ -235,46 +249,58 @@ func oauthCommand() *cli.Command {
 	})
 }
 
-func Before(c *cli.Context) error {
-	before.Do(func() {
-		fs := gravl.Runtime(c).Fs
-		accessToken := c.String("hammerhead-access-token")
-		refreshToken := c.String("hammerhead-refresh-token")
-		expiry := time.Now().Add(-1 * time.Minute)
-		// Hammerhead rotates the refresh token on every use, invalidating the
-		// previous one; a cached token (with its real expiry) is preferred
-		// over the static flag/env value so a rotated token from a prior
-		// invocation isn't discarded.
-		cacheDir := c.String("token-cache")
-		if cached := loadCachedToken(fs, cacheDir); cached != nil {
-			accessToken, refreshToken, expiry = cached.AccessToken, cached.RefreshToken, cached.Expiry
-		}
+func config(c *cli.Context) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     c.String("hammerhead-client-id"),
+		ClientSecret: c.String("hammerhead-client-secret"),
+		Endpoint:     hammerhead.Endpoint(),
+	}
+}
 
-		clientID := c.String("hammerhead-client-id")
-		clientSecret := c.String("hammerhead-client-secret")
-		// force (or confirm) a refresh here - a no-op if the cached access
-		// token is still valid - and cache whatever comes back so a rotated
-		// refresh token survives into the next invocation. Best-effort: if it
-		// fails (e.g. no credentials configured yet), fall through and let
-		// the client below surface the error lazily on first use, as before.
-		if bootstrap, err := hammerhead.NewClient(
-			hammerhead.WithClientCredentials(clientID, clientSecret),
-			hammerhead.WithTokenCredentials(accessToken, refreshToken, expiry)); err == nil {
-			if token, refreshErr := bootstrap.Auth.Refresh(c.Context); refreshErr == nil {
-				accessToken, refreshToken, expiry = token.AccessToken, token.RefreshToken, token.Expiry
-				if cacheErr := saveCachedToken(fs, token, cacheDir); cacheErr != nil {
-					log.Warn().Err(cacheErr).Msg("failed to cache refreshed hammerhead token")
-				}
-			} else {
-				log.Warn().Err(refreshErr).Msg("failed to eagerly refresh hammerhead token")
-			}
-		}
+// tokenCache stores the Hammerhead token in the directory of the `--token-cache` flag if set, the
+// flag predates the token store shared by all providers
+func tokenCache(c *cli.Context) {
+	if c.IsSet("token-cache") {
+		rt := gravl.Runtime(c)
+		rt.TokenStores[Provider] = auth.NewStore(rt.Fs, c.String("token-cache"))
+	}
+}
+
+// token returns the stored token if available, otherwise an expired token from the flags
+//
+// Hammerhead rotates the refresh token on every use, invalidating the previous one, so the
+// flag/env value only seeds the store; the stored token rotated by a prior invocation is
+// preferred until the flag/env value changes.
+func token(c *cli.Context) *oauth2.Token {
+	tokenCache(c)
+	return activity.Token(c, Provider, &oauth2.Token{
+		AccessToken:  c.String("hammerhead-access-token"),
+		RefreshToken: c.String("hammerhead-refresh-token"),
+		Expiry:       time.Now().Add(-1 * time.Minute),
+	}, "hammerhead-access-token", "hammerhead-refresh-token")
+}
 
+// rotate refreshes the token eagerly, a no-op if the access token is still valid, storing
+// whatever comes back so a rotated refresh token survives into the next invocation.
+// Best-effort: if it fails (e.g. no credentials configured yet) the token is returned
+// unchanged and the client surfaces the error lazily on first use.
+func rotate(c *cli.Context, cfg *oauth2.Config, tok *oauth2.Token) *oauth2.Token {
+	fresh, err := activity.Refresh(c, Provider, cfg, tok)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to eagerly refresh hammerhead token")
+		return tok
+	}
+	return fresh
+}
+
+func Before(c *cli.Context) error {
+	before.Do(func() {
+		tok := rotate(c, config(c), token(c))
 		var client *hammerhead.Client
 		client, errBefore = hammerhead.NewClient(
-			hammerhead.WithClientCredentials(clientID, clientSecret),
-			hammerhead.WithTokenCredentials(accessToken, refreshToken, expiry),
-			hammerhead.WithAutoRefresh(c.Context),
+			hammerhead.WithClientCredentials(c.String("hammerhead-client-id"), c.String("hammerhead-client-secret")),
+			hammerhead.WithTokenCredentials(tok.AccessToken, tok.RefreshToken, tok.Expiry),
+			hammerhead.WithHTTPClient(activity.HTTPClient(c, Provider, config(c), tok)),
 			hammerhead.WithHTTPTracing(c.Bool("http-tracing")),
 			hammerhead.WithRateLimiter(rate.NewLimiter(
 				rate.Every(c.Duration("rate-limit")), c.Int("rate-burst"))))
@@ -295,7 +321,7 @@ func Command() *cli.Command {
 		Category:    metricActivity,
 		Usage:       "Query Hammerhead for rides and activities",
 		Description: "Operations supported by the Hammerhead Karoo API",
-		Flags:       append(AuthFlags(), activity.RateLimitFlags()...),
+		Flags:       append(append(AuthFlags(), activity.RateLimitFlags()...), activity.RetryFlags()...),
 		Before:      Before,
 		Subcommands: []*cli.Command{
 			activitiesCommand(),
@@ -303,6 +329,8 @@ func Command() *cli.Command {
 			fileCommand(),
 			oauthCommand(),
 			refreshCommand(),
+			routeCommand(),
+			routesCommand(),
 		},
 	}
 }
@@ -330,8 +358,15 @@ func AuthFlags() []cli.Flag {
 			EnvVars: []string{"HAMMERHEAD_REFRESH_TOKEN"},
 		},
 		&cli.StringFlag{
+			Name:    "hammerhead-api-url",
+			Value:   apiURL,
+			Usage:   "Hammerhead API url",
+			EnvVars: []string{"HAMMERHEAD_API_URL"},
+			Hidden:  true,
+		},
+		&cli.PathFlag{
 			Name:    "token-cache",
-			Usage:   "Directory for the Hammerhead token cache file; defaults to the OS user config directory",
+			Usage:   "Directory of the stored Hammerhead token; defaults to the global --token-cache",
 			EnvVars: []string{"HAMMERHEAD_TOKEN_CACHE"},
 		},
 	}
@@ -93,6 +93,14 @@ func TestActivities(t *testing.T) {
 				"gravl.hammerhead.activity":   2,
 			},
 		},
+		{
+			Name: "activities filtered",
+			Args: []string{"gravl", "hammerhead", "activities", "--filter", ".Duration > 4000", "--attribute", ".Name"},
+			Counters: map[string]int{
+				"gravl.hammerhead.activities": 1,
+				"gravl.hammerhead.activity":   1,
+			},
+		},
 		{
 			Name: "activities with count",
 			Args: []string{"gravl", "hammerhead", "activities", "-N", "1"},
@@ -255,6 +263,32 @@ func TestFileMultiple(t *testing.T) {
 				return nil
 			},
 		},
+		{
+			Name: "multiple ids with checkpoint",
+			Args: []string{"gravl", "hammerhead", "file", "--checkpoint", "/tmp/checkpoint.json",
+				"-O", "/tmp/fits", "act-001", "bad", "act-002"},
+			Before: func(c *cli.Context) error {
+				data := `{"provider":"hammerhead","id":"act-001","completed":"2021-10-01T08:00:00Z"}
+`
+				return afero.WriteFile(gravl.Runtime(c).Fs, "/tmp/checkpoint.json", []byte(data), 0o600)
+			},
+			Counters: map[string]int{
+				"gravl.hammerhead.file":      1,
+				"gravl.checkpoint.skipped":   1,
+				"gravl.checkpoint.completed": 1,
+				"gravl.checkpoint.failed":    1,
+			},
+			After: func(c *cli.Context) error {
+				fs := gravl.Runtime(c).Fs
+				_, err := fs.Stat("/tmp/fits/act-001.fit")
+				a.Error(err)
+				data, err := afero.ReadFile(fs, "/tmp/fits/act-002.fit")
+				a.NoError(err)
+				a.Equal("FIT file content 2", string(data))
+				return nil
+			},
+			Err: "1 of 3 failed, see /tmp/checkpoint.json",
+		},
 	}
 	for _, tt := range tests {
 		tt := tt
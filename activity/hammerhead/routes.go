@@ -0,0 +1,390 @@
+package hammerhead
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/bzimmer/activity"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/activity"
+	"github.com/bzimmer/gravl/activity/rwgps"
+	"github.com/bzimmer/gravl/activity/strava"
+)
+
+const (
+	apiURL      = "https://api.hammerhead.io/v1/api"
+	metricRoute = "route"
+	perPage     = 100
+)
+
+// Route is a route in the authenticated athlete's Hammerhead account
+type Route struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Distance      float64   `json:"distance"`
+	ElevationGain float64   `json:"elevationGain"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// RoutesPage is a single page of routes
+type RoutesPage struct {
+	TotalItems  int      `json:"totalItems"`
+	TotalPages  int      `json:"totalPages"`
+	PerPage     int      `json:"perPage"`
+	CurrentPage int      `json:"currentPage"`
+	Data        []*Route `json:"data"`
+}
+
+// Routes lists, imports, and deletes routes, operations not supported by the Hammerhead client
+type Routes struct {
+	Client  *http.Client
+	BaseURL string
+}
+
+// NewRoutes returns a Routes authenticated with the stored token or the token from the flags,
+// refreshed tokens are stored; requests are rate limited and retried by the provider's transport
+func NewRoutes(c *cli.Context) *Routes {
+	return &Routes{
+		Client:  activity.HTTPClient(c, Provider, config(c), token(c)),
+		BaseURL: c.String("hammerhead-api-url"),
+	}
+}
+
+func (r *Routes) do(req *http.Request, v any) error {
+	res, err := r.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= http.StatusBadRequest {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%s %s: %s %s", req.Method, req.URL.Path, res.Status, strings.TrimSpace(string(msg)))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// Routes returns up to `total` routes, all routes if zero
+func (r *Routes) Routes(ctx context.Context, total int) ([]*Route, error) {
+	var routes []*Route
+	for page := 1; ; page++ {
+		q := url.Values{"page": {strconv.Itoa(page)}, "perPage": {strconv.Itoa(perPage)}}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.BaseURL+"/routes?"+q.Encode(), http.NoBody)
+		if err != nil {
+			return nil, err
+		}
+		var res RoutesPage
+		if err = r.do(req, &res); err != nil {
+			return nil, err
+		}
+		for _, route := range res.Data {
+			if total > 0 && len(routes) == total {
+				return routes, nil
+			}
+			routes = append(routes, route)
+		}
+		// the total pages reported are not reliable, a short page is the last page
+		size := res.PerPage
+		if size == 0 {
+			size = perPage
+		}
+		if len(res.Data) < size {
+			return routes, nil
+		}
+	}
+}
+
+// ImportRoute imports the route file (GPX, TCX, or FIT)
+func (r *Routes) ImportRoute(ctx context.Context, file *api.File) (*Route, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	name := file.Filename
+	if name == "" {
+		name = file.Name + "." + file.Format.String()
+	}
+	fw, err := mw.CreateFormFile("file", filepath.Base(name))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(fw, file); err != nil {
+		return nil, err
+	}
+	if err = mw.Close(); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.BaseURL+"/routes/import", &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	var route Route
+	if err = r.do(req, &route); err != nil {
+		return nil, err
+	}
+	return &route, nil
+}
+
+// DeleteRoute deletes the route
+func (r *Routes) DeleteRoute(ctx context.Context, routeID string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, r.BaseURL+"/routes/"+url.PathEscape(routeID), http.NoBody)
+	if err != nil {
+		return err
+	}
+	return r.do(req, nil)
+}
+
+type importer struct {
+	routes *Routes
+}
+
+// NewRouteImporter returns a RouteImporter for the authenticated athlete's account
+func NewRouteImporter(c *cli.Context) gravl.RouteImporter {
+	return &importer{routes: NewRoutes(c)}
+}
+
+func (i *importer) ImportRoute(ctx context.Context, file *api.File) (*gravl.RouteRef, error) {
+	route, err := i.routes.ImportRoute(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	return &gravl.RouteRef{ID: route.ID, Name: route.Name}, nil
+}
+
+func routes(c *cli.Context) error {
+	ctx, cancel := context.WithTimeout(c.Context, c.Duration("timeout"))
+	defer cancel()
+	rts, err := NewRoutes(c).Routes(ctx, c.Int("count"))
+	if err != nil {
+		return err
+	}
+	f, err := activity.Filter[*Route](c)
+	if err != nil {
+		return err
+	}
+	g, err := activity.Attributer[*Route](c)
+	if err != nil {
+		return err
+	}
+	enc := gravl.Runtime(c).Encoder
+	met := gravl.Runtime(c).Metrics
+	met.IncrCounter([]string{Provider, "routes"}, 1)
+	for i, route := range rts {
+		var ok bool
+		if ok, err = f(ctx, route); err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		var ext any
+		if ext, err = g(ctx, route); err != nil {
+			return err
+		}
+		met.IncrCounter([]string{Provider, metricRoute}, 1)
+		log.Info().
+			Time("date", route.CreatedAt).
+			Str("id", route.ID).
+			Str("name", route.Name).
+			Msg(c.Command.Name)
+		if err = enc.Encode([]any{i, ext}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// open returns the local route file
+func open(c *cli.Context, path string) (*api.File, error) {
+	fp, err := gravl.Runtime(c).Fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	base := filepath.Base(path)
+	return &api.File{
+		Name:     strings.TrimSuffix(base, filepath.Ext(base)),
+		Filename: base,
+		Format:   api.ToFormat(filepath.Ext(base)),
+		Reader:   fp,
+	}, nil
+}
+
+// push imports the file and encodes the imported route
+func push(c *cli.Context, routes *Routes, file *api.File) error {
+	ctx, cancel := context.WithTimeout(c.Context, c.Duration("timeout"))
+	defer cancel()
+	route, err := routes.ImportRoute(ctx, file)
+	if err != nil {
+		return err
+	}
+	gravl.Runtime(c).Metrics.IncrCounter([]string{Provider, metricRoute, c.Command.Name}, 1)
+	log.Info().Str("id", route.ID).Str("name", route.Name).Str("file", file.Filename).Msg(c.Command.Name)
+	return gravl.Runtime(c).Encoder.Encode(route)
+}
+
+func importRoutes(c *cli.Context) error {
+	routes := NewRoutes(c)
+	args := c.Args()
+	for i := 0; i < args.Len(); i++ {
+		file, err := open(c, args.Get(i))
+		if err != nil {
+			return err
+		}
+		err = push(c, routes, file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteRoutes(c *cli.Context) error {
+	routes := NewRoutes(c)
+	args := c.Args()
+	for i := 0; i < args.Len(); i++ {
+		err := func() error {
+			ctx, cancel := context.WithTimeout(c.Context, c.Duration("timeout"))
+			defer cancel()
+			id := args.Get(i)
+			if err := routes.DeleteRoute(ctx, id); err != nil {
+				return err
+			}
+			gravl.Runtime(c).Metrics.IncrCounter([]string{Provider, metricRoute, c.Command.Name}, 1)
+			log.Info().Str("id", id).Msg(c.Command.Name)
+			return nil
+		}()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// source returns the route file from the argument or the provider named by the flag
+func source(c *cli.Context) (*api.File, error) {
+	var from []string
+	for _, name := range []string{strava.Provider, rwgps.Provider} {
+		if c.IsSet("from-" + name + "-route") {
+			from = append(from, name)
+		}
+	}
+	switch {
+	case len(from) == 0 && c.NArg() == 1:
+		return open(c, c.Args().First())
+	case len(from) == 1 && c.NArg() == 0:
+	default:
+		return nil, errors.New("expected one of FILE, --from-strava-route, or --from-rwgps-route")
+	}
+	f, ok := gravl.Runtime(c).RouteExporters[from[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown route exporter '%s'", from[0])
+	}
+	exp, err := f(c)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(c.Context, c.Duration("timeout"))
+	defer cancel()
+	id := c.Int64("from-" + from[0] + "-route")
+	file, err := exp.ExportRoute(ctx, id, api.FormatGPX)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Str("from", from[0]).Int64("id", id).Str("file", file.Filename).Msg("export")
+	return file, nil
+}
+
+func pushRoute(c *cli.Context) error {
+	file, err := source(c)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return push(c, NewRoutes(c), file)
+}
+
+func routesCommand() *cli.Command {
+	return &cli.Command{
+		Name:        "routes",
+		Aliases:     []string{"R"},
+		Usage:       "Manage routes for the authenticated athlete",
+		Description: "List, import, and delete routes in the authenticated athlete's Hammerhead account",
+		Subcommands: []*cli.Command{
+			{
+				Name:    "list",
+				Aliases: []string{"ls"},
+				Usage:   "Query routes for the authenticated athlete",
+				Description: "Query the Hammerhead API for a list of routes for the authenticated athlete. " +
+					activity.Environment[*Route]("Distance and ElevationGain are in meters."),
+				Flags: append([]cli.Flag{
+					&cli.IntFlag{
+						Name:    "count",
+						Aliases: []string{"N"},
+						Value:   0,
+						Usage:   "The number of routes to query from Hammerhead",
+					},
+				}, activity.EvalFlags()...),
+				Action: routes,
+			},
+			{
+				Name:        "import",
+				Usage:       "Import route files",
+				Description: "Import one or more GPX, TCX, or FIT route files to the authenticated athlete's account",
+				ArgsUsage:   "FILE (...)",
+				Action:      importRoutes,
+			},
+			{
+				Name:        "delete",
+				Usage:       "Delete routes",
+				Description: "Delete one or more routes by their ID",
+				ArgsUsage:   "ROUTE_ID (...)",
+				Action:      deleteRoutes,
+			},
+		},
+	}
+}
+
+func routeCommand() *cli.Command {
+	return &cli.Command{
+		Name:        metricRoute,
+		Aliases:     []string{"r"},
+		Usage:       "Send a route to the Karoo",
+		Description: "Operations on a single route",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "push",
+				Usage: "Push a route to the authenticated athlete's account",
+				Description: "Push a local route file, or a route exported as GPX from Strava or RideWithGPS, " +
+					"to the authenticated athlete's account so it syncs to the Karoo",
+				ArgsUsage: "FILE | --from-strava-route ROUTE_ID | --from-rwgps-route ROUTE_ID",
+				Flags: append(append([]cli.Flag{
+					&cli.Int64Flag{
+						Name:  "from-strava-route",
+						Usage: "Push the Strava route with the ID",
+					},
+					&cli.Int64Flag{
+						Name:  "from-rwgps-route",
+						Usage: "Push the RideWithGPS route with the ID",
+					},
+				}, strava.AuthFlags()...), rwgps.AuthFlags()...),
+				Action: pushRoute,
+			},
+		},
+	}
+}
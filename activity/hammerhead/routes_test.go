@@ -0,0 +1,261 @@
+package hammerhead_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/bzimmer/activity"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/oauth2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/activity/hammerhead"
+	"github.com/bzimmer/gravl/internal"
+)
+
+type routeExporter struct {
+	provider string
+}
+
+func (r *routeExporter) ExportRoute(_ context.Context, routeID int64, format api.Format) (*api.File, error) {
+	if routeID == 0 {
+		return nil, errors.New("route not found")
+	}
+	name := fmt.Sprintf("%s-%d", r.provider, routeID)
+	return &api.File{
+		Name:     name,
+		Filename: name + "." + format.String(),
+		Format:   format,
+		Reader:   strings.NewReader("<gpx></gpx>"),
+	}, nil
+}
+
+func routesCommand(t *testing.T, baseURL string) *cli.Command {
+	t.Helper()
+	c := hammerhead.Command()
+	c.Before = func(c *cli.Context) error {
+		for _, provider := range []string{"strava", "rwgps"} {
+			gravl.Runtime(c).RouteExporters[provider] = func(_ *cli.Context) (gravl.RouteExporter, error) {
+				return &routeExporter{provider: provider}, nil
+			}
+		}
+		err := gravl.Runtime(c).Tokens.Save(hammerhead.Provider, &oauth2.Token{
+			AccessToken:  "testtoken",
+			RefreshToken: "testrefresh",
+			Expiry:       time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			return err
+		}
+		return c.Set("hammerhead-api-url", baseURL)
+	}
+	return c
+}
+
+func routesMux(t *testing.T) *http.ServeMux {
+	a := assert.New(t)
+	authorized := func(f http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer testtoken" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			f(w, r)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /routes", authorized(func(w http.ResponseWriter, r *http.Request) {
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		a.NoError(err)
+		res := &hammerhead.RoutesPage{TotalItems: 3, TotalPages: 2, PerPage: 2, CurrentPage: page}
+		switch page {
+		case 1:
+			res.Data = []*hammerhead.Route{
+				{ID: "rt-001", Name: "Coffee Loop", Distance: 42000},
+				{ID: "rt-002", Name: "Hilly Gravel", Distance: 87000, ElevationGain: 1500},
+			}
+		case 2:
+			res.Data = []*hammerhead.Route{{ID: "rt-003", Name: "Commute", Distance: 12000}}
+		}
+		a.NoError(json.NewEncoder(w).Encode(res))
+	}))
+	mux.HandleFunc("POST /routes/import", authorized(func(w http.ResponseWriter, r *http.Request) {
+		fp, hdr, err := r.FormFile("file")
+		a.NoError(err)
+		defer fp.Close()
+		data, err := io.ReadAll(fp)
+		a.NoError(err)
+		a.Equal("<gpx></gpx>", string(data))
+		a.NoError(json.NewEncoder(w).Encode(&hammerhead.Route{ID: "rt-new", Name: hdr.Filename}))
+	}))
+	mux.HandleFunc("DELETE /routes/rt-001", authorized(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return mux
+}
+
+func TestRoutes(t *testing.T) {
+	tests := []*internal.Harness{
+		{
+			Name: "list",
+			Args: []string{"gravl", "hammerhead", "routes", "list"},
+			Counters: map[string]int{
+				"gravl.hammerhead.routes": 1,
+				"gravl.hammerhead.route":  3,
+			},
+		},
+		{
+			Name: "list with count",
+			Args: []string{"gravl", "hammerhead", "routes", "list", "-N", "2"},
+			Counters: map[string]int{
+				"gravl.hammerhead.route": 2,
+			},
+		},
+		{
+			Name: "list filtered",
+			Args: []string{"gravl", "hammerhead", "routes", "list", "--filter", ".ElevationGain > 1000", "--attribute", ".Name"},
+			Counters: map[string]int{
+				"gravl.hammerhead.route": 1,
+			},
+		},
+		{
+			Name: "import",
+			Args: []string{"gravl", "hammerhead", "routes", "import", "/routes/loop.gpx", "/routes/hills.gpx"},
+			Before: func(c *cli.Context) error {
+				fs := gravl.Runtime(c).Fs
+				for _, name := range []string{"loop", "hills"} {
+					if err := afero.WriteFile(fs, "/routes/"+name+".gpx", []byte("<gpx></gpx>"), 0o644); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Counters: map[string]int{
+				"gravl.hammerhead.route.import": 2,
+			},
+		},
+		{
+			Name: "import missing file",
+			Args: []string{"gravl", "hammerhead", "routes", "import", "/routes/missing.gpx"},
+			Err:  "file does not exist",
+		},
+		{
+			Name: "delete",
+			Args: []string{"gravl", "hammerhead", "routes", "delete", "rt-001"},
+			Counters: map[string]int{
+				"gravl.hammerhead.route.delete": 1,
+			},
+		},
+		{
+			Name: "delete unknown route",
+			Args: []string{"gravl", "hammerhead", "routes", "delete", "rt-999"},
+			Err:  "404 Not Found",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			internal.Run(t, tt, routesMux(t), routesCommand)
+		})
+	}
+}
+
+func TestRoutesPages(t *testing.T) {
+	a := assert.New(t)
+	var pages int
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /routes", func(w http.ResponseWriter, r *http.Request) {
+		pages++
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		a.NoError(err)
+		// the total pages are not reported
+		res := &hammerhead.RoutesPage{PerPage: 2, CurrentPage: page}
+		switch page {
+		case 1, 2:
+			res.Data = []*hammerhead.Route{
+				{ID: fmt.Sprintf("rt-%d-1", page)},
+				{ID: fmt.Sprintf("rt-%d-2", page)},
+			}
+		case 3:
+			res.Data = []*hammerhead.Route{{ID: "rt-3-1"}}
+		}
+		a.NoError(json.NewEncoder(w).Encode(res))
+	})
+	svr := httptest.NewServer(mux)
+	defer svr.Close()
+
+	routes := &hammerhead.Routes{Client: svr.Client(), BaseURL: svr.URL}
+	res, err := routes.Routes(t.Context(), 0)
+	a.NoError(err)
+	a.Len(res, 5)
+	a.Equal(3, pages)
+}
+
+func TestRoutePush(t *testing.T) {
+	a := assert.New(t)
+	tests := []*internal.Harness{
+		{
+			Name: "push file",
+			Args: []string{"gravl", "hammerhead", "route", "push", "/routes/loop.gpx"},
+			Before: func(c *cli.Context) error {
+				return afero.WriteFile(gravl.Runtime(c).Fs, "/routes/loop.gpx", []byte("<gpx></gpx>"), 0o644)
+			},
+			Counters: map[string]int{
+				"gravl.hammerhead.route.push": 1,
+			},
+		},
+		{
+			Name: "push strava route",
+			Args: []string{"gravl", "hammerhead", "route", "push", "--from-strava-route", "2987654"},
+			Counters: map[string]int{
+				"gravl.hammerhead.route.push": 1,
+			},
+			After: func(c *cli.Context) error {
+				// the stored token is used
+				token, err := gravl.Runtime(c).Tokens.Token(hammerhead.Provider)
+				a.NoError(err)
+				a.Equal("testrefresh", token.RefreshToken)
+				return nil
+			},
+		},
+		{
+			Name: "push rwgps route",
+			Args: []string{"gravl", "hammerhead", "route", "push", "--from-rwgps-route", "3344556"},
+			Counters: map[string]int{
+				"gravl.hammerhead.route.push": 1,
+			},
+		},
+		{
+			Name: "push unknown route",
+			Args: []string{"gravl", "hammerhead", "route", "push", "--from-rwgps-route", "0"},
+			Err:  "route not found",
+		},
+		{
+			Name: "push too many sources",
+			Args: []string{"gravl", "hammerhead", "route", "push", "--from-rwgps-route", "3344556", "/routes/loop.gpx"},
+			Err:  "expected one of FILE, --from-strava-route, or --from-rwgps-route",
+		},
+		{
+			Name: "push nothing",
+			Args: []string{"gravl", "hammerhead", "route", "push"},
+			Err:  "expected one of FILE, --from-strava-route, or --from-rwgps-route",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			internal.Run(t, tt, routesMux(t), routesCommand)
+		})
+	}
+}
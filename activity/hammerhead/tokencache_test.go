@@ -1,85 +1,129 @@
 package hammerhead //nolint:testpackage // exercises unexported token-cache internals
 
 import (
+	"encoding/json"
+	"net/http"
 	"testing"
+	"time"
 
-	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
 	"golang.org/x/oauth2"
-)
-
-func TestLoadCachedTokenMissing(t *testing.T) {
-	t.Parallel()
-	a := assert.New(t)
-	fs := afero.NewMemMapFs()
-	a.Nil(loadCachedToken(fs, ""))
-}
-
-func TestLoadCachedTokenInvalidJSON(t *testing.T) {
-	t.Parallel()
-	a := assert.New(t)
-	fs := afero.NewMemMapFs()
-	path, err := tokenCachePath("")
-	a.NoError(err)
-	a.NoError(fs.MkdirAll("/x", 0o700))
-	a.NoError(afero.WriteFile(fs, path, []byte("not json"), 0o600))
-	a.Nil(loadCachedToken(fs, ""))
-}
-
-func TestLoadCachedTokenMissingRefreshToken(t *testing.T) {
-	t.Parallel()
-	a := assert.New(t)
-	fs := afero.NewMemMapFs()
-	path, err := tokenCachePath("")
-	a.NoError(err)
-	a.NoError(afero.WriteFile(fs, path, []byte(`{"access_token":"foo"}`), 0o600))
-	a.Nil(loadCachedToken(fs, ""))
-}
-
-func TestSaveAndLoadCachedTokenRoundTrip(t *testing.T) {
-	t.Parallel()
-	a := assert.New(t)
-	fs := afero.NewMemMapFs()
-
-	token := &oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}
-	a.NoError(saveCachedToken(fs, token, ""))
-
-	loaded := loadCachedToken(fs, "")
-	a.NotNil(loaded)
-	a.Equal("access", loaded.AccessToken)
-	a.Equal("refresh", loaded.RefreshToken)
-}
 
-func TestSaveCachedTokenReadOnly(t *testing.T) {
-	t.Parallel()
-	a := assert.New(t)
-	fs := afero.NewReadOnlyFs(afero.NewMemMapFs())
-	token := &oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}
-	a.Error(saveCachedToken(fs, token, ""))
-}
-
-func TestTokenCachePathOverride(t *testing.T) {
-	t.Parallel()
-	a := assert.New(t)
-	path, err := tokenCachePath("/custom/cache")
-	a.NoError(err)
-	a.Equal("/custom/cache/hammerhead-token.json", path)
-}
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/activity"
+	"github.com/bzimmer/gravl/auth"
+	"github.com/bzimmer/gravl/internal"
+)
 
-func TestSaveAndLoadCachedTokenCustomDir(t *testing.T) {
-	t.Parallel()
+func TestTokenCache(t *testing.T) {
 	a := assert.New(t)
-	fs := afero.NewMemMapFs()
-	dir := "/custom/cache"
-
-	token := &oauth2.Token{AccessToken: "custom-access", RefreshToken: "custom-refresh"}
-	a.NoError(saveCachedToken(fs, token, dir))
 
-	loaded := loadCachedToken(fs, dir)
-	a.NotNil(loaded)
-	a.Equal("custom-access", loaded.AccessToken)
-	a.Equal("custom-refresh", loaded.RefreshToken)
+	// Hammerhead rotates the refresh token on every use
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		a.NoError(r.ParseForm())
+		if r.Form.Get("refresh_token") != "stored-refresh" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		a.NoError(json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "rotated-access",
+			"refresh_token": "rotated-refresh",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		}))
+	})
 
-	// default path should be empty
-	a.Nil(loadCachedToken(fs, ""))
+	const dir = "/custom/cache"
+	expired := &oauth2.Token{
+		AccessToken:  "stored-access",
+		RefreshToken: "stored-refresh",
+		Expiry:       time.Now().Add(-time.Minute),
+	}
+	cached := func(c *cli.Context) error {
+		return auth.NewStore(gravl.Runtime(c).Fs, dir).Save(Provider, expired)
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		before  cli.BeforeFunc
+		refresh string
+		stored  string
+		next    string
+	}{
+		{
+			name:    "missing",
+			refresh: "",
+		},
+		{
+			name:    "default directory",
+			before:  func(c *cli.Context) error { return gravl.Runtime(c).Tokens.Save(Provider, expired) },
+			refresh: "rotated-refresh",
+			stored:  "rotated-refresh",
+			next:    "rotated-refresh",
+		},
+		{
+			name:    "custom directory",
+			args:    []string{"--token-cache", dir},
+			before:  cached,
+			refresh: "rotated-refresh",
+			stored:  "rotated-refresh",
+			next:    "rotated-refresh",
+		},
+		{
+			name:    "custom directory not set",
+			before:  cached,
+			refresh: "",
+		},
+		{
+			name:    "flags seed the store",
+			args:    []string{"--token-cache", dir, "--hammerhead-refresh-token", "stored-refresh"},
+			refresh: "rotated-refresh",
+			stored:  "rotated-refresh",
+			next:    "rotated-refresh",
+		},
+		{
+			name:    "flags changed",
+			args:    []string{"--token-cache", dir, "--hammerhead-refresh-token", "flag-refresh"},
+			before:  cached,
+			refresh: "flag-refresh",
+			stored:  "flag-refresh",
+			next:    "flag-refresh",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &internal.Harness{
+				Name:   tt.name,
+				Args:   append([]string{"gravl", tt.name}, tt.args...),
+				Before: tt.before,
+			}
+			internal.Run(t, h, mux, func(_ *testing.T, url string) *cli.Command {
+				return &cli.Command{
+					Name:  tt.name,
+					Flags: append(AuthFlags(), activity.RetryFlags()...),
+					Action: func(c *cli.Context) error {
+						cfg := &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: url + "/token"}}
+						tok := rotate(c, cfg, token(c))
+						a.Equal(tt.refresh, tok.RefreshToken)
+						stored, err := activity.Tokens(c, Provider).Token(Provider)
+						a.NoError(err)
+						switch tt.stored {
+						case "":
+							a.Nil(stored)
+						default:
+							a.Equal(tt.stored, stored.RefreshToken)
+						}
+						// the token of the next invocation
+						a.Equal(tt.next, token(c).RefreshToken)
+						// the other providers use the shared store
+						a.Same(gravl.Runtime(c).Tokens, activity.Tokens(c, "strava"))
+						return nil
+					},
+				}
+			})
+		})
+	}
 }
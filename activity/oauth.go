@@ -1,18 +1,13 @@
 package activity
 
 import (
-	"context"
-	"errors"
 	"fmt"
-	"net"
 	"net/http"
 	"net/url"
-	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v2"
 	"golang.org/x/oauth2"
-	"golang.org/x/sync/errgroup"
 
 	"github.com/bzimmer/gravl"
 	"github.com/bzimmer/gravl/web"
@@ -60,65 +55,12 @@ func newHandler(c *cli.Context, cfg *OAuthConfig) (http.Handler, error) {
 	return mux, nil
 }
 
-func newListener(cfg *OAuthConfig) (net.Listener, error) {
-	var lc net.ListenConfig
-	listener, err := lc.Listen(context.Background(), "tcp4", fmt.Sprintf("127.0.0.1:%d", cfg.Port))
-	if err != nil {
-		return nil, err
-	}
-	return listener, nil
-}
-
 func oauth(c *cli.Context, cfg *OAuthConfig) error {
 	mux, err := newHandler(c, cfg)
 	if err != nil {
 		return err
 	}
-	listener, err := newListener(cfg)
-	if err != nil {
-		return err
-	}
-	svr := &http.Server{
-		Handler:           mux,
-		ReadTimeout:       5 * time.Second,
-		WriteTimeout:      10 * time.Second,
-		ReadHeaderTimeout: 5 * time.Second,
-	}
-	grp, ctx := errgroup.WithContext(c.Context)
-	grp.Go(func() error {
-		if svrErr := svr.Serve(listener); !errors.Is(svrErr, http.ErrServerClosed) {
-			log.Info().Err(svrErr).Msg("closed")
-			return svrErr
-		}
-		return nil
-	})
-	grp.Go(func() error {
-		<-ctx.Done()
-		return svr.Close()
-	})
-	grp.Go(func() error {
-		if cfg.Started == nil {
-			return nil
-		}
-		u, parseErr := url.Parse("http://" + listener.Addr().String())
-		if parseErr != nil {
-			return parseErr
-		}
-		log.Info().Str("address", u.String()).Msg("serving")
-		select {
-		case <-c.Done():
-			return c.Err()
-		case cfg.Started <- u:
-			return nil
-		}
-	})
-	if err = grp.Wait(); err != nil {
-		if errors.Is(err, context.Canceled) {
-			return nil
-		}
-		return err
-	}
-	return nil
+	return Serve(c, mux, Localhost, cfg.Port, cfg.Started)
 }
 
 func OAuthCommand(cfg *OAuthConfig) *cli.Command {
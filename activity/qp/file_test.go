@@ -46,7 +46,7 @@ func TestWrite(t *testing.T) {
 			After: func(c *cli.Context) error {
 				bs, ok := c.App.Writer.(*bytes.Buffer)
 				a.True(ok)
-				a.Equal(bs.String(), "")
+				a.JSONEq(`{"name":"Foo","filename":"Foo.gpx","format":"gpx","id":776765443}`, bs.String())
 				stat, err := gravl.Runtime(c).Fs.Stat("/tmp/Foo.gpx")
 				a.NoError(err)
 				a.NotNil(stat)
@@ -0,0 +1,391 @@
+package qp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	api "github.com/bzimmer/activity"
+	"github.com/hashicorp/go-metrics"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/activity"
+)
+
+const metricFollow = "follow"
+
+// highwater records the start time of the latest activity followed from each source and the
+// activities the mark advanced past without delivering them to every destination
+type highwater struct {
+	fs     afero.Fs
+	path   string
+	After  map[string]time.Time `json:"after"`
+	Failed map[string][]int64   `json:"failed,omitempty"`
+}
+
+func loadHighwater(fs afero.Fs, path string) (*highwater, error) {
+	path, err := userConfigPath(path, "follow.json")
+	if err != nil {
+		return nil, err
+	}
+	h := &highwater{fs: fs, path: path, After: make(map[string]time.Time), Failed: make(map[string][]int64)}
+	data, err := afero.ReadFile(fs, path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return h, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(data, h); err != nil {
+		return nil, fmt.Errorf("invalid state %s: %w", path, err)
+	}
+	if h.After == nil {
+		h.After = make(map[string]time.Time)
+	}
+	if h.Failed == nil {
+		h.Failed = make(map[string][]int64)
+	}
+	return h, nil
+}
+
+// advance the mark for the source and persist the state if the time is later than the current mark
+func (h *highwater) advance(source string, t time.Time) error {
+	if mark, ok := h.After[source]; ok && !t.After(mark) {
+		return nil
+	}
+	h.After[source] = t.UTC()
+	return h.save()
+}
+
+// settle advances the mark past the activity, recording it as failed if it was not delivered to every
+// destination so a single failing activity does not prevent following newer activities; a failed
+// activity is delivered again at the start of the next pass
+func (h *highwater) settle(source string, ref *gravl.ActivityRef, failed bool) error {
+	ids := slices.DeleteFunc(h.Failed[source], func(id int64) bool { return id == ref.ID })
+	if failed {
+		ids = append(ids, ref.ID)
+	}
+	switch len(ids) {
+	case 0:
+		delete(h.Failed, source)
+	default:
+		h.Failed[source] = ids
+	}
+	if mark, ok := h.After[source]; !ok || ref.Start.After(mark) {
+		h.After[source] = ref.Start.UTC()
+	}
+	return h.save()
+}
+
+func (h *highwater) save() error {
+	if err := h.fs.MkdirAll(filepath.Dir(h.path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := h.path + ".tmp"
+	if err = afero.WriteFile(h.fs, tmp, data, 0o600); err != nil {
+		return err
+	}
+	return h.fs.Rename(tmp, h.path)
+}
+
+// retry calls fn until it succeeds or the retries are exhausted, doubling the wait after each failure
+func retry(ctx context.Context, met *metrics.Metrics, retries int, backoff time.Duration, fn func() error) error {
+	var err error
+	for i := 0; ; i++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if i >= retries {
+			return err
+		}
+		met.IncrCounter([]string{metricFollow, "retry"}, 1)
+		log.Warn().Err(err).Int("attempt", i+1).Dur("backoff", backoff).Msg(metricFollow)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+type follower struct {
+	from     string
+	lister   gravl.Lister
+	exporter api.Exporter
+	xfers    []*xfer
+	state    *highwater
+	retries  int
+	backoff  time.Duration
+	timeout  time.Duration
+	metrics  *metrics.Metrics
+}
+
+func newFollower(c *cli.Context) (*follower, error) {
+	from := c.String("from")
+	lst, err := lister(c, from)
+	if err != nil {
+		return nil, err
+	}
+	expr, err := exporter(c, from)
+	if err != nil {
+		return nil, err
+	}
+	f := &follower{
+		from:     from,
+		lister:   lst,
+		exporter: expr,
+		retries:  c.Int("pass-retries"),
+		backoff:  c.Duration("backoff"),
+		timeout:  c.Duration("timeout"),
+		metrics:  gravl.Runtime(c).Metrics,
+	}
+	for _, to := range c.StringSlice("to") {
+		var upd api.Uploader
+		upd, err = uploader(c, to)
+		if err != nil {
+			return nil, err
+		}
+		if len(f.xfers) == 0 {
+			var x *xfer
+			if x, err = newXfer(c, to, upd); err != nil {
+				return nil, err
+			}
+			x.polling(c.Duration("poll-interval"), c.Int("poll-iterations"))
+			f.xfers = append(f.xfers, x)
+			continue
+		}
+		f.xfers = append(f.xfers, f.xfers[0].fork(to, upd))
+	}
+	if f.state, err = loadHighwater(gravl.Runtime(c).Fs, c.String("state")); err != nil {
+		return nil, err
+	}
+	// an explicit starting point takes precedence over the stored mark; with neither
+	// only activities started from now on are followed
+	_, after, err := activity.DateRange(c, activity.NaturalParse, activity.AraddonParse)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c.IsSet("after"):
+		f.state.After[from] = after.UTC()
+	case f.state.After[from].IsZero():
+		if err = f.state.advance(from, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// pass delivers the activities which failed in a previous pass, by id, then lists the activities
+// started after the mark and delivers them, oldest first, advancing the mark after each activity;
+// activities not delivered to every destination are recorded as failed
+func (f *follower) pass(ctx context.Context) error {
+	var listed []*gravl.ActivityRef
+	err := retry(ctx, f.metrics, f.retries, f.backoff, func() error {
+		tctx, cancel := context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+		var err error
+		listed, err = f.lister.List(tctx, 0, time.Time{}, f.state.After[f.from])
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	f.metrics.IncrCounter([]string{metricFollow, "list"}, 1)
+	sort.SliceStable(listed, func(i, j int) bool { return listed[i].Start.Before(listed[j].Start) })
+	failed := f.state.Failed[f.from]
+	refs := make([]*gravl.ActivityRef, 0, len(failed)+len(listed))
+	for _, id := range failed {
+		f.metrics.IncrCounter([]string{metricFollow, "retried"}, 1)
+		refs = append(refs, &gravl.ActivityRef{ID: id})
+	}
+	for _, ref := range listed {
+		if !slices.Contains(failed, ref.ID) {
+			refs = append(refs, ref)
+		}
+	}
+	var errs []error
+	for _, ref := range refs {
+		err = f.follow(ctx, ref)
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			f.metrics.IncrCounter([]string{metricFollow, "failed"}, 1)
+			errs = append(errs, err)
+		}
+		if err = f.state.settle(f.from, ref, err != nil); err != nil {
+			return err
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// follow exports the activity once and delivers it to each destination it was not previously delivered to
+func (f *follower) follow(ctx context.Context, ref *gravl.ActivityRef) error {
+	sourceID := strconv.FormatInt(ref.ID, 10)
+	var pending []*xfer
+	for _, x := range f.xfers {
+		ok, err := x.delivered(ctx, f.from, sourceID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			pending = append(pending, x)
+		}
+	}
+	if len(pending) == 0 {
+		f.metrics.IncrCounter([]string{metricFollow, "skipped"}, 1)
+		return nil
+	}
+	log.Info().Int64("id", ref.ID).Str("name", ref.Name).Time("start", ref.Start).Msg(metricFollow)
+	var exp *api.Export
+	var data []byte
+	err := retry(ctx, f.metrics, f.retries, f.backoff, func() error {
+		tctx, cancel := context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+		var err error
+		exp, err = f.exporter.Export(tctx, ref.ID)
+		if err != nil {
+			return err
+		}
+		if exp == nil || exp.File == nil || exp.Reader == nil {
+			return fmt.Errorf("empty export for activity %d", ref.ID)
+		}
+		defer exp.Close()
+		data, err = io.ReadAll(exp)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	f.metrics.IncrCounter([]string{metricFollow, "export", metricSuccess}, 1)
+	// an upload is not idempotent so it is not retried, a failed delivery is retried only if
+	// the activity is followed again
+	var errs []error
+	for _, x := range pending {
+		tctx, cancel := context.WithTimeout(ctx, f.timeout)
+		err = x.deliver(tctx, f.from, sourceID, &api.File{
+			Name:     exp.Name,
+			Filename: exp.Filename,
+			Format:   exp.Format,
+			Reader:   bytes.NewReader(data),
+		}, true)
+		cancel()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s activity %d to %s: %w", f.from, ref.ID, x.to, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func follow(c *cli.Context) error {
+	f, err := newFollower(c)
+	if err != nil {
+		return err
+	}
+	n, interval := c.Int("iterations"), c.Duration("interval")
+	for i := 1; ; i++ {
+		err = f.pass(c.Context)
+		if c.Context.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			f.metrics.IncrCounter([]string{metricFollow, "error"}, 1)
+			log.Error().Err(err).Time("after", f.state.After[f.from]).Msg(metricFollow)
+		}
+		if n > 0 && i >= n {
+			return err
+		}
+		select {
+		case <-c.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+func followFlags() []cli.Flag {
+	x := flags(cfg{from: true, ledger: true, force: true, transform: true})
+	x = append(x,
+		&cli.StringSliceFlag{
+			Name:     "to",
+			Usage:    "Sink data providers, comma separated or repeated",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "after",
+			Usage: "Follow activities started after the time specified rather than the stored mark",
+		},
+		&cli.StringFlag{
+			Name:  "state",
+			Usage: "File recording the start time of the latest activity followed; defaults to the OS user config directory",
+		},
+		&cli.DurationFlag{
+			Name:  "interval",
+			Value: time.Minute * 5,
+			Usage: "The amount of time to wait between checking the source for new activities",
+		},
+		&cli.IntFlag{
+			Name:    "iterations",
+			Aliases: []string{"N"},
+			Value:   0,
+			Usage:   "The number of times to check the source for new activities (forever if zero)",
+		},
+		&cli.DurationFlag{
+			Name:  "poll-interval",
+			Value: time.Second * 2,
+			Usage: "The amount of time to wait between polling for the status of an upload",
+		},
+		&cli.IntFlag{
+			Name:  "poll-iterations",
+			Value: 5,
+			Usage: "The max number of polling iterations performed for each upload",
+		},
+		// `--retries` applies to each request, a list or export failing once those are exhausted is
+		// retried up to `--pass-retries` times
+		&cli.IntFlag{
+			Name:  "pass-retries",
+			Value: 1,
+			Usage: "Maximum number of times a list or export failing after the retries of each request is retried",
+		},
+		&cli.DurationFlag{
+			Name:  "backoff",
+			Value: time.Second * 5,
+			Usage: "The amount of time to wait before the first retry of a failed list or export, doubled for each retry",
+		})
+	return x
+}
+
+func followCommand() *cli.Command {
+	return &cli.Command{
+		Name:  metricFollow,
+		Usage: "Continually copy new activities from a source to one or more destinations",
+		Description: "Periodically list the activities started after the stored mark, export each new activity " +
+			"and upload it to every destination, skipping destinations the ledger records as delivered. A delivery " +
+			"is recorded in the ledger once uploaded and confirmed once polling shows the upload was processed; " +
+			"activities not delivered to every destination are recorded as failed in the state file and delivered " +
+			"again at the start of each subsequent pass while the mark advances past them. If neither the mark nor " +
+			"`--after` is set only activities started from now on are followed",
+		ArgsUsage: "--from <exporter> --to <uploader>[,<uploader>...]",
+		Flags:     followFlags(),
+		Action:    follow,
+	}
+}
@@ -0,0 +1,257 @@
+package qp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	api "github.com/bzimmer/activity"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/internal"
+	"github.com/bzimmer/gravl/internal/blackhole"
+)
+
+const statePath = "/config/gravl/follow.json"
+
+// flaky fails the first `failures` uploads
+type flaky struct {
+	api.Uploader
+	failures int
+}
+
+func (f *flaky) Upload(ctx context.Context, file *api.File) (api.Upload, error) {
+	if f.failures > 0 {
+		f.failures--
+		return nil, errors.New("service unavailable")
+	}
+	return f.Uploader.Upload(ctx, file)
+}
+
+// stalled fails the first `failures` exports
+type stalled struct {
+	api.Exporter
+	failures int
+}
+
+func (s *stalled) Export(ctx context.Context, activityID int64) (*api.Export, error) {
+	if s.failures > 0 {
+		s.failures--
+		return nil, errors.New("gateway timeout")
+	}
+	return s.Exporter.Export(ctx, activityID)
+}
+
+type state struct {
+	After  map[string]time.Time `json:"after"`
+	Failed map[string][]int64   `json:"failed"`
+}
+
+func readState(t *testing.T, c *cli.Context) *state {
+	a := assert.New(t)
+	data, err := afero.ReadFile(gravl.Runtime(c).Fs, statePath)
+	a.NoError(err)
+	var s state
+	a.NoError(json.Unmarshal(data, &s))
+	return &s
+}
+
+func TestFollow(t *testing.T) {
+	a := assert.New(t)
+	providers := func(failures int) cli.BeforeFunc {
+		return func(c *cli.Context) error {
+			gravl.Runtime(c).Listers[blackhole.Provider] = blackhole.ListerFunc
+			gravl.Runtime(c).Exporters[blackhole.Provider] = blackhole.ExporterFunc
+			gravl.Runtime(c).Exporters["stalled"] = func(_ *cli.Context) (api.Exporter, error) {
+				return &stalled{Exporter: blackhole.NewExporter(), failures: 1}, nil
+			}
+			gravl.Runtime(c).Listers["stalled"] = blackhole.ListerFunc
+			gravl.Runtime(c).Uploaders[blackhole.Provider] = blackhole.UploaderFunc
+			upd := &flaky{Uploader: blackhole.NewUploader(), failures: failures}
+			gravl.Runtime(c).Uploaders["flaky"] = func(_ *cli.Context) (api.Uploader, error) {
+				return upd, nil
+			}
+			return nil
+		}
+	}
+	args := func(args ...string) []string {
+		return append([]string{"gravl", "qp", "follow", "--from", "blackhole",
+			"--ledger", ledgerPath, "--state", statePath, "--backoff", "1ms", "-N", "1"}, args...)
+	}
+	tests := []*internal.Harness{
+		{
+			Name:   "follow to many",
+			Args:   args("--to", "blackhole,flaky", "--after", "2021-09-30"),
+			Before: providers(0),
+			Counters: map[string]int{
+				"gravl.follow.list":           1,
+				"gravl.follow.export.success": blackhole.Activities,
+				"gravl.upload.file.success":   2 * blackhole.Activities,
+			},
+			After: func(c *cli.Context) error {
+				s := readState(t, c)
+				a.Equal(time.Date(2021, time.October, 3, 8, 0, 0, 0, time.UTC), s.After[blackhole.Provider])
+				a.Empty(s.Failed)
+				data, err := afero.ReadFile(gravl.Runtime(c).Fs, ledgerPath)
+				a.NoError(err)
+				var res struct {
+					Deliveries []map[string]any `json:"deliveries"`
+				}
+				a.NoError(json.Unmarshal(data, &res))
+				a.Len(res.Deliveries, 2*blackhole.Activities)
+				return nil
+			},
+		},
+		{
+			Name: "export retried",
+			Args: []string{"gravl", "qp", "follow", "--from", "stalled", "--to", "blackhole", "--after", "2021-10-02",
+				"--ledger", ledgerPath, "--state", statePath, "--backoff", "1ms", "-N", "1"},
+			Before: providers(0),
+			Counters: map[string]int{
+				"gravl.follow.retry":          1,
+				"gravl.follow.export.success": 2,
+				"gravl.upload.file.success":   2,
+			},
+		},
+		{
+			Name: "export not retried",
+			Args: []string{"gravl", "qp", "follow", "--from", "stalled", "--to", "blackhole", "--after", "2021-10-02",
+				"--ledger", ledgerPath, "--state", statePath, "--retries", "5", "--pass-retries", "0", "-N", "1"},
+			Before: providers(0),
+			Err:    "gateway timeout",
+			Counters: map[string]int{
+				"gravl.follow.error":          1,
+				"gravl.follow.failed":         1,
+				"gravl.follow.export.success": 1,
+				"gravl.upload.file.success":   1,
+			},
+		},
+		{
+			Name: "follow from the stored mark",
+			Args: args("--to", "blackhole"),
+			Before: gravl.Befores(providers(0), func(c *cli.Context) error {
+				return afero.WriteFile(gravl.Runtime(c).Fs, statePath,
+					[]byte(`{"after":{"blackhole":"2021-10-02T08:00:00Z"}}`), 0o600)
+			}),
+			Counters: map[string]int{
+				"gravl.follow.export.success": 1,
+				"gravl.upload.file.success":   1,
+			},
+		},
+		{
+			Name: "follow skips delivered",
+			Args: args("--to", "blackhole", "--after", "2021-10-02"),
+			Before: gravl.Befores(providers(0), writeLedger(`{"deliveries":[
+				{"source":"blackhole","source_id":"1001","destination":"blackhole","upload_id":88191}]}`)),
+			Counters: map[string]int{
+				"gravl.follow.skipped":        1,
+				"gravl.follow.export.success": 1,
+				"gravl.upload.file.success":   1,
+			},
+		},
+		{
+			Name:   "follow starts now",
+			Args:   args("--to", "blackhole"),
+			Before: providers(0),
+			Counters: map[string]int{
+				"gravl.follow.list": 1,
+			},
+			After: func(c *cli.Context) error {
+				a.WithinDuration(time.Now(), readState(t, c).After[blackhole.Provider], time.Minute)
+				return nil
+			},
+		},
+		{
+			Name:   "upload fails",
+			Args:   args("--to", "blackhole,flaky", "--after", "2021-09-30"),
+			Before: providers(2),
+			Err:    "blackhole activity 1000 to flaky: service unavailable",
+			Counters: map[string]int{
+				"gravl.follow.error":          1,
+				"gravl.follow.failed":         2,
+				"gravl.follow.export.success": blackhole.Activities,
+				"gravl.upload.file.success":   blackhole.Activities + 1,
+			},
+			After: func(c *cli.Context) error {
+				s := readState(t, c)
+				a.Equal(time.Date(2021, time.October, 3, 8, 0, 0, 0, time.UTC), s.After[blackhole.Provider])
+				a.Equal([]int64{1000, 1001}, s.Failed[blackhole.Provider])
+				return nil
+			},
+		},
+		{
+			Name: "failed delivery retried",
+			Args: args("--to", "blackhole,flaky"),
+			Before: gravl.Befores(providers(0),
+				func(c *cli.Context) error {
+					return afero.WriteFile(gravl.Runtime(c).Fs, statePath,
+						[]byte(`{"after":{"blackhole":"2021-10-03T08:00:00Z"},"failed":{"blackhole":[1001]}}`), 0o600)
+				},
+				writeLedger(`{"deliveries":[
+				{"source":"blackhole","source_id":"1001","destination":"blackhole","upload_id":88191}]}`)),
+			Counters: map[string]int{
+				"gravl.follow.retried":        1,
+				"gravl.follow.export.success": 1,
+				"gravl.upload.file.success":   1,
+			},
+			After: func(c *cli.Context) error {
+				s := readState(t, c)
+				a.Equal(time.Date(2021, time.October, 3, 8, 0, 0, 0, time.UTC), s.After[blackhole.Provider])
+				a.Empty(s.Failed[blackhole.Provider])
+				return nil
+			},
+		},
+		{
+			Name: "failed delivery fails again",
+			Args: args("--to", "blackhole,flaky", "--after", "2021-10-02"),
+			Before: gravl.Befores(providers(1),
+				func(c *cli.Context) error {
+					return afero.WriteFile(gravl.Runtime(c).Fs, statePath,
+						[]byte(`{"after":{"blackhole":"2021-10-03T08:00:00Z"},"failed":{"blackhole":[1001]}}`), 0o600)
+				}),
+			Err: "blackhole activity 1001 to flaky: service unavailable",
+			Counters: map[string]int{
+				"gravl.follow.retried":        1,
+				"gravl.follow.error":          1,
+				"gravl.follow.failed":         1,
+				"gravl.follow.export.success": 2,
+				"gravl.upload.file.success":   3,
+			},
+			After: func(c *cli.Context) error {
+				s := readState(t, c)
+				a.Equal(time.Date(2021, time.October, 3, 8, 0, 0, 0, time.UTC), s.After[blackhole.Provider])
+				a.Equal([]int64{1001}, s.Failed[blackhole.Provider])
+				return nil
+			},
+		},
+		{
+			Name: "invalid state",
+			Args: args("--to", "blackhole"),
+			Before: gravl.Befores(providers(0), func(c *cli.Context) error {
+				return afero.WriteFile(gravl.Runtime(c).Fs, statePath, []byte("not json"), 0o600)
+			}),
+			Err: "invalid state",
+		},
+		{
+			Name: "unknown lister",
+			Args: []string{"gravl", "qp", "follow", "--from", "nowhere", "--to", "blackhole"},
+			Err:  "unknown lister",
+		},
+		{
+			Name: "missing destination",
+			Args: []string{"gravl", "qp", "follow", "--from", "blackhole"},
+			Err:  `Required flag "to" not set`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			internal.Run(t, tt, nil, command)
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package qp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	api "github.com/bzimmer/activity"
+	caapi "github.com/bzimmer/activity/cyclinganalytics"
+	stravaapi "github.com/bzimmer/activity/strava"
+	"github.com/spf13/afero"
+
+	"github.com/bzimmer/gravl/activity/rwgps"
+)
+
+// sourceFile is the source provider recorded for uploads of local files
+const sourceFile = "file"
+
+// delivery records a source activity delivered to a destination platform
+type delivery struct {
+	Source      string    `json:"source"`
+	SourceID    string    `json:"source_id"`
+	Destination string    `json:"destination"`
+	UploadID    int64     `json:"upload_id"`
+	ActivityID  int64     `json:"activity_id,omitempty"`
+	Delivered   time.Time `json:"delivered"`
+	// Pending is true until the platform is confirmed to have processed the upload
+	Pending bool `json:"pending,omitempty"`
+}
+
+// ledger persists deliveries across invocations so copies and uploads are idempotent
+type ledger struct {
+	mu         sync.Mutex
+	fs         afero.Fs
+	path       string
+	Deliveries []*delivery `json:"deliveries"`
+}
+
+// ledgerPath returns the file used to persist deliveries; when empty the OS user
+// config directory is used (e.g. ~/.config/gravl/ledger.json on Linux), next to
+// the Hammerhead token cache
+func ledgerPath(path string) (string, error) {
+	return userConfigPath(path, "ledger.json")
+}
+
+// userConfigPath returns the path if not empty, otherwise the filename in the gravl user config directory
+func userConfigPath(path, filename string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gravl", filename), nil
+}
+
+func loadLedger(fs afero.Fs, path string) (*ledger, error) {
+	path, err := ledgerPath(path)
+	if err != nil {
+		return nil, err
+	}
+	l := &ledger{fs: fs, path: path}
+	data, err := afero.ReadFile(fs, path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return l, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("invalid ledger %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// lookup returns the delivery of the source activity to the destination or nil if not delivered
+func (l *ledger) lookup(source, sourceID, destination string) *delivery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, d := range l.Deliveries {
+		if d.Source == source && d.SourceID == sourceID && d.Destination == destination {
+			return d
+		}
+	}
+	return nil
+}
+
+// record the delivery, replacing any previous delivery of the source activity to the destination
+func (l *ledger) record(d *delivery) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.remove(d.Source, d.SourceID, d.Destination)
+	l.Deliveries = append(l.Deliveries, d)
+	return l.save()
+}
+
+// clear the delivery of the source activity to the destination
+func (l *ledger) clear(source, sourceID, destination string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.remove(source, sourceID, destination)
+	return l.save()
+}
+
+func (l *ledger) remove(source, sourceID, destination string) {
+	l.Deliveries = slices.DeleteFunc(l.Deliveries, func(x *delivery) bool {
+		return x.Source == source && x.SourceID == sourceID && x.Destination == destination
+	})
+}
+
+func (l *ledger) save() error {
+	if err := l.fs.MkdirAll(filepath.Dir(l.path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err = afero.WriteFile(l.fs, tmp, data, 0o600); err != nil {
+		return err
+	}
+	return l.fs.Rename(tmp, l.path)
+}
+
+// completed returns the destination activity id of a processed upload or an error if the
+// platform failed to process the file; platforms not reporting an activity id return zero
+func completed(u api.Upload) (int64, error) {
+	switch v := u.(type) {
+	case *stravaapi.Upload:
+		if v.Error != "" {
+			return 0, fmt.Errorf("upload %d failed: %s", v.ID, v.Error)
+		}
+		return v.ActivityID, nil
+	case *caapi.Upload:
+		if v.Status != "done" {
+			return 0, fmt.Errorf("upload %d failed: %s", v.ID, v.Error)
+		}
+		return v.RideID, nil
+	case *rwgps.Upload:
+		if v.Status != rwgps.StatusSuccess {
+			return 0, fmt.Errorf("upload %d failed: %s", v.TaskID, v.Message)
+		}
+		return v.ActivityID, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,251 @@
+package qp_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	api "github.com/bzimmer/activity"
+	"github.com/bzimmer/activity/strava"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/internal"
+	"github.com/bzimmer/gravl/internal/blackhole"
+)
+
+const (
+	ledgerPath = "/config/gravl/ledger.json"
+	// sha256 of an empty file
+	emptySum = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+func writeLedger(data string) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		return afero.WriteFile(gravl.Runtime(c).Fs, ledgerPath, []byte(data), 0o600)
+	}
+}
+
+// unprocessed accepts uploads but fails to process them
+type unprocessed struct{}
+
+func (unprocessed) Upload(_ context.Context, _ *api.File) (api.Upload, error) {
+	return &strava.Upload{ID: 7}, nil
+}
+
+func (unprocessed) Status(_ context.Context, id api.UploadID) (api.Upload, error) {
+	return &strava.Upload{ID: int64(id), Error: "duplicate activity"}, nil
+}
+
+// processing accepts uploads which are never processed
+type processing struct{}
+
+func (processing) Upload(_ context.Context, _ *api.File) (api.Upload, error) {
+	return &strava.Upload{ID: 9}, nil
+}
+
+func (processing) Status(_ context.Context, id api.UploadID) (api.Upload, error) {
+	return &strava.Upload{ID: int64(id)}, nil
+}
+
+func readLedger(c *cli.Context) ([]map[string]any, error) {
+	data, err := afero.ReadFile(gravl.Runtime(c).Fs, ledgerPath)
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Deliveries []map[string]any `json:"deliveries"`
+	}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return res.Deliveries, nil
+}
+
+func TestLedger(t *testing.T) {
+	a := assert.New(t)
+	providers := func(c *cli.Context) error {
+		gravl.Runtime(c).Uploaders[blackhole.Provider] = blackhole.UploaderFunc
+		gravl.Runtime(c).Exporters[blackhole.Provider] = blackhole.ExporterFunc
+		gravl.Runtime(c).Uploaders["unprocessed"] = func(_ *cli.Context) (api.Uploader, error) {
+			return unprocessed{}, nil
+		}
+		gravl.Runtime(c).Uploaders["processing"] = func(_ *cli.Context) (api.Uploader, error) {
+			return processing{}, nil
+		}
+		return nil
+	}
+	pending := func(n int, want bool) cli.AfterFunc {
+		return func(c *cli.Context) error {
+			res, err := readLedger(c)
+			a.NoError(err)
+			a.Len(res, n)
+			for _, d := range res {
+				a.Equal(want, d["pending"] == true)
+			}
+			return nil
+		}
+	}
+	delivered := writeLedger(`{"deliveries":[
+		{"source":"blackhole","source_id":"61292794933","destination":"blackhole","upload_id":88191},
+		{"source":"file","source_id":"` + emptySum + `","destination":"blackhole","upload_id":88192}]}`)
+	tests := []*internal.Harness{
+		{
+			Name: "copy records delivery",
+			Args: []string{"gravl", "qp", "copy", "--ledger", ledgerPath,
+				"--from", "blackhole", "--to", "blackhole", "61292794933"},
+			Before: providers,
+			Counters: map[string]int{
+				"gravl.upload.file.success": 1,
+			},
+			After: func(c *cli.Context) error {
+				res, err := readLedger(c)
+				a.NoError(err)
+				a.Len(res, 1)
+				a.Equal("61292794933", res[0]["source_id"])
+				a.Equal("blackhole", res[0]["destination"])
+				a.Nil(res[0]["pending"])
+				return nil
+			},
+		},
+		{
+			Name: "copy unprocessed",
+			Args: []string{"gravl", "qp", "copy", "--ledger", ledgerPath,
+				"--from", "blackhole", "--to", "unprocessed", "61292794933"},
+			Before: providers,
+			Err:    "upload 7 failed: duplicate activity",
+			Counters: map[string]int{
+				"gravl.upload.file.success": 1,
+				"gravl.upload.rejected":     1,
+			},
+			After: pending(0, false),
+		},
+		{
+			Name: "copy still processing",
+			Args: []string{"gravl", "qp", "copy", "--ledger", ledgerPath, "--iterations", "1", "--interval", "1ms",
+				"--from", "blackhole", "--to", "processing", "61292794933"},
+			Before: providers,
+			Counters: map[string]int{
+				"gravl.upload.file.success": 1,
+				"gravl.upload.pending":      1,
+			},
+			After: pending(1, true),
+		},
+		{
+			Name: "upload without polling",
+			Args: []string{"gravl", "qp", "upload", "--ledger", ledgerPath, "--to", "blackhole", "/foo/"},
+			Before: gravl.Befores(providers, func(c *cli.Context) error {
+				fs := gravl.Runtime(c).Fs
+				a.NoError(fs.MkdirAll("/foo", 0o755))
+				return afero.WriteFile(fs, "/foo/ride.fit", []byte{}, 0o644)
+			}),
+			Counters: map[string]int{
+				"gravl.upload.file.success": 1,
+				"gravl.upload.pending":      1,
+			},
+			After: pending(1, true),
+		},
+		{
+			Name: "copy confirms pending",
+			Args: []string{"gravl", "qp", "copy", "--ledger", ledgerPath,
+				"--from", "blackhole", "--to", "blackhole", "61292794933"},
+			Before: gravl.Befores(providers, writeLedger(`{"deliveries":[
+				{"source":"blackhole","source_id":"61292794933","destination":"blackhole","upload_id":88191,"pending":true}]}`)),
+			Counters: map[string]int{
+				"gravl.upload.skipping.delivered": 1,
+			},
+			After: pending(1, false),
+		},
+		{
+			Name: "copy skips processing",
+			Args: []string{"gravl", "qp", "copy", "--ledger", ledgerPath,
+				"--from", "blackhole", "--to", "processing", "61292794933"},
+			Before: gravl.Befores(providers, writeLedger(`{"deliveries":[
+				{"source":"blackhole","source_id":"61292794933","destination":"processing","upload_id":9,"pending":true}]}`)),
+			Counters: map[string]int{
+				"gravl.upload.skipping.delivered": 1,
+			},
+			After: pending(1, true),
+		},
+		{
+			Name: "copy delivers unprocessed again",
+			Args: []string{"gravl", "qp", "copy", "--ledger", ledgerPath,
+				"--from", "blackhole", "--to", "unprocessed", "61292794933"},
+			Before: gravl.Befores(providers, writeLedger(`{"deliveries":[
+				{"source":"blackhole","source_id":"61292794933","destination":"unprocessed","upload_id":7,"pending":true}]}`)),
+			Err: "upload 7 failed: duplicate activity",
+			Counters: map[string]int{
+				"gravl.upload.file.success": 1,
+				"gravl.upload.rejected":     2,
+			},
+			After: pending(0, false),
+		},
+		{
+			Name: "copy skips delivered",
+			Args: []string{"gravl", "qp", "copy", "--ledger", ledgerPath,
+				"--from", "blackhole", "--to", "blackhole", "61292794933"},
+			Before: gravl.Befores(providers, delivered),
+			Counters: map[string]int{
+				"gravl.upload.skipping.delivered": 1,
+			},
+		},
+		{
+			Name: "copy forced",
+			Args: []string{"gravl", "qp", "copy", "--ledger", ledgerPath, "--force",
+				"--from", "blackhole", "--to", "blackhole", "61292794933"},
+			Before: gravl.Befores(providers, delivered),
+			Counters: map[string]int{
+				"gravl.upload.file.success": 1,
+			},
+		},
+		{
+			Name: "upload skips delivered",
+			Args: []string{"gravl", "qp", "upload", "--ledger", ledgerPath, "--to", "blackhole", "/foo/"},
+			Before: gravl.Befores(providers, delivered, func(c *cli.Context) error {
+				fs := gravl.Runtime(c).Fs
+				a.NoError(fs.MkdirAll("/foo", 0o755))
+				return afero.WriteFile(fs, "/foo/ride.fit", []byte{}, 0o644)
+			}),
+			Counters: map[string]int{
+				"gravl.walk.file.success":         1,
+				"gravl.upload.skipping.delivered": 1,
+			},
+		},
+		{
+			Name: "status by source id",
+			Args: []string{"gravl", "qp", "status", "--ledger", ledgerPath,
+				"--from", "blackhole", "--to", "blackhole", "61292794933"},
+			Before: gravl.Befores(providers, delivered),
+			Counters: map[string]int{
+				"gravl.upload.poll": 1,
+			},
+		},
+		{
+			Name:   "status is not forced",
+			Args:   []string{"gravl", "qp", "status", "--ledger", ledgerPath, "--force", "--to", "blackhole", "88191"},
+			Before: providers,
+			Err:    "flag provided but not defined: -force",
+		},
+		{
+			Name:   "status by unknown source id",
+			Args:   []string{"gravl", "qp", "status", "--ledger", ledgerPath, "--from", "blackhole", "--to", "blackhole", "1"},
+			Before: gravl.Befores(providers, delivered),
+			Err:    "no delivery of blackhole activity 1 to blackhole",
+		},
+		{
+			Name: "invalid ledger",
+			Args: []string{"gravl", "qp", "copy", "--ledger", ledgerPath,
+				"--from", "blackhole", "--to", "blackhole", "61292794933"},
+			Before: gravl.Befores(providers, writeLedger("not json")),
+			Err:    "invalid ledger",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			internal.Run(t, tt, nil, command)
+		})
+	}
+}
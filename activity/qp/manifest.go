@@ -0,0 +1,98 @@
+package qp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	manifestFilename = "manifest.json"
+	// manifestBatch is the number of entries added between writes of the manifest
+	manifestBatch = 25
+)
+
+// entry records a single activity exported to the archive
+type entry struct {
+	Provider string    `json:"provider"`
+	ID       int64     `json:"id"`
+	Filename string    `json:"filename"`
+	Format   string    `json:"format"`
+	Hash     string    `json:"sha256"`
+	Exported time.Time `json:"exported"`
+}
+
+// key identifies an activity in the manifest
+type key struct {
+	provider string
+	id       int64
+}
+
+// manifest tracks the activities exported to an archive directory
+type manifest struct {
+	fs      afero.Fs
+	path    string
+	index   map[key]bool
+	unsaved int
+	Entries []*entry `json:"entries"`
+}
+
+// loadManifest reads the manifest from the archive directory, a missing manifest is empty
+func loadManifest(fs afero.Fs, dir string) (*manifest, error) {
+	m := &manifest{fs: fs, path: filepath.Join(dir, manifestFilename), index: make(map[key]bool)}
+	data, err := afero.ReadFile(fs, m.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return m, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", m.path, err)
+	}
+	for _, e := range m.Entries {
+		m.index[key{provider: e.Provider, id: e.ID}] = true
+	}
+	return m, nil
+}
+
+func (m *manifest) contains(provider string, id int64) bool {
+	return m.index[key{provider: provider, id: id}]
+}
+
+// add the entry, the manifest is persisted every `manifestBatch` entries so an interrupted
+// sync keeps most of its progress without rewriting the manifest for each activity
+func (m *manifest) add(e *entry) error {
+	m.Entries = append(m.Entries, e)
+	m.index[key{provider: e.Provider, id: e.ID}] = true
+	m.unsaved++
+	if m.unsaved < manifestBatch {
+		return nil
+	}
+	return m.save()
+}
+
+// save persists the manifest if entries were added since it was last saved
+func (m *manifest) save() error {
+	if m.unsaved == 0 {
+		return nil
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err = afero.WriteFile(m.fs, tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err = m.fs.Rename(tmp, m.path); err != nil {
+		return err
+	}
+	m.unsaved = 0
+	return nil
+}
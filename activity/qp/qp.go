@@ -2,9 +2,15 @@ package qp
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"time"
 
 	api "github.com/bzimmer/activity"
@@ -17,17 +23,12 @@ import (
 	"github.com/bzimmer/gravl"
 	"github.com/bzimmer/gravl/activity"
 	"github.com/bzimmer/gravl/activity/cyclinganalytics"
+	"github.com/bzimmer/gravl/activity/hammerhead"
 	"github.com/bzimmer/gravl/activity/rwgps"
 	"github.com/bzimmer/gravl/activity/strava"
 	"github.com/bzimmer/gravl/activity/zwift"
 )
 
-func poller(c *cli.Context, upd api.Uploader) api.Poller {
-	return api.NewPoller(upd,
-		api.WithInterval(c.Duration("interval")),
-		api.WithIterations(c.Int("iterations")))
-}
-
 func exporter(c *cli.Context, name string) (api.Exporter, error) {
 	if f, ok := gravl.Runtime(c).Exporters[name]; ok {
 		return f(c)
@@ -74,10 +75,124 @@ func providersCommand() *cli.Command {
 }
 
 type xfer struct {
-	metrics  *metrics.Metrics
-	uploader api.Uploader
-	poller   api.Poller
-	encoder  gravl.Encoder
+	to         string
+	force      bool
+	ledger     *ledger
+	pipeline   []Transformer
+	metrics    *metrics.Metrics
+	uploader   api.Uploader
+	poller     api.Poller
+	interval   time.Duration
+	iterations int
+	encoder    gravl.Encoder
+}
+
+func newXfer(c *cli.Context, to string, upd api.Uploader) (*xfer, error) {
+	ldg, err := loadLedger(gravl.Runtime(c).Fs, c.String("ledger"))
+	if err != nil {
+		return nil, err
+	}
+	pipeline, err := transformers(c)
+	if err != nil {
+		return nil, err
+	}
+	x := &xfer{
+		to:       to,
+		force:    c.Bool("force"),
+		ledger:   ldg,
+		pipeline: pipeline,
+		uploader: upd,
+		encoder:  gravl.Runtime(c).Encoder,
+		metrics:  gravl.Runtime(c).Metrics,
+	}
+	x.polling(c.Duration("interval"), c.Int("iterations"))
+	return x, nil
+}
+
+// polling sets the interval between and the number of polls for the status of an upload
+func (x *xfer) polling(interval time.Duration, iterations int) {
+	x.interval, x.iterations = interval, iterations
+	x.poller = api.NewPoller(x.uploader, api.WithInterval(interval), api.WithIterations(iterations))
+}
+
+// fork returns a transfer to another destination sharing the ledger, transforms, and polling
+func (x *xfer) fork(to string, upd api.Uploader) *xfer {
+	y := *x
+	y.to, y.uploader = to, upd
+	y.polling(x.interval, x.iterations)
+	return &y
+}
+
+// delivered returns true if the source activity was previously delivered to the destination, the
+// status of a pending delivery is checked first so an upload the platform failed to process is delivered again
+func (x *xfer) delivered(ctx context.Context, source, sourceID string) (bool, error) {
+	if x.force || x.ledger == nil {
+		return false, nil
+	}
+	d := x.ledger.lookup(source, sourceID, x.to)
+	if d == nil {
+		return false, nil
+	}
+	if d.Pending {
+		ok, err := x.confirm(ctx, d)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	x.metrics.IncrCounter([]string{metricUpload, "skipping", "delivered"}, 1)
+	log.Info().
+		Str("source", source).
+		Str("id", sourceID).
+		Str("to", x.to).
+		Int64("upload", d.UploadID).
+		Msg("skipping, already delivered")
+	return true, nil
+}
+
+// confirm checks the status of the upload of the pending delivery returning false, and clearing the
+// delivery, only if the platform failed to process the upload; a delivery whose status is unavailable
+// remains pending rather than risk a duplicate upload
+func (x *xfer) confirm(ctx context.Context, d *delivery) (bool, error) {
+	u, err := x.uploader.Status(ctx, api.UploadID(d.UploadID))
+	if err != nil {
+		log.Warn().Err(err).Int64("upload", d.UploadID).Str("to", x.to).Msg("unable to confirm pending delivery")
+		return true, nil
+	}
+	if u == nil || !u.Done() {
+		return true, nil
+	}
+	if _, err = completed(u); err != nil {
+		x.metrics.IncrCounter([]string{metricUpload, "rejected"}, 1)
+		log.Warn().Err(err).Str("source", d.Source).Str("id", d.SourceID).Str("to", x.to).Msg("delivering again")
+		return false, x.ledger.clear(d.Source, d.SourceID, x.to)
+	}
+	return true, x.record(d.Source, d.SourceID, u)
+}
+
+// record the upload of the source activity in the ledger, pending until the platform has processed the
+// upload and cleared if the platform failed to process it so the activity can be delivered again
+func (x *xfer) record(source, sourceID string, u api.Upload) error {
+	d := &delivery{
+		Source:      source,
+		SourceID:    sourceID,
+		Destination: x.to,
+		UploadID:    int64(u.Identifier()),
+		Delivered:   time.Now().UTC(),
+		Pending:     !u.Done(),
+	}
+	var err error
+	if !d.Pending {
+		if d.ActivityID, err = completed(u); err != nil {
+			x.metrics.IncrCounter([]string{metricUpload, "rejected"}, 1)
+		}
+	}
+	switch {
+	case x.ledger == nil:
+		return err
+	case err != nil:
+		return errors.Join(err, x.ledger.clear(source, sourceID, x.to))
+	}
+	return x.ledger.record(d)
 }
 
 func (x *xfer) upload(ctx context.Context, export *api.File) (api.Upload, error) {
@@ -89,120 +204,244 @@ func (x *xfer) upload(ctx context.Context, export *api.File) (api.Upload, error)
 	return u, nil
 }
 
-func (x *xfer) poll(ctx context.Context, uploadID api.UploadID) error {
+// poll the status of the upload returning the last status received
+func (x *xfer) poll(ctx context.Context, uploadID api.UploadID) (api.Upload, error) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	i := 0
+	var last api.Upload
 	for res := range x.poller.Poll(ctx, uploadID) {
 		if res.Err != nil {
-			return res.Err
+			return nil, res.Err
 		}
+		last = res.Upload
 		x.metrics.IncrCounter([]string{metricUpload, "poll"}, 1)
 		log.Info().Int("iteration", i).Int64("id", int64(res.Upload.Identifier())).Msg("poll")
 		if err := x.encoder.Encode(res.Upload); err != nil {
-			return err
+			return nil, err
 		}
 		i++
 	}
-	return nil
+	return last, nil
 }
 
-func upload(c *cli.Context) error {
+// deliver transforms and uploads the file and optionally polls for the upload status, the delivery is
+// recorded as pending once uploaded and confirmed once the upload is processed successfully
+func (x *xfer) deliver(ctx context.Context, source, sourceID string, file *api.File, poll bool) error {
+	file, err := transform(file, x.pipeline)
+	if err != nil {
+		return err
+	}
+	if len(x.pipeline) > 0 {
+		x.metrics.IncrCounter([]string{metricUpload, "transform", metricSuccess}, 1)
+	}
+	u, err := x.upload(ctx, file)
+	if err != nil {
+		return err
+	}
+	if err = x.record(source, sourceID, u); err != nil {
+		return err
+	}
+	if !poll {
+		x.metrics.IncrCounter([]string{metricUpload, "pending"}, 1)
+		return x.encoder.Encode(u)
+	}
+	last, err := x.poll(ctx, u.Identifier())
+	if err != nil {
+		return err
+	}
+	if last == nil || !last.Done() {
+		x.metrics.IncrCounter([]string{metricUpload, "pending"}, 1)
+		return nil
+	}
+	return x.record(source, sourceID, last)
+}
+
+// digest returns the sha256 of the file contents and rewinds the file
+func digest(fp afero.File) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, fp); err != nil {
+		return "", err
+	}
+	if _, err := fp.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// uploadResult tags the result of uploading a file with the file
+type uploadResult struct {
+	File   string `json:"file"`
+	Upload any    `json:"upload,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// fileEncoder tags each encoded value with the file and serializes encoding across workers
+type fileEncoder struct {
+	mu   *sync.Mutex
+	enc  gravl.Encoder
+	file string
+}
+
+func (f *fileEncoder) Encode(v any) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.enc.Encode(&uploadResult{File: f.file, Upload: v})
+}
+
+func (f *fileEncoder) fail(err error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.enc.Encode(&uploadResult{File: f.file, Error: err.Error()})
+}
+
+// uploadFile uploads the file unless previously delivered
+func (x *xfer) uploadFile(ctx context.Context, fs afero.Fs, path string, poll bool) error {
+	fp, err := fs.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	sum, err := digest(fp)
+	if err != nil {
+		return err
+	}
+	ok, err := x.delivered(ctx, sourceFile, sum)
+	if err != nil || ok {
+		return err
+	}
+	file := &api.File{
+		Name:     filepath.Base(path),
+		Filename: path,
+		Reader:   fp,
+		Format:   api.ToFormat(filepath.Ext(path)),
+	}
+	return x.deliver(ctx, sourceFile, sum, file, poll)
+}
+
+func upload(c *cli.Context) error { //nolint:gocognit
 	fs := gravl.Runtime(c).Fs
-	enc := gravl.Runtime(c).Encoder
-	met := gravl.Runtime(c).Metrics
 	upd, err := uploader(c, c.String("to"))
 	if err != nil {
 		return err
 	}
-	x := xfer{
-		poller:   poller(c, upd),
-		metrics:  met,
-		encoder:  enc,
-		uploader: upd,
+	x, err := newXfer(c, c.String("to"), upd)
+	if err != nil {
+		return err
 	}
 
-	up := func(res *walkResult) error {
-		ctx, cancel := context.WithTimeout(c.Context, c.Duration("timeout"))
-		defer cancel()
-		var fp afero.File
-		fp, err = fs.Open(res.path)
-		if err != nil {
-			return err
-		}
-		defer fp.Close()
-		file := &api.File{
-			Name:     filepath.Base(res.path),
-			Filename: res.path,
-			Reader:   fp,
-			Format:   api.ToFormat(filepath.Ext(res.path)),
-		}
-		var u api.Upload
-		u, err = x.upload(ctx, file)
-		if err != nil {
-			return err
-		}
-		if c.Bool("poll") {
-			return x.poll(ctx, u.Identifier())
-		}
-		return enc.Encode(u)
-	}
+	concurrency := max(c.Int("concurrency"), 1)
+	failFast, poll, dur := c.Bool("fail-fast"), c.Bool("poll"), c.Duration("timeout")
 
-	args := c.Args()
-	for i := 0; i < args.Len(); i++ {
-		wctx, wcancel := context.WithCancel(c.Context)
-		var walkErr error
-		for res := range walk(wctx, c, args.Get(i)) {
-			if res.err != nil {
-				walkErr = res.err
-				break
-			}
-			log.Info().Str("file", res.path).Msg("uploading")
-			if err = up(res); err != nil {
-				walkErr = err
-				break
+	var mu sync.Mutex
+	var errs []error
+	paths := make(chan string)
+	grp, ctx := errgroup.WithContext(c.Context)
+	grp.Go(func() error {
+		defer close(paths)
+		for _, arg := range c.Args().Slice() {
+			for res := range walk(ctx, c, arg) {
+				if res.err != nil {
+					return res.err
+				}
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case paths <- res.path:
+				}
 			}
 		}
-		wcancel()
-		if walkErr != nil {
-			return walkErr
-		}
+		return nil
+	})
+	for range concurrency {
+		grp.Go(func() error {
+			for path := range paths {
+				log.Info().Str("file", path).Msg("uploading")
+				enc := &fileEncoder{mu: &mu, enc: x.encoder, file: path}
+				y := *x
+				y.encoder = enc
+				tctx, cancel := context.WithTimeout(ctx, dur)
+				uploadErr := y.uploadFile(tctx, fs, path, poll)
+				cancel()
+				if uploadErr == nil {
+					continue
+				}
+				if failFast {
+					return uploadErr
+				}
+				x.metrics.IncrCounter([]string{metricUpload, metricFile, "failed"}, 1)
+				log.Error().Err(uploadErr).Str("file", path).Msg(metricUpload)
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", path, uploadErr))
+				mu.Unlock()
+				if encodeErr := enc.fail(uploadErr); encodeErr != nil {
+					return encodeErr
+				}
+			}
+			return nil
+		})
 	}
-	return nil
+	if err = grp.Wait(); err != nil {
+		return err
+	}
+	return errors.Join(errs...)
 }
 
 func uploadCommand() *cli.Command {
 	return &cli.Command{
-		Name:        metricUpload,
-		Usage:       "Upload files to an activity platform",
-		Description: "Upload one or more activity files (FIT, GPX, TCX) to the specified platform",
-		ArgsUsage:   "{FILE | DIRECTORY} (...)",
-		Flags:       flags(cfg{to: true, poll: true}),
-		Action:      upload,
+		Name:  metricUpload,
+		Usage: "Upload files to an activity platform",
+		Description: "Upload one or more activity files (FIT, GPX, TCX) to the specified platform, " +
+			"up to --concurrency files at a time",
+		ArgsUsage: "{FILE | DIRECTORY} (...)",
+		Flags: append(flags(cfg{to: true, poll: true, polling: true, ledger: true, force: true, transform: true}),
+			&cli.BoolFlag{
+				Name:  "fail-fast",
+				Value: false,
+				Usage: "Stop uploading at the first failure rather than attempting the remaining files",
+			}),
+		Action: upload,
 	}
 }
 
+// uploadID returns the upload id from the argument, or if `from` is set the upload id
+// recorded in the ledger for the delivery of the source activity
+func uploadID(c *cli.Context, x *xfer, arg string) (api.UploadID, error) {
+	if !c.IsSet("from") {
+		id, err := strconv.ParseInt(arg, 0, 64)
+		if err != nil {
+			return 0, err
+		}
+		return api.UploadID(id), nil
+	}
+	d := x.ledger.lookup(c.String("from"), arg, x.to)
+	if d == nil {
+		return 0, fmt.Errorf("no delivery of %s activity %s to %s", c.String("from"), arg, x.to)
+	}
+	return api.UploadID(d.UploadID), nil
+}
+
 func status(c *cli.Context) error {
 	args := c.Args()
 	upd, err := uploader(c, c.String("to"))
 	if err != nil {
 		return err
 	}
-	x := xfer{
-		poller:  poller(c, upd),
-		encoder: gravl.Runtime(c).Encoder,
-		metrics: gravl.Runtime(c).Metrics,
+	x, err := newXfer(c, c.String("to"), upd)
+	if err != nil {
+		return err
 	}
 	for i := 0; i < args.Len(); i++ {
 		err = func() error {
 			ctx, cancel := context.WithTimeout(c.Context, c.Duration("timeout"))
 			defer cancel()
-			var uploadID int64
-			uploadID, err = strconv.ParseInt(args.Get(i), 0, 64)
+			var id api.UploadID
+			id, err = uploadID(c, x, args.Get(i))
 			if err != nil {
 				return err
 			}
-			return x.poll(ctx, api.UploadID(uploadID))
+			_, err = x.poll(ctx, id)
+			return err
 		}()
 		if err != nil {
 			return err
@@ -215,9 +454,9 @@ func statusCommand() *cli.Command {
 	return &cli.Command{
 		Name:        "status",
 		Usage:       "Check the status of the upload",
-		ArgsUsage:   "UPLOAD_ID (...)",
-		Flags:       flags(cfg{to: true, poll: true}),
-		Description: "Check the status of an upload",
+		ArgsUsage:   "{UPLOAD_ID | --from <exporter> ACTIVITY_ID} (...)",
+		Flags:       flags(cfg{from: true, to: true, poll: true, polling: true, ledger: true}),
+		Description: "Check the status of an upload by upload id, or by source activity id using the delivery ledger",
 		Action:      status,
 	}
 }
@@ -250,37 +489,36 @@ func export(c *cli.Context) error {
 		return err
 	}
 	met := gravl.Runtime(c).Metrics
-	for i := 0; i < c.NArg(); i++ {
-		var exp *api.Export
-		var activityID int64
-		activityID, err = strconv.ParseInt(c.Args().Get(i), 10, 64)
+	return activity.Checkpoint(c, c.String("from"), c.Args().Slice(), func(id string) error {
+		activityID, err := strconv.ParseInt(id, 10, 64)
 		if err != nil {
 			return err
 		}
-		exp, err = expr.Export(c.Context, activityID)
+		ctx, cancel := context.WithTimeout(c.Context, c.Duration("timeout"))
+		defer cancel()
+		exp, err := expr.Export(ctx, activityID)
 		if err != nil {
 			return err
 		}
 		met.IncrCounter([]string{"export", "success"}, 1)
-		if err = write(c, exp); err != nil {
-			return err
-		}
-	}
-	return nil
+		return write(c, exp)
+	})
 }
 
 func exportCommand() *cli.Command {
 	return &cli.Command{
 		Name:        "export",
 		Usage:       "Export an activity from the source",
-		Flags:       flags(cfg{from: true, io: true}),
+		ArgsUsage:   "--from <exporter> id [id, ...]",
+		Flags:       append(flags(cfg{from: true, io: true}), activity.CheckpointFlag()),
 		Description: "Export an activity from the source",
 		Action:      export,
 	}
 }
 
 func qp(c *cli.Context) error {
-	expr, err := exporter(c, c.String("from"))
+	from := c.String("from")
+	expr, err := exporter(c, from)
 	if err != nil {
 		return err
 	}
@@ -290,11 +528,9 @@ func qp(c *cli.Context) error {
 		return err
 	}
 
-	x := xfer{
-		poller:   poller(c, upd),
-		uploader: upd,
-		encoder:  gravl.Runtime(c).Encoder,
-		metrics:  gravl.Runtime(c).Metrics,
+	x, err := newXfer(c, c.String("to"), upd)
+	if err != nil {
+		return err
 	}
 	dur := c.Duration("timeout")
 	grp, ctx := errgroup.WithContext(c.Context)
@@ -304,6 +540,14 @@ func qp(c *cli.Context) error {
 		if err != nil {
 			return err
 		}
+		sourceID := strconv.FormatInt(activityID, 10)
+		var ok bool
+		if ok, err = x.delivered(c.Context, from, sourceID); err != nil {
+			return err
+		}
+		if ok {
+			continue
+		}
 		grp.Go(func() error {
 			tctx, cancel := context.WithTimeout(ctx, dur)
 			defer cancel()
@@ -312,36 +556,60 @@ func qp(c *cli.Context) error {
 				return err
 			}
 			log.Info().Int64("id", activityID).Str("exp", exp.Name).Msg("export")
-			u, err := x.upload(tctx, exp.File)
-			if err != nil {
-				return err
-			}
-			return x.poll(tctx, u.Identifier())
+			return x.deliver(tctx, from, sourceID, exp.File, true)
 		})
 	}
 	return grp.Wait()
 }
 
+// Copy the activities from the source to the destination as `qp copy` would when run with only
+// the source and destination specified, the remaining flags take their default or environment values
+func Copy(c *cli.Context, from, to string, ids ...int64) error {
+	cmd := copyCommand()
+	set := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	for _, f := range append(Command().Flags, cmd.Flags...) {
+		if err := f.Apply(set); err != nil {
+			return err
+		}
+	}
+	args := []string{"--from", from, "--to", to}
+	for _, id := range ids {
+		args = append(args, strconv.FormatInt(id, 10))
+	}
+	if err := set.Parse(args); err != nil {
+		return err
+	}
+	ctx := cli.NewContext(c.App, set, c)
+	ctx.Command = cmd
+	return qp(ctx)
+}
+
 func copyCommand() *cli.Command {
 	return &cli.Command{
-		Name:        "copy",
-		Usage:       "Copy an activity from a source to a destination",
-		ArgsUsage:   "--from <exporter> --to <uploader> id [id, ...]",
-		Flags:       flags(cfg{from: true, to: true, poll: true, io: true}),
-		Description: "Copy an activity from a source to a destination",
-		Action:      qp,
+		Name:      "copy",
+		Usage:     "Copy an activity from a source to a destination",
+		ArgsUsage: "--from <exporter> --to <uploader> id [id, ...]",
+		Flags:     flags(cfg{from: true, to: true, polling: true, io: true, ledger: true, force: true, transform: true}),
+		Description: "Copy an activity from a source to a destination, polling the status of each upload and " +
+			"skipping activities previously delivered",
+		Action: qp,
 	}
 }
 
 type cfg struct {
 	from bool
 	to   bool
-	poll bool
-	io   bool
+	// poll adds `--poll`, polling adds the interval and iterations used when polling
+	poll      bool
+	polling   bool
+	io        bool
+	ledger    bool
+	force     bool
+	transform bool
 }
 
 func flags(c cfg) []cli.Flag {
-	x := activity.RateLimitFlags()
+	x := append(activity.RateLimitFlags(), activity.RetryFlags()...)
 	if c.from {
 		x = append(x,
 			&cli.StringFlag{
@@ -373,14 +641,55 @@ if not specified the contents are streamed to stdout`,
 			}...,
 		)
 	}
-	if c.poll {
+	if c.ledger {
 		x = append(x,
 			[]cli.Flag{
-				&cli.BoolFlag{
-					Name:  "poll",
-					Value: false,
-					Usage: "Continually check the status of the request until it is completed",
+				&cli.StringFlag{
+					Name:    "ledger",
+					Usage:   "File recording activities delivered, pending until processed; defaults to the OS user config directory",
+					EnvVars: []string{"GRAVL_LEDGER"},
+				},
+			}...)
+	}
+	if c.force {
+		x = append(x,
+			&cli.BoolFlag{
+				Name:  "force",
+				Value: false,
+				Usage: "Deliver the activity even if the ledger records a previous delivery",
+			})
+	}
+	if c.transform {
+		x = append(x,
+			[]cli.Flag{
+				&cli.GenericFlag{
+					Name:  "transform",
+					Value: &repeated{},
+					Usage: `Transform applied to the file before uploading, separate by commas or repeat the flag to apply several
+in order: strip-hr, privacy-zone={NAME | LAT:LNG:RADIUS}, trim-start=DURATION, trim-end=DURATION, rename=TEMPLATE;
+the transforms other than rename re-encode the file, dropping the laps and events of a FIT file`,
+				},
+				&cli.StringSliceFlag{
+					Name:  "zone",
+					Usage: "Named privacy zone for use with the privacy-zone transform (NAME=LAT:LNG:RADIUS, radius in meters)",
+				},
+				&cli.StringFlag{
+					Name:  "as",
+					Usage: "Convert the file to the format (fit, gpx, tcx) before applying any transforms and uploading",
 				},
+			}...)
+	}
+	if c.poll {
+		x = append(x,
+			&cli.BoolFlag{
+				Name:  "poll",
+				Value: false,
+				Usage: "Continually check the status of the request until it is completed",
+			})
+	}
+	if c.polling {
+		x = append(x,
+			[]cli.Flag{
 				&cli.DurationFlag{
 					Name:  "interval",
 					Value: time.Second * 2,
@@ -405,6 +714,12 @@ gravl qp export --from <exporter> (ids)...
 gravl qp copy --from <exporter> --to <uploader> (ids)...
 
 gravl qp status --from <exporter> (ids)...
+
+gravl qp sync --from <exporter> --to-dir <directory>
+gravl qp follow --from <exporter> --to <uploader>[,<uploader>...]
+
+gravl qp route export --from <route exporter> (ids)...
+gravl qp route copy --from <route exporter> --to <route importer> (ids)...
 */
 
 func Command() *cli.Command {
@@ -417,7 +732,9 @@ func Command() *cli.Command {
 			var x []cli.Flag
 			for _, q := range [][]cli.Flag{
 				cyclinganalytics.AuthFlags(),
+				hammerhead.AuthFlags(),
 				rwgps.AuthFlags(),
+				rwgps.ExportFlags(),
 				strava.AuthFlags(),
 				zwift.AuthFlags(),
 			} {
@@ -430,6 +747,9 @@ func Command() *cli.Command {
 			exportCommand(),
 			listCommand(),
 			statusCommand(),
+			syncCommand(),
+			followCommand(),
+			routeCommand(),
 			uploadCommand(),
 			providersCommand(),
 		},
@@ -2,10 +2,15 @@ package qp_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"strings"
 	"testing"
 
+	api "github.com/bzimmer/activity"
+	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"github.com/urfave/cli/v2"
 
@@ -48,6 +53,34 @@ func TestUpload(t *testing.T) {
 				"gravl.upload.file.success": 1,
 			},
 		},
+		{
+			Name:   "concurrent",
+			Args:   []string{"gravl", "qp", "upload", "--to", "rejecting", "--concurrency", "3", "/rides"},
+			Before: rides("a.fit", "b.fit", "c.fit", "d.fit"),
+			Counters: map[string]int{
+				"gravl.walk.file.success":   4,
+				"gravl.upload.file.success": 4,
+			},
+		},
+		{
+			Name:   "continue past failures",
+			Args:   []string{"gravl", "qp", "upload", "--to", "rejecting", "--concurrency", "3", "/rides"},
+			Before: rides("a.fit", "b-bad.fit", "c.fit"),
+			Counters: map[string]int{
+				"gravl.upload.file.success": 2,
+				"gravl.upload.file.failed":  1,
+			},
+			Err: "/rides/b-bad.fit: rejected",
+		},
+		{
+			Name:   "fail fast",
+			Args:   []string{"gravl", "qp", "upload", "--to", "rejecting", "--concurrency", "1", "--fail-fast", "/rides"},
+			Before: rides("a.fit", "b-bad.fit", "c.fit"),
+			Counters: map[string]int{
+				"gravl.upload.file.success": 1,
+			},
+			Err: "rejected",
+		},
 	}
 	for _, tt := range tests {
 		tt := tt
@@ -57,6 +90,34 @@ func TestUpload(t *testing.T) {
 	}
 }
 
+// rejecting fails the upload of any file with "bad" in the filename
+type rejecting struct {
+	api.Uploader
+}
+
+func (r *rejecting) Upload(ctx context.Context, file *api.File) (api.Upload, error) {
+	if strings.Contains(file.Filename, "bad") {
+		return nil, errors.New("rejected")
+	}
+	return r.Uploader.Upload(ctx, file)
+}
+
+// rides creates each file in the `/rides` directory and registers the rejecting uploader
+func rides(names ...string) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		gravl.Runtime(c).Uploaders["rejecting"] = func(_ *cli.Context) (api.Uploader, error) {
+			return &rejecting{Uploader: blackhole.NewUploader()}, nil
+		}
+		for _, name := range names {
+			// distinct contents so the ledger does not treat the files as the same activity
+			if err := afero.WriteFile(gravl.Runtime(c).Fs, "/rides/"+name, []byte(name), 0o644); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
 func TestStatus(t *testing.T) {
 	tests := []*internal.Harness{
 		{
@@ -102,6 +163,37 @@ func TestExport(t *testing.T) {
 				"gravl.export.success": 1,
 			},
 		},
+		{
+			Name: "export with checkpoint",
+			Args: []string{"gravl", "qp", "export", "--from", "blackhole", "--checkpoint", "/backfill.json",
+				"-o", "61292794933", "abc", "61292794934"},
+			Before: func(c *cli.Context) error {
+				gravl.Runtime(c).Exporters[blackhole.Provider] = blackhole.ExporterFunc
+				return nil
+			},
+			Counters: map[string]int{
+				"gravl.export.success":       2,
+				"gravl.checkpoint.completed": 2,
+				"gravl.checkpoint.failed":    1,
+			},
+			Err: "1 of 3 failed, see /backfill.json",
+		},
+		{
+			Name: "export resumed from checkpoint",
+			Args: []string{"gravl", "qp", "export", "--from", "blackhole", "--checkpoint", "/backfill.json",
+				"-o", "61292794933", "61292794934"},
+			Before: func(c *cli.Context) error {
+				gravl.Runtime(c).Exporters[blackhole.Provider] = blackhole.ExporterFunc
+				data := `{"provider":"blackhole","id":"61292794933","completed":"2021-10-01T08:00:00Z"}
+`
+				return afero.WriteFile(gravl.Runtime(c).Fs, "/backfill.json", []byte(data), 0o600)
+			},
+			Counters: map[string]int{
+				"gravl.export.success":       1,
+				"gravl.checkpoint.skipped":   1,
+				"gravl.checkpoint.completed": 1,
+			},
+		},
 	}
 	for _, tt := range tests {
 		tt := tt
@@ -135,12 +227,47 @@ func TestCopy(t *testing.T) {
 	}
 }
 
+func TestCopyFunc(t *testing.T) {
+	tests := []*internal.Harness{
+		{
+			Name: "copy",
+			Args: []string{"gravl", "copy"},
+			Before: func(c *cli.Context) error {
+				gravl.Runtime(c).Uploaders[blackhole.Provider] = blackhole.UploaderFunc
+				gravl.Runtime(c).Exporters[blackhole.Provider] = blackhole.ExporterFunc
+				return nil
+			},
+			Counters: map[string]int{
+				"gravl.upload.file.success": 2,
+			},
+		},
+		{
+			Name: "unknown exporter",
+			Args: []string{"gravl", "copy"},
+			Err:  "unknown exporter",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			internal.Run(t, tt, nil, func(_ *testing.T, _ string) *cli.Command {
+				return &cli.Command{
+					Name: "copy",
+					Action: func(c *cli.Context) error {
+						return qp.Copy(c, blackhole.Provider, blackhole.Provider, 1001, 1002)
+					},
+				}
+			})
+		})
+	}
+}
+
 func TestProviders(t *testing.T) {
 	a := assert.New(t)
 	tests := []*internal.Harness{
 		{
 			Name: "providers",
-			Args: []string{"gravl", "-j", "qp", "providers"},
+			Args: []string{"gravl", "qp", "providers"},
 			Before: func(c *cli.Context) error {
 				c.App.Writer = new(bytes.Buffer)
 				gravl.Runtime(c).Exporters[blackhole.Provider] = blackhole.ExporterFunc
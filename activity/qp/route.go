@@ -0,0 +1,138 @@
+package qp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	api "github.com/bzimmer/activity"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+)
+
+const metricRoute = "route"
+
+func routeExporter(c *cli.Context, name string) (gravl.RouteExporter, error) {
+	if f, ok := gravl.Runtime(c).RouteExporters[name]; ok {
+		return f(c)
+	}
+	return nil, errors.New("unknown route exporter")
+}
+
+func routeImporter(c *cli.Context, name string) (gravl.RouteImporter, error) {
+	if f, ok := gravl.Runtime(c).RouteImporters[name]; ok {
+		return f(c)
+	}
+	return nil, errors.New("unknown route importer")
+}
+
+// courseFormat returns the format of the course file
+func courseFormat(c *cli.Context) (api.Format, error) {
+	format := api.ToFormat(c.String("as"))
+	//nolint:exhaustive // only gpx and tcx are supported
+	switch format {
+	case api.FormatGPX, api.FormatTCX:
+		return format, nil
+	default:
+		return format, fmt.Errorf("unsupported route format '%s', expected one of gpx, tcx", c.String("as"))
+	}
+}
+
+// routes calls `f` with the course file of each route in the arguments
+func routes(c *cli.Context, f func(ctx context.Context, routeID int64, file *api.File) error) error {
+	from := c.String("from")
+	expr, err := routeExporter(c, from)
+	if err != nil {
+		return err
+	}
+	format, err := courseFormat(c)
+	if err != nil {
+		return err
+	}
+	met := gravl.Runtime(c).Metrics
+	for i := 0; i < c.NArg(); i++ {
+		var routeID int64
+		routeID, err = strconv.ParseInt(c.Args().Get(i), 10, 64)
+		if err != nil {
+			return err
+		}
+		err = func() error {
+			ctx, cancel := context.WithTimeout(c.Context, c.Duration("timeout"))
+			defer cancel()
+			file, exportErr := expr.ExportRoute(ctx, routeID, format)
+			if exportErr != nil {
+				return exportErr
+			}
+			defer file.Close()
+			met.IncrCounter([]string{metricRoute, "export", metricSuccess}, 1)
+			log.Info().Str("from", from).Int64("id", routeID).Str("file", file.Filename).Msg("export")
+			return f(ctx, routeID, file)
+		}()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func routeExport(c *cli.Context) error {
+	return routes(c, func(_ context.Context, routeID int64, file *api.File) error {
+		return write(c, &api.Export{File: file, ID: routeID})
+	})
+}
+
+func routeCopy(c *cli.Context) error {
+	to := c.String("to")
+	imp, err := routeImporter(c, to)
+	if err != nil {
+		return err
+	}
+	enc := gravl.Runtime(c).Encoder
+	met := gravl.Runtime(c).Metrics
+	return routes(c, func(ctx context.Context, routeID int64, file *api.File) error {
+		ref, err := imp.ImportRoute(ctx, file)
+		if err != nil {
+			return err
+		}
+		met.IncrCounter([]string{metricRoute, "import", metricSuccess}, 1)
+		log.Info().Str("to", to).Int64("from", routeID).Str("id", ref.ID).Str("name", ref.Name).Msg("import")
+		return enc.Encode(ref)
+	})
+}
+
+func routeFlags(c cfg) []cli.Flag {
+	return append(flags(c), &cli.StringFlag{
+		Name:  "as",
+		Value: api.FormatGPX.String(),
+		Usage: "Format of the course file (gpx, tcx)",
+	})
+}
+
+func routeCommand() *cli.Command {
+	return &cli.Command{
+		Name:        metricRoute,
+		Usage:       "Manage the flow of planned routes between different platforms",
+		Description: "Export planned routes as course files and copy them between platforms",
+		Subcommands: []*cli.Command{
+			{
+				Name:        "export",
+				Usage:       "Export a route from the source",
+				Description: "Export one or more routes from the source as GPX or TCX course files",
+				ArgsUsage:   "--from <route exporter> id [id, ...]",
+				Flags:       routeFlags(cfg{from: true, io: true}),
+				Action:      routeExport,
+			},
+			{
+				Name:        "copy",
+				Usage:       "Copy a route from a source to a destination",
+				Description: "Copy one or more routes from the source to the destination as GPX or TCX course files",
+				ArgsUsage:   "--from <route exporter> --to <route importer> id [id, ...]",
+				Flags:       routeFlags(cfg{from: true, to: true}),
+				Action:      routeCopy,
+			},
+		},
+	}
+}
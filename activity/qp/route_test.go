@@ -0,0 +1,84 @@
+package qp_test
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/internal"
+	"github.com/bzimmer/gravl/internal/blackhole"
+)
+
+func TestRoute(t *testing.T) {
+	a := assert.New(t)
+	providers := func(c *cli.Context) error {
+		gravl.Runtime(c).RouteExporters[blackhole.Provider] = blackhole.RouteExporterFunc
+		gravl.Runtime(c).RouteImporters[blackhole.Provider] = blackhole.RouteImporterFunc
+		return nil
+	}
+	tests := []*internal.Harness{
+		{
+			Name:   "export",
+			Args:   []string{"gravl", "qp", "route", "export", "--from", "blackhole", "2987654"},
+			Before: providers,
+			Counters: map[string]int{
+				"gravl.route.export.success": 1,
+			},
+		},
+		{
+			Name:   "export tcx to a file",
+			Args:   []string{"gravl", "qp", "route", "export", "--from", "blackhole", "--as", "tcx", "-O", "/routes/bar.tcx", "2987654"},
+			Before: providers,
+			Counters: map[string]int{
+				"gravl.route.export.success": 1,
+			},
+			After: func(c *cli.Context) error {
+				data, err := afero.ReadFile(gravl.Runtime(c).Fs, "/routes/bar.tcx")
+				a.NoError(err)
+				a.Equal(blackhole.Data, string(data))
+				return nil
+			},
+		},
+		{
+			Name:   "export unsupported format",
+			Args:   []string{"gravl", "qp", "route", "export", "--from", "blackhole", "--as", "fit", "2987654"},
+			Before: providers,
+			Err:    "unsupported route format 'fit', expected one of gpx, tcx",
+		},
+		{
+			Name: "unknown route exporter",
+			Args: []string{"gravl", "qp", "route", "export", "--from", "nowhere", "2987654"},
+			Err:  "unknown route exporter",
+		},
+		{
+			Name:   "copy",
+			Args:   []string{"gravl", "qp", "route", "copy", "--from", "blackhole", "--to", "blackhole", "2987654", "3344556"},
+			Before: providers,
+			Counters: map[string]int{
+				"gravl.route.export.success": 2,
+				"gravl.route.import.success": 2,
+			},
+		},
+		{
+			Name:   "copy invalid id",
+			Args:   []string{"gravl", "qp", "route", "copy", "--from", "blackhole", "--to", "blackhole", "abc"},
+			Before: providers,
+			Err:    "invalid syntax",
+		},
+		{
+			Name:   "unknown route importer",
+			Args:   []string{"gravl", "qp", "route", "copy", "--from", "blackhole", "--to", "nowhere", "2987654"},
+			Before: providers,
+			Err:    "unknown route importer",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			internal.Run(t, tt, nil, command)
+		})
+	}
+}
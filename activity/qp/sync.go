@@ -0,0 +1,183 @@
+package qp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	api "github.com/bzimmer/activity"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/activity"
+)
+
+const metricSync = "sync"
+
+func lister(c *cli.Context, name string) (gravl.Lister, error) {
+	if f, ok := gravl.Runtime(c).Listers[name]; ok {
+		return f(c)
+	}
+	return nil, errors.New("unknown lister")
+}
+
+// archive exports the activity to the provider's directory in the archive
+func archive(ctx context.Context, fs afero.Fs, expr api.Exporter, dir, provider string, id int64) (*entry, error) {
+	exp, err := expr.Export(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if exp == nil || exp.File == nil || exp.Reader == nil {
+		return nil, fmt.Errorf("empty export for activity %d", id)
+	}
+	defer exp.Close()
+	name := exp.Filename
+	if name == "" {
+		name = exp.Name
+	}
+	// without a name the activity id alone names the file
+	base := fmt.Sprintf("%d.%s", id, exp.Format)
+	if name != "" {
+		base = fmt.Sprintf("%d-%s", id, filepath.Base(name))
+	}
+	filename := filepath.Join(provider, base)
+	// write to a temporary file so a failed export does not leave a partial file in the archive
+	path := filepath.Join(dir, filename)
+	tmp := path + ".tmp"
+	fp, err := fs.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(fp, hash), exp)
+	if err = errors.Join(err, fp.Close()); err != nil {
+		return nil, errors.Join(err, fs.Remove(tmp))
+	}
+	if err = fs.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+	return &entry{
+		Provider: provider,
+		ID:       id,
+		Filename: filename,
+		Format:   exp.Format.String(),
+		Hash:     hex.EncodeToString(hash.Sum(nil)),
+		Exported: time.Now().UTC(),
+	}, nil
+}
+
+func synchronize(c *cli.Context) error {
+	from, dir := c.String("from"), c.String("to-dir")
+	lst, err := lister(c, from)
+	if err != nil {
+		return err
+	}
+	expr, err := exporter(c, from)
+	if err != nil {
+		return err
+	}
+	before, after, err := activity.DateRange(c, activity.NaturalParse, activity.AraddonParse)
+	if err != nil {
+		return err
+	}
+	fs := gravl.Runtime(c).Fs
+	if err = fs.MkdirAll(filepath.Join(dir, from), 0o755); err != nil {
+		return err
+	}
+	man, err := loadManifest(fs, dir)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context, c.Duration("timeout"))
+	defer cancel()
+	refs, err := lst.List(ctx, c.Int("count"), before, after)
+	if err != nil {
+		return err
+	}
+	// the manifest is saved even if the sync fails so the activities archived are not exported again
+	err = archiveAll(c, expr, man, dir, from, refs)
+	return errors.Join(err, man.save())
+}
+
+// archiveAll archives the activities not in the manifest, a failed export does not stop the
+// remaining activities from being archived
+func archiveAll(c *cli.Context, expr api.Exporter, man *manifest, dir, from string, refs []*gravl.ActivityRef) error {
+	var failures []error
+	enc := gravl.Runtime(c).Encoder
+	met := gravl.Runtime(c).Metrics
+	for _, ref := range refs {
+		if man.contains(from, ref.ID) {
+			met.IncrCounter([]string{metricSync, "skipped"}, 1)
+			log.Debug().Int64("id", ref.ID).Str("provider", from).Msg("already archived")
+			continue
+		}
+		log.Info().Int64("id", ref.ID).Str("name", ref.Name).Time("start", ref.Start).Msg(c.Command.Name)
+		ent, err := archiveWithTimeout(c, expr, dir, from, ref.ID)
+		if err != nil {
+			if c.Context.Err() != nil {
+				// interrupted, the activity is exported again on the next run
+				return err
+			}
+			met.IncrCounter([]string{metricSync, "export", "failed"}, 1)
+			log.Error().Err(err).Int64("id", ref.ID).Str("provider", from).Msg(c.Command.Name)
+			failures = append(failures, fmt.Errorf("activity %d: %w", ref.ID, err))
+			continue
+		}
+		if err = man.add(ent); err != nil {
+			return err
+		}
+		met.IncrCounter([]string{metricSync, "export", metricSuccess}, 1)
+		if err = enc.Encode(ent); err != nil {
+			return err
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return fmt.Errorf("failed to export %d activities: %w", len(failures), errors.Join(failures...))
+}
+
+func archiveWithTimeout(c *cli.Context, expr api.Exporter, dir, provider string, id int64) (*entry, error) {
+	ctx, cancel := context.WithTimeout(c.Context, c.Duration("timeout"))
+	defer cancel()
+	return archive(ctx, gravl.Runtime(c).Fs, expr, dir, provider, id)
+}
+
+func syncFlags() []cli.Flag {
+	x := flags(cfg{from: true})
+	x = append(x,
+		&cli.StringFlag{
+			Name:     "to-dir",
+			Usage:    "Directory of the local archive",
+			Required: true,
+		},
+		&cli.IntFlag{
+			Name:    "count",
+			Aliases: []string{"N"},
+			Value:   0,
+			Usage:   "The number of activities to query from the source (all if zero)",
+		})
+	return append(x, activity.DateRangeFlags()...)
+}
+
+func syncCommand() *cli.Command {
+	return &cli.Command{
+		Name:  metricSync,
+		Usage: "Mirror activities from a source to a local archive",
+		Description: "Export all activities from the source not already recorded in the archive manifest, " +
+			"recording the provider, activity id, file hash, format, and time of export for each. A failed export " +
+			"does not stop the sync, the activities archived are recorded and the failures reported once all " +
+			"activities are attempted",
+		ArgsUsage: "--from <exporter> --to-dir <directory>",
+		Flags:     syncFlags(),
+		Action:    synchronize,
+	}
+}
@@ -0,0 +1,241 @@
+package qp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	api "github.com/bzimmer/activity"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/internal"
+	"github.com/bzimmer/gravl/internal/blackhole"
+)
+
+type manifest struct {
+	Entries []struct {
+		Provider string `json:"provider"`
+		ID       int64  `json:"id"`
+		Filename string `json:"filename"`
+		Format   string `json:"format"`
+		Hash     string `json:"sha256"`
+	} `json:"entries"`
+}
+
+func readManifest(t *testing.T, c *cli.Context, path string) *manifest {
+	a := assert.New(t)
+	data, err := afero.ReadFile(gravl.Runtime(c).Fs, path)
+	a.NoError(err)
+	var m manifest
+	a.NoError(json.Unmarshal(data, &m))
+	return &m
+}
+
+type failing struct{}
+
+func (failing) Read(_ []byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+// failingExporter fails to export the activity `id` or all activities if zero
+type failingExporter struct {
+	id int64
+}
+
+func (x failingExporter) Export(_ context.Context, id int64) (*api.Export, error) {
+	var reader io.Reader = strings.NewReader(blackhole.Data)
+	if x.id == 0 || x.id == id {
+		reader = failing{}
+	}
+	return &api.Export{
+		ID:   id,
+		File: &api.File{Format: api.FormatGPX, Name: "Foo", Filename: "Foo.gpx", Reader: reader},
+	}, nil
+}
+
+// unnamedExporter exports activities without a name or filename
+type unnamedExporter struct{}
+
+func (unnamedExporter) Export(_ context.Context, id int64) (*api.Export, error) {
+	return &api.Export{
+		ID:   id,
+		File: &api.File{Format: api.FormatFIT, Reader: strings.NewReader(blackhole.Data)},
+	}, nil
+}
+
+func TestSync(t *testing.T) {
+	a := assert.New(t)
+	providers := func(c *cli.Context) error {
+		gravl.Runtime(c).Listers[blackhole.Provider] = blackhole.ListerFunc
+		gravl.Runtime(c).Exporters[blackhole.Provider] = blackhole.ExporterFunc
+		return nil
+	}
+	tests := []*internal.Harness{
+		{
+			Name:   "sync all",
+			Args:   []string{"gravl", "qp", "sync", "--from", "blackhole", "--to-dir", "/archive"},
+			Before: providers,
+			Counters: map[string]int{
+				"gravl.sync.export.success": blackhole.Activities,
+			},
+			After: func(c *cli.Context) error {
+				m := readManifest(t, c, "/archive/manifest.json")
+				a.Len(m.Entries, blackhole.Activities)
+				for _, e := range m.Entries {
+					a.Equal(blackhole.Provider, e.Provider)
+					a.Equal("gpx", e.Format)
+					a.NotEmpty(e.Hash)
+					data, err := afero.ReadFile(gravl.Runtime(c).Fs, "/archive/"+e.Filename)
+					a.NoError(err)
+					a.Equal(blackhole.Data, string(data))
+				}
+				a.Equal(m.Entries[0].Hash, m.Entries[1].Hash)
+				return nil
+			},
+		},
+		{
+			Name: "sync skips archived",
+			Args: []string{"gravl", "qp", "sync", "--from", "blackhole", "--to-dir", "/archive"},
+			Before: gravl.Befores(providers, func(c *cli.Context) error {
+				fs := gravl.Runtime(c).Fs
+				a.NoError(fs.MkdirAll("/archive", 0o755))
+				return afero.WriteFile(fs, "/archive/manifest.json",
+					[]byte(`{"entries":[{"provider":"blackhole","id":1001,"filename":"blackhole/1001-Foo.gpx"}]}`), 0o644)
+			}),
+			Counters: map[string]int{
+				"gravl.sync.skipped":        1,
+				"gravl.sync.export.success": blackhole.Activities - 1,
+			},
+			After: func(c *cli.Context) error {
+				m := readManifest(t, c, "/archive/manifest.json")
+				a.Len(m.Entries, blackhole.Activities)
+				return nil
+			},
+		},
+		{
+			Name:   "sync with count",
+			Args:   []string{"gravl", "qp", "sync", "--from", "blackhole", "--to-dir", "/archive", "-N", "1"},
+			Before: providers,
+			Counters: map[string]int{
+				"gravl.sync.export.success": 1,
+			},
+		},
+		{
+			Name:   "sync before",
+			Args:   []string{"gravl", "qp", "sync", "--from", "blackhole", "--to-dir", "/archive", "--before", "2021-10-02"},
+			Before: providers,
+			Counters: map[string]int{
+				"gravl.sync.export.success": 1,
+			},
+			After: func(c *cli.Context) error {
+				m := readManifest(t, c, "/archive/manifest.json")
+				a.Len(m.Entries, 1)
+				a.Equal(int64(1000), m.Entries[0].ID)
+				return nil
+			},
+		},
+		{
+			Name: "failed export",
+			Args: []string{"gravl", "qp", "sync", "--from", "blackhole", "--to-dir", "/archive"},
+			Err:  "connection reset",
+			Before: func(c *cli.Context) error {
+				gravl.Runtime(c).Listers[blackhole.Provider] = blackhole.ListerFunc
+				gravl.Runtime(c).Exporters[blackhole.Provider] = func(*cli.Context) (api.Exporter, error) {
+					return failingExporter{}, nil
+				}
+				return nil
+			},
+			After: func(c *cli.Context) error {
+				files, err := afero.ReadDir(gravl.Runtime(c).Fs, "/archive/blackhole")
+				a.NoError(err)
+				a.Empty(files)
+				return nil
+			},
+		},
+		{
+			Name: "sync before with count",
+			Args: []string{"gravl", "qp", "sync", "--from", "blackhole", "--to-dir", "/archive",
+				"--before", "2021-10-03", "-N", "2"},
+			Before: providers,
+			Counters: map[string]int{
+				"gravl.sync.export.success": 2,
+			},
+			After: func(c *cli.Context) error {
+				m := readManifest(t, c, "/archive/manifest.json")
+				a.Len(m.Entries, 2)
+				return nil
+			},
+		},
+		{
+			Name: "failed export records progress",
+			Args: []string{"gravl", "qp", "sync", "--from", "blackhole", "--to-dir", "/archive"},
+			Err:  "failed to export 1 activities",
+			Before: func(c *cli.Context) error {
+				gravl.Runtime(c).Listers[blackhole.Provider] = blackhole.ListerFunc
+				gravl.Runtime(c).Exporters[blackhole.Provider] = func(*cli.Context) (api.Exporter, error) {
+					return failingExporter{id: 1001}, nil
+				}
+				return nil
+			},
+			Counters: map[string]int{
+				"gravl.sync.export.failed":  1,
+				"gravl.sync.export.success": blackhole.Activities - 1,
+			},
+			After: func(c *cli.Context) error {
+				m := readManifest(t, c, "/archive/manifest.json")
+				a.Len(m.Entries, blackhole.Activities-1)
+				for _, e := range m.Entries {
+					a.NotEqual(int64(1001), e.ID)
+				}
+				return nil
+			},
+		},
+		{
+			Name: "unnamed export",
+			Args: []string{"gravl", "qp", "sync", "--from", "blackhole", "--to-dir", "/archive", "-N", "1"},
+			Before: func(c *cli.Context) error {
+				gravl.Runtime(c).Listers[blackhole.Provider] = blackhole.ListerFunc
+				gravl.Runtime(c).Exporters[blackhole.Provider] = func(*cli.Context) (api.Exporter, error) {
+					return unnamedExporter{}, nil
+				}
+				return nil
+			},
+			After: func(c *cli.Context) error {
+				m := readManifest(t, c, "/archive/manifest.json")
+				a.Len(m.Entries, 1)
+				a.Equal("blackhole/1000.fit", m.Entries[0].Filename)
+				return nil
+			},
+		},
+		{
+			Name: "invalid manifest",
+			Args: []string{"gravl", "qp", "sync", "--from", "blackhole", "--to-dir", "/archive"},
+			Err:  "invalid manifest",
+			Before: gravl.Befores(providers, func(c *cli.Context) error {
+				return afero.WriteFile(gravl.Runtime(c).Fs, "/archive/manifest.json", []byte("not json"), 0o644)
+			}),
+		},
+		{
+			Name: "unknown lister",
+			Args: []string{"gravl", "qp", "sync", "--from", "nowhere", "--to-dir", "/archive"},
+			Err:  "unknown lister",
+		},
+		{
+			Name: "missing directory",
+			Args: []string{"gravl", "qp", "sync", "--from", "blackhole"},
+			Err:  `Required flag "to-dir" not set`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			internal.Run(t, tt, nil, command)
+		})
+	}
+}
@@ -0,0 +1,334 @@
+package qp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	api "github.com/bzimmer/activity"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl/track"
+)
+
+// Transformer rewrites the contents of an activity file before it is uploaded
+type Transformer interface {
+	Transform(file *api.File) (*api.File, error)
+}
+
+// TransformerFunc adapts a function to the Transformer interface
+type TransformerFunc func(file *api.File) (*api.File, error)
+
+func (f TransformerFunc) Transform(file *api.File) (*api.File, error) {
+	return f(file)
+}
+
+// rewrite decodes the file, applies the function to the track, and encodes the track in the file's format;
+// only the points and summary of the track are encoded so the laps and events of a FIT file are not preserved
+func rewrite(file *api.File, f func(trk *track.Track) error) (*api.File, error) {
+	trk, err := track.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+	if err = f(trk); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err = track.Encode(&buf, trk, trk.Format); err != nil {
+		return nil, err
+	}
+	return &api.File{
+		Reader:   &buf,
+		Name:     file.Name,
+		Filename: file.Filename,
+		Format:   api.ToFormat("." + string(trk.Format)),
+	}, nil
+}
+
+// drop removes all points for which the predicate returns true
+func drop(trk *track.Track, f func(pt *track.Point) bool) {
+	points := trk.Points[:0]
+	for _, pt := range trk.Points {
+		if !f(pt) {
+			points = append(points, pt)
+		}
+	}
+	trk.Points = points
+	// the ascent reported by the device included the dropped points
+	trk.Ascent = 0
+}
+
+// StripHR removes all heart rate data from the file
+func StripHR() Transformer {
+	return TransformerFunc(func(file *api.File) (*api.File, error) {
+		return rewrite(file, func(trk *track.Track) error {
+			for _, pt := range trk.Points {
+				pt.HeartRate, pt.Channels = 0, pt.Channels&^track.ChannelHeartRate
+			}
+			return nil
+		})
+	})
+}
+
+// Zone is a circular region described by a center and a radius in meters
+type Zone struct {
+	Lat, Lng, Radius float64
+}
+
+// PrivacyZone removes all points within the zone
+func PrivacyZone(zone Zone) Transformer {
+	return TransformerFunc(func(file *api.File) (*api.File, error) {
+		return rewrite(file, func(trk *track.Track) error {
+			drop(trk, func(pt *track.Point) bool {
+				return pt.Has(track.ChannelPosition) && track.Haversine(zone.Lat, zone.Lng, pt.Lat, pt.Lng) <= zone.Radius
+			})
+			return nil
+		})
+	})
+}
+
+// TrimStart removes all points recorded within the duration of the first point
+func TrimStart(d time.Duration) Transformer {
+	return TransformerFunc(func(file *api.File) (*api.File, error) {
+		return rewrite(file, func(trk *track.Track) error {
+			start := trk.Summarize().Start.Add(d)
+			drop(trk, func(pt *track.Point) bool {
+				return !pt.Time.IsZero() && pt.Time.Before(start)
+			})
+			return nil
+		})
+	})
+}
+
+// TrimEnd removes all points recorded within the duration of the last point
+func TrimEnd(d time.Duration) Transformer {
+	return TransformerFunc(func(file *api.File) (*api.File, error) {
+		return rewrite(file, func(trk *track.Track) error {
+			s := trk.Summarize()
+			end := s.Start.Add(time.Duration(s.Duration*float64(time.Second)) - d)
+			drop(trk, func(pt *track.Point) bool {
+				return !pt.Time.IsZero() && pt.Time.After(end)
+			})
+			return nil
+		})
+	})
+}
+
+// Rename sets the name of the activity using the template
+//
+// The template has access to `.Name` (the current name), `.Filename`, `.Format`,
+// `.Start` (the time of the first point), and `.Date` (`.Start` as YYYY-MM-DD).
+// FIT files have no name so only the name given to the uploader changes.
+func Rename(tmpl *template.Template) Transformer {
+	return TransformerFunc(func(file *api.File) (*api.File, error) {
+		contents, err := io.ReadAll(file)
+		if err != nil {
+			return nil, err
+		}
+		trk, err := track.Decode(bytes.NewReader(contents))
+		if err != nil {
+			return nil, err
+		}
+		data := struct {
+			Name, Filename, Format, Date string
+			Start                        time.Time
+		}{Name: file.Name, Filename: file.Filename, Format: string(trk.Format), Start: trk.Summarize().Start}
+		if !data.Start.IsZero() {
+			data.Date = data.Start.Format(time.DateOnly)
+		}
+		var name strings.Builder
+		if err = tmpl.Execute(&name, data); err != nil {
+			return nil, err
+		}
+		res := &api.File{
+			Reader:   bytes.NewReader(contents),
+			Name:     name.String(),
+			Filename: file.Filename,
+			Format:   api.ToFormat("." + string(trk.Format)),
+		}
+		if trk.Format == track.FormatFIT {
+			return res, nil
+		}
+		trk.Name = res.Name
+		var buf bytes.Buffer
+		if err = track.Encode(&buf, trk, trk.Format); err != nil {
+			return nil, err
+		}
+		res.Reader = &buf
+		return res, nil
+	})
+}
+
+// Convert encodes the file in the format, files already in the format are unchanged
+func Convert(format track.Format) Transformer {
+	return TransformerFunc(func(file *api.File) (*api.File, error) {
+		contents, err := io.ReadAll(file)
+		if err != nil {
+			return nil, err
+		}
+		trk, err := track.Decode(bytes.NewReader(contents))
+		if err != nil {
+			return nil, err
+		}
+		if trk.Format == format {
+			return &api.File{
+				Reader:   bytes.NewReader(contents),
+				Name:     file.Name,
+				Filename: file.Filename,
+				Format:   file.Format,
+			}, nil
+		}
+		var buf bytes.Buffer
+		if err = track.Encode(&buf, trk, format); err != nil {
+			return nil, err
+		}
+		ext := "." + string(format)
+		return &api.File{
+			Reader:   &buf,
+			Name:     strings.TrimSuffix(file.Name, filepath.Ext(file.Name)) + ext,
+			Filename: strings.TrimSuffix(file.Filename, filepath.Ext(file.Filename)) + ext,
+			Format:   api.ToFormat(ext),
+		}, nil
+	})
+}
+
+func parseZone(spec string) (Zone, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 3 {
+		return Zone{}, fmt.Errorf("invalid zone '%s', expected LAT:LNG:RADIUS", spec)
+	}
+	var vals [3]float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return Zone{}, fmt.Errorf("invalid zone '%s': %w", spec, err)
+		}
+		vals[i] = v
+	}
+	return Zone{Lat: vals[0], Lng: vals[1], Radius: vals[2]}, nil
+}
+
+// zones parses the named zones from the `zone` flag
+func zones(c *cli.Context) (map[string]Zone, error) {
+	res := make(map[string]Zone)
+	for _, spec := range c.StringSlice("zone") {
+		name, val, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid zone '%s', expected NAME=LAT:LNG:RADIUS", spec)
+		}
+		zone, err := parseZone(val)
+		if err != nil {
+			return nil, err
+		}
+		res[name] = zone
+	}
+	return res, nil
+}
+
+// newTransformer creates a transformer from its specification, eg `trim-start=2m`
+func newTransformer(spec string, named map[string]Zone) (Transformer, error) {
+	name, arg, _ := strings.Cut(spec, "=")
+	switch name {
+	case "strip-hr":
+		return StripHR(), nil
+	case "privacy-zone":
+		if zone, ok := named[arg]; ok {
+			return PrivacyZone(zone), nil
+		}
+		zone, err := parseZone(arg)
+		if err != nil {
+			return nil, err
+		}
+		return PrivacyZone(zone), nil
+	case "trim-start", "trim-end":
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			return nil, err
+		}
+		if name == "trim-start" {
+			return TrimStart(d), nil
+		}
+		return TrimEnd(d), nil
+	case "rename":
+		tmpl, err := template.New(name).Parse(arg)
+		if err != nil {
+			return nil, err
+		}
+		return Rename(tmpl), nil
+	}
+	return nil, fmt.Errorf("unknown transform '%s'", name)
+}
+
+// repeated collects the transforms of each use of a flag, unlike a string slice flag a comma within a
+// `rename` template does not separate transforms
+type repeated []string
+
+func (r *repeated) Set(value string) error {
+	for _, spec := range strings.Split(value, ",") {
+		name, _, _ := strings.Cut(strings.TrimSpace(spec), "=")
+		if n := len(*r); n > 0 && !transformName(name) && strings.HasPrefix((*r)[n-1], "rename=") {
+			(*r)[n-1] += "," + spec
+			continue
+		}
+		*r = append(*r, strings.TrimSpace(spec))
+	}
+	return nil
+}
+
+// transformName returns true if the name is a transform
+func transformName(name string) bool {
+	switch name {
+	case "strip-hr", "privacy-zone", "trim-start", "trim-end", "rename":
+		return true
+	}
+	return false
+}
+
+func (r *repeated) String() string {
+	return strings.Join(*r, " ")
+}
+
+// transformers creates the pipeline of transformers specified by the `transform` flag,
+// preceded by a conversion if the `as` flag is set
+func transformers(c *cli.Context) ([]Transformer, error) {
+	named, err := zones(c)
+	if err != nil {
+		return nil, err
+	}
+	var res []Transformer
+	if c.IsSet("as") {
+		var format track.Format
+		if format, err = track.ToFormat(c.String("as")); err != nil {
+			return nil, err
+		}
+		res = append(res, Convert(format))
+	}
+	var specs []string
+	if x, ok := c.Generic("transform").(*repeated); ok {
+		specs = *x
+	}
+	for _, spec := range specs {
+		var t Transformer
+		if t, err = newTransformer(spec, named); err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+// transform applies the pipeline of transformers to the file
+func transform(file *api.File, pipeline []Transformer) (*api.File, error) {
+	var err error
+	for _, t := range pipeline {
+		if file, err = t.Transform(file); err != nil {
+			return nil, err
+		}
+	}
+	return file, nil
+}
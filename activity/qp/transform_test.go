@@ -0,0 +1,307 @@
+package qp_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/bzimmer/activity"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/internal"
+	"github.com/bzimmer/gravl/track"
+)
+
+const gpx = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx xmlns="http://www.topografix.com/GPX/1/1" xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1">
+ <trk>
+  <name>Morning Ride</name>
+  <trkseg>
+   <trkpt lat="47.6000" lon="-122.3000"><time>2021-10-01T08:00:00Z</time>` +
+	`<extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>101</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions></trkpt>
+   <trkpt lat="47.6001" lon="-122.3001"><time>2021-10-01T08:00:30Z</time>` +
+	`<extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>102</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions></trkpt>
+   <trkpt lat="47.7000" lon="-122.4000"><time>2021-10-01T08:01:00Z</time>` +
+	`<extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>103</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions></trkpt>
+   <trkpt lat="47.8000" lon="-122.5000"><time>2021-10-01T08:01:30Z</time>` +
+	`<extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>104</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions></trkpt>
+  </trkseg>
+ </trk>
+</gpx>`
+
+const tcx = `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2">
+ <Activities><Activity Sport="Biking"><Id>2021-10-01T08:00:00Z</Id><Lap StartTime="2021-10-01T08:00:00Z">
+  <Track>
+   <Trackpoint><Time>2021-10-01T08:00:00Z</Time><Position><LatitudeDegrees>47.6</LatitudeDegrees>` +
+	`<LongitudeDegrees>-122.3</LongitudeDegrees></Position><HeartRateBpm><Value>101</Value></HeartRateBpm></Trackpoint>
+   <Trackpoint><Time>2021-10-01T08:01:00Z</Time><Position><LatitudeDegrees>47.7</LatitudeDegrees>` +
+	`<LongitudeDegrees>-122.4</LongitudeDegrees></Position><HeartRateBpm><Value>102</Value></HeartRateBpm></Trackpoint>
+  </Track>
+ </Lap></Activity></Activities>
+</TrainingCenterDatabase>`
+
+// fit returns a FIT file of a two minute ride with heart rate
+func fit(t *testing.T) string {
+	return ride(t, 5)
+}
+
+// ride returns a FIT file of a ride with heart rate of n points thirty seconds apart
+func ride(t *testing.T, n int) string {
+	start := time.Date(2021, time.October, 1, 8, 0, 0, 0, time.UTC)
+	trk := &track.Track{Format: track.FormatFIT}
+	for i := range n {
+		trk.Points = append(trk.Points, &track.Point{
+			Time:      start.Add(time.Duration(i*30) * time.Second),
+			Lat:       47.6 + float64(i)/100,
+			Lng:       -122.3,
+			HeartRate: float64(100 + i),
+			Channels:  track.ChannelPosition | track.ChannelHeartRate,
+		})
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, track.EncodeFIT(&buf, trk))
+	return buf.String()
+}
+
+// decode the uploaded contents
+func decode(t *testing.T, contents string) *track.Track {
+	trk, err := track.Decode(strings.NewReader(contents))
+	assert.NoError(t, err)
+	return trk
+}
+
+type captured struct{}
+
+func (u *captured) Identifier() api.UploadID { return 1 }
+
+func (u *captured) Done() bool { return true }
+
+// capture records the name and contents of uploaded files
+type capture struct {
+	names    []string
+	contents []string
+}
+
+func (c *capture) Upload(_ context.Context, file *api.File) (api.Upload, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	c.names = append(c.names, file.Name)
+	c.contents = append(c.contents, string(data))
+	return &captured{}, nil
+}
+
+func (c *capture) Status(_ context.Context, _ api.UploadID) (api.Upload, error) {
+	return &captured{}, nil
+}
+
+func TestTransform(t *testing.T) {
+	a := assert.New(t)
+	setup := func(cpt *capture, filename, contents string) cli.BeforeFunc {
+		return func(c *cli.Context) error {
+			gravl.Runtime(c).Uploaders["capture"] = func(_ *cli.Context) (api.Uploader, error) {
+				return cpt, nil
+			}
+			fs := gravl.Runtime(c).Fs
+			a.NoError(fs.MkdirAll("/rides", 0o755))
+			return afero.WriteFile(fs, "/rides/"+filename, []byte(contents), 0o644)
+		}
+	}
+	args := func(transforms ...string) []string {
+		x := []string{"gravl", "qp", "upload", "--ledger", "/ledger.json", "--to", "capture"}
+		for _, t := range transforms {
+			x = append(x, "--transform", t)
+		}
+		return append(x, "/rides/")
+	}
+	tests := []struct {
+		name, filename, contents, err string
+		transforms                    []string
+		extra                         []string
+		expect                        func(cpt *capture)
+	}{
+		{
+			name:     "strip-hr gpx",
+			filename: "ride.gpx", contents: gpx,
+			transforms: []string{"strip-hr"},
+			expect: func(cpt *capture) {
+				a.NotContains(cpt.contents[0], "hr>")
+				a.Equal(4, strings.Count(cpt.contents[0], "<trkpt"))
+			},
+		},
+		{
+			name:     "strip-hr tcx",
+			filename: "ride.tcx", contents: tcx,
+			transforms: []string{"strip-hr"},
+			expect: func(cpt *capture) {
+				a.NotContains(cpt.contents[0], "HeartRateBpm")
+				a.Equal(2, strings.Count(cpt.contents[0], "<Trackpoint>"))
+			},
+		},
+		{
+			name:     "privacy-zone inline",
+			filename: "ride.gpx", contents: gpx,
+			transforms: []string{"privacy-zone=47.6:-122.3:100"},
+			expect: func(cpt *capture) {
+				a.Equal(2, strings.Count(cpt.contents[0], "<trkpt"))
+				a.NotContains(cpt.contents[0], `lat="47.6"`)
+			},
+		},
+		{
+			name:     "privacy-zone named",
+			filename: "ride.tcx", contents: tcx,
+			transforms: []string{"privacy-zone=home"},
+			extra:      []string{"--zone", "home=47.6:-122.3:100"},
+			expect: func(cpt *capture) {
+				a.Equal(1, strings.Count(cpt.contents[0], "<Trackpoint>"))
+			},
+		},
+		{
+			name:     "trim-start and trim-end",
+			filename: "ride.gpx", contents: gpx,
+			transforms: []string{"trim-start=1m", "trim-end=10s"},
+			expect: func(cpt *capture) {
+				a.Equal(1, strings.Count(cpt.contents[0], "<trkpt"))
+				a.Contains(cpt.contents[0], "08:01:00Z")
+			},
+		},
+		{
+			name:     "rename gpx",
+			filename: "ride.gpx", contents: gpx,
+			transforms: []string{"rename={{.Date}} {{.Name}}"},
+			expect: func(cpt *capture) {
+				a.Equal("2021-10-01 ride.gpx", cpt.names[0])
+				a.Contains(cpt.contents[0], "<name>2021-10-01 ride.gpx</name>")
+			},
+		},
+		{
+			name:     "rename fit",
+			filename: "ride.fit", contents: fit(t),
+			transforms: []string{"rename=Zwift {{.Name}}"},
+			expect: func(cpt *capture) {
+				a.Equal("Zwift ride.fit", cpt.names[0])
+				a.Equal(fit(t), cpt.contents[0])
+			},
+		},
+		{
+			name:     "rename with a comma",
+			filename: "ride.gpx", contents: gpx,
+			transforms: []string{"rename={{.Date}}, {{.Name}}"},
+			expect: func(cpt *capture) {
+				a.Equal("2021-10-01, ride.gpx", cpt.names[0])
+			},
+		},
+		{
+			name:     "comma separated",
+			filename: "ride.fit", contents: ride(t, 8),
+			transforms: []string{"strip-hr,privacy-zone=home,trim-start=2m,rename={{.Date}} {{.Name}}"},
+			extra:      []string{"--zone", "home=47.6:-122.3:100"},
+			expect: func(cpt *capture) {
+				a.Equal("2021-10-01 ride.fit", cpt.names[0])
+				trk := decode(t, cpt.contents[0])
+				a.Len(trk.Points, 3)
+				a.Zero(trk.Channels() & track.ChannelHeartRate)
+			},
+		},
+		{
+			name:     "strip-hr fit",
+			filename: "ride.fit", contents: fit(t),
+			transforms: []string{"strip-hr"},
+			expect: func(cpt *capture) {
+				trk := decode(t, cpt.contents[0])
+				a.Equal(track.FormatFIT, trk.Format)
+				a.Len(trk.Points, 5)
+				a.Zero(trk.Channels() & track.ChannelHeartRate)
+			},
+		},
+		{
+			name:     "privacy-zone and trim fit",
+			filename: "ride.fit", contents: fit(t),
+			transforms: []string{"privacy-zone=47.6:-122.3:100", "trim-end=30s"},
+			expect: func(cpt *capture) {
+				trk := decode(t, cpt.contents[0])
+				a.Len(trk.Points, 3)
+				a.Equal(time.Date(2021, time.October, 1, 8, 0, 30, 0, time.UTC), trk.Points[0].Time)
+			},
+		},
+		{
+			name:     "as tcx",
+			filename: "ride.gpx", contents: gpx,
+			extra: []string{"--as", "tcx"},
+			expect: func(cpt *capture) {
+				a.Equal("ride.tcx", cpt.names[0])
+				a.Equal(4, strings.Count(cpt.contents[0], "<Trackpoint>"))
+			},
+		},
+		{
+			name:     "as gpx then strip-hr",
+			filename: "ride.tcx", contents: tcx,
+			transforms: []string{"strip-hr"},
+			extra:      []string{"--as", "gpx"},
+			expect: func(cpt *capture) {
+				a.Equal("ride.gpx", cpt.names[0])
+				a.Equal(2, strings.Count(cpt.contents[0], "<trkpt"))
+				a.NotContains(cpt.contents[0], "hr>")
+			},
+		},
+		{
+			name:     "as unknown format",
+			filename: "ride.gpx", contents: gpx,
+			extra: []string{"--as", "kml"},
+			err:   "unknown format: 'kml'",
+		},
+		{
+			name:     "strip-hr unknown format",
+			filename: "ride.fit", contents: "not an activity",
+			transforms: []string{"strip-hr"},
+			err:        "unknown format",
+		},
+		{
+			name:     "unknown transform",
+			filename: "ride.gpx", contents: gpx,
+			transforms: []string{"strip-power"},
+			err:        "unknown transform 'strip-power'",
+		},
+		{
+			name:     "invalid zone",
+			filename: "ride.gpx", contents: gpx,
+			transforms: []string{"privacy-zone=work"},
+			err:        "invalid zone 'work'",
+		},
+		{
+			name:     "invalid duration",
+			filename: "ride.gpx", contents: gpx,
+			transforms: []string{"trim-start=two minutes"},
+			err:        "invalid duration",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cpt := &capture{}
+			x := args(tt.transforms...)
+			x = append(x[:len(x)-1], append(tt.extra, x[len(x)-1])...)
+			internal.Run(t, &internal.Harness{
+				Name:   tt.name,
+				Args:   x,
+				Err:    tt.err,
+				Before: setup(cpt, tt.filename, tt.contents),
+				After: func(_ *cli.Context) error {
+					if tt.expect != nil {
+						a.Len(cpt.contents, 1)
+						tt.expect(cpt)
+					}
+					return nil
+				},
+			}, nil, command)
+		})
+	}
+}
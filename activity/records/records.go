@@ -0,0 +1,250 @@
+package records
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/activity"
+	"github.com/bzimmer/gravl/activity/analyze"
+	"github.com/bzimmer/gravl/activity/strava"
+	"github.com/bzimmer/gravl/analysis"
+	"github.com/bzimmer/gravl/track"
+)
+
+// path returns the records file; when empty the OS user config directory is used
+// (e.g. ~/.config/gravl/records.json on Linux)
+func path(c *cli.Context) (string, error) {
+	if path := c.Path("records"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gravl", "records.json"), nil
+}
+
+func read(fs afero.Fs, path string) (*analysis.Records, error) {
+	records := &analysis.Records{Records: make(map[string]*analysis.Record)}
+	data, err := afero.ReadFile(fs, path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return records, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(data, records); err != nil {
+		return nil, fmt.Errorf("invalid records %s: %w", path, err)
+	}
+	return records, nil
+}
+
+func write(fs afero.Fs, path string, records *analysis.Records) error {
+	if err := fs.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	return afero.WriteFile(fs, path, data, 0o600)
+}
+
+// daterange returns the date range of the flags, the range starts at the last update of the
+// records, less the overlap for activities synced after the update, if not specified
+func daterange(c *cli.Context, records *analysis.Records) (time.Time, time.Time, error) {
+	before, after, err := activity.DateRange(c, activity.NaturalParse, activity.AraddonParse)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if before.IsZero() {
+		before = time.Now()
+	}
+	if after.IsZero() && !records.Updated.IsZero() {
+		// rescanning an activity is harmless as a record is replaced only by a better value
+		after = records.Updated.Add(-c.Duration("overlap"))
+	}
+	if after.After(before) {
+		return time.Time{}, time.Time{}, errors.New("invalid date range")
+	}
+	return before, after, nil
+}
+
+// activities returns the activity files started in the date range
+func activities(c *cli.Context, before, after time.Time) ([]*analysis.Activity, error) {
+	met := gravl.Runtime(c).Metrics
+	var res []*analysis.Activity
+	err := analyze.Tracks(c, before, after, func(path string, trk *track.Track, summary *track.Summary) error {
+		met.IncrCounter([]string{c.Command.Name, "file"}, 1)
+		res = append(res, &analysis.Activity{
+			ID:       path,
+			Start:    summary.Start,
+			Distance: summary.Distance,
+			Climbing: summary.ElevationGain,
+			Streams:  analysis.FromTrack(trk),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// candidates returns the records of the activities and segment efforts in the date range
+func candidates(c *cli.Context, before, after time.Time) ([]*analysis.Record, error) {
+	var durations []int
+	for _, d := range c.Int64Slice("durations") {
+		durations = append(durations, int(d))
+	}
+	var distances []float64
+	for _, d := range c.Float64Slice("distances") {
+		distances = append(distances, d*1000)
+	}
+	var acts []*analysis.Activity
+	var err error
+	switch from := c.String("from"); from {
+	case "":
+		acts, err = activities(c, before, after)
+	case strava.Provider:
+		acts, err = strava.Activities(c, before, after, len(durations) > 0, len(distances) > 0)
+	default:
+		return nil, errors.New("unsupported source: " + from)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var res []*analysis.Record
+	for _, act := range acts {
+		res = append(res, analysis.Candidates(act, durations, distances)...)
+	}
+	if segments := c.Int64Slice("segment"); len(segments) > 0 {
+		efforts, err := strava.SegmentRecords(c, segments, before, after)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, efforts...)
+	}
+	return res, nil
+}
+
+func update(c *cli.Context) error {
+	if c.String("from") == "" && c.NArg() == 0 && len(c.Int64Slice("segment")) == 0 {
+		log.Warn().Msg("no args specified; exiting")
+		return nil
+	}
+	rt := gravl.Runtime(c)
+	path, err := path(c)
+	if err != nil {
+		return err
+	}
+	records, err := read(rt.Fs, path)
+	if err != nil {
+		return err
+	}
+	before, after, err := daterange(c, records)
+	if err != nil {
+		return err
+	}
+	log.Info().Time("before", before).Time("after", after).Msg("date range")
+	res, err := candidates(c, before, after)
+	if err != nil {
+		return err
+	}
+	improvements := records.Update(res)
+	records.Updated = before
+	rt.Metrics.IncrCounter([]string{c.Command.Name, "candidate"}, float32(len(res)))
+	if err = write(rt.Fs, path, records); err != nil {
+		return err
+	}
+	for _, x := range improvements {
+		rt.Metrics.IncrCounter([]string{c.Command.Name, "new"}, 1)
+		log.Info().Str("measure", x.Measure).Float64("value", x.Value).Str("activity", x.Activity).Msg("record")
+		if c.Bool("all") {
+			continue
+		}
+		if err = rt.Encoder.Encode(x); err != nil {
+			return err
+		}
+	}
+	if c.Bool("all") {
+		for _, x := range records.Sorted() {
+			if err = rt.Encoder.Encode(x); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func flags() []cli.Flag {
+	x := []cli.Flag{
+		&cli.StringFlag{
+			Name:  "from",
+			Usage: "Source of the activities, either local files if not specified or `strava`",
+		},
+		&cli.PathFlag{
+			Name:  "records",
+			Usage: "Path of the records file (default: ~/.config/gravl/records.json)",
+		},
+		&cli.DurationFlag{
+			Name:  "overlap",
+			Value: time.Hour * 72,
+			Usage: "Rescan the activities started this long before the last run to include those synced after it",
+		},
+		&cli.BoolFlag{
+			Name:  "all",
+			Usage: "Encode all records rather than only the new records",
+		},
+		&cli.Int64SliceFlag{
+			Name:  "durations",
+			Value: cli.NewInt64Slice(5, 60, 300, 1200, 3600),
+			Usage: "Durations in seconds of the best power records",
+		},
+		&cli.Float64SliceFlag{
+			Name:  "distances",
+			Value: cli.NewFloat64Slice(10, 20, 40),
+			Usage: "Distances in kilometers of the fastest time records",
+		},
+		&cli.Int64SliceFlag{
+			Name:  "segment",
+			Usage: "Strava segment id of a best effort record, may be repeated",
+		},
+		&cli.StringFlag{
+			Name:  "filter",
+			Usage: "Expression selecting the Strava activities considered for records, eg '.Type == \"Ride\"'",
+		},
+	}
+	for _, q := range [][]cli.Flag{
+		activity.DateRangeFlags(), strava.AuthFlags(), activity.RateLimitFlags(), activity.RetryFlags(),
+	} {
+		x = append(x, q...)
+	}
+	return x
+}
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:     "records",
+		Category: "activity",
+		Usage:    "Track personal records and report new records",
+		Description: "Scan activities for the best power for each duration, the fastest time for each distance, the " +
+			"longest ride, the most climbing, and, with `--segment`, the best effort on each Strava segment. The " +
+			"records are kept in a file and only new records are reported, each with the record it replaced. The " +
+			"activities are read from FIT, GPX, and TCX files, such as an archive created by `qp sync`, or, with " +
+			"`--from strava`, queried from Strava. Unless `--after` is specified only the activities since the " +
+			"last run, less `--overlap` for those synced late, are scanned.",
+		ArgsUsage: "{FILE | DIRECTORY} ...",
+		Flags:     flags(),
+		Action:    update,
+	}
+}
@@ -0,0 +1,188 @@
+package records_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/activity/records"
+	"github.com/bzimmer/gravl/analysis"
+	"github.com/bzimmer/gravl/internal"
+	"github.com/bzimmer/gravl/track"
+)
+
+const path = "/gravl/records.json"
+
+func command(_ *testing.T, _ string) *cli.Command {
+	return records.Command()
+}
+
+// ride writes a FIT file of a ten minute ride
+func ride(path string) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		start := time.Date(2021, time.October, 1, 8, 0, 0, 0, time.UTC)
+		trk := &track.Track{Format: track.FormatFIT}
+		for i := range 600 {
+			trk.Points = append(trk.Points, &track.Point{
+				Time:      start.Add(time.Duration(i) * time.Second),
+				Power:     float64(150 + i%60),
+				Distance:  float64(i * 20),
+				Elevation: 100 + float64(i)/10,
+				Channels:  track.ChannelPower | track.ChannelDistance | track.ChannelElevation,
+			})
+		}
+		var buf bytes.Buffer
+		if err := track.EncodeFIT(&buf, trk); err != nil {
+			return err
+		}
+		return afero.WriteFile(gravl.Runtime(c).Fs, path, buf.Bytes(), 0o644)
+	}
+}
+
+// existing writes a records file updated before the ride with a longer ride
+func existing(updated time.Time) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		if err := ride("/rides/ride.fit")(c); err != nil {
+			return err
+		}
+		data, err := json.Marshal(&analysis.Records{
+			Updated: updated,
+			Records: map[string]*analysis.Record{
+				"longest":  {Measure: "longest", Value: 100000, Unit: analysis.UnitMeters, Activity: "1"},
+				"power-5s": {Measure: "power-5s", Value: 100, Unit: analysis.UnitWatts, Activity: "1"},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		return afero.WriteFile(gravl.Runtime(c).Fs, path, data, 0o600)
+	}
+}
+
+func read(c *cli.Context) (*analysis.Records, error) {
+	data, err := afero.ReadFile(gravl.Runtime(c).Fs, path)
+	if err != nil {
+		return nil, err
+	}
+	var res analysis.Records
+	if err = json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func TestRecords(t *testing.T) {
+	tests := []*internal.Harness{
+		{
+			Name:   "first run",
+			Args:   []string{"gravl", "records", "--records", path, "/rides"},
+			Before: ride("/rides/ride.fit"),
+			Counters: map[string]int{
+				"gravl.records.file": 1,
+				"gravl.records.new":  6,
+			},
+			After: func(c *cli.Context) error {
+				res, err := read(c)
+				if err != nil {
+					return err
+				}
+				if len(res.Records) != 6 || res.Records["fastest-10km"].Value != 500 {
+					return errors.New("unexpected records")
+				}
+				if res.Updated.IsZero() {
+					return errors.New("expected records to be updated")
+				}
+				return nil
+			},
+		},
+		{
+			Name:   "improved records",
+			Args:   []string{"gravl", "records", "--records", path, "--all", "/rides"},
+			Before: existing(time.Date(2021, time.September, 1, 0, 0, 0, 0, time.UTC)),
+			Counters: map[string]int{
+				"gravl.records.file": 1,
+				"gravl.records.new":  5,
+			},
+			After: func(c *cli.Context) error {
+				res, err := read(c)
+				if err != nil {
+					return err
+				}
+				if res.Records["longest"].Activity != "1" || res.Records["power-5s"].Activity != "/rides/ride.fit" {
+					return errors.New("unexpected records")
+				}
+				return nil
+			},
+		},
+		{
+			Name:   "since the last run",
+			Args:   []string{"gravl", "records", "--records", path, "/rides"},
+			Before: existing(time.Date(2021, time.November, 1, 0, 0, 0, 0, time.UTC)),
+			Counters: map[string]int{
+				"gravl.records.candidate": 1,
+			},
+			After: func(c *cli.Context) error {
+				res, err := read(c)
+				if err != nil {
+					return err
+				}
+				if len(res.Records) != 2 || res.Records["power-5s"].Activity != "1" {
+					return errors.New("expected the ride before the last run to be skipped")
+				}
+				return nil
+			},
+		},
+		{
+			Name:   "synced after the last run",
+			Args:   []string{"gravl", "records", "--records", path, "/rides"},
+			Before: existing(time.Date(2021, time.October, 2, 0, 0, 0, 0, time.UTC)),
+			Counters: map[string]int{
+				"gravl.records.file": 1,
+				"gravl.records.new":  5,
+			},
+		},
+		{
+			Name:   "synced before the overlap",
+			Args:   []string{"gravl", "records", "--records", path, "--overlap", "12h", "/rides"},
+			Before: existing(time.Date(2021, time.October, 2, 0, 0, 0, 0, time.UTC)),
+			Counters: map[string]int{
+				"gravl.records.candidate": 1,
+			},
+		},
+		{
+			Name:   "invalid date range",
+			Args:   []string{"gravl", "records", "--records", path, "--after", "2021-10-15", "--before", "2021-10-05", "/rides"},
+			Before: ride("/rides/ride.fit"),
+			Err:    "invalid date range",
+		},
+		{
+			Name: "invalid records",
+			Args: []string{"gravl", "records", "--records", path, "/rides"},
+			Before: func(c *cli.Context) error {
+				return afero.WriteFile(gravl.Runtime(c).Fs, path, []byte("{"), 0o600)
+			},
+			Err: "invalid records " + path,
+		},
+		{
+			Name: "unsupported source",
+			Args: []string{"gravl", "records", "--records", path, "--from", "zwift"},
+			Err:  "unsupported source: zwift",
+		},
+		{
+			Name: "no args",
+			Args: []string{"gravl", "records"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			internal.Run(t, tt, nil, command)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package activity
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	api "github.com/bzimmer/activity"
+	"github.com/hashicorp/go-metrics"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+const metricRetry = "retry"
+
+type idempotentKey struct{}
+
+// Idempotent marks requests made with the context as safe to retry regardless of the method,
+// such as uploads the provider deduplicates
+func Idempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+// idempotent returns true if repeating the request has the same effect as making it once
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	if req.Header.Get("Idempotency-Key") != "" {
+		return true
+	}
+	ok, _ := req.Context().Value(idempotentKey{}).(bool)
+	return ok
+}
+
+type idempotentUploader struct {
+	api.Uploader
+}
+
+func (u *idempotentUploader) Upload(ctx context.Context, file *api.File) (api.Upload, error) {
+	return u.Uploader.Upload(Idempotent(ctx), file)
+}
+
+// IdempotentUploader returns an uploader whose uploads are retried, suitable only for
+// providers which reject a duplicate of a previously uploaded file
+func IdempotentUploader(upd api.Uploader) api.Uploader {
+	return &idempotentUploader{Uploader: upd}
+}
+
+// RetryFlags support retrying failed requests
+func RetryFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:  "retries",
+			Value: 3,
+			Usage: "Maximum number of times a request failing with a network error or 5xx response is retried",
+		},
+		&cli.DurationFlag{
+			Name:  "retry-backoff",
+			Value: time.Second,
+			Usage: "Time to wait before the first retry, doubling for each subsequent retry",
+		},
+		&cli.DurationFlag{
+			Name:  "retry-max-wait",
+			Value: time.Second * 30,
+			Usage: "Maximum time to wait between retries",
+		},
+	}
+}
+
+// RetryTransport retries idempotent requests failing with a network error or 5xx response,
+// doubling the wait between each attempt
+type RetryTransport struct {
+	Provider  string
+	Transport http.RoundTripper
+	Metrics   *metrics.Metrics
+	Retries   int
+	Backoff   time.Duration
+	MaxWait   time.Duration
+	// Sleep waits for the duration, defaults to a timer honoring the context
+	Sleep func(context.Context, time.Duration) error
+}
+
+func (t *RetryTransport) sleep(ctx context.Context, d time.Duration) error {
+	if t.Sleep == nil {
+		return sleep(ctx, d)
+	}
+	return t.Sleep(ctx, d)
+}
+
+func (t *RetryTransport) transport() http.RoundTripper {
+	if t.Transport == nil {
+		return http.DefaultTransport
+	}
+	return t.Transport
+}
+
+// RoundTrip executes the request, retrying if it fails and it is safe to do so
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	retryable := idempotent(req) && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil)
+	wait := t.Backoff
+	for i := 0; ; i++ {
+		res, err := t.transport().RoundTrip(req)
+		switch {
+		case i >= t.Retries || !retryable:
+			return res, err
+		case err != nil:
+			if ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				return nil, err
+			}
+		case res.StatusCode < http.StatusInternalServerError:
+			return res, nil
+		}
+		ev := log.Warn().Str("provider", t.Provider).Str("method", req.Method).
+			Str("url", req.URL.Redacted()).Int("attempt", i+1).Dur("backoff", wait)
+		if err != nil {
+			ev.Err(err).Msg(metricRetry)
+		} else {
+			ev.Int("status", res.StatusCode).Msg(metricRetry)
+			_, _ = io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+		t.Metrics.IncrCounter([]string{t.Provider, metricRetry}, 1)
+		if err = t.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+		wait = min(wait*2, max(t.MaxWait, t.Backoff))
+		retry := req.Clone(ctx)
+		if req.GetBody != nil {
+			if retry.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		req = retry
+	}
+}
@@ -0,0 +1,197 @@
+package activity_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	api "github.com/bzimmer/activity"
+	"github.com/hashicorp/go-metrics"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bzimmer/gravl/activity"
+)
+
+func TestRetryFlags(t *testing.T) {
+	a := assert.New(t)
+	flags := activity.RetryFlags()
+	a.Equal(3, len(flags))
+}
+
+// poster uploads by POSTing the file contents to the url
+type poster struct {
+	client *http.Client
+	url    string
+}
+
+func (p *poster) Upload(ctx context.Context, file *api.File) (api.Upload, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return nil, res.Body.Close()
+}
+
+func (p *poster) Status(_ context.Context, _ api.UploadID) (api.Upload, error) {
+	return nil, nil //nolint:nilnil // not used
+}
+
+func TestRetryTransport(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		switch r.URL.Path {
+		case "/flaky":
+			if n < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		case "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(svr.Close)
+
+	tests := []struct {
+		name, method, path, key string
+		idempotent              bool
+		status                  int
+		calls                   int32
+		sleeps                  []time.Duration
+	}{
+		{
+			name: "get retried", method: http.MethodGet, path: "/flaky",
+			status: http.StatusOK, calls: 3, sleeps: []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			name: "backoff capped", method: http.MethodGet, path: "/broken",
+			status: http.StatusInternalServerError, calls: 5,
+			sleeps: []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second},
+		},
+		{
+			name: "client error not retried", method: http.MethodGet, path: "/missing",
+			status: http.StatusNotFound, calls: 1,
+		},
+		{
+			name: "post not retried", method: http.MethodPost, path: "/flaky",
+			status: http.StatusServiceUnavailable, calls: 1,
+		},
+		{
+			name: "post with idempotency key", method: http.MethodPost, path: "/flaky", key: "abc",
+			status: http.StatusOK, calls: 3, sleeps: []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			name: "idempotent post", method: http.MethodPost, path: "/flaky", idempotent: true,
+			status: http.StatusOK, calls: 3, sleeps: []time.Duration{time.Second, 2 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		a := assert.New(t)
+		calls.Store(0)
+		var sleeps []time.Duration
+		rt := &activity.RetryTransport{
+			Provider: "strava",
+			Metrics:  metrics.Default(),
+			Retries:  4,
+			Backoff:  time.Second,
+			MaxWait:  3 * time.Second,
+			Sleep: func(_ context.Context, d time.Duration) error {
+				sleeps = append(sleeps, d)
+				return nil
+			},
+		}
+		ctx := t.Context()
+		if tt.idempotent {
+			ctx = activity.Idempotent(ctx)
+		}
+		req, err := http.NewRequestWithContext(ctx, tt.method, svr.URL+tt.path, strings.NewReader("ride"))
+		a.NoError(err)
+		if tt.key != "" {
+			req.Header.Set("Idempotency-Key", tt.key)
+		}
+		res, err := rt.RoundTrip(req)
+		a.NoError(err, tt.name)
+		a.NoError(res.Body.Close())
+		a.Equal(tt.status, res.StatusCode, tt.name)
+		a.Equal(tt.calls, calls.Load(), tt.name)
+		a.Equal(tt.sleeps, sleeps, tt.name)
+	}
+}
+
+func TestRetryTransportNetworkError(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	svr := httptest.NewServer(http.NotFoundHandler())
+	url := svr.URL
+	svr.Close()
+
+	var sleeps int
+	rt := &activity.RetryTransport{
+		Provider: "strava",
+		Metrics:  metrics.Default(),
+		Retries:  2,
+		Backoff:  time.Millisecond,
+		Sleep: func(_ context.Context, _ time.Duration) error {
+			sleeps++
+			return nil
+		},
+	}
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, url, http.NoBody)
+	a.NoError(err)
+	res, err := rt.RoundTrip(req) //nolint:bodyclose // no response
+	a.Nil(res)
+	a.ErrorContains(err, "connection refused")
+	a.Equal(2, sleeps)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	rt.Sleep = nil
+	rt.Backoff = time.Hour
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	a.NoError(err)
+	time.AfterFunc(10*time.Millisecond, cancel)
+	res, err = rt.RoundTrip(req) //nolint:bodyclose // no response
+	a.Nil(res)
+	a.ErrorIs(err, context.Canceled)
+}
+
+func TestIdempotentUploader(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	var calls atomic.Int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	t.Cleanup(svr.Close)
+
+	client := &http.Client{Transport: &activity.RetryTransport{
+		Provider: "strava",
+		Metrics:  metrics.Default(),
+		Retries:  1,
+		Backoff:  time.Millisecond,
+	}}
+	upd := activity.IdempotentUploader(&poster{client: client, url: svr.URL})
+	_, err := upd.Upload(t.Context(), &api.File{Reader: strings.NewReader("ride")})
+	a.NoError(err)
+	a.Equal(int32(2), calls.Load())
+}
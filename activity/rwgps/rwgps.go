@@ -11,6 +11,7 @@ import (
 	"github.com/bzimmer/activity/rwgps"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/oauth2"
 	"golang.org/x/time/rate"
 
 	"github.com/bzimmer/gravl"
@@ -23,8 +24,9 @@ const (
 )
 
 var (
-	before    sync.Once //nolint:gochecknoglobals // once
-	errBefore error     //nolint:gochecknoglobals // paired with before
+	before    sync.Once     //nolint:gochecknoglobals // once
+	errBefore error         //nolint:gochecknoglobals // paired with before
+	limiter   *rate.Limiter //nolint:gochecknoglobals // shared by the client and transfers
 )
 
 func athlete(c *cli.Context) error {
@@ -73,18 +75,37 @@ func trips(c *cli.Context, kind string) error {
 	if err != nil {
 		return err
 	}
+	f, err := activity.Filter[*rwgps.Trip](c)
+	if err != nil {
+		return err
+	}
+	g, err := activity.Attributer[*rwgps.Trip](c)
+	if err != nil {
+		return err
+	}
 	enc := gravl.Runtime(c).Encoder
 	met := gravl.Runtime(c).Metrics
 	met.IncrCounter([]string{Provider, c.Command.Name}, 1)
 	metKey := []string{Provider, metric}
 	for i, trip := range trips {
+		var ok bool
+		if ok, err = f(ctx, trip); err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		var ext any
+		if ext, err = g(ctx, trip); err != nil {
+			return err
+		}
 		met.IncrCounter(metKey, 1)
 		log.Info().
 			Time("date", trip.DepartedAt).
 			Int64("id", trip.ID).
 			Str("name", trip.Name).
 			Msg(c.Command.Name)
-		err = enc.Encode([]any{i, trip})
+		err = enc.Encode([]any{i, ext})
 		if err != nil {
 			return err
 		}
@@ -92,38 +113,46 @@ func trips(c *cli.Context, kind string) error {
 	return nil
 }
 
+// environment documents the expression environment of trips and routes
+func environment() string {
+	return activity.Environment[*rwgps.Trip](
+		"Distances and elevations are in meters, speeds in kilometers per hour, and times in seconds.")
+}
+
 func activitiesCommand() *cli.Command {
 	return &cli.Command{
-		Name:        "activities",
-		Aliases:     []string{"A"},
-		Usage:       "Query activities for the authenticated athlete",
-		Description: "Query the RideWithGPS API for a list of trips for the authenticated athlete",
-		Flags: []cli.Flag{
+		Name:    "activities",
+		Aliases: []string{"A"},
+		Usage:   "Query activities for the authenticated athlete",
+		Description: "Query the RideWithGPS API for a list of trips for the authenticated athlete. " +
+			environment(),
+		Flags: append([]cli.Flag{
 			&cli.IntFlag{
 				Name:    "count",
 				Aliases: []string{"N"},
 				Value:   0,
 				Usage:   "The number of activities to query from RideWithGPS",
 			},
-		},
+		}, activity.EvalFlags()...),
 		Action: func(c *cli.Context) error { return trips(c, "trips") },
 	}
 }
 
 func routesCommand() *cli.Command {
 	return &cli.Command{
-		Name:        "routes",
-		Usage:       "Query routes for an athlete from RideWithGPS",
-		Description: "Query the RideWithGPS API for a list of planned routes for the authenticated athlete",
-		Aliases:     []string{"R"},
-		Flags: []cli.Flag{
+		Name:  "routes",
+		Usage: "Query routes for an athlete from RideWithGPS",
+		Description: "Query the RideWithGPS API for a list of planned routes for the authenticated athlete. " +
+			environment(),
+		Aliases: []string{"R"},
+		Flags: append([]cli.Flag{
 			&cli.IntFlag{
 				Name:    "count",
 				Aliases: []string{"N"},
 				Value:   0,
 				Usage:   "The number of routes to query from RideWithGPS",
 			},
-		},
+		}, activity.EvalFlags()...),
 		Action: func(c *cli.Context) error { return trips(c, "routes") },
 	}
 }
@@ -193,15 +222,21 @@ func routeCommand() *cli.Command {
 	}
 }
 
+// token returns the token from the flags if set, otherwise the stored token if available
+func token(c *cli.Context) *oauth2.Token {
+	return activity.Token(c, Provider, &oauth2.Token{AccessToken: c.String("rwgps-access-token")}, "rwgps-access-token")
+}
+
 func Before(c *cli.Context) error {
 	before.Do(func() {
+		limiter = rate.NewLimiter(rate.Every(c.Duration("rate-limit")), c.Int("rate-burst"))
 		var client *rwgps.Client
 		client, errBefore = rwgps.NewClient(
 			rwgps.WithClientCredentials(c.String("rwgps-client-id"), ""),
-			rwgps.WithTokenCredentials(c.String("rwgps-access-token"), "", time.Time{}),
+			rwgps.WithTokenCredentials(token(c).AccessToken, "", time.Time{}),
+			rwgps.WithTransport(activity.Transport(c, Provider)),
 			rwgps.WithHTTPTracing(c.Bool("http-tracing")),
-			rwgps.WithRateLimiter(rate.NewLimiter(
-				rate.Every(c.Duration("rate-limit")), c.Int("rate-burst"))))
+			rwgps.WithRateLimiter(limiter))
 		if errBefore != nil {
 			return
 		}
@@ -218,7 +253,7 @@ func Command() *cli.Command {
 		Category:    metricActivity,
 		Usage:       "Query RideWithGPS for rides and routes",
 		Description: "Operations supported by the RideWithGPS API",
-		Flags:       append(AuthFlags(), activity.RateLimitFlags()...),
+		Flags:       append(append(AuthFlags(), activity.RateLimitFlags()...), activity.RetryFlags()...),
 		Before:      Before,
 		Subcommands: []*cli.Command{
 			activitiesCommand(),
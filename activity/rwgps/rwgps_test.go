@@ -187,6 +187,27 @@ func TestTrips(t *testing.T) {
 				"gravl.rwgps.activity":   2,
 			},
 		},
+		{
+			Name: "activities filtered",
+			Args: []string{"gravl", "rwgps", "activities", "--filter", ".ID == 82827929"},
+			Counters: map[string]int{
+				"gravl.rwgps.activities": 1,
+				"gravl.rwgps.activity":   1,
+			},
+		},
+		{
+			Name: "activities invalid filter",
+			Args: []string{"gravl", "rwgps", "activities", "--filter", ".Typo == 'Ride'"},
+			Err:  "has no field Typo",
+		},
+		{
+			Name: "routes attributes",
+			Args: []string{"gravl", "rwgps", "routes", "--attribute", ".ID"},
+			Counters: map[string]int{
+				"gravl.rwgps.routes": 1,
+				"gravl.rwgps.route":  4,
+			},
+		},
 		{
 			Name: "routes two",
 			Args: []string{"gravl", "rwgps", "routes", "-N", "2"},
@@ -0,0 +1,277 @@
+package rwgps
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	api "github.com/bzimmer/activity"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/time/rate"
+
+	"github.com/bzimmer/gravl/activity"
+)
+
+const baseURL = "https://ridewithgps.com"
+
+// Status of a queued upload task
+const (
+	StatusProcessing = 0
+	StatusSuccess    = 1
+)
+
+// Upload is the status of a file uploaded to RideWithGPS, the file is processed as a queued task
+type Upload struct {
+	TaskID     int64  `json:"task_id"`
+	Status     int    `json:"status"`
+	Message    string `json:"message,omitempty"`
+	ActivityID int64  `json:"activity_id,omitempty"`
+}
+
+func (u *Upload) Identifier() api.UploadID {
+	return api.UploadID(u.TaskID)
+}
+
+// Done returns true once the task is no longer queued or processing
+func (u *Upload) Done() bool {
+	return u.Status != StatusProcessing
+}
+
+// Transfer exports and uploads trips and exports routes, operations not supported by the RideWithGPS client
+type Transfer struct {
+	Client  *http.Client
+	Limiter *rate.Limiter
+	BaseURL string
+	APIKey  string
+	Token   string
+	// Format of exported trips: original, fit, gpx, or tcx
+	Format string
+}
+
+// NewTransfer returns a Transfer sharing the transport and rate limiter of the client created by Before
+func NewTransfer(c *cli.Context) (*Transfer, error) {
+	key, tok := c.String("rwgps-client-id"), token(c).AccessToken
+	if key == "" || tok == "" {
+		return nil, errors.New("missing rwgps client id or access token")
+	}
+	return &Transfer{
+		Client:  &http.Client{Transport: activity.Transport(c, Provider)},
+		Limiter: limiter,
+		BaseURL: baseURL,
+		APIKey:  key,
+		Token:   tok,
+		Format:  c.String("rwgps-export-format"),
+	}, nil
+}
+
+func (t *Transfer) do(req *http.Request) (*http.Response, error) {
+	if t.Limiter != nil {
+		if err := t.Limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	req.Header.Set("x-rwgps-api-key", t.APIKey)
+	req.Header.Set("x-rwgps-auth-token", t.Token)
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		defer res.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return nil, fmt.Errorf("%s %s: %s %s", req.Method, req.URL.Path, res.Status, strings.TrimSpace(string(msg)))
+	}
+	return res, nil
+}
+
+// Export the trip in the configured format
+func (t *Transfer) Export(ctx context.Context, activityID int64) (*api.Export, error) {
+	var path string
+	switch t.Format {
+	case "", "original":
+		path = fmt.Sprintf("/trips/%d/original", activityID)
+	case "fit":
+		path = fmt.Sprintf("/trips/%d.fit", activityID)
+	case "gpx":
+		path = fmt.Sprintf("/trips/%d.gpx?sub_format=track", activityID)
+	case "tcx":
+		path = fmt.Sprintf("/trips/%d.tcx?sub_format=history", activityID)
+	default:
+		return nil, fmt.Errorf("unknown export format '%s'", t.Format)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.BaseURL+path, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	filename := fmt.Sprintf("%d", activityID)
+	if t.Format != "" && t.Format != "original" {
+		filename += "." + t.Format
+	}
+	// the original file is named by the server
+	_, params, perr := mime.ParseMediaType(res.Header.Get("Content-Disposition"))
+	if perr == nil && params["filename"] != "" {
+		filename = filepath.Base(params["filename"])
+	}
+	return &api.Export{
+		ID: activityID,
+		File: &api.File{
+			Name:     strings.TrimSuffix(filename, filepath.Ext(filename)),
+			Filename: filename,
+			Format:   api.ToFormat(filepath.Ext(filename)),
+			Reader:   bytes.NewReader(data),
+		},
+	}, nil
+}
+
+// ExportRoute returns the route as a GPX or TCX course file
+func (t *Transfer) ExportRoute(ctx context.Context, routeID int64, format api.Format) (*api.File, error) {
+	var path string
+	//nolint:exhaustive // only gpx and tcx are supported
+	switch format {
+	case api.FormatGPX:
+		path = fmt.Sprintf("/routes/%d.gpx?sub_format=track", routeID)
+	case api.FormatTCX:
+		path = fmt.Sprintf("/routes/%d.tcx?sub_format=course", routeID)
+	default:
+		return nil, fmt.Errorf("unsupported route format '%s'", format)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.BaseURL+path, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%d", routeID)
+	return &api.File{
+		Name:     name,
+		Filename: name + "." + format.String(),
+		Format:   format,
+		Reader:   bytes.NewReader(data),
+	}, nil
+}
+
+// Upload the file as a new trip, the upload is processed asynchronously
+func (t *Transfer) Upload(ctx context.Context, file *api.File) (api.Upload, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	name := file.Filename
+	if name == "" {
+		name = file.Name
+	}
+	fw, err := mw.CreateFormFile("file", filepath.Base(name))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(fw, file); err != nil {
+		return nil, err
+	}
+	if err = mw.Close(); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.BaseURL+"/trips.json", &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	res, err := t.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var task struct {
+		Success int    `json:"success"`
+		TaskID  int64  `json:"task_id"`
+		Message string `json:"message"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&task); err != nil {
+		return nil, err
+	}
+	if task.Success != 1 {
+		if task.Message == "" {
+			task.Message = "upload failed"
+		}
+		return nil, errors.New(task.Message)
+	}
+	return &Upload{TaskID: task.TaskID}, nil
+}
+
+// Status returns the status of the queued upload task
+func (t *Transfer) Status(ctx context.Context, id api.UploadID) (api.Upload, error) {
+	u := fmt.Sprintf("%s/queued_tasks/status.json?ids=%d&include_objects=true", t.BaseURL, id)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var status struct {
+		QueuedTasks []struct {
+			ID                int64  `json:"id"`
+			Status            int    `json:"status"`
+			Message           string `json:"message"`
+			AssociatedObjects []struct {
+				ID   int64  `json:"id"`
+				Type string `json:"type"`
+			} `json:"associated_objects"`
+		} `json:"queued_tasks"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+	for _, task := range status.QueuedTasks {
+		if task.ID != int64(id) {
+			continue
+		}
+		upload := &Upload{TaskID: task.ID, Status: task.Status, Message: task.Message}
+		for _, obj := range task.AssociatedObjects {
+			if obj.Type == "Trip" {
+				upload.ActivityID = obj.ID
+			}
+		}
+		return upload, nil
+	}
+	return nil, fmt.Errorf("unknown upload %d", id)
+}
+
+// ExportFlags configure the format of exported trips
+func ExportFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "rwgps-export-format",
+			Value:   "original",
+			Usage:   "Format of trips exported from RideWithGPS: original, fit, gpx, or tcx",
+			EnvVars: []string{"RWGPS_EXPORT_FORMAT"},
+		},
+	}
+}
@@ -0,0 +1,216 @@
+package rwgps_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	api "github.com/bzimmer/activity"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl/activity/rwgps"
+	"github.com/bzimmer/gravl/internal"
+)
+
+func transfer(t *testing.T, format string, mux *http.ServeMux) *rwgps.Transfer {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-rwgps-api-key") != "KEY" || r.Header.Get("x-rwgps-auth-token") != "TOKEN" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(svr.Close)
+	return &rwgps.Transfer{
+		Client:  svr.Client(),
+		BaseURL: svr.URL,
+		APIKey:  "KEY",
+		Token:   "TOKEN",
+		Format:  format,
+	}
+}
+
+func TestTransferExport(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/trips/1001/original", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="Morning_Ride.fit"`)
+		_, _ = w.Write([]byte("fit"))
+	})
+	mux.HandleFunc("/trips/1001.gpx", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("sub_format") != "track" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte("<gpx></gpx>"))
+	})
+	mux.HandleFunc("/trips/1001.tcx", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("<tcx></tcx>"))
+	})
+
+	tests := []struct {
+		name, format, filename, data, err string
+		id                                int64
+		fmt                               api.Format
+	}{
+		{name: "original", format: "original", id: 1001, filename: "Morning_Ride.fit", data: "fit", fmt: api.FormatFIT},
+		{name: "default", id: 1001, filename: "Morning_Ride.fit", data: "fit", fmt: api.FormatFIT},
+		{name: "gpx", format: "gpx", id: 1001, filename: "1001.gpx", data: "<gpx></gpx>", fmt: api.FormatGPX},
+		{name: "tcx", format: "tcx", id: 1001, filename: "1001.tcx", data: "<tcx></tcx>", fmt: api.FormatTCX},
+		{name: "unknown format", format: "kml", id: 1001, err: "unknown export format 'kml'"},
+		{name: "not found", format: "gpx", id: 2002, err: "404 Not Found"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			a := assert.New(t)
+			exp, err := transfer(t, tt.format, mux).Export(t.Context(), tt.id)
+			if tt.err != "" {
+				a.Error(err)
+				a.Contains(err.Error(), tt.err)
+				return
+			}
+			a.NoError(err)
+			a.Equal(tt.id, exp.ID)
+			a.Equal(tt.filename, exp.Filename)
+			a.Equal(tt.fmt, exp.Format)
+			data, err := io.ReadAll(exp)
+			a.NoError(err)
+			a.Equal(tt.data, string(data))
+		})
+	}
+}
+
+func TestTransferExportRoute(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/routes/3344556.gpx", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("<gpx></gpx>"))
+	})
+	mux.HandleFunc("/routes/3344556.tcx", func(w http.ResponseWriter, r *http.Request) {
+		a.Equal("course", r.URL.Query().Get("sub_format"))
+		_, _ = w.Write([]byte("<tcx></tcx>"))
+	})
+
+	x := transfer(t, "", mux)
+	for format, data := range map[api.Format]string{api.FormatGPX: "<gpx></gpx>", api.FormatTCX: "<tcx></tcx>"} {
+		file, err := x.ExportRoute(t.Context(), 3344556, format)
+		a.NoError(err)
+		a.Equal("3344556."+format.String(), file.Filename)
+		a.Equal(format, file.Format)
+		body, err := io.ReadAll(file)
+		a.NoError(err)
+		a.Equal(data, string(body))
+	}
+
+	file, err := x.ExportRoute(t.Context(), 3344556, api.FormatFIT)
+	a.Nil(file)
+	a.EqualError(err, "unsupported route format 'fit'")
+
+	file, err = x.ExportRoute(t.Context(), 1, api.FormatGPX)
+	a.Nil(file)
+	a.ErrorContains(err, "404 Not Found")
+}
+
+func TestTransferUpload(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/trips.json", func(w http.ResponseWriter, r *http.Request) {
+		a.Equal(http.MethodPost, r.Method)
+		fp, hdr, err := r.FormFile("file")
+		a.NoError(err)
+		defer fp.Close()
+		data, err := io.ReadAll(fp)
+		a.NoError(err)
+		w.Header().Set("Content-Type", "application/json")
+		switch hdr.Filename {
+		case "Morning_Ride.gpx":
+			a.Equal("<gpx></gpx>", string(data))
+			_, _ = w.Write([]byte(`{"success":1,"task_id":8812}`))
+		default:
+			_, _ = w.Write([]byte(`{"success":0,"message":"unsupported file"}`))
+		}
+	})
+	mux.HandleFunc("/queued_tasks/status.json", func(w http.ResponseWriter, r *http.Request) {
+		a.Equal("8812", r.URL.Query().Get("ids"))
+		w.Header().Set("Content-Type", "application/json")
+		a.NoError(json.NewEncoder(w).Encode(map[string]any{
+			"queued_tasks": []map[string]any{{
+				"id":                 8812,
+				"status":             1,
+				"message":            "complete",
+				"associated_objects": []map[string]any{{"id": 998877, "type": "Trip"}},
+			}},
+		}))
+	})
+
+	x := transfer(t, "", mux)
+	u, err := x.Upload(t.Context(), &api.File{
+		Name:     "Morning Ride",
+		Filename: "Morning_Ride.gpx",
+		Format:   api.FormatGPX,
+		Reader:   strings.NewReader("<gpx></gpx>"),
+	})
+	a.NoError(err)
+	a.Equal(api.UploadID(8812), u.Identifier())
+	a.False(u.Done())
+
+	u, err = x.Status(t.Context(), u.Identifier())
+	a.NoError(err)
+	a.True(u.Done())
+	a.Equal(&rwgps.Upload{TaskID: 8812, Status: 1, Message: "complete", ActivityID: 998877}, u)
+
+	u, err = x.Upload(t.Context(), &api.File{Filename: "Evening_Ride.kml", Reader: strings.NewReader("")})
+	a.Nil(u)
+	a.EqualError(err, "unsupported file")
+
+	x.Token = "EXPIRED"
+	u, err = x.Status(t.Context(), 8812)
+	a.Nil(u)
+	a.ErrorContains(err, "401 Unauthorized")
+}
+
+func TestTransferCredentials(t *testing.T) {
+	a := assert.New(t)
+	tests := []*internal.Harness{
+		{
+			Name: "credentials",
+			Args: []string{"gravl", "credentials", "--rwgps-client-id", "KEY", "--rwgps-access-token", "TOKEN"},
+			Action: func(c *cli.Context) error {
+				x, err := rwgps.NewTransfer(c)
+				a.NoError(err)
+				a.Equal("KEY", x.APIKey)
+				a.Equal("TOKEN", x.Token)
+				return err
+			},
+		},
+		{
+			Name: "missing",
+			Args: []string{"gravl", "missing", "--rwgps-client-id", "KEY"},
+			Err:  "missing rwgps client id or access token",
+			Action: func(c *cli.Context) error {
+				_, err := rwgps.NewTransfer(c)
+				return err
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			cmd := func(_ *testing.T, _ string) *cli.Command {
+				return &cli.Command{Name: tt.Name, Flags: rwgps.AuthFlags(), Action: tt.Action}
+			}
+			internal.Run(t, tt, nil, cmd)
+		})
+	}
+}
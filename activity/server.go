@@ -0,0 +1,77 @@
+package activity
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/sync/errgroup"
+)
+
+// Localhost is the address on which servers listen unless configured otherwise
+const Localhost = "127.0.0.1"
+
+func newListener(address string, port int) (net.Listener, error) {
+	var lc net.ListenConfig
+	listener, err := lc.Listen(context.Background(), "tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	return listener, nil
+}
+
+// Serve the handler on the address and port until the context is canceled, if not nil the url
+// of the server is sent on `started` once listening
+func Serve(c *cli.Context, handler http.Handler, address string, port int, started chan<- *url.URL) error {
+	listener, err := newListener(address, port)
+	if err != nil {
+		return err
+	}
+	svr := &http.Server{
+		Handler:           handler,
+		ReadTimeout:       5 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	grp, ctx := errgroup.WithContext(c.Context)
+	grp.Go(func() error {
+		if svrErr := svr.Serve(listener); !errors.Is(svrErr, http.ErrServerClosed) {
+			log.Info().Err(svrErr).Msg("closed")
+			return svrErr
+		}
+		return nil
+	})
+	grp.Go(func() error {
+		<-ctx.Done()
+		return svr.Close()
+	})
+	grp.Go(func() error {
+		if started == nil {
+			return nil
+		}
+		u, parseErr := url.Parse("http://" + listener.Addr().String())
+		if parseErr != nil {
+			return parseErr
+		}
+		log.Info().Str("address", u.String()).Msg("serving")
+		select {
+		case <-c.Done():
+			return c.Err()
+		case started <- u:
+			return nil
+		}
+	})
+	if err = grp.Wait(); err != nil {
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package strava
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	api "github.com/bzimmer/activity"
+	"github.com/bzimmer/activity/strava"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/activity"
+	"github.com/bzimmer/gravl/analysis"
+)
+
+// Streams returns the streams of the activity required for its analysis
+func Streams(c *cli.Context, id int64) (*analysis.Streams, error) {
+	if err := Before(c); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(c.Context, c.Duration("timeout"))
+	defer cancel()
+	sms, err := gravl.Runtime(c).Strava.Activity.Streams(ctx, id, "time", "watts", "heartrate", "distance", "altitude")
+	if err != nil {
+		return nil, err
+	}
+	s := &analysis.Streams{}
+	for _, x := range []struct {
+		src *strava.Stream
+		dst *[]float64
+	}{
+		{sms.Time, &s.Time},
+		{sms.Watts, &s.Power},
+		{sms.HeartRate, &s.HeartRate},
+		{sms.Distance, &s.Distance},
+		{sms.Elevation, &s.Elevation},
+	} {
+		if x.src != nil {
+			*x.dst = x.src.Data
+		}
+	}
+	return s, nil
+}
+
+// Stress returns the training stress of each activity in the date range, the streams of activities
+// with power are analyzed for their normalized power while the others are estimated from their summary
+func Stress(c *cli.Context, before, after time.Time, cfg *analysis.Config) ([]*analysis.Stress, error) {
+	if err := Before(c); err != nil {
+		return nil, err
+	}
+	var acts []*strava.Activity
+	err := func() error {
+		ctx, cancel := context.WithTimeout(c.Context, c.Duration("timeout"))
+		defer cancel()
+		res := gravl.Runtime(c).Strava.Activity.Activities(ctx, api.Pagination{}, strava.WithDateRange(before, after))
+		return strava.ActivitiesIter(res, func(act *strava.Activity) (bool, error) {
+			acts = append(acts, act)
+			return true, nil
+		})
+	}()
+	if err != nil {
+		return nil, err
+	}
+	met := gravl.Runtime(c).Metrics
+	stress := make([]*analysis.Stress, 0, len(acts))
+	for _, act := range acts {
+		seconds := int(act.MovingTime.Seconds())
+		s := analysis.Estimate(act.StartDate, seconds, 0, act.AverageHeartrate, cfg)
+		if act.AverageWatts > 0 {
+			sms, err := Streams(c, act.ID)
+			if err != nil {
+				return nil, err
+			}
+			res, err := analysis.Analyze(sms, cfg)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %w", act.ID, err)
+			}
+			s = res.Stress(act.StartDate, cfg)
+		}
+		met.IncrCounter([]string{Provider, "stress", s.Method}, 1)
+		log.Info().
+			Time("date", act.StartDateLocal).
+			Int64("id", act.ID).
+			Str("name", act.Name).
+			Float64("tss", s.TSS).
+			Str("method", s.Method).
+			Msg("stress")
+		stress = append(stress, s)
+	}
+	return stress, nil
+}
+
+// Activities returns the activities in the date range passing the filter with the streams required
+// for their power and fastest distance records, if any
+func Activities(c *cli.Context, before, after time.Time, power, distance bool) ([]*analysis.Activity, error) {
+	if err := Before(c); err != nil {
+		return nil, err
+	}
+	f, err := activity.Filter[*strava.Activity](c)
+	if err != nil {
+		return nil, err
+	}
+	var acts []*strava.Activity
+	err = func() error {
+		ctx, cancel := context.WithTimeout(c.Context, c.Duration("timeout"))
+		defer cancel()
+		res := gravl.Runtime(c).Strava.Activity.Activities(ctx, api.Pagination{}, strava.WithDateRange(before, after))
+		return strava.ActivitiesIter(res, func(act *strava.Activity) (bool, error) {
+			ok, err := f(ctx, act)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				acts = append(acts, act)
+			}
+			return true, nil
+		})
+	}()
+	if err != nil {
+		return nil, err
+	}
+	met := gravl.Runtime(c).Metrics
+	res := make([]*analysis.Activity, 0, len(acts))
+	for _, act := range acts {
+		x := &analysis.Activity{
+			ID:       strconv.FormatInt(act.ID, 10),
+			Start:    act.StartDate,
+			Distance: act.Distance.Meters(),
+			Climbing: act.ElevationGain.Meters(),
+		}
+		if distance || (power && act.AverageWatts > 0) {
+			if x.Streams, err = Streams(c, act.ID); err != nil {
+				return nil, err
+			}
+			met.IncrCounter([]string{Provider, "streams"}, 1)
+		}
+		res = append(res, x)
+	}
+	return res, nil
+}
+
+// SegmentRecords returns the athlete's efforts on each segment in the date range as record candidates
+func SegmentRecords(c *cli.Context, segmentIDs []int64, before, after time.Time) ([]*analysis.Record, error) {
+	segments := NewSegments(c)
+	met := gravl.Runtime(c).Metrics
+	var res []*analysis.Record
+	for _, id := range segmentIDs {
+		efforts, err := func() ([]*SegmentEffort, error) {
+			ctx, cancel := context.WithTimeout(c.Context, c.Duration("timeout"))
+			defer cancel()
+			return segments.Efforts(ctx, id, before, after)
+		}()
+		if err != nil {
+			return nil, err
+		}
+		met.IncrCounter([]string{Provider, "segment", "effort"}, float32(len(efforts)))
+		for _, effort := range efforts {
+			res = append(res, &analysis.Record{
+				Measure:  fmt.Sprintf("segment-%d", id),
+				Value:    float64(effort.ElapsedTime),
+				Unit:     analysis.UnitSeconds,
+				Activity: strconv.FormatInt(effort.Activity.ID, 10),
+				Date:     effort.StartDate,
+			})
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,260 @@
+package strava
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/activity"
+	"github.com/bzimmer/gravl/web"
+)
+
+// WebhookEvent is a notification from Strava that an activity or athlete was created, updated, or deleted
+type WebhookEvent struct {
+	ObjectType     string         `json:"object_type"`
+	ObjectID       int64          `json:"object_id"`
+	AspectType     string         `json:"aspect_type"`
+	OwnerID        int64          `json:"owner_id"`
+	SubscriptionID int64          `json:"subscription_id"`
+	EventTime      int64          `json:"event_time"`
+	Updates        map[string]any `json:"updates,omitempty"`
+}
+
+func (e *WebhookEvent) validate() error {
+	switch e.ObjectType {
+	case "activity", "athlete":
+	default:
+		return fmt.Errorf("invalid object_type '%s'", e.ObjectType)
+	}
+	switch e.AspectType {
+	case "create", "update", "delete":
+	default:
+		return fmt.Errorf("invalid aspect_type '%s'", e.AspectType)
+	}
+	switch {
+	case e.ObjectID == 0:
+		return errors.New("missing object_id")
+	case e.OwnerID == 0:
+		return errors.New("missing owner_id")
+	case e.EventTime == 0:
+		return errors.New("missing event_time")
+	}
+	return nil
+}
+
+// NewWebhookHandler returns a handler answering the subscription verification request with the
+// challenge if the verify token matches and sending valid events on the channel
+//
+// Strava expects events to be acknowledged within two seconds so events are only queued by the
+// handler; if the queue is full the event is refused and Strava will retry the delivery
+func NewWebhookHandler(verify string, events chan<- *WebhookEvent) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			q := r.URL.Query()
+			if q.Get("hub.mode") != "subscribe" || q.Get("hub.verify_token") != verify {
+				http.Error(w, "invalid verification request", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(map[string]string{"hub.challenge": q.Get("hub.challenge")}); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+		case http.MethodPost:
+			r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+			var event WebhookEvent
+			if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := event.validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			select {
+			case events <- &event:
+				w.WriteHeader(http.StatusOK)
+			default:
+				http.Error(w, "event queue is full", http.StatusServiceUnavailable)
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// webhookAction handles an event received by the webhook
+type webhookAction func(c *cli.Context, event *WebhookEvent) error
+
+func logAction(_ *cli.Context, event *WebhookEvent) error {
+	log.Info().
+		Str("object_type", event.ObjectType).
+		Int64("object_id", event.ObjectID).
+		Str("aspect_type", event.AspectType).
+		Int64("owner_id", event.OwnerID).
+		Interface("updates", event.Updates).
+		Msg("event")
+	return nil
+}
+
+// ndjsonAction encodes the event with the runtime encoder or appends it to the file if specified
+func ndjsonAction(path string) webhookAction {
+	return func(c *cli.Context, event *WebhookEvent) error {
+		if path == "" {
+			return gravl.Runtime(c).Encoder.Encode(event)
+		}
+		fp, err := gravl.Runtime(c).Fs.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		if err = json.NewEncoder(fp).Encode(event); err != nil {
+			fp.Close()
+			return err
+		}
+		return fp.Close()
+	}
+}
+
+// copyAction copies each newly created activity from Strava to the uploader
+func copyAction(to string) webhookAction {
+	return func(c *cli.Context, event *WebhookEvent) error {
+		if event.ObjectType != "activity" || event.AspectType != "create" {
+			return nil
+		}
+		copier := gravl.Runtime(c).Copy
+		if copier == nil {
+			return errors.New("copy is not available")
+		}
+		return copier(c, Provider, to, event.ObjectID)
+	}
+}
+
+// webhookActions parses the action specs, eg `log`, `ndjson=events.ndjson`, or `copy=rwgps`
+func webhookActions(specs []string) ([]webhookAction, error) {
+	if len(specs) == 0 {
+		specs = []string{"log"}
+	}
+	actions := make([]webhookAction, 0, len(specs))
+	for _, spec := range specs {
+		name, arg, _ := strings.Cut(spec, "=")
+		switch name {
+		case "log":
+			actions = append(actions, logAction)
+		case "ndjson":
+			actions = append(actions, ndjsonAction(arg))
+		case "copy":
+			if arg == "" {
+				return nil, errors.New("copy requires an uploader, eg copy=rwgps")
+			}
+			actions = append(actions, copyAction(arg))
+		default:
+			return nil, fmt.Errorf("unknown action '%s'", name)
+		}
+	}
+	return actions, nil
+}
+
+// dispatch the events to the actions until stopped, events queued when stopped are dispatched before returning
+func dispatch(c *cli.Context, events <-chan *WebhookEvent, stop <-chan struct{}, actions []webhookAction) {
+	met := gravl.Runtime(c).Metrics
+	handle := func(event *WebhookEvent) {
+		met.IncrCounter([]string{Provider, metricWebhook, event.ObjectType, event.AspectType}, 1)
+		for _, action := range actions {
+			if err := action(c, event); err != nil {
+				met.IncrCounter([]string{Provider, metricWebhook, "action", "error"}, 1)
+				log.Error().Err(err).Int64("object_id", event.ObjectID).Msg(metricWebhook)
+			}
+		}
+	}
+	for {
+		select {
+		case event := <-events:
+			handle(event)
+		case <-stop:
+			for {
+				select {
+				case event := <-events:
+					handle(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func whserve(c *cli.Context, started chan<- *url.URL) error {
+	actions, err := webhookActions(c.StringSlice("action"))
+	if err != nil {
+		return err
+	}
+	events := make(chan *WebhookEvent, c.Int("queue"))
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		dispatch(c, events, stop, actions)
+	}()
+	handle := web.NewLogHandler(&log.Logger)
+	mux := http.NewServeMux()
+	mux.Handle(c.String("path"), handle(NewWebhookHandler(c.String("verify"), events)))
+	err = activity.Serve(c, mux, c.String("address"), c.Int("port"), started)
+	close(stop)
+	<-done
+	return err
+}
+
+// WebhookServeCommand serves the webhook callback, the url of the server is sent on `started` if not nil
+func WebhookServeCommand(started chan<- *url.URL) *cli.Command {
+	return &cli.Command{
+		Name:  "serve",
+		Usage: "Receive webhook events",
+		Description: "Serve the webhook callback, answering the subscription verification request and handling " +
+			"activity and athlete events with the actions: `log` (the default) logs the event, `ndjson[=FILE]` " +
+			"writes the event to stdout or appends it to the file, and `copy=UPLOADER` copies the activity from Strava " +
+			"to the uploader for each new activity as `qp copy` would",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "verify",
+				Usage:    "String chosen by the application owner for client security, as specified when subscribing",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "address",
+				Aliases: []string{"bind"},
+				Value:   activity.Localhost,
+				Usage:   "Address on which to listen, eg 0.0.0.0 to accept events from other hosts",
+			},
+			&cli.IntFlag{
+				Name:  "port",
+				Value: 9002,
+				Usage: "Port on which to listen",
+			},
+			&cli.StringFlag{
+				Name:  "path",
+				Value: "/" + Provider + "/webhook",
+				Usage: "Path of the callback url",
+			},
+			&cli.StringSliceFlag{
+				Name:  "action",
+				Usage: "Actions performed for each event, in order: log, ndjson[=FILE], copy=UPLOADER",
+			},
+			&cli.IntFlag{
+				Name:  "queue",
+				Value: 100,
+				Usage: "Number of events queued for the actions before events are refused",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			return whserve(c, started)
+		},
+	}
+}
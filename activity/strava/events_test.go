@@ -0,0 +1,271 @@
+package strava_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/activity/strava"
+	"github.com/bzimmer/gravl/internal"
+)
+
+const (
+	created = `{"aspect_type":"create","event_time":1516126040,"object_id":1360128428,` +
+		`"object_type":"activity","owner_id":134815,"subscription_id":120475}`
+	updated = `{"aspect_type":"update","event_time":1516126040,"object_id":1360128428,` +
+		`"object_type":"activity","owner_id":134815,"subscription_id":120475,"updates":{"title":"Messy"}}`
+	deauthorized = `{"aspect_type":"update","event_time":1516126040,"object_id":134815,` +
+		`"object_type":"athlete","owner_id":134815,"subscription_id":120475,"updates":{"authorized":"false"}}`
+)
+
+func post(ctx context.Context, u, body string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	return res.StatusCode, nil
+}
+
+func TestWebhookHandler(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name, method, query, body, response string
+		status, events                      int
+	}{
+		{
+			name:     "verification",
+			method:   http.MethodGet,
+			query:    "hub.mode=subscribe&hub.verify_token=STRAVA&hub.challenge=15f7d1a91c1f40f8a748fd134752feb3",
+			status:   http.StatusOK,
+			response: `{"hub.challenge":"15f7d1a91c1f40f8a748fd134752feb3"}`,
+		},
+		{
+			name:   "verification with the wrong token",
+			method: http.MethodGet,
+			query:  "hub.mode=subscribe&hub.verify_token=GARMIN&hub.challenge=15f7d1a91c1f40f8a748fd134752feb3",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "activity created",
+			method: http.MethodPost,
+			body:   created,
+			status: http.StatusOK,
+			events: 1,
+		},
+		{
+			name:   "athlete deauthorized",
+			method: http.MethodPost,
+			body:   deauthorized,
+			status: http.StatusOK,
+			events: 1,
+		},
+		{
+			name:     "invalid json",
+			method:   http.MethodPost,
+			body:     `{"aspect_type":`,
+			status:   http.StatusBadRequest,
+			response: "unexpected EOF",
+		},
+		{
+			name:     "invalid object type",
+			method:   http.MethodPost,
+			body:     strings.Replace(created, `"activity"`, `"route"`, 1),
+			status:   http.StatusBadRequest,
+			response: "invalid object_type 'route'",
+		},
+		{
+			name:     "invalid aspect type",
+			method:   http.MethodPost,
+			body:     strings.Replace(created, `"create"`, `"rename"`, 1),
+			status:   http.StatusBadRequest,
+			response: "invalid aspect_type 'rename'",
+		},
+		{
+			name:     "missing object id",
+			method:   http.MethodPost,
+			body:     `{"aspect_type":"create","event_time":1516126040,"object_type":"activity","owner_id":134815}`,
+			status:   http.StatusBadRequest,
+			response: "missing object_id",
+		},
+		{
+			name:   "method not allowed",
+			method: http.MethodPut,
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			a := assert.New(t)
+			events := make(chan *strava.WebhookEvent, 1)
+			svr := httptest.NewServer(strava.NewWebhookHandler("STRAVA", events))
+			defer svr.Close()
+
+			req, err := http.NewRequestWithContext(t.Context(), tt.method, svr.URL+"?"+tt.query, strings.NewReader(tt.body))
+			a.NoError(err)
+			res, err := svr.Client().Do(req)
+			a.NoError(err)
+			defer res.Body.Close()
+			a.Equal(tt.status, res.StatusCode)
+			body, err := io.ReadAll(res.Body)
+			a.NoError(err)
+			a.Contains(string(body), tt.response)
+			a.Len(events, tt.events)
+		})
+	}
+}
+
+func TestWebhookHandlerQueueFull(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	events := make(chan *strava.WebhookEvent)
+	svr := httptest.NewServer(strava.NewWebhookHandler("STRAVA", events))
+	defer svr.Close()
+
+	status, err := post(t.Context(), svr.URL, created)
+	a.NoError(err)
+	a.Equal(http.StatusServiceUnavailable, status)
+}
+
+func TestWebhookServe(t *testing.T) {
+	a := assert.New(t)
+
+	tests := []struct {
+		harness *internal.Harness
+		events  []string
+		copied  []string
+	}{
+		{
+			harness: &internal.Harness{
+				Name: "ndjson and copy",
+				Args: []string{"gravl", "strava", "serve", "--verify", "STRAVA",
+					"--port", "0", "--action", "log", "--action", "ndjson=/events.ndjson", "--action", "copy=rwgps"},
+				Counters: map[string]int{
+					"gravl.strava.webhook.activity.create": 1,
+					"gravl.strava.webhook.activity.update": 1,
+					"gravl.strava.webhook.athlete.update":  1,
+				},
+				After: func(c *cli.Context) error {
+					data, err := afero.ReadFile(gravl.Runtime(c).Fs, "/events.ndjson")
+					a.NoError(err)
+					a.Equal(3, strings.Count(string(data), "\n"))
+					a.Contains(string(data), `"updates":{"title":"Messy"}`)
+					return nil
+				},
+			},
+			events: []string{created, updated, deauthorized},
+			copied: []string{"strava rwgps 1360128428"},
+		},
+		{
+			harness: &internal.Harness{
+				Name: "copy fails",
+				Args: []string{
+					"gravl", "strava", "serve", "--verify", "STRAVA",
+					"--address", "127.0.0.1", "--port", "0", "--action", "copy=zwift"},
+				Counters: map[string]int{
+					"gravl.strava.webhook.activity.create": 1,
+					"gravl.strava.webhook.action.error":    1,
+				},
+			},
+			events: []string{created},
+			copied: []string{"strava zwift 1360128428"},
+		},
+		{
+			harness: &internal.Harness{
+				Name: "invalid address",
+				Args: []string{"gravl", "strava", "serve", "--verify", "STRAVA", "--bind", "256.0.0.1", "--port", "0"},
+				Err:  "256.0.0.1",
+			},
+		},
+		{
+			harness: &internal.Harness{
+				Name: "unknown action",
+				Args: []string{"gravl", "strava", "serve", "--verify", "STRAVA", "--action", "email"},
+				Err:  "unknown action 'email'",
+			},
+		},
+		{
+			harness: &internal.Harness{
+				Name: "copy without uploader",
+				Args: []string{"gravl", "strava", "serve", "--verify", "STRAVA", "--action", "copy"},
+				Err:  "copy requires an uploader",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.harness.Name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+			defer cancel()
+			var copied []string
+			started := make(chan *url.URL, 1)
+			app := internal.NewTestApp(t, tt.harness, &cli.Command{
+				Name:        "strava",
+				Subcommands: []*cli.Command{strava.WebhookServeCommand(started)},
+			})
+			app.Before = gravl.Befores(app.Before, func(c *cli.Context) error {
+				gravl.Runtime(c).Copy = func(_ *cli.Context, from, to string, ids ...int64) error {
+					copied = append(copied, fmt.Sprintf("%s %s %d", from, to, ids[0]))
+					if to == "zwift" {
+						return errors.New("unknown uploader")
+					}
+					return nil
+				}
+				return nil
+			})
+			grp, ctx := errgroup.WithContext(ctx)
+			grp.Go(func() error {
+				if tt.events == nil {
+					return nil
+				}
+				defer cancel()
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case u := <-started:
+					for _, event := range tt.events {
+						status, err := post(ctx, u.String()+"/strava/webhook", event)
+						if err != nil {
+							return err
+						}
+						a.Equal(http.StatusOK, status)
+					}
+					return nil
+				}
+			})
+			grp.Go(func() error {
+				err := app.RunContext(ctx, tt.harness.Args)
+				if tt.harness.Err == "" {
+					a.NoError(err)
+				} else {
+					a.Error(err)
+					a.Contains(err.Error(), tt.harness.Err)
+				}
+				return nil
+			})
+			a.NoError(grp.Wait())
+			a.Equal(tt.copied, copied)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package strava
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	api "github.com/bzimmer/activity"
+	"github.com/bzimmer/activity/strava"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/maintenance"
+)
+
+// Gear returns the activities in the date range with their gear and usage
+func Gear(c *cli.Context, before, after time.Time) ([]*maintenance.Activity, error) {
+	if err := Before(c); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(c.Context, c.Duration("timeout"))
+	defer cancel()
+	var res []*maintenance.Activity
+	met := gravl.Runtime(c).Metrics
+	acts := gravl.Runtime(c).Strava.Activity.Activities(ctx, api.Pagination{}, strava.WithDateRange(before, after))
+	err := strava.ActivitiesIter(acts, func(act *strava.Activity) (bool, error) {
+		met.IncrCounter([]string{Provider, metricActivity}, 1)
+		res = append(res, &maintenance.Activity{
+			ID:        strconv.FormatInt(act.ID, 10),
+			Source:    Provider,
+			Name:      act.Name,
+			Sport:     act.SportType,
+			GearID:    act.GearID,
+			Start:     act.StartDate,
+			Distance:  act.Distance.Meters(),
+			Elevation: act.ElevationGain.Meters(),
+			Duration:  act.MovingTime.Seconds(),
+		})
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
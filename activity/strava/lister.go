@@ -0,0 +1,39 @@
+package strava
+
+import (
+	"context"
+	"time"
+
+	api "github.com/bzimmer/activity"
+	"github.com/bzimmer/activity/strava"
+
+	"github.com/bzimmer/gravl"
+)
+
+type lister struct {
+	client *strava.Client
+}
+
+// NewLister returns a lister for the authenticated athlete's activities
+func NewLister(client *strava.Client) gravl.Lister {
+	return &lister{client: client}
+}
+
+func (l *lister) List(ctx context.Context, count int, before, after time.Time) ([]*gravl.ActivityRef, error) {
+	var opts []strava.APIOption
+	if !before.IsZero() || !after.IsZero() {
+		if before.IsZero() {
+			before = time.Now()
+		}
+		opts = append(opts, strava.WithDateRange(before, after))
+	}
+	var refs []*gravl.ActivityRef
+	acts := l.client.Activity.Activities(ctx, api.Pagination{Total: count}, opts...)
+	if err := strava.ActivitiesIter(acts, func(act *strava.Activity) (bool, error) {
+		refs = append(refs, &gravl.ActivityRef{ID: act.ID, Name: act.Name, Start: act.StartDate})
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
@@ -0,0 +1,75 @@
+package strava
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	api "github.com/bzimmer/activity"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/time/rate"
+
+	"github.com/bzimmer/gravl/activity"
+)
+
+const apiURL = "https://www.strava.com/api/v3"
+
+// RouteExporter exports routes as GPX or TCX files, an operation not supported by the Strava client
+type RouteExporter struct {
+	Client  *http.Client
+	Limiter *rate.Limiter
+	BaseURL string
+}
+
+// NewRouteExporter returns a RouteExporter authenticated with the stored token or the token from the flags,
+// refreshed tokens are stored
+func NewRouteExporter(c *cli.Context) *RouteExporter {
+	return &RouteExporter{
+		Client:  activity.HTTPClient(c, Provider, config(c), token(c)),
+		Limiter: rate.NewLimiter(rate.Every(c.Duration("rate-limit")), c.Int("rate-burst")),
+		BaseURL: apiURL,
+	}
+}
+
+// ExportRoute returns the route as a GPX or TCX file
+func (r *RouteExporter) ExportRoute(ctx context.Context, routeID int64, format api.Format) (*api.File, error) {
+	//nolint:exhaustive // only gpx and tcx are supported
+	switch format {
+	case api.FormatGPX, api.FormatTCX:
+	default:
+		return nil, fmt.Errorf("unsupported route format '%s'", format)
+	}
+	u := fmt.Sprintf("%s/routes/%d/export_%s", r.BaseURL, routeID, format)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	if r.Limiter != nil {
+		if err = r.Limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	res, err := r.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= http.StatusBadRequest {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return nil, fmt.Errorf("route %d: %s %s", routeID, res.Status, strings.TrimSpace(string(msg)))
+	}
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%d", routeID)
+	return &api.File{
+		Name:     name,
+		Filename: name + "." + format.String(),
+		Format:   format,
+		Reader:   bytes.NewReader(data),
+	}, nil
+}
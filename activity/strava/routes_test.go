@@ -0,0 +1,58 @@
+package strava_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bzimmer/activity"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bzimmer/gravl/activity/strava"
+)
+
+func TestExportRoute(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/routes/2987654/export_gpx", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("<gpx></gpx>"))
+	})
+	mux.HandleFunc("/routes/2987654/export_tcx", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("<tcx></tcx>"))
+	})
+	svr := httptest.NewServer(mux)
+	t.Cleanup(svr.Close)
+
+	tests := []struct {
+		name, filename, data, err string
+		id                        int64
+		format                    activity.Format
+	}{
+		{name: "gpx", id: 2987654, format: activity.FormatGPX, filename: "2987654.gpx", data: "<gpx></gpx>"},
+		{name: "tcx", id: 2987654, format: activity.FormatTCX, filename: "2987654.tcx", data: "<tcx></tcx>"},
+		{name: "fit", id: 2987654, format: activity.FormatFIT, err: "unsupported route format 'fit'"},
+		{name: "not found", id: 1, format: activity.FormatGPX, err: "route 1: 404 Not Found"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			a := assert.New(t)
+			exp := &strava.RouteExporter{Client: svr.Client(), BaseURL: svr.URL}
+			file, err := exp.ExportRoute(t.Context(), tt.id, tt.format)
+			if tt.err != "" {
+				a.Nil(file)
+				a.ErrorContains(err, tt.err)
+				return
+			}
+			a.NoError(err)
+			a.Equal(tt.filename, file.Filename)
+			a.Equal(tt.format, file.Format)
+			data, err := io.ReadAll(file)
+			a.NoError(err)
+			a.Equal(tt.data, string(data))
+		})
+	}
+}
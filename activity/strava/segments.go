@@ -0,0 +1,93 @@
+package strava
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/time/rate"
+
+	"github.com/bzimmer/gravl/activity"
+)
+
+// SegmentEffort is an athlete's effort on a segment
+type SegmentEffort struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	ElapsedTime int       `json:"elapsed_time"`
+	MovingTime  int       `json:"moving_time"`
+	StartDate   time.Time `json:"start_date"`
+	Activity    struct {
+		ID int64 `json:"id"`
+	} `json:"activity"`
+	Segment struct {
+		ID int64 `json:"id"`
+	} `json:"segment"`
+}
+
+// Segments queries the athlete's segment efforts, an operation not supported by the Strava client
+type Segments struct {
+	Client  *http.Client
+	Limiter *rate.Limiter
+	BaseURL string
+}
+
+// NewSegments returns a Segments authenticated with the stored token or the token from the flags,
+// refreshed tokens are stored
+func NewSegments(c *cli.Context) *Segments {
+	return &Segments{
+		Client:  activity.HTTPClient(c, Provider, config(c), token(c)),
+		Limiter: rate.NewLimiter(rate.Every(c.Duration("rate-limit")), c.Int("rate-burst")),
+		BaseURL: apiURL,
+	}
+}
+
+// Efforts returns the athlete's efforts on the segment started within the date range
+func (s *Segments) Efforts(ctx context.Context, segmentID int64, before, after time.Time) ([]*SegmentEffort, error) {
+	const perPage = 200
+	var efforts []*SegmentEffort
+	for page := 1; ; page++ {
+		q := url.Values{}
+		q.Set("segment_id", fmt.Sprintf("%d", segmentID))
+		q.Set("start_date_local", after.Format(time.RFC3339))
+		q.Set("end_date_local", before.Format(time.RFC3339))
+		q.Set("per_page", fmt.Sprintf("%d", perPage))
+		q.Set("page", fmt.Sprintf("%d", page))
+		var res []*SegmentEffort
+		if err := s.get(ctx, segmentID, s.BaseURL+"/segment_efforts?"+q.Encode(), &res); err != nil {
+			return nil, err
+		}
+		efforts = append(efforts, res...)
+		if len(res) < perPage {
+			return efforts, nil
+		}
+	}
+}
+
+func (s *Segments) get(ctx context.Context, segmentID int64, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, http.NoBody)
+	if err != nil {
+		return err
+	}
+	if s.Limiter != nil {
+		if err = s.Limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= http.StatusBadRequest {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("segment %d: %s %s", segmentID, res.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
@@ -0,0 +1,60 @@
+package strava_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bzimmer/gravl/activity/strava"
+)
+
+func TestSegmentEfforts(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/segment_efforts", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("segment_id") != "229781" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"Record Not Found"}`))
+			return
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		efforts := make([]map[string]any, 0)
+		n := 200
+		if page > 1 {
+			n = 3
+		}
+		for i := range n {
+			efforts = append(efforts, map[string]any{
+				"id":           page*1000 + i,
+				"elapsed_time": 600 + i,
+				"start_date":   "2021-10-01T08:00:00Z",
+				"activity":     map[string]any{"id": 88},
+				"segment":      map[string]any{"id": 229781},
+			})
+		}
+		_ = json.NewEncoder(w).Encode(efforts)
+	})
+	svr := httptest.NewServer(mux)
+	t.Cleanup(svr.Close)
+
+	a := assert.New(t)
+	segments := &strava.Segments{Client: svr.Client(), BaseURL: svr.URL}
+	before, after := time.Now(), time.Now().Add(-24*time.Hour)
+
+	efforts, err := segments.Efforts(t.Context(), 229781, before, after)
+	a.NoError(err)
+	a.Len(efforts, 203)
+	a.Equal(int64(88), efforts[0].Activity.ID)
+	a.Equal(int64(229781), efforts[0].Segment.ID)
+	a.Equal(600, efforts[0].ElapsedTime)
+
+	efforts, err = segments.Efforts(t.Context(), 1, before, after)
+	a.Nil(efforts)
+	a.ErrorContains(err, "segment 1: 404 Not Found")
+}
@@ -2,7 +2,6 @@ package strava
 
 import (
 	"context"
-	"errors"
 	"slices"
 	"strconv"
 	"sync"
@@ -12,6 +11,7 @@ import (
 	"github.com/bzimmer/activity/strava"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/oauth2"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/time/rate"
 
@@ -64,6 +64,7 @@ func refresh(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	activity.SaveToken(c, Provider, tokens)
 	return gravl.Runtime(c).Encoder.Encode(tokens)
 }
 
@@ -76,40 +77,6 @@ func refreshCommand() *cli.Command {
 	}
 }
 
-func evaluator(c *cli.Context, evaluation string) (eval.Evaluator, error) {
-	if c.IsSet(evaluation) {
-		ev, err := gravl.Runtime(c).Evaluator(c.String(evaluation))
-		if err != nil {
-			return nil, err
-		}
-		return ev, nil
-	}
-	//nolint:nilnil // no evaluation
-	return nil, nil
-}
-
-func filter(c *cli.Context) (func(ctx context.Context, act *strava.Activity) (bool, error), error) {
-	ev, err := evaluator(c, "filter")
-	if err != nil {
-		return nil, err
-	}
-	if ev == nil {
-		return func(_ context.Context, _ *strava.Activity) (bool, error) { return true, nil }, nil
-	}
-	return ev.Bool, nil
-}
-
-func attributer(c *cli.Context) (func(ctx context.Context, act *strava.Activity) (any, error), error) {
-	ev, err := evaluator(c, "attribute")
-	if err != nil {
-		return nil, err
-	}
-	if ev == nil {
-		return func(_ context.Context, act *strava.Activity) (any, error) { return act, nil }, nil
-	}
-	return ev.Eval, nil
-}
-
 func daterange(c *cli.Context) (strava.APIOption, error) {
 	before, after, err := activity.DateRange(c, activity.NaturalParse, activity.AraddonParse)
 	if err != nil {
@@ -124,11 +91,15 @@ func activities(c *cli.Context) error {
 	ctx, cancel := context.WithTimeout(c.Context, c.Duration("timeout"))
 	defer cancel()
 
-	f, err := filter(c)
+	f, err := activity.Filter[*strava.Activity](c)
+	if err != nil {
+		return err
+	}
+	g, err := activity.Attributer[*strava.Activity](c)
 	if err != nil {
 		return err
 	}
-	g, err := attributer(c)
+	agg, err := activity.Aggregator[*strava.Activity](c)
 	if err != nil {
 		return err
 	}
@@ -146,9 +117,10 @@ func activities(c *cli.Context) error {
 		met.AddSample([]string{Provider, c.Command.Name}, float32(time.Since(t).Seconds()))
 	}(time.Now())
 
+	var grouped []any
 	metKey := []string{Provider, metricActivity}
 	acts := client.Activity.Activities(ctx, api.Pagination{Total: c.Int("count")}, opt)
-	return strava.ActivitiesIter(acts, func(act *strava.Activity) (bool, error) {
+	err = strava.ActivitiesIter(acts, func(act *strava.Activity) (bool, error) {
 		// filter
 		var ok bool
 		ok, err = f(ctx, act)
@@ -158,6 +130,12 @@ func activities(c *cli.Context) error {
 		if !ok {
 			return true, nil
 		}
+		// aggregate after all activities are collected
+		if agg != nil {
+			met.IncrCounter(metKey, 1)
+			grouped = append(grouped, act)
+			return true, nil
+		}
 		// extract
 		var ext any
 		ext, err = g(ctx, act)
@@ -177,32 +155,50 @@ func activities(c *cli.Context) error {
 		}
 		return true, nil
 	})
+	if err != nil || agg == nil {
+		return err
+	}
+	return aggregate(c, agg, grouped)
+}
+
+// aggregate the activities encoding one row per group
+func aggregate(c *cli.Context, agg eval.Aggregator, acts []any) error {
+	rows, err := agg.Aggregate(c.Context, acts)
+	if err != nil {
+		return err
+	}
+	enc := gravl.Runtime(c).Encoder
+	gravl.Runtime(c).Metrics.IncrCounter([]string{Provider, "group"}, float32(len(rows)))
+	for _, row := range rows {
+		if err = enc.Encode(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// environment documents the expression environment of activities
+func environment() string {
+	return activity.Environment[*strava.Activity](
+		"Distances and elevations are in meters, speeds in meters per second, and times in seconds.")
 }
 
 func activitiesCommand() *cli.Command {
 	return &cli.Command{
-		Name:        "activities",
-		Usage:       "Query activities for an athlete from Strava",
-		Description: "Query the Strava API for a list of activities for the authenticated athlete, with optional date range filtering and expression-based attribute extraction",
-		Aliases:     []string{"A"},
-		Flags: append([]cli.Flag{
+		Name:  "activities",
+		Usage: "Query activities for an athlete from Strava",
+		Description: "Query the Strava API for a list of activities for the authenticated athlete, with optional " +
+			"date range filtering, expression-based attribute extraction, and aggregation of the activities into " +
+			"groups with one row emitted per group. " + environment(),
+		Aliases: []string{"A"},
+		Flags: append(append(append([]cli.Flag{
 			&cli.IntFlag{
 				Name:    "count",
 				Aliases: []string{"N"},
 				Value:   0,
 				Usage:   "The number of activities to query from Strava (the number returned will be <= N)",
 			},
-			&cli.StringFlag{
-				Name:    "filter",
-				Aliases: []string{"f"},
-				Usage:   "Expression for filtering activities to remove",
-			},
-			&cli.StringSliceFlag{
-				Name:    "attribute",
-				Aliases: []string{"B"},
-				Usage:   "Evaluate the expression on an activity and return only those results",
-			},
-		}, activity.DateRangeFlags()...),
+		}, activity.EvalFlags()...), activity.AggregateFlags()...), activity.DateRangeFlags()...),
 		Action: activities,
 	}
 }
@@ -402,79 +398,36 @@ func updateFlags() []cli.Flag {
 		usage := pairs[i][1]
 		flags = append(flags, &cli.BoolFlag{Name: name, Usage: usage})
 	}
-	return flags
+	flags = append(flags,
+		&cli.StringSliceFlag{
+			Name:  "set",
+			Usage: "Set a field, one of name, sport, gear, description, hidden, commute, or trainer, eg 'commute=true'",
+		},
+		&cli.StringFlag{
+			Name:  "where",
+			Usage: "Expression choosing the activities in the date range to update rather than activity ids",
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Report the planned changes of each activity without updating it",
+		},
+	)
+	return append(flags, activity.DateRangeFlags()...)
 }
 
-func updateCommand() *cli.Command { //nolint:gocognit
+func updateCommand() *cli.Command {
 	return &cli.Command{
-		Name:        "update",
-		Usage:       "Update an activity on Strava",
-		Description: "Update attributes of a specific Strava activity such as name, sport type, gear, description, commute status, trainer status, and visibility",
-		ArgsUsage:   activityArgsUsage,
-		Flags:       updateFlags(),
-		Action: func(c *cli.Context) error {
-			met := gravl.Runtime(c).Metrics
-			return entity(c, func(ctx context.Context, client *strava.Client, id int64) (any, error) {
-				update := &strava.UpdatableActivity{ID: id}
-				if c.IsSet("name") {
-					val := c.String("name")
-					update.Name = &val
-					met.IncrCounter([]string{Provider, c.Command.Name, "name"}, 1)
-				}
-				if c.IsSet("sport") {
-					val := c.String("sport")
-					update.SportType = &val
-					met.IncrCounter([]string{Provider, c.Command.Name, "sport"}, 1)
-				}
-				if c.IsSet("gear") {
-					val := c.String("gear")
-					update.GearID = &val
-					met.IncrCounter([]string{Provider, c.Command.Name, "gear"}, 1)
-				}
-				if c.IsSet("description") {
-					val := c.String("description")
-					update.Description = &val
-					met.IncrCounter([]string{Provider, c.Command.Name, "description"}, 1)
-				}
-				switch {
-				case c.IsSet("hidden") && c.IsSet("no-hidden"):
-					return nil, errors.New("only one of hidden or no-hidden can be specified")
-				case c.IsSet("hidden"):
-					val := true
-					update.Hidden = &val
-					met.IncrCounter([]string{Provider, c.Command.Name, "hidden"}, 1)
-				case c.IsSet("no-hidden"):
-					val := false
-					update.Hidden = &val
-					met.IncrCounter([]string{Provider, c.Command.Name, "no-hidden"}, 1)
-				}
-				switch {
-				case c.IsSet("commute") && c.IsSet("no-commute"):
-					return nil, errors.New("only one of commute or no-commute can be specified")
-				case c.IsSet("commute"):
-					val := true
-					update.Commute = &val
-					met.IncrCounter([]string{Provider, c.Command.Name, "commute"}, 1)
-				case c.IsSet("no-commute"):
-					val := false
-					update.Commute = &val
-					met.IncrCounter([]string{Provider, c.Command.Name, "no-commute"}, 1)
-				}
-				switch {
-				case c.IsSet("trainer") && c.IsSet("no-trainer"):
-					return nil, errors.New("only one of trainer or no-trainer can be specified")
-				case c.IsSet("trainer"):
-					val := true
-					update.Trainer = &val
-					met.IncrCounter([]string{Provider, c.Command.Name, "trainer"}, 1)
-				case c.IsSet("no-trainer"):
-					val := false
-					update.Trainer = &val
-					met.IncrCounter([]string{Provider, c.Command.Name, "no-trainer"}, 1)
-				}
-				return client.Activity.Update(ctx, update)
-			})
-		},
+		Name:  "update",
+		Usage: "Update activities on Strava",
+		Description: "Update attributes of Strava activities such as name, sport type, gear, description, commute " +
+			"status, trainer status, and visibility. The activities are either specified by id or, with `--where`, " +
+			"chosen by evaluating the expression on each activity in the date range, eg `--where '.Type == \"Ride\" " +
+			"&& !weekend(.StartDateLocal)' --set commute=true --after 2024-01-01`. Activities already matching the " +
+			"update are skipped and `--dry-run` reports the planned changes without updating the activities. " +
+			environment(),
+		ArgsUsage: activityArgsUsage,
+		Flags:     updateFlags(),
+		Action:    update,
 	}
 }
 
@@ -560,15 +513,32 @@ func oauthCommand() *cli.Command {
 	})
 }
 
+func config(c *cli.Context) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     c.String("strava-client-id"),
+		ClientSecret: c.String("strava-client-secret"),
+		Endpoint:     strava.Endpoint(),
+	}
+}
+
+// token returns an expired token from the flags if set, otherwise the stored token if available
+func token(c *cli.Context) *oauth2.Token {
+	return activity.Token(c, Provider, &oauth2.Token{
+		// setting the access token to the empty string results in an error, so we use the refresh token as a placeholder
+		AccessToken:  c.String("strava-refresh-token"),
+		RefreshToken: c.String("strava-refresh-token"),
+		Expiry:       time.Now().Add(-1 * time.Minute),
+	}, "strava-refresh-token")
+}
+
 func Before(c *cli.Context) error {
 	before.Do(func() {
+		tok := token(c)
 		var client *strava.Client
 		client, errBefore = strava.NewClient(
-			strava.WithTokenCredentials(
-				// setting the access token to the empty string results in an error, so we use the refresh token as a placeholder
-				c.String("strava-refresh-token"), c.String("strava-refresh-token"), time.Now().Add(-1*time.Minute)),
+			strava.WithTokenCredentials(tok.AccessToken, tok.RefreshToken, tok.Expiry),
 			strava.WithClientCredentials(c.String("strava-client-id"), c.String("strava-client-secret")),
-			strava.WithAutoRefresh(c.Context),
+			strava.WithHTTPClient(activity.HTTPClient(c, Provider, config(c), tok)),
 			strava.WithHTTPTracing(c.Bool("http-tracing")),
 			strava.WithRateLimiter(rate.NewLimiter(
 				rate.Every(c.Duration("rate-limit")), c.Int("rate-burst"))))
@@ -583,13 +553,19 @@ func Before(c *cli.Context) error {
 	return errBefore
 }
 
+// NewUploader returns an uploader whose uploads are retried on failure, which is safe
+// because Strava rejects a duplicate of a previously uploaded file
+func NewUploader(client *strava.Client) api.Uploader {
+	return activity.IdempotentUploader(client.Uploader())
+}
+
 func Command() *cli.Command {
 	return &cli.Command{
 		Name:        Provider,
 		Category:    metricActivity,
 		Usage:       "Query Strava for rides and routes",
 		Description: "Operations supported by the Strava API",
-		Flags:       append(AuthFlags(), activity.RateLimitFlags()...),
+		Flags:       append(append(AuthFlags(), activity.RateLimitFlags()...), activity.RetryFlags()...),
 		Before:      Before,
 		Subcommands: []*cli.Command{
 			activitiesCommand(),
@@ -131,6 +131,27 @@ func TestActivities(t *testing.T) {
 			Args:     []string{"gravl", "strava", "activities", "-N", "3", "--attribute", ".Type"},
 			Counters: map[string]int{"gravl.strava.activity": 3},
 		},
+		{
+			Name: "activities grouped",
+			Args: []string{"gravl", "strava", "activities", "-N", "3", "--group-by", ".Type", "--aggregate", "count(), sum(.Distance)"},
+			Counters: map[string]int{
+				"gravl.strava.activity": 3,
+				"gravl.strava.group":    2,
+			},
+		},
+		{
+			Name: "activities aggregated",
+			Args: []string{"gravl", "strava", "activities", "-N", "3", "--aggregate", "count()"},
+			Counters: map[string]int{
+				"gravl.strava.activity": 3,
+				"gravl.strava.group":    1,
+			},
+		},
+		{
+			Name: "activities grouped with attributes",
+			Args: []string{"gravl", "strava", "activities", "--group-by", ".Type", "--attribute", ".ID"},
+			Err:  "attributes cannot be combined with group-by or aggregate",
+		},
 		{
 			Name: "activities since invalid",
 			Args: []string{"gravl", "strava", "activities", "-N", "3", "--since", "72h"},
@@ -449,3 +470,137 @@ func TestUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateWhere(t *testing.T) {
+	a := assert.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/athlete/activities", func(w http.ResponseWriter, r *http.Request) {
+		acts := []*api.Activity{
+			{ID: 201, Type: "Ride", Name: "Morning Ride"},
+			{ID: 202, Type: "Ride", Name: "Evening Ride", Commute: true, GearID: "b123"},
+			{ID: 203, Type: "Run", Name: "Lunch Run"},
+		}
+		if r.URL.Query().Get("page") > "1" {
+			acts = nil
+		}
+		a.NoError(json.NewEncoder(w).Encode(acts))
+	})
+	mux.HandleFunc("/activities/201", func(w http.ResponseWriter, r *http.Request) {
+		a.Equal(http.MethodPut, r.Method)
+		var act api.UpdatableActivity
+		a.NoError(json.NewDecoder(r.Body).Decode(&act))
+		a.True(*act.Commute)
+		a.Equal("b123", *act.GearID)
+		a.Nil(act.Trainer)
+		a.NoError(json.NewEncoder(w).Encode(&api.Activity{ID: 201, Commute: true, GearID: "b123"}))
+	})
+	mux.HandleFunc("/activities/301", func(w http.ResponseWriter, r *http.Request) {
+		a.Equal(http.MethodGet, r.Method)
+		a.NoError(json.NewEncoder(w).Encode(&api.Activity{ID: 301, Name: "Gravel", GearID: "b456"}))
+	})
+
+	tests := []*internal.Harness{
+		{
+			Name: "where",
+			Args: []string{"gravl", "strava", "update", "--where", ".Type == 'Ride'",
+				"--set", "commute=true", "--set", "gear=b123"},
+			Counters: map[string]int{
+				"gravl.strava.update.match":     2,
+				"gravl.strava.update.unchanged": 1,
+				"gravl.strava.update":           1,
+				"gravl.strava.update.commute":   1,
+				"gravl.strava.update.gear":      1,
+			},
+		},
+		{
+			Name: "where with flags",
+			Args: []string{"gravl", "strava", "update", "--where", ".ID == 201", "--commute", "--set", "gear=b123"},
+			Counters: map[string]int{
+				"gravl.strava.update.match":   1,
+				"gravl.strava.update.commute": 1,
+			},
+		},
+		{
+			Name: "where dry run",
+			Args: []string{"gravl", "strava", "update", "--dry-run", "--where", ".Type == 'Ride'", "--commute"},
+			Counters: map[string]int{
+				"gravl.strava.update.match":     2,
+				"gravl.strava.update.unchanged": 1,
+				"gravl.strava.update.planned":   1,
+			},
+		},
+		{
+			Name: "dry run",
+			Args: []string{"gravl", "strava", "update", "--dry-run", "--set", "gear=b123", "301"},
+			Counters: map[string]int{
+				"gravl.strava.update": 1,
+			},
+		},
+		{
+			Name: "where with ids",
+			Args: []string{"gravl", "strava", "update", "--where", ".Type == 'Ride'", "--commute", "201"},
+			Err:  "activity ids cannot be combined with --where",
+		},
+		{
+			Name: "where without fields",
+			Args: []string{"gravl", "strava", "update", "--where", ".Type == 'Ride'"},
+			Err:  "no fields specified to update",
+		},
+		{
+			Name: "invalid assignment",
+			Args: []string{"gravl", "strava", "update", "--set", "commute", "201"},
+			Err:  "invalid assignment 'commute', expected FIELD=VALUE",
+		},
+		{
+			Name: "unknown field",
+			Args: []string{"gravl", "strava", "update", "--set", "kudos=10", "201"},
+			Err:  "unknown field 'kudos'",
+		},
+		{
+			Name: "invalid value",
+			Args: []string{"gravl", "strava", "update", "--set", "commute=often", "201"},
+			Err:  "invalid value for commute: 'often'",
+		},
+		{
+			Name: "field specified more than once",
+			Args: []string{"gravl", "strava", "update", "--no-commute", "--set", "commute=true", "201"},
+			Err:  "commute specified more than once",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			internal.Run(t, tt, mux, command)
+		})
+	}
+}
+
+func TestLister(t *testing.T) {
+	a := assert.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/athlete/activities", func(w http.ResponseWriter, _ *http.Request) {
+		acts := []*api.Activity{{ID: 1, Name: "Foo"}, {ID: 2, Name: "Bar"}, {ID: 3, Name: "Baz"}}
+		enc := json.NewEncoder(w)
+		a.NoError(enc.Encode(acts))
+	})
+
+	tt := &internal.Harness{Name: "lister", Args: []string{"gravl", "lister"}}
+	internal.Run(t, tt, mux, func(t *testing.T, baseURL string) *cli.Command {
+		cmd := command(t, baseURL)
+		return &cli.Command{
+			Name:   tt.Name,
+			Flags:  cmd.Flags,
+			Before: cmd.Before,
+			Action: func(c *cli.Context) error {
+				refs, err := strava.NewLister(gravl.Runtime(c).Strava).List(c.Context, 2, time.Time{}, time.Time{})
+				a.NoError(err)
+				a.Len(refs, 2)
+				a.Equal(int64(1), refs[0].ID)
+				a.Equal("Bar", refs[1].Name)
+				return nil
+			},
+		}
+	})
+}
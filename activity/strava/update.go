@@ -0,0 +1,250 @@
+package strava
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	api "github.com/bzimmer/activity"
+	"github.com/bzimmer/activity/strava"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+)
+
+// change is the current and updated value of an activity's field, the current value is nil if unknown
+type change struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// plan is the planned update of an activity
+type plan struct {
+	ID      int64              `json:"id"`
+	Name    string             `json:"name"`
+	Changes map[string]*change `json:"changes"`
+}
+
+// updates returns the update, without an activity id, of the fields set by the flags and `--set` assignments
+func updates(c *cli.Context) (*strava.UpdatableActivity, error) {
+	update := &strava.UpdatableActivity{}
+	strs := map[string]**string{
+		"name":        &update.Name,
+		"sport":       &update.SportType,
+		"gear":        &update.GearID,
+		"description": &update.Description,
+	}
+	bools := map[string]**bool{
+		"hidden":  &update.Hidden,
+		"commute": &update.Commute,
+		"trainer": &update.Trainer,
+	}
+	for name, field := range strs {
+		if c.IsSet(name) {
+			val := c.String(name)
+			*field = &val
+		}
+	}
+	for _, name := range []string{"hidden", "commute", "trainer"} {
+		var val bool
+		switch {
+		case c.IsSet(name) && c.IsSet("no-"+name):
+			return nil, fmt.Errorf("only one of %s or no-%s can be specified", name, name)
+		case c.IsSet(name):
+			val = true
+		case c.IsSet("no-" + name):
+			val = false
+		default:
+			continue
+		}
+		*bools[name] = &val
+	}
+	for _, set := range c.StringSlice("set") {
+		name, val, ok := strings.Cut(set, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid assignment '%s', expected FIELD=VALUE", set)
+		}
+		name = strings.TrimSpace(name)
+		if field, ok := strs[name]; ok {
+			if *field != nil {
+				return nil, fmt.Errorf("%s specified more than once", name)
+			}
+			*field = &val
+			continue
+		}
+		field, ok := bools[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown field '%s'", name)
+		}
+		if *field != nil {
+			return nil, fmt.Errorf("%s specified more than once", name)
+		}
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: '%s'", name, val)
+		}
+		*field = &b
+	}
+	return update, nil
+}
+
+// diff returns the planned update of the activity, fields already at their updated value are omitted
+func diff(act *strava.Activity, fields *strava.UpdatableActivity) *plan {
+	p := &plan{ID: act.ID, Name: act.Name, Changes: make(map[string]*change)}
+	strs := []struct {
+		name    string
+		from    string
+		to      *string
+		unknown bool
+	}{
+		{"name", act.Name, fields.Name, false},
+		{"sport", act.SportType, fields.SportType, false},
+		{"gear", act.GearID, fields.GearID, false},
+		{"description", "", fields.Description, true},
+	}
+	for _, x := range strs {
+		switch {
+		case x.to == nil:
+		case x.unknown:
+			p.Changes[x.name] = &change{To: *x.to}
+		case x.from != *x.to:
+			p.Changes[x.name] = &change{From: x.from, To: *x.to}
+		}
+	}
+	bools := []struct {
+		name    string
+		from    bool
+		to      *bool
+		unknown bool
+	}{
+		{"hidden", false, fields.Hidden, true},
+		{"commute", act.Commute, fields.Commute, false},
+		{"trainer", act.Trainer, fields.Trainer, false},
+	}
+	for _, x := range bools {
+		switch {
+		case x.to == nil:
+		case x.unknown:
+			p.Changes[x.name] = &change{To: *x.to}
+		case x.from != *x.to:
+			p.Changes[x.name] = &change{From: x.from, To: *x.to}
+		}
+	}
+	return p
+}
+
+// apply returns an entityFunc updating the activity with the fields
+func apply(c *cli.Context, fields *strava.UpdatableActivity) entityFunc {
+	met := gravl.Runtime(c).Metrics
+	counter := func(name string, val bool) string {
+		if val {
+			return name
+		}
+		return "no-" + name
+	}
+	return func(ctx context.Context, client *strava.Client, id int64) (any, error) {
+		x := *fields
+		x.ID = id
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"name", x.Name != nil},
+			{"sport", x.SportType != nil},
+			{"gear", x.GearID != nil},
+			{"description", x.Description != nil},
+		} {
+			if f.set {
+				met.IncrCounter([]string{Provider, c.Command.Name, f.name}, 1)
+			}
+		}
+		for _, f := range []struct {
+			name string
+			val  *bool
+		}{
+			{"hidden", x.Hidden},
+			{"commute", x.Commute},
+			{"trainer", x.Trainer},
+		} {
+			if f.val != nil {
+				met.IncrCounter([]string{Provider, c.Command.Name, counter(f.name, *f.val)}, 1)
+			}
+		}
+		return client.Activity.Update(ctx, &x)
+	}
+}
+
+// where updates the activities in the date range for which the `--where` expression is true
+func where(c *cli.Context, fields *strava.UpdatableActivity) error {
+	if c.NArg() > 0 {
+		return errors.New("activity ids cannot be combined with --where")
+	}
+	if *fields == (strava.UpdatableActivity{}) {
+		return errors.New("no fields specified to update")
+	}
+	ev, err := gravl.Runtime(c).Evaluator(c.String("where"), (*strava.Activity)(nil))
+	if err != nil {
+		return err
+	}
+	opt, err := daterange(c)
+	if err != nil {
+		return err
+	}
+	enc := gravl.Runtime(c).Encoder
+	met := gravl.Runtime(c).Metrics
+	var ids []string
+	err = func() error {
+		ctx, cancel := context.WithTimeout(c.Context, c.Duration("timeout"))
+		defer cancel()
+		acts := gravl.Runtime(c).Strava.Activity.Activities(ctx, api.Pagination{}, opt)
+		return strava.ActivitiesIter(acts, func(act *strava.Activity) (bool, error) {
+			ok, err := ev.Bool(ctx, act)
+			if err != nil {
+				return false, err
+			}
+			if !ok {
+				return true, nil
+			}
+			met.IncrCounter([]string{Provider, c.Command.Name, "match"}, 1)
+			p := diff(act, fields)
+			if len(p.Changes) == 0 {
+				met.IncrCounter([]string{Provider, c.Command.Name, "unchanged"}, 1)
+				return true, nil
+			}
+			if c.Bool("dry-run") {
+				met.IncrCounter([]string{Provider, c.Command.Name, "planned"}, 1)
+				return true, enc.Encode(p)
+			}
+			log.Info().Int64("id", act.ID).Str("name", act.Name).Msg("matched")
+			ids = append(ids, strconv.FormatInt(act.ID, 10))
+			return true, nil
+		})
+	}()
+	if err != nil || c.Bool("dry-run") {
+		return err
+	}
+	return entityWithArgs(c, apply(c, fields), ids)
+}
+
+func update(c *cli.Context) error {
+	fields, err := updates(c)
+	if err != nil {
+		return err
+	}
+	if c.IsSet("where") {
+		return where(c, fields)
+	}
+	if c.Bool("dry-run") {
+		return entity(c, func(ctx context.Context, client *strava.Client, id int64) (any, error) {
+			act, err := client.Activity.Activity(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			return diff(act, fields), nil
+		})
+	}
+	return entity(c, apply(c, fields))
+}
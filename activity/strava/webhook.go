@@ -117,10 +117,11 @@ func whsubscribeCommand() *cli.Command {
 func webhookCommand() *cli.Command {
 	return &cli.Command{
 		Name:        metricWebhook,
-		Usage:       "Manage webhook subscriptions",
-		Description: "Manage Strava webhook subscriptions for receiving event notifications",
+		Usage:       "Manage webhook subscriptions and receive events",
+		Description: "Manage Strava webhook subscriptions and serve the callback receiving event notifications",
 		Subcommands: []*cli.Command{
 			whlistCommand(),
+			WebhookServeCommand(nil),
 			whsubscribeCommand(),
 			whunsubscribeCommand(),
 		},
@@ -0,0 +1,111 @@
+package activity
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/oauth2"
+
+	"github.com/bzimmer/gravl"
+)
+
+// Tokens returns the store of the provider's tokens
+func Tokens(c *cli.Context, provider string) gravl.TokenStore {
+	rt := gravl.Runtime(c)
+	if store, ok := rt.TokenStores[provider]; ok {
+		return store
+	}
+	return rt.Tokens
+}
+
+// Token returns the provider's stored token if available, otherwise the token from the flags.
+// A token from the flags set, on the command line or by environment variable, since it last
+// seeded the store replaces the stored token
+func Token(c *cli.Context, provider string, token *oauth2.Token, flags ...string) *oauth2.Token {
+	store := Tokens(c, provider)
+	stored, err := store.Token(provider)
+	if err != nil {
+		log.Warn().Err(err).Str("provider", provider).Msg("failed to read stored token")
+		return token
+	}
+	for _, name := range flags {
+		if !c.IsSet(name) {
+			continue
+		}
+		if stored != nil {
+			var seeded bool
+			if seeded, err = store.Seeded(provider, token); err != nil || seeded {
+				return stored
+			}
+		}
+		if err = store.Seed(provider, token); err != nil {
+			log.Warn().Err(err).Str("provider", provider).Msg("failed to store token")
+		}
+		return token
+	}
+	if stored == nil {
+		return token
+	}
+	return stored
+}
+
+// SaveToken stores the provider's token, logging rather than failing on error since the
+// token remains usable for the current invocation
+func SaveToken(c *cli.Context, provider string, token *oauth2.Token) {
+	if err := Tokens(c, provider).Save(provider, token); err != nil {
+		log.Warn().Err(err).Str("provider", provider).Msg("failed to store token")
+		return
+	}
+	gravl.Runtime(c).Metrics.IncrCounter([]string{provider, "token", "stored"}, 1)
+}
+
+// Refresh returns the token, exchanging the refresh token for a new token if the access token
+// has expired, and stores a new token so a rotated refresh token survives into the next invocation
+func Refresh(c *cli.Context, provider string, cfg *oauth2.Config, token *oauth2.Token) (*oauth2.Token, error) {
+	fresh, err := cfg.TokenSource(HTTPContext(c, provider), token).Token()
+	if err != nil {
+		return nil, err
+	}
+	if fresh.AccessToken != token.AccessToken {
+		SaveToken(c, provider, fresh)
+	}
+	return fresh, nil
+}
+
+// storingTokenSource stores each new token so a token refreshed, and possibly rotated,
+// while making requests survives into the next invocation
+type storingTokenSource struct {
+	mu   sync.Mutex
+	c    *cli.Context
+	src  oauth2.TokenSource
+	prov string
+	last string
+}
+
+func (s *storingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, err := s.src.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token.AccessToken != s.last {
+		s.last = token.AccessToken
+		SaveToken(s.c, s.prov, token)
+	}
+	return token, nil
+}
+
+// HTTPClient returns a client using the provider's transport which refreshes the token as
+// needed, storing each refreshed token
+func HTTPClient(c *cli.Context, provider string, cfg *oauth2.Config, token *oauth2.Token) *http.Client {
+	ctx := HTTPContext(c, provider)
+	return oauth2.NewClient(ctx, &storingTokenSource{
+		c:    c,
+		src:  cfg.TokenSource(ctx, token),
+		prov: provider,
+		last: token.AccessToken,
+	})
+}
@@ -0,0 +1,181 @@
+package activity_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/oauth2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/activity"
+	"github.com/bzimmer/gravl/internal"
+)
+
+func TestToken(t *testing.T) {
+	a := assert.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		a.NoError(r.ParseForm())
+		a.Equal("refresh", r.Form.Get("refresh_token"))
+		w.Header().Set("Content-Type", "application/json")
+		a.NoError(json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "rotated-access",
+			"refresh_token": "rotated-refresh",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		}))
+	})
+	mux.HandleFunc("GET /athlete", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer rotated-access" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		}
+	})
+
+	expired := &oauth2.Token{AccessToken: "access", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Minute)}
+	tests := []*internal.Harness{
+		{
+			Name: "flags",
+			Args: []string{"gravl", "flags"},
+			Action: func(c *cli.Context) error {
+				a.Equal(expired, activity.Token(c, "strava", expired))
+				return nil
+			},
+		},
+		{
+			Name: "stored",
+			Args: []string{"gravl", "stored"},
+			Before: func(c *cli.Context) error {
+				return gravl.Runtime(c).Tokens.Save("strava", &oauth2.Token{RefreshToken: "stored"})
+			},
+			Action: func(c *cli.Context) error {
+				a.Equal("stored", activity.Token(c, "strava", expired).RefreshToken)
+				return nil
+			},
+		},
+		{
+			Name: "flags set",
+			Args: []string{"gravl", "flags set", "--strava-refresh-token", "refresh"},
+			Before: func(c *cli.Context) error {
+				return gravl.Runtime(c).Tokens.Save("strava", &oauth2.Token{RefreshToken: "stored"})
+			},
+			Action: func(c *cli.Context) error {
+				// the flags seed the store
+				a.Equal(expired, activity.Token(c, "strava", expired, "strava-refresh-token"))
+				a.Equal("refresh", activity.Token(c, "strava", expired, "strava-access-token").RefreshToken)
+				// a token refreshed since is preferred until the flags change
+				a.NoError(gravl.Runtime(c).Tokens.Save("strava", &oauth2.Token{RefreshToken: "rotated"}))
+				a.Equal("rotated", activity.Token(c, "strava", expired, "strava-refresh-token").RefreshToken)
+				changed := &oauth2.Token{RefreshToken: "changed"}
+				a.Equal(changed, activity.Token(c, "strava", changed, "strava-refresh-token"))
+				a.Equal("changed", activity.Token(c, "strava", expired).RefreshToken)
+				return nil
+			},
+		},
+		{
+			Name: "refreshed token stored",
+			Args: []string{"gravl", "refreshed token stored"},
+			Counters: map[string]int{
+				"gravl.strava.token.stored": 1,
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			command := func(_ *testing.T, url string) *cli.Command {
+				action := tt.Action
+				if action == nil {
+					action = func(c *cli.Context) error {
+						cfg := &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: url + "/token"}}
+						client := activity.HTTPClient(c, "strava", cfg, expired)
+						for range 2 {
+							req, err := http.NewRequestWithContext(c.Context, http.MethodGet, url+"/athlete", http.NoBody)
+							a.NoError(err)
+							res, err := client.Do(req)
+							a.NoError(err)
+							a.NoError(res.Body.Close())
+							a.Equal(http.StatusOK, res.StatusCode)
+						}
+						token, err := gravl.Runtime(c).Tokens.Token("strava")
+						a.NoError(err)
+						a.Equal("rotated-refresh", token.RefreshToken)
+						return nil
+					}
+				}
+				return &cli.Command{
+					Name: tt.Name,
+					Flags: append(append(activity.RateLimitFlags(), activity.RetryFlags()...),
+						&cli.StringFlag{Name: "strava-access-token"}, &cli.StringFlag{Name: "strava-refresh-token"}),
+					Action: action,
+				}
+			}
+			internal.Run(t, tt, mux, command)
+		})
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	a := assert.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		a.NoError(r.ParseForm())
+		a.Equal("refresh", r.Form.Get("refresh_token"))
+		w.Header().Set("Content-Type", "application/json")
+		a.NoError(json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "rotated-access",
+			"refresh_token": "rotated-refresh",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		}))
+	})
+
+	tests := []struct {
+		name, refresh string
+		token         *oauth2.Token
+		stored        int
+	}{
+		{
+			name:    "expired",
+			token:   &oauth2.Token{AccessToken: "access", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Minute)},
+			refresh: "rotated-refresh",
+			stored:  1,
+		},
+		{
+			name:    "valid",
+			token:   &oauth2.Token{AccessToken: "access", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)},
+			refresh: "refresh",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &internal.Harness{Name: tt.name, Args: []string{"gravl", tt.name}}
+			if tt.stored > 0 {
+				h.Counters = map[string]int{"gravl.strava.token.stored": tt.stored}
+			}
+			internal.Run(t, h, mux, func(_ *testing.T, url string) *cli.Command {
+				return &cli.Command{
+					Name:  tt.name,
+					Flags: append(activity.RateLimitFlags(), activity.RetryFlags()...),
+					Action: func(c *cli.Context) error {
+						cfg := &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: url + "/token"}}
+						token, err := activity.Refresh(c, "strava", cfg, tt.token)
+						a.NoError(err)
+						a.Equal(tt.refresh, token.RefreshToken)
+						if tt.stored > 0 {
+							token, err = gravl.Runtime(c).Tokens.Token("strava")
+							a.NoError(err)
+							a.Equal(tt.refresh, token.RefreshToken)
+						}
+						return nil
+					},
+				}
+			})
+		})
+	}
+}
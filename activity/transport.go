@@ -0,0 +1,245 @@
+package activity
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-metrics"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/oauth2"
+
+	"github.com/bzimmer/gravl"
+)
+
+const (
+	metricRateLimit = "ratelimit"
+	// rateThreshold is the fraction of a window's quota after which the remaining
+	// requests are spread evenly over the time left in the window
+	rateThreshold = 0.8
+	// retryAfter is the wait after a 429 response without a Retry-After header
+	retryAfter = 15 * time.Second
+	// maxThrottled is the number of times a request is attempted again after a 429 response
+	maxThrottled = 3
+)
+
+// window is a period over which a provider enforces a request quota
+type window struct {
+	name  string
+	reset func(time.Time) time.Time
+}
+
+// windows returns the windows, in header order, of the comma separated limits reported by Strava
+func windows() []window {
+	return []window{
+		{name: "15m", reset: func(t time.Time) time.Time {
+			return t.UTC().Truncate(15 * time.Minute).Add(15 * time.Minute)
+		}},
+		{name: "daily", reset: func(t time.Time) time.Time {
+			y, m, d := t.UTC().Date()
+			return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+		}},
+	}
+}
+
+// RateLimitTransport adapts the rate of requests to the quota reported by the provider
+//
+// The usage reported in the `X-RateLimit-Limit` and `X-RateLimit-Usage` headers (and their
+// `X-ReadRateLimit` counterparts) slows requests as a window nears its limit and pauses them
+// until the window resets once the limit is reached. A 429 response pauses requests for the
+// duration of the `Retry-After` header before the request is attempted again.
+type RateLimitTransport struct {
+	Provider  string
+	Transport http.RoundTripper
+	Metrics   *metrics.Metrics
+	// Now returns the current time, defaults to time.Now
+	Now func() time.Time
+	// Sleep waits for the duration, defaults to a timer honoring the context
+	Sleep func(context.Context, time.Duration) error
+
+	mu    sync.Mutex
+	until time.Time
+}
+
+var transports sync.Mutex //nolint:gochecknoglobals // guards the runtime's transports
+
+// Transport returns the transport shared by all clients of the provider, retrying failed
+// requests and adapting to the provider's quota; the transport is created on first use
+func Transport(c *cli.Context, provider string) http.RoundTripper {
+	transports.Lock()
+	defer transports.Unlock()
+	rt := gravl.Runtime(c)
+	if t, ok := rt.Transports[provider]; ok {
+		return t
+	}
+	t := &RetryTransport{
+		Provider: provider,
+		Transport: &RateLimitTransport{
+			Provider:  provider,
+			Transport: http.DefaultTransport,
+			Metrics:   rt.Metrics,
+		},
+		Metrics: rt.Metrics,
+		Retries: c.Int("retries"),
+		Backoff: c.Duration("retry-backoff"),
+		MaxWait: c.Duration("retry-max-wait"),
+	}
+	rt.Transports[provider] = t
+	return t
+}
+
+// HTTPContext returns a context for creating oauth2 clients which use the provider's transport
+func HTTPContext(c *cli.Context, provider string) context.Context {
+	return context.WithValue(c.Context, oauth2.HTTPClient, &http.Client{Transport: Transport(c, provider)})
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (t *RateLimitTransport) now() time.Time {
+	if t.Now == nil {
+		return time.Now()
+	}
+	return t.Now()
+}
+
+func (t *RateLimitTransport) sleep(ctx context.Context, d time.Duration) error {
+	if t.Sleep == nil {
+		return sleep(ctx, d)
+	}
+	return t.Sleep(ctx, d)
+}
+
+func (t *RateLimitTransport) transport() http.RoundTripper {
+	if t.Transport == nil {
+		return http.DefaultTransport
+	}
+	return t.Transport
+}
+
+// RoundTrip waits as required by the quota before executing the request
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for i := 0; ; i++ {
+		if err := t.wait(req.Context()); err != nil {
+			return nil, err
+		}
+		res, err := t.transport().RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		t.observe(res)
+		if res.StatusCode != http.StatusTooManyRequests || i == maxThrottled {
+			return res, nil
+		}
+		// the request was not processed so it is safe to attempt again if the body can be replayed
+		retry := req.Clone(req.Context())
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return res, nil
+			}
+			if retry.Body, err = req.GetBody(); err != nil {
+				return res, nil //nolint:nilerr // the throttled response is the better result
+			}
+		}
+		_, _ = io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		req = retry
+	}
+}
+
+// wait until the quota allows another request
+func (t *RateLimitTransport) wait(ctx context.Context) error {
+	t.mu.Lock()
+	d := t.until.Sub(t.now())
+	t.mu.Unlock()
+	if d <= 0 {
+		return nil
+	}
+	t.Metrics.IncrCounter([]string{t.Provider, metricRateLimit, "wait"}, 1)
+	t.Metrics.AddSample([]string{t.Provider, metricRateLimit, "wait"}, float32(d.Seconds()))
+	log.Info().Str("provider", t.Provider).Dur("wait", d).Msg(metricRateLimit)
+	return t.sleep(ctx, d)
+}
+
+// observe the quota reported by the response, delaying subsequent requests if needed
+func (t *RateLimitTransport) observe(res *http.Response) {
+	now := t.now()
+	var delay time.Duration
+	for _, prefix := range []string{"X-RateLimit", "X-ReadRateLimit"} {
+		delay = max(delay, t.usage(res.Header, prefix, now))
+	}
+	if res.StatusCode == http.StatusTooManyRequests {
+		t.Metrics.IncrCounter([]string{t.Provider, metricRateLimit, "throttled"}, 1)
+		delay = max(delay, parseRetryAfter(res.Header.Get("Retry-After"), now))
+	}
+	if delay <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if until := now.Add(delay); until.After(t.until) {
+		t.until = until
+	}
+}
+
+// usage reports the remaining quota of each window and returns the delay needed to stay within it
+func (t *RateLimitTransport) usage(header http.Header, prefix string, now time.Time) time.Duration {
+	limits := parseInts(header.Get(prefix + "-Limit"))
+	usages := parseInts(header.Get(prefix + "-Usage"))
+	name := strings.ToLower(strings.TrimPrefix(prefix, "X-"))
+	var delay time.Duration
+	for i, w := range windows() {
+		if i >= len(limits) || i >= len(usages) || limits[i] <= 0 {
+			break
+		}
+		remaining := max(limits[i]-usages[i], 0)
+		t.Metrics.SetGauge([]string{t.Provider, name, w.name, "remaining"}, float32(remaining))
+		left := w.reset(now).Sub(now)
+		switch {
+		case remaining == 0:
+			delay = max(delay, left)
+		case float64(usages[i]) >= rateThreshold*float64(limits[i]):
+			delay = max(delay, left/time.Duration(remaining+1))
+		}
+	}
+	return delay
+}
+
+func parseInts(s string) []int {
+	var x []int
+	for _, v := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return nil
+		}
+		x = append(x, n)
+	}
+	return x
+}
+
+// parseRetryAfter returns the duration specified as either seconds or an http date
+func parseRetryAfter(s string, now time.Time) time.Duration {
+	if s == "" {
+		return retryAfter
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Duration(n) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		return t.Sub(now)
+	}
+	return retryAfter
+}
@@ -0,0 +1,225 @@
+package activity_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl/activity"
+	"github.com/bzimmer/gravl/internal"
+)
+
+func newTransport(t *testing.T, sleeps *[]time.Duration) (*activity.RateLimitTransport, *metrics.InmemSink) {
+	t.Helper()
+	cfg := metrics.DefaultConfig("gravl")
+	cfg.EnableHostname = false
+	cfg.EnableRuntimeMetrics = false
+	sink := metrics.NewInmemSink(time.Hour, time.Hour)
+	met, err := metrics.New(cfg, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &activity.RateLimitTransport{
+		Provider: "strava",
+		Metrics:  met,
+		Now: func() time.Time {
+			return time.Date(2021, time.October, 1, 8, 5, 0, 0, time.UTC)
+		},
+		Sleep: func(_ context.Context, d time.Duration) error {
+			*sleeps = append(*sleeps, d)
+			return nil
+		},
+	}, sink
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name, limit, usage string
+		wait, remaining    time.Duration
+		gauges             map[string]float32
+	}{
+		{
+			name: "no headers",
+		},
+		{
+			name:  "under the threshold",
+			limit: "200,2000",
+			usage: "10,100",
+			gauges: map[string]float32{
+				"gravl.strava.ratelimit.15m.remaining":   190,
+				"gravl.strava.ratelimit.daily.remaining": 1900,
+			},
+		},
+		{
+			name:  "nearly used up",
+			limit: "200,2000",
+			usage: "180,100",
+			// ten minutes left in the window spread over the twenty remaining requests
+			wait:   10 * time.Minute / 21,
+			gauges: map[string]float32{"gravl.strava.ratelimit.15m.remaining": 20},
+		},
+		{
+			name:   "window used up",
+			limit:  "200,2000",
+			usage:  "200,100",
+			wait:   10 * time.Minute,
+			gauges: map[string]float32{"gravl.strava.ratelimit.15m.remaining": 0},
+		},
+		{
+			name:   "daily used up",
+			limit:  "200,2000",
+			usage:  "10,2000",
+			wait:   15*time.Hour + 55*time.Minute,
+			gauges: map[string]float32{"gravl.strava.ratelimit.daily.remaining": 0},
+		},
+		{
+			name:  "invalid headers",
+			limit: "200,abc",
+			usage: "10,100",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			a := assert.New(t)
+			svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if tt.limit != "" {
+					w.Header().Set("X-RateLimit-Limit", tt.limit)
+					w.Header().Set("X-RateLimit-Usage", tt.usage)
+				}
+			}))
+			t.Cleanup(svr.Close)
+
+			var sleeps []time.Duration
+			rt, sink := newTransport(t, &sleeps)
+			client := &http.Client{Transport: rt}
+			for range 2 {
+				res, err := client.Get(svr.URL)
+				a.NoError(err)
+				a.NoError(res.Body.Close())
+			}
+			if tt.wait == 0 {
+				a.Empty(sleeps)
+			} else {
+				a.Equal([]time.Duration{tt.wait}, sleeps)
+			}
+			gauges := sink.Data()[0].Gauges
+			for key, val := range tt.gauges {
+				a.Equal(val, gauges[key].Value, key)
+			}
+		})
+	}
+}
+
+func TestRateLimitTransportThrottled(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	var calls atomic.Int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		body, err := io.ReadAll(r.Body)
+		a.NoError(err)
+		a.Equal("ride", string(body))
+		switch r.URL.Path {
+		case "/always":
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/date":
+			if n == 1 {
+				w.Header().Set("Retry-After", "Fri, 01 Oct 2021 08:07:00 GMT")
+				w.WriteHeader(http.StatusTooManyRequests)
+			}
+		default:
+			if n == 1 {
+				w.Header().Set("Retry-After", "30")
+				w.WriteHeader(http.StatusTooManyRequests)
+			}
+		}
+	}))
+	t.Cleanup(svr.Close)
+
+	tests := []struct {
+		path   string
+		status int
+		calls  int32
+		sleeps []time.Duration
+	}{
+		{path: "/once", status: http.StatusOK, calls: 2, sleeps: []time.Duration{30 * time.Second}},
+		{path: "/date", status: http.StatusOK, calls: 2, sleeps: []time.Duration{2 * time.Minute}},
+		{path: "/always", status: http.StatusTooManyRequests, calls: 4,
+			sleeps: []time.Duration{5 * time.Second, 5 * time.Second, 5 * time.Second}},
+	}
+	for _, tt := range tests {
+		calls.Store(0)
+		var sleeps []time.Duration
+		rt, _ := newTransport(t, &sleeps)
+		// the sleeps are recorded rather than taken so advance the clock as a sleep would
+		now := rt.Now()
+		rt.Now = func() time.Time { return now }
+		rt.Sleep = func(_ context.Context, d time.Duration) error {
+			sleeps = append(sleeps, d)
+			now = now.Add(d)
+			return nil
+		}
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, svr.URL+tt.path, strings.NewReader("ride"))
+		a.NoError(err)
+		res, err := rt.RoundTrip(req)
+		a.NoError(err)
+		a.NoError(res.Body.Close())
+		a.Equal(tt.status, res.StatusCode, tt.path)
+		a.Equal(tt.calls, calls.Load(), tt.path)
+		a.Equal(tt.sleeps, sleeps, tt.path)
+	}
+}
+
+func TestRateLimitTransportCancelled(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	t.Cleanup(svr.Close)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, svr.URL, http.NoBody)
+	a.NoError(err)
+	res, err := (&activity.RateLimitTransport{Provider: "strava", Metrics: metrics.Default()}).RoundTrip(req)
+	a.Nil(res)
+	a.ErrorIs(err, context.DeadlineExceeded)
+}
+
+func TestTransport(t *testing.T) {
+	a := assert.New(t)
+	tt := &internal.Harness{
+		Name: "transport",
+		Args: []string{"gravl", "transport", "--retries", "2"},
+	}
+	internal.Run(t, tt, nil, func(_ *testing.T, _ string) *cli.Command {
+		return &cli.Command{
+			Name:  tt.Name,
+			Flags: activity.RetryFlags(),
+			Action: func(c *cli.Context) error {
+				strava := activity.Transport(c, "strava")
+				a.Same(strava, activity.Transport(c, "strava"))
+				a.NotSame(strava, activity.Transport(c, "rwgps"))
+				a.Equal(2, strava.(*activity.RetryTransport).Retries)
+				return nil
+			},
+		}
+	})
+}
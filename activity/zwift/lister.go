@@ -0,0 +1,49 @@
+package zwift
+
+import (
+	"context"
+	"time"
+
+	api "github.com/bzimmer/activity"
+	"github.com/bzimmer/activity/zwift"
+
+	"github.com/bzimmer/gravl"
+)
+
+type lister struct {
+	client *zwift.Client
+}
+
+// NewLister returns a lister for the authenticated athlete's activities
+func NewLister(client *zwift.Client) gravl.Lister {
+	return &lister{client: client}
+}
+
+func (l *lister) List(ctx context.Context, count int, before, after time.Time) ([]*gravl.ActivityRef, error) {
+	profile, err := l.client.Profile.Profile(ctx, zwift.Me)
+	if err != nil {
+		return nil, err
+	}
+	// the zwift api does not support a date range so filter on the client, querying all
+	// activities if the range is bounded so the count applies to those in the range
+	total := count
+	if !before.IsZero() || !after.IsZero() {
+		total = 0
+	}
+	acts, err := l.client.Activity.Activities(ctx, profile.ID, api.Pagination{Total: total})
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]*gravl.ActivityRef, 0, len(acts))
+	for _, act := range acts {
+		if count > 0 && len(refs) == count {
+			break
+		}
+		start := act.StartDate.Time
+		if (!after.IsZero() && !start.After(after)) || (!before.IsZero() && !start.Before(before)) {
+			continue
+		}
+		refs = append(refs, &gravl.ActivityRef{ID: act.ID, Name: act.Name, Start: start})
+	}
+	return refs, nil
+}
@@ -72,6 +72,7 @@ func refresh(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	activity.SaveToken(c, Provider, token)
 	gravl.Runtime(c).Metrics.IncrCounter([]string{Provider, c.Command.Name}, 1)
 	return gravl.Runtime(c).Encoder.Encode(token)
 }
@@ -98,18 +99,37 @@ func activities(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	f, err := activity.Filter[*zwift.Activity](c)
+	if err != nil {
+		return err
+	}
+	g, err := activity.Attributer[*zwift.Activity](c)
+	if err != nil {
+		return err
+	}
 	met := gravl.Runtime(c).Metrics
 	enc := gravl.Runtime(c).Encoder
 	met.IncrCounter([]string{Provider, c.Command.Name}, 1)
 	metKey := []string{Provider, metricActivity}
 	for _, act := range acts {
+		var ok bool
+		if ok, err = f(ctx, act); err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		var ext any
+		if ext, err = g(ctx, act); err != nil {
+			return err
+		}
 		met.IncrCounter(metKey, 1)
 		log.Info().
 			Time("date", act.StartDate.Time).
 			Int64("id", act.ID).
 			Str("name", act.Name).
 			Msg(c.Command.Name)
-		if err = enc.Encode(act); err != nil {
+		if err = enc.Encode(ext); err != nil {
 			return err
 		}
 	}
@@ -118,18 +138,19 @@ func activities(c *cli.Context) error {
 
 func activitiesCommand() *cli.Command {
 	return &cli.Command{
-		Name:        "activities",
-		Usage:       "Query activities for an athlete from Zwift",
-		Description: "Query the Zwift API for a list of activities for the authenticated athlete",
-		Aliases:     []string{"A"},
-		Flags: []cli.Flag{
+		Name:  "activities",
+		Usage: "Query activities for an athlete from Zwift",
+		Description: "Query the Zwift API for a list of activities for the authenticated athlete. " +
+			activity.Environment[*zwift.Activity]("Fields are in the units named by the Zwift API, eg `DistanceInMeters`."),
+		Aliases: []string{"A"},
+		Flags: append([]cli.Flag{
 			&cli.IntFlag{
 				Name:    "count",
 				Aliases: []string{"N"},
 				Value:   0,
 				Usage:   "The number of activities to query from Zwift (the number returned will be <= N)",
 			},
-		},
+		}, activity.EvalFlags()...),
 		Action: activities,
 	}
 }
@@ -274,9 +295,15 @@ func AuthFlags() []cli.Flag {
 // Before configures the zwift client
 func Before(c *cli.Context) error {
 	before.Do(func() {
+		// a valid stored token avoids authenticating with the username and password
+		auth := zwift.WithTokenRefresh(c.String("zwift-username"), c.String("zwift-password"))
+		if tok := activity.Token(c, Provider, nil); tok != nil && tok.Valid() {
+			auth = zwift.WithTokenCredentials(tok.AccessToken, tok.RefreshToken, tok.Expiry)
+		}
 		var client *zwift.Client
 		client, errBefore = zwift.NewClient(
-			zwift.WithTokenRefresh(c.String("zwift-username"), c.String("zwift-password")),
+			zwift.WithTransport(activity.Transport(c, Provider)),
+			auth,
 			zwift.WithHTTPTracing(c.Bool("http-tracing")),
 			zwift.WithRateLimiter(rate.NewLimiter(
 				rate.Every(c.Duration("rate-limit")), c.Int("rate-burst"))))
@@ -297,7 +324,7 @@ func Command() *cli.Command {
 		Category:    metricActivity,
 		Usage:       "Query Zwift for activities",
 		Description: "Operations supported by the Zwift API",
-		Flags:       append(AuthFlags(), activity.RateLimitFlags()...),
+		Flags:       append(append(AuthFlags(), activity.RateLimitFlags()...), activity.RetryFlags()...),
 		Before:      Before,
 		Subcommands: []*cli.Command{
 			activitiesCommand(),
@@ -130,6 +130,14 @@ func TestActivities(t *testing.T) {
 				"gravl.zwift.activities": 1,
 			},
 		},
+		{
+			Name: "filtered activities",
+			Args: []string{"gravl", "zwift", "activities", "--filter", ".ID > 9010"},
+			Counters: map[string]int{
+				"gravl.zwift.activity":   2,
+				"gravl.zwift.activities": 1,
+			},
+		},
 	}
 	for _, tt := range tests {
 		tt := tt
@@ -287,3 +295,35 @@ func TestBefore(t *testing.T) {
 		})
 	}
 }
+
+func TestLister(t *testing.T) {
+	a := assert.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/profiles/me", func(w http.ResponseWriter, _ *http.Request) {
+		enc := json.NewEncoder(w)
+		a.NoError(enc.Encode(&api.Profile{ID: 103}))
+	})
+	mux.HandleFunc("/api/profiles/103/activities/", func(w http.ResponseWriter, _ *http.Request) {
+		acts := []*api.Activity{{ID: 9001}, {ID: 9021}, {ID: 9501}}
+		enc := json.NewEncoder(w)
+		a.NoError(enc.Encode(acts))
+	})
+
+	tt := &internal.Harness{Name: "lister", Args: []string{"gravl", "lister"}}
+	internal.Run(t, tt, mux, func(t *testing.T, baseURL string) *cli.Command {
+		cmd := command(t, baseURL)
+		return &cli.Command{
+			Name:   tt.Name,
+			Flags:  cmd.Flags,
+			Before: cmd.Before,
+			Action: func(c *cli.Context) error {
+				refs, err := zwift.NewLister(gravl.Runtime(c).Zwift).List(c.Context, 2, time.Time{}, time.Time{})
+				a.NoError(err)
+				a.Len(refs, 2)
+				a.Equal(int64(9021), refs[1].ID)
+				return nil
+			},
+		}
+	})
+}
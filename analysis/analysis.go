@@ -0,0 +1,358 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrNoSamples is returned when the streams do not include any timed samples
+var ErrNoSamples = errors.New("no samples")
+
+// Config of the athlete's thresholds and the analysis
+type Config struct {
+	// FTP is the functional threshold power in watts, power zones, intensity factor, and TSS
+	// are computed only if greater than zero
+	FTP float64 `json:"ftp"`
+	// MaxHeartRate in beats per minute, heart rate zones are computed only if greater than zero
+	MaxHeartRate float64 `json:"max_heartrate"`
+	// PowerZones are the upper bounds of each power zone but the last as a fraction of FTP
+	PowerZones []float64 `json:"power_zones"`
+	// HeartRateZones are the upper bounds of each heart rate zone but the last as a fraction of max heart rate
+	HeartRateZones []float64 `json:"heartrate_zones"`
+	// Durations in seconds of the mean-max power curve
+	Durations []int `json:"durations"`
+	// ClimbGain is the minimum elevation gain in meters of a climb
+	ClimbGain float64 `json:"climb_gain"`
+	// ClimbGrade is the minimum average grade in percent of a climb
+	ClimbGrade float64 `json:"climb_grade"`
+	// ThresholdHeartRate in beats per minute for estimating training stress from heart rate,
+	// defaults to 90 percent of max heart rate if zero
+	ThresholdHeartRate float64 `json:"threshold_heartrate"`
+	// Intensity is the intensity factor assumed when estimating training stress from duration
+	Intensity float64 `json:"intensity"`
+	// FitnessDays is the time constant in days of chronic training load
+	FitnessDays int `json:"fitness_days"`
+	// FatigueDays is the time constant in days of acute training load
+	FatigueDays int `json:"fatigue_days"`
+}
+
+// DefaultConfig returns the seven Coggan power zones, five heart rate zones, a power
+// curve from one second to one hour, and the conventional 42 and 7 day training load
+func DefaultConfig() *Config {
+	return &Config{
+		PowerZones:     []float64{0.55, 0.75, 0.90, 1.05, 1.20, 1.50},
+		HeartRateZones: []float64{0.60, 0.70, 0.80, 0.90},
+		Durations:      []int{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+		ClimbGain:      30,
+		ClimbGrade:     3,
+		Intensity:      0.7,
+		FitnessDays:    42,
+		FatigueDays:    7,
+	}
+}
+
+// Analysis of an activity's streams
+type Analysis struct {
+	// Duration in seconds
+	Duration int `json:"duration"`
+	// Moving is the duration in seconds excluding pauses in the recording
+	Moving     int         `json:"moving"`
+	Power      *Power      `json:"power,omitempty"`
+	HeartRate  *HeartRate  `json:"heartrate,omitempty"`
+	Decoupling *Decoupling `json:"decoupling,omitempty"`
+	Climbs     []*Climb    `json:"climbs,omitempty"`
+}
+
+// Power metrics
+type Power struct {
+	Average         float64   `json:"average"`
+	Normalized      float64   `json:"normalized"`
+	IntensityFactor float64   `json:"intensity_factor,omitempty"`
+	TSS             float64   `json:"tss,omitempty"`
+	Curve           []*Effort `json:"curve"`
+	Zones           []*Zone   `json:"zones,omitempty"`
+}
+
+// HeartRate metrics
+type HeartRate struct {
+	Average float64 `json:"average"`
+	Max     float64 `json:"max"`
+	Zones   []*Zone `json:"zones,omitempty"`
+}
+
+// Effort is the highest average power held for the duration
+type Effort struct {
+	// Duration in seconds
+	Duration int `json:"duration"`
+	// Start in seconds from the start of the activity
+	Start int     `json:"start"`
+	Watts float64 `json:"watts"`
+}
+
+// Zone is the time spent between the zone's bounds
+type Zone struct {
+	Zone int     `json:"zone"`
+	Min  float64 `json:"min"`
+	// Max is zero for the last, unbounded, zone
+	Max     float64 `json:"max,omitempty"`
+	Seconds int     `json:"seconds"`
+	Percent float64 `json:"percent"`
+}
+
+// Decoupling compares the efficiency, output per heart beat, of the first and second half of the
+// activity, a value greater than 5 percent suggests the effort exceeded the athlete's aerobic endurance
+type Decoupling struct {
+	// Basis is the output compared to heart rate, either power or speed
+	Basis   string  `json:"basis"`
+	First   float64 `json:"first"`
+	Second  float64 `json:"second"`
+	Percent float64 `json:"percent"`
+}
+
+// Climb is a sustained ascent
+type Climb struct {
+	// Start in seconds from the start of the activity
+	Start int `json:"start"`
+	// Duration in seconds
+	Duration int `json:"duration"`
+	// Distance in meters
+	Distance float64 `json:"distance,omitempty"`
+	// Gain in meters
+	Gain float64 `json:"gain"`
+	// Grade in percent
+	Grade float64 `json:"grade,omitempty"`
+	// VAM is the velocità ascensionale media, the rate of ascent in meters per hour
+	VAM   float64 `json:"vam"`
+	Watts float64 `json:"watts,omitempty"`
+}
+
+// Analyze the streams
+func Analyze(s *Streams, cfg *Config) (*Analysis, error) {
+	if len(s.Time) == 0 {
+		return nil, ErrNoSamples
+	}
+	for i := 1; i < len(s.Time); i++ {
+		if s.Time[i] < s.Time[i-1] {
+			return nil, fmt.Errorf("time decreases at sample %d", i)
+		}
+	}
+	n := int(s.Time[len(s.Time)-1]) + 1
+	power := resample(s.Time, s.Power, n)
+	hr := resample(s.Time, s.HeartRate, n)
+	dist := resample(s.Time, s.Distance, n)
+	ele := resample(s.Time, s.Elevation, n)
+
+	a := &Analysis{Duration: n, Moving: len(resample(s.Time, s.Time, n).present())}
+	if power.valid() {
+		a.Power = analyzePower(power, cfg)
+	}
+	if hr.valid() {
+		a.HeartRate = &HeartRate{Average: round(hr.mean()), Max: round(hr.max())}
+		if cfg.MaxHeartRate > 0 {
+			a.HeartRate.Zones = zones(hr, cfg.MaxHeartRate, cfg.HeartRateZones)
+		}
+		switch {
+		case power.valid():
+			a.Decoupling = decoupling("power", power, hr)
+		case dist.valid():
+			a.Decoupling = decoupling("speed", speed(dist), hr)
+		}
+	}
+	if ele.valid() {
+		a.Climbs = climbs(ele, dist, power, cfg)
+	}
+	return a, nil
+}
+
+// analyzePower computes the normalized power and TSS from the moving samples, pauses in
+// the recording are excluded rather than counted as zero watts
+func analyzePower(power series, cfg *Config) *Power {
+	zeroed, moving := power.zeroed(), power.present()
+	np := normalized(moving)
+	p := &Power{
+		Average:    round(zeroed.mean()),
+		Normalized: round(np),
+		Curve:      curve(zeroed, cfg.Durations),
+	}
+	if cfg.FTP > 0 {
+		intensity := np / cfg.FTP
+		p.IntensityFactor = round(intensity)
+		p.TSS = round(tss(len(moving), intensity))
+		p.Zones = zones(power, cfg.FTP, cfg.PowerZones)
+	}
+	return p
+}
+
+// normalized power is the fourth root of the mean of the fourth power of the 30 second rolling average
+func normalized(power series) float64 {
+	const window = 30
+	if len(power) < window {
+		return 0
+	}
+	var sum, total float64
+	for i, v := range power {
+		sum += v
+		if i >= window {
+			sum -= power[i-window]
+		}
+		if i >= window-1 {
+			total += math.Pow(sum/window, 4)
+		}
+	}
+	return math.Pow(total/float64(len(power)-window+1), 0.25)
+}
+
+// curve returns the mean-max power for each duration no longer than the activity
+func curve(power series, durations []int) []*Effort {
+	efforts := make([]*Effort, 0, len(durations))
+	for _, d := range durations {
+		if d <= 0 || d > len(power) {
+			continue
+		}
+		var sum float64
+		for _, v := range power[:d] {
+			sum += v
+		}
+		best, start := sum, 0
+		for i := d; i < len(power); i++ {
+			sum += power[i] - power[i-d]
+			if sum > best {
+				best, start = sum, i-d+1
+			}
+		}
+		efforts = append(efforts, &Effort{Duration: d, Start: start, Watts: round(best / float64(d))})
+	}
+	return efforts
+}
+
+// zones returns the time spent in each zone, the bounds are fractions of the threshold
+func zones(x series, threshold float64, bounds []float64) []*Zone {
+	zs := make([]*Zone, len(bounds)+1)
+	for i := range zs {
+		zs[i] = &Zone{Zone: i + 1}
+		if i > 0 {
+			zs[i].Min = math.Round(bounds[i-1] * threshold)
+		}
+		if i < len(bounds) {
+			zs[i].Max = math.Round(bounds[i] * threshold)
+		}
+	}
+	var total int
+	for _, v := range x {
+		if math.IsNaN(v) {
+			continue
+		}
+		total++
+		i := len(bounds)
+		for j, b := range bounds {
+			if v < b*threshold {
+				i = j
+				break
+			}
+		}
+		zs[i].Seconds++
+	}
+	for _, z := range zs {
+		if total > 0 {
+			z.Percent = round(float64(z.Seconds) / float64(total) * 100)
+		}
+	}
+	return zs
+}
+
+// speed in meters per second derived from the distance
+func speed(dist series) series {
+	x := make(series, len(dist))
+	x[0] = math.NaN()
+	for i := 1; i < len(dist); i++ {
+		x[i] = dist[i] - dist[i-1]
+	}
+	return x
+}
+
+// decoupling compares the ratio of output to heart rate of each half of the activity
+func decoupling(basis string, output, hr series) *Decoupling {
+	var idx []int
+	for i := range hr {
+		if !math.IsNaN(output[i]) && !math.IsNaN(hr[i]) && hr[i] > 0 {
+			idx = append(idx, i)
+		}
+	}
+	if len(idx) < 2 {
+		return nil
+	}
+	ratio := func(idx []int) float64 {
+		var out, beats float64
+		for _, i := range idx {
+			out += output[i]
+			beats += hr[i]
+		}
+		return out / beats
+	}
+	first, second := ratio(idx[:len(idx)/2]), ratio(idx[len(idx)/2:])
+	if first == 0 {
+		return nil
+	}
+	return &Decoupling{
+		Basis:   basis,
+		First:   first,
+		Second:  second,
+		Percent: round((first - second) / first * 100),
+	}
+}
+
+// climbDescent is the drop in meters from the highest point which ends a climb
+const climbDescent = 10
+
+// climbs returns the ascents meeting the minimum gain and grade
+func climbs(ele, dist, power series, cfg *Config) []*Climb {
+	var res []*Climb
+	add := func(start, peak int) {
+		gain := ele[peak] - ele[start]
+		if peak == start || gain < cfg.ClimbGain {
+			return
+		}
+		c := &Climb{
+			Start:    start,
+			Duration: peak - start,
+			Gain:     round(gain),
+			VAM:      math.Round(gain / float64(peak-start) * 3600),
+		}
+		if dist.valid() && !math.IsNaN(dist[start]) && !math.IsNaN(dist[peak]) {
+			d := dist[peak] - dist[start]
+			if d <= 0 || gain/d*100 < cfg.ClimbGrade {
+				return
+			}
+			c.Distance = round(d)
+			c.Grade = round(gain / d * 100)
+		}
+		if power.valid() {
+			c.Watts = round(power[start : peak+1].zeroed().mean())
+		}
+		res = append(res, c)
+	}
+	start, peak := -1, -1
+	for i, v := range ele {
+		if math.IsNaN(v) {
+			continue
+		}
+		switch {
+		case start < 0:
+			start, peak = i, i
+		case v <= ele[start] || ele[peak]-v >= climbDescent:
+			add(start, peak)
+			start, peak = i, i
+		case v > ele[peak]:
+			peak = i
+		}
+	}
+	if start >= 0 {
+		add(start, peak)
+	}
+	return res
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
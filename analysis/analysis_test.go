@@ -0,0 +1,237 @@
+package analysis_test
+
+import (
+	"encoding/json"
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bzimmer/gravl/analysis"
+	"github.com/bzimmer/gravl/track"
+)
+
+var update = flag.Bool("update", false, "update the golden files") //nolint:gochecknoglobals // test flag
+
+// sampler returns the streams sampled every `every` seconds for `n` seconds
+type sampler struct {
+	n, every                       int
+	power, hr, distance, elevation func(i int) float64
+}
+
+func (s *sampler) streams() *analysis.Streams {
+	x := &analysis.Streams{}
+	for i := 0; i < s.n; i += s.every {
+		x.Time = append(x.Time, float64(i))
+		for _, f := range []struct {
+			stream *[]float64
+			value  func(int) float64
+		}{
+			{&x.Power, s.power},
+			{&x.HeartRate, s.hr},
+			{&x.Distance, s.distance},
+			{&x.Elevation, s.elevation},
+		} {
+			if f.value != nil {
+				*f.stream = append(*f.stream, f.value(i))
+			}
+		}
+	}
+	return x
+}
+
+func steady() *analysis.Streams {
+	return (&sampler{
+		n: 3600, every: 1,
+		power:     func(i int) float64 { return math.Round(200 + 20*math.Sin(float64(i)/60)) },
+		hr:        func(i int) float64 { return math.Round(130 + float64(i)/360) },
+		distance:  func(i int) float64 { return float64(i) * 8 },
+		elevation: func(int) float64 { return 100 },
+	}).streams()
+}
+
+func intervals() *analysis.Streams {
+	power := func(i int) float64 {
+		switch {
+		case i < 600:
+			return 150
+		case i < 1500:
+			if (i-600)%180 < 60 {
+				return 400
+			}
+			return 120
+		default:
+			return 100
+		}
+	}
+	return (&sampler{
+		n: 1800, every: 1,
+		power: power,
+		hr:    func(i int) float64 { return math.Round(100 + power(i)/5) },
+	}).streams()
+}
+
+func climb() *analysis.Streams {
+	return (&sampler{
+		n: 2400, every: 1,
+		power: func(i int) float64 {
+			if i >= 600 && i < 1800 {
+				return 250
+			}
+			return 160
+		},
+		hr: func(i int) float64 {
+			if i >= 600 && i < 1800 {
+				return 155
+			}
+			return 135
+		},
+		distance: func(i int) float64 {
+			switch {
+			case i < 600:
+				return float64(i) * 9
+			case i < 1800:
+				return 5400 + float64(i-600)*4
+			default:
+				return 10200 + float64(i-1800)*12
+			}
+		},
+		elevation: func(i int) float64 {
+			switch {
+			case i < 600:
+				return 50
+			case i < 1800:
+				return 50 + float64(i-600)*0.24
+			default:
+				return math.Max(50, 338-float64(i-1800)*0.6)
+			}
+		},
+	}).streams()
+}
+
+func paused() *analysis.Streams {
+	s := (&sampler{
+		n: 1200, every: 2,
+		hr:       func(i int) float64 { return math.Round(140 + float64(i)/60) },
+		distance: func(i int) float64 { return math.Min(float64(i), 600)*6 + math.Max(float64(i)-660, 0)*6 },
+	}).streams()
+	// the recording is paused for a minute after ten minutes
+	var x analysis.Streams
+	for i, t := range s.Time {
+		if t > 600 && t < 660 {
+			continue
+		}
+		x.Time = append(x.Time, t)
+		x.HeartRate = append(x.HeartRate, s.HeartRate[i])
+		x.Distance = append(x.Distance, s.Distance[i])
+	}
+	return &x
+}
+
+func golden(t *testing.T, name string, v any) {
+	t.Helper()
+	a := assert.New(t)
+	data, err := json.MarshalIndent(v, "", "  ")
+	a.NoError(err)
+	path := filepath.Join("testdata", name+".golden.json")
+	if *update {
+		a.NoError(os.WriteFile(path, append(data, '\n'), 0o600))
+	}
+	expected, err := os.ReadFile(path)
+	a.NoError(err)
+	a.JSONEq(string(expected), string(data))
+}
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		streams *analysis.Streams
+	}{
+		{name: "steady", streams: steady()},
+		{name: "intervals", streams: intervals()},
+		{name: "climb", streams: climb()},
+		{name: "paused", streams: paused()},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := analysis.DefaultConfig()
+			cfg.FTP = 250
+			cfg.MaxHeartRate = 185
+			res, err := analysis.Analyze(tt.streams, cfg)
+			assert.NoError(t, err)
+			golden(t, tt.name, res)
+		})
+	}
+}
+
+func TestAnalyzeWithoutThresholds(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	res, err := analysis.Analyze(intervals(), analysis.DefaultConfig())
+	a.NoError(err)
+	a.NotZero(res.Power.Normalized)
+	a.Zero(res.Power.TSS)
+	a.Nil(res.Power.Zones)
+	a.Nil(res.HeartRate.Zones)
+}
+
+func TestAnalyzePausedPower(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	// a steady 200 watts for an hour with the recording paused for ten minutes in the middle
+	var s analysis.Streams
+	for i := range 4200 {
+		if i >= 1800 && i < 2400 {
+			continue
+		}
+		s.Time = append(s.Time, float64(i))
+		s.Power = append(s.Power, 200)
+	}
+	cfg := analysis.DefaultConfig()
+	cfg.FTP = 250
+	res, err := analysis.Analyze(&s, cfg)
+	a.NoError(err)
+	a.Equal(4200, res.Duration)
+	a.Equal(200.0, res.Power.Normalized)
+	a.Equal(0.8, res.Power.IntensityFactor)
+	// the moving time is the hour and the few seconds the last sample before the pause is held
+	a.InDelta(64.0, res.Power.TSS, 0.1)
+}
+
+func TestAnalyzeInvalid(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	res, err := analysis.Analyze(&analysis.Streams{}, analysis.DefaultConfig())
+	a.Nil(res)
+	a.ErrorIs(err, analysis.ErrNoSamples)
+
+	res, err = analysis.Analyze(&analysis.Streams{Time: []float64{0, 2, 1}}, analysis.DefaultConfig())
+	a.Nil(res)
+	a.ErrorContains(err, "time decreases at sample 2")
+}
+
+func TestFromTrack(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	start := time.Date(2021, time.October, 1, 8, 0, 0, 0, time.UTC)
+	trk := &track.Track{Points: []*track.Point{
+		{Time: start, Power: 200, HeartRate: 120, Channels: track.ChannelPower | track.ChannelHeartRate},
+		{Time: start.Add(time.Second), HeartRate: 121, Channels: track.ChannelHeartRate},
+		{Power: 180, Channels: track.ChannelPower},
+		{Time: start.Add(2 * time.Second), Power: 210, HeartRate: 122, Channels: track.ChannelPower | track.ChannelHeartRate},
+	}}
+	s := analysis.FromTrack(trk)
+	a.Equal([]float64{0, 1, 2}, s.Time)
+	a.Equal([]float64{120, 121, 122}, s.HeartRate)
+	a.Len(s.Power, 3)
+	a.True(math.IsNaN(s.Power[1]))
+	a.Empty(s.Distance)
+	a.Empty(s.Elevation)
+}
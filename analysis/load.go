@@ -0,0 +1,95 @@
+package analysis
+
+import (
+	"time"
+)
+
+// Stress is the training stress score of an activity
+type Stress struct {
+	Start time.Time `json:"start"`
+	TSS   float64   `json:"tss"`
+	// Method of estimating the score: power, heartrate, or duration
+	Method string `json:"method"`
+}
+
+// Load is the training load at the end of a day
+type Load struct {
+	Date       string  `json:"date"`
+	Activities int     `json:"activities"`
+	TSS        float64 `json:"tss"`
+	// CTL is the chronic training load, or fitness
+	CTL float64 `json:"ctl"`
+	// ATL is the acute training load, or fatigue
+	ATL float64 `json:"atl"`
+	// TSB is the training stress balance, or form, the fitness less the fatigue at the start of the day
+	TSB float64 `json:"tsb"`
+}
+
+// tss is the training stress score of an effort of the duration and intensity factor
+func tss(seconds int, intensity float64) float64 {
+	return float64(seconds) / 3600 * intensity * intensity * 100
+}
+
+// Estimate the training stress score of an activity from its normalized power if available,
+// otherwise its average heart rate, otherwise its duration alone
+func Estimate(start time.Time, seconds int, np, hr float64, cfg *Config) *Stress {
+	threshold := cfg.ThresholdHeartRate
+	if threshold == 0 {
+		threshold = 0.9 * cfg.MaxHeartRate
+	}
+	switch {
+	case np > 0 && cfg.FTP > 0:
+		return &Stress{Start: start, TSS: round(tss(seconds, np/cfg.FTP)), Method: "power"}
+	case hr > 0 && threshold > 0:
+		return &Stress{Start: start, TSS: round(tss(seconds, hr/threshold)), Method: "heartrate"}
+	default:
+		return &Stress{Start: start, TSS: round(tss(seconds, cfg.Intensity)), Method: "duration"}
+	}
+}
+
+// Stress estimates the training stress score of the analyzed activity from its moving time
+func (a *Analysis) Stress(start time.Time, cfg *Config) *Stress {
+	var np, hr float64
+	if a.Power != nil {
+		np = a.Power.Normalized
+	}
+	if a.HeartRate != nil {
+		hr = a.HeartRate.Average
+	}
+	return Estimate(start, a.Moving, np, hr, cfg)
+}
+
+// TrainingLoad returns the training load of each day from the first to the last inclusive,
+// the days are in the location of first and the load prior to the first day is assumed to be zero
+func TrainingLoad(stress []*Stress, first, last time.Time, cfg *Config) []*Load {
+	loc := first.Location()
+	date := func(t time.Time) time.Time {
+		y, m, d := t.In(loc).Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, loc)
+	}
+	days := make(map[time.Time]*Load)
+	for _, s := range stress {
+		day := date(s.Start)
+		if days[day] == nil {
+			days[day] = &Load{}
+		}
+		days[day].Activities++
+		days[day].TSS += s.TSS
+	}
+	var ctl, atl float64
+	var loads []*Load
+	for day := date(first); !day.After(last); day = day.AddDate(0, 0, 1) {
+		load := days[day]
+		if load == nil {
+			load = &Load{}
+		}
+		load.Date = day.Format(time.DateOnly)
+		load.TSB = round(ctl - atl)
+		ctl += (load.TSS - ctl) / float64(cfg.FitnessDays)
+		atl += (load.TSS - atl) / float64(cfg.FatigueDays)
+		load.TSS = round(load.TSS)
+		load.CTL, load.ATL = round(ctl), round(atl)
+		loads = append(loads, load)
+	}
+	return loads
+}
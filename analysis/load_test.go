@@ -0,0 +1,79 @@
+package analysis_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bzimmer/gravl/analysis"
+)
+
+func TestEstimate(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	start := time.Date(2021, time.October, 1, 8, 0, 0, 0, time.UTC)
+	cfg := analysis.DefaultConfig()
+	cfg.FTP = 250
+	cfg.MaxHeartRate = 180
+
+	// an hour at threshold is 100 TSS
+	s := analysis.Estimate(start, 3600, 250, 150, cfg)
+	a.Equal(&analysis.Stress{Start: start, TSS: 100, Method: "power"}, s)
+
+	// the threshold heart rate defaults to 90 percent of max
+	s = analysis.Estimate(start, 3600, 0, 162, cfg)
+	a.Equal("heartrate", s.Method)
+	a.Equal(100.0, s.TSS)
+
+	cfg.ThresholdHeartRate = 150
+	s = analysis.Estimate(start, 7200, 0, 120, cfg)
+	a.Equal("heartrate", s.Method)
+	a.Equal(128.0, s.TSS)
+
+	s = analysis.Estimate(start, 7200, 0, 0, cfg)
+	a.Equal("duration", s.Method)
+	a.Equal(98.0, s.TSS)
+
+	cfg.FTP = 0
+	s = analysis.Estimate(start, 3600, 250, 0, cfg)
+	a.Equal("duration", s.Method)
+
+	res, err := analysis.Analyze(intervals(), analysis.DefaultConfig())
+	a.NoError(err)
+	s = res.Stress(start, cfg)
+	a.Equal("heartrate", s.Method)
+}
+
+func TestTrainingLoad(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	loc := time.FixedZone("PDT", -7*60*60)
+	first := time.Date(2021, time.October, 1, 0, 0, 0, 0, loc)
+	day := func(n, hour int) time.Time {
+		return first.Add(time.Duration(n*24+hour) * time.Hour)
+	}
+	// two weeks of riding with a rest day each week and a long ride every weekend
+	var stress []*analysis.Stress
+	for n := range 14 {
+		switch n % 7 {
+		case 0:
+		case 1, 6:
+			stress = append(stress, &analysis.Stress{Start: day(n, 9), TSS: 150, Method: "power"})
+		default:
+			stress = append(stress, &analysis.Stress{Start: day(n, 6), TSS: 60, Method: "heartrate"})
+		}
+	}
+	// the second ride of the day is counted in the local date of its start, not its UTC date
+	stress = append(stress, &analysis.Stress{Start: day(3, 20), TSS: 40, Method: "duration"})
+	// activities outside the range are ignored
+	stress = append(stress, &analysis.Stress{Start: day(-3, 9), TSS: 200, Method: "power"})
+
+	loads := analysis.TrainingLoad(stress, first, day(13, 12), analysis.DefaultConfig())
+	a.Len(loads, 14)
+	a.Equal("2021-10-01", loads[0].Date)
+	a.Equal("2021-10-14", loads[13].Date)
+	a.Equal(2, loads[3].Activities)
+	a.Equal(100.0, loads[3].TSS)
+	golden(t, "load", loads)
+}
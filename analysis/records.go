@@ -0,0 +1,156 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Units of a record's value
+const (
+	UnitWatts   = "watts"
+	UnitSeconds = "seconds"
+	UnitMeters  = "meters"
+)
+
+// Record is the best value of a measure and the activity which achieved it
+type Record struct {
+	Measure string  `json:"measure"`
+	Value   float64 `json:"value"`
+	// Unit of the value, lower values are better only for seconds
+	Unit     string    `json:"unit"`
+	Activity string    `json:"activity"`
+	Date     time.Time `json:"date"`
+}
+
+// better returns true if x is an improvement on the record
+func (r *Record) better(x *Record) bool {
+	if r.Unit == UnitSeconds {
+		return x.Value < r.Value
+	}
+	return x.Value > r.Value
+}
+
+// Improvement is a new record and the record it replaced, if any
+type Improvement struct {
+	*Record
+	Previous *Record `json:"previous,omitempty"`
+}
+
+// Records is the best value of each measure
+type Records struct {
+	// Updated is the time the records were last updated
+	Updated time.Time          `json:"updated"`
+	Records map[string]*Record `json:"records"`
+}
+
+// Update the records with the candidates returning the improvements, sorted by measure, on the
+// records prior to the update
+func (r *Records) Update(candidates []*Record) []*Improvement {
+	if r.Records == nil {
+		r.Records = make(map[string]*Record)
+	}
+	previous := make(map[string]*Record, len(r.Records))
+	for key, val := range r.Records {
+		previous[key] = val
+	}
+	for _, x := range candidates {
+		if cur, ok := r.Records[x.Measure]; !ok || cur.better(x) {
+			r.Records[x.Measure] = x
+		}
+	}
+	var res []*Improvement
+	for key, val := range r.Records {
+		if prev := previous[key]; prev != val {
+			res = append(res, &Improvement{Record: val, Previous: prev})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Measure < res[j].Measure })
+	return res
+}
+
+// Sorted returns the records sorted by measure
+func (r *Records) Sorted() []*Record {
+	res := make([]*Record, 0, len(r.Records))
+	for _, val := range r.Records {
+		res = append(res, val)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Measure < res[j].Measure })
+	return res
+}
+
+// Activity is an activity considered for records
+type Activity struct {
+	ID    string
+	Start time.Time
+	// Distance in meters
+	Distance float64
+	// Climbing is the elevation gain in meters
+	Climbing float64
+	// Streams are optional, the power and fastest distance records require them
+	Streams *Streams
+}
+
+// label formats seconds as minutes if a whole number of minutes
+func label(seconds int) string {
+	if seconds >= 60 && seconds%60 == 0 {
+		return fmt.Sprintf("%dm", seconds/60)
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
+
+// Candidates returns the activity's best power for each duration, fastest time for each distance
+// in meters, distance, and climbing
+func Candidates(act *Activity, durations []int, distances []float64) []*Record {
+	record := func(measure string, value float64, unit string) *Record {
+		return &Record{Measure: measure, Value: round(value), Unit: unit, Activity: act.ID, Date: act.Start}
+	}
+	var res []*Record
+	if act.Distance > 0 {
+		res = append(res, record("longest", act.Distance, UnitMeters))
+	}
+	if act.Climbing > 0 {
+		res = append(res, record("climbing", act.Climbing, UnitMeters))
+	}
+	s := act.Streams
+	if s == nil || len(s.Time) == 0 {
+		return res
+	}
+	n := int(s.Time[len(s.Time)-1]) + 1
+	if power := resample(s.Time, s.Power, n); power.valid() {
+		for _, e := range curve(power.zeroed(), durations) {
+			res = append(res, record("power-"+label(e.Duration), e.Watts, UnitWatts))
+		}
+	}
+	for _, d := range distances {
+		if secs, ok := fastest(s, d); ok {
+			res = append(res, record(fmt.Sprintf("fastest-%gkm", d/1000), secs, UnitSeconds))
+		}
+	}
+	return res
+}
+
+// fastest returns the shortest time in seconds in which the distance was covered
+func fastest(s *Streams, distance float64) (float64, bool) {
+	if len(s.Distance) != len(s.Time) || distance <= 0 {
+		return 0, false
+	}
+	var times, dists []float64
+	for i, d := range s.Distance {
+		if !math.IsNaN(d) {
+			times, dists = append(times, s.Time[i]), append(dists, d)
+		}
+	}
+	best, ok := math.Inf(1), false
+	var i int
+	for j := range dists {
+		for i+1 < j && dists[j]-dists[i+1] >= distance {
+			i++
+		}
+		if dists[j]-dists[i] >= distance {
+			best, ok = math.Min(best, times[j]-times[i]), true
+		}
+	}
+	return best, ok
+}
@@ -0,0 +1,78 @@
+package analysis_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bzimmer/gravl/analysis"
+)
+
+func TestCandidates(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	start := time.Date(2021, time.October, 1, 8, 0, 0, 0, time.UTC)
+	act := &analysis.Activity{ID: "1", Start: start, Distance: 28800, Climbing: 120, Streams: steady()}
+	res := analysis.Candidates(act, []int{5, 60, 1200, 7200}, []float64{10000, 20000, 40000})
+	records := make(map[string]*analysis.Record)
+	for _, r := range res {
+		a.Equal("1", r.Activity)
+		a.Equal(start, r.Date)
+		records[r.Measure] = r
+	}
+	a.Len(records, 7)
+	a.Equal(28800.0, records["longest"].Value)
+	a.Equal(120.0, records["climbing"].Value)
+	a.Equal(analysis.UnitWatts, records["power-5s"].Unit)
+	a.Equal(220.0, records["power-5s"].Value)
+	a.Contains(records, "power-1m")
+	a.Contains(records, "power-20m")
+	a.NotContains(records, "power-120m")
+	a.Equal(analysis.UnitSeconds, records["fastest-10km"].Unit)
+	a.Equal(1250.0, records["fastest-10km"].Value)
+	a.Equal(2500.0, records["fastest-20km"].Value)
+	a.NotContains(records, "fastest-40km")
+
+	res = analysis.Candidates(&analysis.Activity{ID: "2", Streams: paused()}, []int{5}, []float64{1000})
+	a.Len(res, 1)
+	a.Equal("fastest-1km", res[0].Measure)
+	a.Equal(168.0, res[0].Value)
+
+	res = analysis.Candidates(&analysis.Activity{ID: "3", Distance: 1000}, []int{5}, []float64{1000})
+	a.Len(res, 1)
+	a.Equal("longest", res[0].Measure)
+}
+
+func TestRecordsUpdate(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	longest := &analysis.Record{Measure: "longest", Value: 100000, Unit: analysis.UnitMeters, Activity: "1"}
+	fastest := &analysis.Record{Measure: "fastest-10km", Value: 1200, Unit: analysis.UnitSeconds, Activity: "1"}
+	records := &analysis.Records{}
+	res := records.Update([]*analysis.Record{longest, fastest})
+	a.Len(res, 2)
+	a.Equal("fastest-10km", res[0].Measure)
+	a.Nil(res[0].Previous)
+	a.Equal("longest", res[1].Measure)
+
+	res = records.Update([]*analysis.Record{
+		{Measure: "longest", Value: 90000, Unit: analysis.UnitMeters, Activity: "2"},
+		{Measure: "fastest-10km", Value: 1100, Unit: analysis.UnitSeconds, Activity: "2"},
+		{Measure: "climbing", Value: 1500, Unit: analysis.UnitMeters, Activity: "2"},
+	})
+	a.Len(res, 2)
+	a.Equal("climbing", res[0].Measure)
+	a.Nil(res[0].Previous)
+	a.Equal("fastest-10km", res[1].Measure)
+	a.Equal(1100.0, res[1].Value)
+	a.Equal(fastest, res[1].Previous)
+	a.Equal(longest, records.Records["longest"])
+
+	sorted := records.Sorted()
+	a.Len(sorted, 3)
+	a.Equal("climbing", sorted[0].Measure)
+	a.Equal("longest", sorted[2].Measure)
+
+	a.Empty(records.Update(nil))
+}
@@ -0,0 +1,148 @@
+package analysis
+
+import (
+	"math"
+
+	"github.com/bzimmer/gravl/track"
+)
+
+// maxGap is the longest gap in seconds between samples over which the previous sample is held,
+// longer gaps are treated as the recording being paused
+const maxGap = 5
+
+// Streams are the recorded samples of an activity
+//
+// Each stream is either empty or the same length as Time, a NaN marks a sample missing from
+// the stream. The json names match those of Strava's streams.
+type Streams struct {
+	// Time in seconds from the start of the activity
+	Time []float64 `json:"time"`
+	// Power in watts
+	Power []float64 `json:"watts,omitempty"`
+	// HeartRate in beats per minute
+	HeartRate []float64 `json:"heartrate,omitempty"`
+	// Distance in meters from the start of the activity
+	Distance []float64 `json:"distance,omitempty"`
+	// Elevation in meters
+	Elevation []float64 `json:"altitude,omitempty"`
+}
+
+// FromTrack returns the streams of the track, points without a timestamp are skipped
+func FromTrack(t *track.Track) *Streams {
+	channels := t.Channels()
+	s := &Streams{}
+	var start float64
+	for _, p := range t.Points {
+		if p.Time.IsZero() {
+			continue
+		}
+		secs := float64(p.Time.UnixMilli()) / 1000
+		if len(s.Time) == 0 {
+			start = secs
+		}
+		s.Time = append(s.Time, secs-start)
+		for _, x := range []struct {
+			channel track.Channel
+			stream  *[]float64
+			value   float64
+		}{
+			{track.ChannelPower, &s.Power, p.Power},
+			{track.ChannelHeartRate, &s.HeartRate, p.HeartRate},
+			{track.ChannelDistance, &s.Distance, p.Distance},
+			{track.ChannelElevation, &s.Elevation, p.Elevation},
+		} {
+			if channels&x.channel == 0 {
+				continue
+			}
+			v := math.NaN()
+			if p.Has(x.channel) {
+				v = x.value
+			}
+			*x.stream = append(*x.stream, v)
+		}
+	}
+	return s
+}
+
+// series is a stream resampled to one sample per second, a NaN marks a missing sample
+type series []float64
+
+// resample the stream to one sample per second, holding each sample until the next
+func resample(times, values []float64, n int) series {
+	if len(values) == 0 || len(values) != len(times) {
+		return nil
+	}
+	x := make(series, n)
+	var j int
+	for i := range x {
+		for j+1 < len(times) && times[j+1] <= float64(i) {
+			j++
+		}
+		if times[j] > float64(i) || float64(i)-times[j] > maxGap {
+			x[i] = math.NaN()
+			continue
+		}
+		x[i] = values[j]
+	}
+	return x
+}
+
+// valid returns true if any sample is present
+func (s series) valid() bool {
+	for _, v := range s {
+		if !math.IsNaN(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// zeroed returns the series with missing samples replaced by zero
+func (s series) zeroed() series {
+	x := make(series, len(s))
+	for i, v := range s {
+		if !math.IsNaN(v) {
+			x[i] = v
+		}
+	}
+	return x
+}
+
+// present returns the series without the missing samples
+func (s series) present() series {
+	x := make(series, 0, len(s))
+	for _, v := range s {
+		if !math.IsNaN(v) {
+			x = append(x, v)
+		}
+	}
+	return x
+}
+
+// mean of the present samples
+func (s series) mean() float64 {
+	var sum float64
+	var n int
+	for _, v := range s {
+		if math.IsNaN(v) {
+			continue
+		}
+		sum += v
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+// max of the present samples
+func (s series) max() float64 {
+	var m float64
+	for _, v := range s {
+		if !math.IsNaN(v) {
+			m = math.Max(m, v)
+		}
+	}
+	return m
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+)
+
+const metricAuth = "auth"
+
+// Status describes a provider's stored token without revealing it
+type Status struct {
+	Provider string    `json:"provider"`
+	Stored   bool      `json:"stored"`
+	Expiry   time.Time `json:"expiry,omitzero"`
+	Valid    bool      `json:"valid"`
+	Refresh  bool      `json:"refresh"`
+}
+
+func status(c *cli.Context) error {
+	store := gravl.Runtime(c).Tokens
+	providers := c.Args().Slice()
+	if len(providers) == 0 {
+		var err error
+		if providers, err = store.Providers(); err != nil {
+			return err
+		}
+	}
+	enc := gravl.Runtime(c).Encoder
+	met := gravl.Runtime(c).Metrics
+	for _, provider := range providers {
+		token, err := store.Token(provider)
+		if err != nil {
+			return err
+		}
+		met.IncrCounter([]string{metricAuth, c.Command.Name}, 1)
+		s := &Status{Provider: provider}
+		if token != nil {
+			s.Stored = true
+			s.Expiry = token.Expiry
+			s.Valid = token.Valid()
+			s.Refresh = token.RefreshToken != ""
+		}
+		if err = enc.Encode(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func logout(c *cli.Context) error {
+	if c.NArg() == 0 {
+		log.Warn().Msg("no args specified; exiting")
+		return nil
+	}
+	store := gravl.Runtime(c).Tokens
+	met := gravl.Runtime(c).Metrics
+	for _, provider := range c.Args().Slice() {
+		ok, err := store.Delete(provider)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			log.Info().Str("provider", provider).Msg("no stored token")
+			continue
+		}
+		met.IncrCounter([]string{metricAuth, c.Command.Name}, 1)
+		log.Info().Str("provider", provider).Msg("deleted stored token")
+	}
+	return nil
+}
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  metricAuth,
+		Usage: "Manage the stored provider tokens",
+		Description: "Tokens acquired with a provider's `oauth` or `refresh` command, and tokens refreshed while " +
+			"querying a provider, are stored and preferred over the tokens from the flags on subsequent invocations " +
+			"until the tokens from the flags change",
+		Subcommands: []*cli.Command{
+			{
+				Name:        "status",
+				Usage:       "Show the status of the stored tokens",
+				Description: "Show the expiry and validity of the stored token of each provider, or all providers if none are specified",
+				ArgsUsage:   "[PROVIDER...]",
+				Action:      status,
+			},
+			{
+				Name:        "logout",
+				Usage:       "Delete the stored tokens",
+				Description: "Delete the stored token of each provider so the tokens from the flags are used",
+				ArgsUsage:   "PROVIDER...",
+				Action:      logout,
+			},
+		},
+	}
+}
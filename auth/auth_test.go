@@ -0,0 +1,77 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/oauth2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/auth"
+	"github.com/bzimmer/gravl/internal"
+)
+
+func command(_ *testing.T, _ string) *cli.Command {
+	return auth.Command()
+}
+
+func save(c *cli.Context) error {
+	store := gravl.Runtime(c).Tokens
+	if err := store.Save("strava", &oauth2.Token{
+		AccessToken: "access", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)}); err != nil {
+		return err
+	}
+	return store.Save("hammerhead", &oauth2.Token{RefreshToken: "refresh"})
+}
+
+func TestAuth(t *testing.T) {
+	a := assert.New(t)
+	tests := []*internal.Harness{
+		{
+			Name:   "status",
+			Args:   []string{"gravl", "auth", "status"},
+			Before: save,
+			Counters: map[string]int{
+				"gravl.auth.status": 2,
+			},
+		},
+		{
+			Name:   "status of providers",
+			Args:   []string{"gravl", "auth", "status", "strava", "zwift"},
+			Before: save,
+			Counters: map[string]int{
+				"gravl.auth.status": 2,
+			},
+		},
+		{
+			Name: "status without tokens",
+			Args: []string{"gravl", "auth", "status"},
+		},
+		{
+			Name:   "logout",
+			Args:   []string{"gravl", "auth", "logout", "strava", "zwift"},
+			Before: save,
+			Counters: map[string]int{
+				"gravl.auth.logout": 1,
+			},
+			After: func(c *cli.Context) error {
+				providers, err := gravl.Runtime(c).Tokens.Providers()
+				a.NoError(err)
+				a.Equal([]string{"hammerhead"}, providers)
+				return nil
+			},
+		},
+		{
+			Name: "logout without providers",
+			Args: []string{"gravl", "auth", "logout"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			internal.Run(t, tt, nil, command)
+		})
+	}
+}
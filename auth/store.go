@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+	"golang.org/x/oauth2"
+)
+
+const suffix = "-token.json"
+
+// entry is the stored token and the fingerprint of the token from the flags which seeded it
+type entry struct {
+	*oauth2.Token
+	Seed string `json:"seed,omitempty"`
+}
+
+// fingerprint identifies a token from the flags without storing it a second time
+func fingerprint(token *oauth2.Token) string {
+	sum := sha256.Sum256([]byte(token.AccessToken + "\x00" + token.RefreshToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// Store persists the token of each provider in its own file, readable only by the user
+type Store struct {
+	fs  afero.Fs
+	dir string
+}
+
+// NewStore returns a store writing tokens to the directory; when empty the OS user
+// config directory is used (e.g. ~/.config/gravl on Linux)
+func NewStore(fs afero.Fs, dir string) *Store {
+	return &Store{fs: fs, dir: dir}
+}
+
+func (s *Store) directory() (string, error) {
+	if s.dir != "" {
+		return s.dir, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gravl"), nil
+}
+
+func (s *Store) path(provider string) (string, error) {
+	dir, err := s.directory()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, provider+suffix), nil
+}
+
+// Token returns the provider's token or nil if none is stored
+func (s *Store) Token(provider string) (*oauth2.Token, error) {
+	e, err := s.read(provider)
+	if err != nil {
+		return nil, err
+	}
+	if e.Token == nil || (e.AccessToken == "" && e.RefreshToken == "") {
+		return nil, nil //nolint:nilnil // no usable token is stored
+	}
+	return e.Token, nil
+}
+
+// Save the provider's token, replacing any previously stored token
+func (s *Store) Save(provider string, token *oauth2.Token) error {
+	e, err := s.read(provider)
+	if err != nil {
+		// an invalid token is replaced
+		e = &entry{}
+	}
+	return s.write(provider, &entry{Token: token, Seed: e.Seed})
+}
+
+// Seed stores the provider's token from the flags, remembering it so it seeds the store only once
+func (s *Store) Seed(provider string, token *oauth2.Token) error {
+	return s.write(provider, &entry{Token: token, Seed: fingerprint(token)})
+}
+
+// Seeded returns true if the token from the flags last seeded the store
+func (s *Store) Seeded(provider string, token *oauth2.Token) (bool, error) {
+	e, err := s.read(provider)
+	if err != nil {
+		return false, err
+	}
+	return e.Seed == fingerprint(token), nil
+}
+
+func (s *Store) read(provider string) (*entry, error) {
+	path, err := s.path(provider)
+	if err != nil {
+		return nil, err
+	}
+	data, err := afero.ReadFile(s.fs, path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &entry{}, nil
+		}
+		return nil, err
+	}
+	var e entry
+	if err = json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("invalid token %s: %w", path, err)
+	}
+	return &e, nil
+}
+
+func (s *Store) write(provider string, e *entry) error {
+	path, err := s.path(provider)
+	if err != nil {
+		return err
+	}
+	if err = s.fs.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(e) //nolint:gosec // oauth token stored on disk for the authenticated user
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = afero.WriteFile(s.fs, tmp, data, 0o600); err != nil {
+		return err
+	}
+	return s.fs.Rename(tmp, path)
+}
+
+// Delete the provider's token returning true if a token was stored
+func (s *Store) Delete(provider string) (bool, error) {
+	path, err := s.path(provider)
+	if err != nil {
+		return false, err
+	}
+	if err = s.fs.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Providers returns the sorted names of the providers with a stored token
+func (s *Store) Providers() ([]string, error) {
+	dir, err := s.directory()
+	if err != nil {
+		return nil, err
+	}
+	matches, err := afero.Glob(s.fs, filepath.Join(dir, "*"+suffix))
+	if err != nil {
+		return nil, err
+	}
+	providers := make([]string, 0, len(matches))
+	for _, match := range matches {
+		providers = append(providers, strings.TrimSuffix(filepath.Base(match), suffix))
+	}
+	sort.Strings(providers)
+	return providers, nil
+}
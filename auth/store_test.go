@@ -0,0 +1,105 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+
+	"github.com/bzimmer/gravl/auth"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	fs := afero.NewMemMapFs()
+	store := auth.NewStore(fs, "/gravl")
+
+	token, err := store.Token("strava")
+	a.NoError(err)
+	a.Nil(token)
+
+	expiry := time.Date(2021, time.October, 1, 8, 0, 0, 0, time.UTC)
+	a.NoError(store.Save("strava", &oauth2.Token{AccessToken: "access", RefreshToken: "refresh", Expiry: expiry}))
+	a.NoError(store.Save("hammerhead", &oauth2.Token{RefreshToken: "refresh"}))
+
+	info, err := fs.Stat("/gravl/strava-token.json")
+	a.NoError(err)
+	a.Equal("-rw-------", info.Mode().Perm().String())
+	info, err = fs.Stat("/gravl")
+	a.NoError(err)
+	a.Equal("-rwx------", info.Mode().Perm().String())
+
+	token, err = store.Token("strava")
+	a.NoError(err)
+	a.Equal("access", token.AccessToken)
+	a.Equal("refresh", token.RefreshToken)
+	a.True(expiry.Equal(token.Expiry))
+
+	providers, err := store.Providers()
+	a.NoError(err)
+	a.Equal([]string{"hammerhead", "strava"}, providers)
+
+	ok, err := store.Delete("strava")
+	a.NoError(err)
+	a.True(ok)
+	ok, err = store.Delete("strava")
+	a.NoError(err)
+	a.False(ok)
+
+	providers, err = store.Providers()
+	a.NoError(err)
+	a.Equal([]string{"hammerhead"}, providers)
+}
+
+func TestStoreInvalid(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	fs := afero.NewMemMapFs()
+	store := auth.NewStore(fs, "/gravl")
+
+	a.NoError(afero.WriteFile(fs, "/gravl/strava-token.json", []byte("{"), 0o600))
+	token, err := store.Token("strava")
+	a.Nil(token)
+	a.ErrorContains(err, "invalid token /gravl/strava-token.json")
+
+	a.NoError(afero.WriteFile(fs, "/gravl/zwift-token.json", []byte("{}"), 0o600))
+	token, err = store.Token("zwift")
+	a.NoError(err)
+	a.Nil(token)
+}
+
+func TestStoreSeed(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	fs := afero.NewMemMapFs()
+	store := auth.NewStore(fs, "/gravl")
+
+	seed := &oauth2.Token{RefreshToken: "seed"}
+	ok, err := store.Seeded("hammerhead", seed)
+	a.NoError(err)
+	a.False(ok)
+
+	a.NoError(store.Seed("hammerhead", seed))
+	ok, err = store.Seeded("hammerhead", seed)
+	a.NoError(err)
+	a.True(ok)
+
+	// the seed survives the token being refreshed
+	a.NoError(store.Save("hammerhead", &oauth2.Token{RefreshToken: "rotated"}))
+	ok, err = store.Seeded("hammerhead", seed)
+	a.NoError(err)
+	a.True(ok)
+	token, err := store.Token("hammerhead")
+	a.NoError(err)
+	a.Equal("rotated", token.RefreshToken)
+
+	ok, err = store.Seeded("hammerhead", &oauth2.Token{RefreshToken: "changed"})
+	a.NoError(err)
+	a.False(ok)
+}
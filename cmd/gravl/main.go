@@ -4,12 +4,11 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/bzimmer/activity"
@@ -23,13 +22,20 @@ import (
 	"golang.org/x/oauth2"
 
 	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/activity/analyze"
 	"github.com/bzimmer/gravl/activity/cyclinganalytics"
+	"github.com/bzimmer/gravl/activity/gear"
 	"github.com/bzimmer/gravl/activity/hammerhead"
 	"github.com/bzimmer/gravl/activity/qp"
+	"github.com/bzimmer/gravl/activity/records"
 	"github.com/bzimmer/gravl/activity/rwgps"
 	"github.com/bzimmer/gravl/activity/strava"
 	"github.com/bzimmer/gravl/activity/zwift"
+	"github.com/bzimmer/gravl/auth"
+	"github.com/bzimmer/gravl/config"
 	"github.com/bzimmer/gravl/eval/antonmedv"
+	"github.com/bzimmer/gravl/file"
+	"github.com/bzimmer/gravl/format"
 	"github.com/bzimmer/gravl/version"
 )
 
@@ -62,7 +68,16 @@ func initQP(c *cli.Context) error {
 		if err := strava.Before(c); err != nil {
 			return nil, err
 		}
-		return gravl.Runtime(c).Strava.Uploader(), nil
+		return strava.NewUploader(gravl.Runtime(c).Strava), nil
+	}
+	gravl.Runtime(c).Listers[strava.Provider] = func(c *cli.Context) (gravl.Lister, error) {
+		if err := strava.Before(c); err != nil {
+			return nil, err
+		}
+		return strava.NewLister(gravl.Runtime(c).Strava), nil
+	}
+	gravl.Runtime(c).RouteExporters[strava.Provider] = func(c *cli.Context) (gravl.RouteExporter, error) {
+		return strava.NewRouteExporter(c), nil
 	}
 	// cyclinganalytics
 	gravl.Runtime(c).Uploaders[cyclinganalytics.Provider] = func(c *cli.Context) (activity.Uploader, error) {
@@ -71,6 +86,25 @@ func initQP(c *cli.Context) error {
 		}
 		return gravl.Runtime(c).CyclingAnalytics.Uploader(), nil
 	}
+	// rwgps
+	gravl.Runtime(c).Exporters[rwgps.Provider] = func(c *cli.Context) (activity.Exporter, error) {
+		if err := rwgps.Before(c); err != nil {
+			return nil, err
+		}
+		return rwgps.NewTransfer(c)
+	}
+	gravl.Runtime(c).Uploaders[rwgps.Provider] = func(c *cli.Context) (activity.Uploader, error) {
+		if err := rwgps.Before(c); err != nil {
+			return nil, err
+		}
+		return rwgps.NewTransfer(c)
+	}
+	gravl.Runtime(c).RouteExporters[rwgps.Provider] = func(c *cli.Context) (gravl.RouteExporter, error) {
+		if err := rwgps.Before(c); err != nil {
+			return nil, err
+		}
+		return rwgps.NewTransfer(c)
+	}
 	// zwift
 	gravl.Runtime(c).Exporters[zwift.Provider] = func(c *cli.Context) (activity.Exporter, error) {
 		if err := zwift.Before(c); err != nil {
@@ -78,6 +112,12 @@ func initQP(c *cli.Context) error {
 		}
 		return gravl.Runtime(c).Zwift.Exporter(), nil
 	}
+	gravl.Runtime(c).Listers[zwift.Provider] = func(c *cli.Context) (gravl.Lister, error) {
+		if err := zwift.Before(c); err != nil {
+			return nil, err
+		}
+		return zwift.NewLister(gravl.Runtime(c).Zwift), nil
+	}
 	// hammerhead
 	gravl.Runtime(c).Exporters[hammerhead.Provider] = func(c *cli.Context) (activity.Exporter, error) {
 		if err := hammerhead.Before(c); err != nil {
@@ -85,30 +125,18 @@ func initQP(c *cli.Context) error {
 		}
 		return gravl.Runtime(c).Hammerhead.Exporter(), nil
 	}
-	return nil
-}
-
-type encoder struct {
-	pool *sync.Pool
-}
-
-func (enc encoder) Encode(v any) error {
-	if enc.pool == nil {
-		return nil
-	}
-	x, ok := enc.pool.Get().(*json.Encoder)
-	if !ok {
-		return errors.New("did not receive encoder from pool")
-	}
-	err := x.Encode(v)
-	if err == nil {
-		enc.pool.Put(x)
+	gravl.Runtime(c).RouteImporters[hammerhead.Provider] = func(c *cli.Context) (gravl.RouteImporter, error) {
+		return hammerhead.NewRouteImporter(c), nil
 	}
-	return err
+	gravl.Runtime(c).Copy = qp.Copy
+	return nil
 }
 
 func initRuntime(c *cli.Context) error {
-	var pool = &sync.Pool{New: func() any { return json.NewEncoder(c.App.Writer) }}
+	enc, err := format.New(c.App.Writer, c.String("format"))
+	if err != nil {
+		return err
+	}
 
 	cfg := metrics.DefaultConfig(c.App.Name)
 	cfg.EnableRuntimeMetrics = false
@@ -119,21 +147,41 @@ func initRuntime(c *cli.Context) error {
 		return err
 	}
 
+	fs := afero.NewOsFs()
 	c.App.Metadata[gravl.RuntimeKey] = &gravl.Rt{
-		Start:     time.Now(),
-		Encoder:   &encoder{pool: pool},
-		Filterer:  antonmedv.Filterer,
-		Evaluator: antonmedv.Evaluator,
-		Sink:      sink,
-		Metrics:   metric,
-		Fs:        afero.NewOsFs(),
-		Uploaders: make(map[string]gravl.UploaderFunc),
-		Exporters: make(map[string]gravl.ExporterFunc),
-		Endpoints: make(map[string]oauth2.Endpoint),
+		Start:          time.Now(),
+		Encoder:        enc,
+		Filterer:       antonmedv.Filterer,
+		Evaluator:      antonmedv.Evaluator,
+		Aggregator:     antonmedv.Aggregator,
+		Sink:           sink,
+		Metrics:        metric,
+		Fs:             fs,
+		Tokens:         auth.NewStore(fs, c.String("token-cache")),
+		Uploaders:      make(map[string]gravl.UploaderFunc),
+		Exporters:      make(map[string]gravl.ExporterFunc),
+		Listers:        make(map[string]gravl.ListerFunc),
+		RouteExporters: make(map[string]gravl.RouteExporterFunc),
+		RouteImporters: make(map[string]gravl.RouteImporterFunc),
+		Endpoints:      make(map[string]oauth2.Endpoint),
+		Transports:     make(map[string]http.RoundTripper),
+		TokenStores:    make(map[string]gravl.TokenStore),
 	}
 	return nil
 }
 
+func initConfig(c *cli.Context) error {
+	cfg, err := config.Read(gravl.Runtime(c).Fs, c.String("config"))
+	if err != nil {
+		return err
+	}
+	if err = cfg.Validate(c.App.Commands); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	cfg.Install(c.App.Commands)
+	return nil
+}
+
 func initLogging(c *cli.Context) error {
 	monochrome := c.Bool("monochrome")
 	level, err := zerolog.ParseLevel(c.String("verbosity"))
@@ -168,12 +216,12 @@ func flags() []cli.Flag {
 			Value:   false,
 			Usage:   "Use monochrome logging, color enabled by default",
 		},
-		&cli.BoolFlag{
-			Name:     "json",
-			Aliases:  []string{"j"},
-			Usage:    "Emit all results as JSON and print to stdout",
-			Value:    false,
-			Required: false,
+		&cli.StringFlag{
+			Name:  "format",
+			Value: "ndjson",
+			Usage: "Output format (" + strings.Join(format.Formats(), ", ") + "); json emits a single array, " +
+				"csv and table flatten the results into columns named by the attributes, and geojson emits " +
+				"a feature collection of the polylines, streams, or starting points",
 		},
 		&cli.BoolFlag{
 			Name:  "http-tracing",
@@ -186,16 +234,31 @@ func flags() []cli.Flag {
 			Value:   time.Second * 10,
 			Usage:   "Timeout duration (eg, 1ms, 2s, 5m, 3h)",
 		},
+		&cli.PathFlag{
+			Name:    "token-cache",
+			Usage:   "Directory of the stored provider tokens (default: ~/.config/gravl)",
+			EnvVars: []string{"GRAVL_TOKEN_CACHE"},
+		},
+		&cli.PathFlag{
+			Name:    "config",
+			Usage:   "Config file of queries, command defaults, and credentials (default: ~/.config/gravl/config.yaml)",
+			EnvVars: []string{"GRAVL_CONFIG"},
+		},
 	}
 }
 
 func commands() []*cli.Command {
 	return []*cli.Command{
+		analyze.Command(),
+		auth.Command(),
 		cyclinganalytics.Command(),
+		file.Command(),
+		gear.Command(),
 		hammerhead.Command(),
 		manual.Manual(),
 		manual.EnvVars(),
 		qp.Command(),
+		records.Command(),
 		rwgps.Command(),
 		strava.Command(),
 		version.Command(),
@@ -214,11 +277,14 @@ func main() {
 		Description: "command line access to activity platforms",
 		Flags:       flags(),
 		Commands:    commands(),
-		Before:      gravl.Befores(initSignal(cancel), initLogging, initRuntime, initQP),
+		Before:      gravl.Befores(initSignal(cancel), initLogging, initRuntime, initConfig, initQP),
 		After: func(c *cli.Context) error {
 			t := gravl.Runtime(c).Start
 			met := gravl.Runtime(c).Metrics
 			met.AddSample([]string{"runtime"}, float32(time.Since(t).Seconds()))
+			if err := gravl.Flush(c); err != nil {
+				return err
+			}
 			return gravl.Stats(c)
 		},
 	}
@@ -0,0 +1,272 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// QueryFlag is the name of the flag selecting a named query
+const QueryFlag = "query"
+
+// Values maps flag names to values, lists are used for flags which accept multiple values
+type Values map[string]any
+
+// Config holds named queries, default flag values for commands, provider credentials, and gear
+//
+// Values from the config are only applied to flags not set on the command line or by an
+// environment variable; a named query takes precedence over command defaults which take
+// precedence over provider credentials.
+type Config struct {
+	// Queries are named collections of flag values selected with `--query`
+	Queries map[string]Values `yaml:"queries"`
+	// Defaults are flag values keyed by command, eg `strava activities`
+	Defaults map[string]Values `yaml:"defaults"`
+	// Providers are flag values keyed by provider, eg `strava: {client-id: 123}` sets `--strava-client-id`
+	Providers map[string]Values `yaml:"providers"`
+	// Gear holds the maintenance intervals and gear rules of `gravl gear`
+	Gear *Gear `yaml:"gear"`
+}
+
+// Path returns the path of the config file; when empty the OS user config directory is used
+// (e.g. ~/.config/gravl/config.yaml on Linux), next to the token cache and ledger
+func Path(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gravl", "config.yaml"), nil
+}
+
+// Decode the config, unknown sections are an error
+func Decode(r io.Reader) (*Config, error) {
+	cfg := &Config{}
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Read the config at `path`, if no path is specified a missing default config is not an error
+func Read(fs afero.Fs, path string) (*Config, error) {
+	name, err := Path(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := afero.ReadFile(fs, name)
+	if err != nil {
+		if path == "" && errors.Is(err, os.ErrNotExist) {
+			return &Config{}, nil
+		}
+		return nil, err
+	}
+	cfg, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", name, err)
+	}
+	log.Info().Str("path", name).Msg("config")
+	return cfg, nil
+}
+
+// strings returns the flag values as strings suitable for `cli.Context.Set`
+func (v Values) strings(name string) ([]string, error) {
+	format := func(x any) (string, error) {
+		switch z := x.(type) {
+		case string:
+			return z, nil
+		case bool, int, int64, uint64, float64:
+			return fmt.Sprint(z), nil
+		case time.Time:
+			return z.Format(time.RFC3339), nil
+		default:
+			return "", fmt.Errorf("unsupported value for flag '%s'", name)
+		}
+	}
+	switch z := v[name].(type) {
+	case []any:
+		vals := make([]string, len(z))
+		for i := range z {
+			val, err := format(z[i])
+			if err != nil {
+				return nil, err
+			}
+			vals[i] = val
+		}
+		return vals, nil
+	default:
+		val, err := format(z)
+		if err != nil {
+			return nil, err
+		}
+		return []string{val}, nil
+	}
+}
+
+// provider returns the provider values keyed by flag name
+func (cfg *Config) provider(name string) Values {
+	vals := make(Values, len(cfg.Providers[name]))
+	for key, val := range cfg.Providers[name] {
+		vals[name+"-"+key] = val
+	}
+	return vals
+}
+
+// walk calls `fn` for every command with its space separated path
+func walk(cmds []*cli.Command, prefix string, fn func(string, *cli.Command)) {
+	for _, cmd := range cmds {
+		path := strings.TrimSpace(prefix + " " + cmd.Name)
+		fn(path, cmd)
+		walk(cmd.Subcommands, path, fn)
+	}
+}
+
+func hasFlag(cmd *cli.Command, name string) bool {
+	for _, f := range cmd.Flags {
+		for _, x := range f.Names() {
+			if x == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// check returns an error if any of the flags is not known or has an unsupported value
+func check(section string, vals Values, known func(string) bool) error {
+	names := make([]string, 0, len(vals))
+	for name := range vals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !known(name) {
+			return fmt.Errorf("%s: unknown flag '%s'", section, name)
+		}
+		if _, err := vals.strings(name); err != nil {
+			return fmt.Errorf("%s: %w", section, err)
+		}
+	}
+	return nil
+}
+
+// Validate the config against the commands, all commands and flags must exist
+func (cfg *Config) Validate(cmds []*cli.Command) error {
+	paths := make(map[string]*cli.Command)
+	walk(cmds, "", func(path string, cmd *cli.Command) { paths[path] = cmd })
+	anywhere := func(query bool) func(string) bool {
+		return func(name string) bool {
+			for _, cmd := range paths {
+				if (!query || hasFlag(cmd, QueryFlag)) && hasFlag(cmd, name) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	for name, vals := range cfg.Queries {
+		if err := check(fmt.Sprintf("query '%s'", name), vals, anywhere(true)); err != nil {
+			return err
+		}
+	}
+	for path, vals := range cfg.Defaults {
+		cmd, ok := paths[path]
+		if !ok {
+			return fmt.Errorf("defaults: unknown command '%s'", path)
+		}
+		known := func(name string) bool { return hasFlag(cmd, name) }
+		if err := check(fmt.Sprintf("defaults for '%s'", path), vals, known); err != nil {
+			return err
+		}
+	}
+	for name := range cfg.Providers {
+		if _, ok := paths[name]; !ok {
+			return fmt.Errorf("providers: unknown provider '%s'", name)
+		}
+		if err := check(fmt.Sprintf("provider '%s'", name), cfg.provider(name), anywhere(false)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply sets the values of the command's flags which have not already been set
+func apply(c *cli.Context, vals Values) error {
+	for _, f := range c.Command.Flags {
+		name := f.Names()[0]
+		if c.IsSet(name) {
+			continue
+		}
+		var val any
+		for _, x := range f.Names() {
+			if v, ok := vals[x]; ok {
+				name, val = x, v
+				break
+			}
+		}
+		if val == nil {
+			continue
+		}
+		args, err := vals.strings(name)
+		if err != nil {
+			return err
+		}
+		for _, arg := range args {
+			if err = c.Set(f.Names()[0], arg); err != nil {
+				return fmt.Errorf("invalid value for flag '%s': %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// before returns a `cli.BeforeFunc` applying the config to the command prior to `fn`
+func (cfg *Config) before(path string, fn cli.BeforeFunc) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		if c.IsSet(QueryFlag) && hasFlag(c.Command, QueryFlag) {
+			name := c.String(QueryFlag)
+			vals, ok := cfg.Queries[name]
+			if !ok {
+				return fmt.Errorf("unknown query '%s'", name)
+			}
+			if err := apply(c, vals); err != nil {
+				return fmt.Errorf("query '%s': %w", name, err)
+			}
+		}
+		if err := apply(c, cfg.Defaults[path]); err != nil {
+			return fmt.Errorf("defaults for '%s': %w", path, err)
+		}
+		for name := range cfg.Providers {
+			if err := apply(c, cfg.provider(name)); err != nil {
+				return fmt.Errorf("provider '%s': %w", name, err)
+			}
+		}
+		if fn == nil {
+			return nil
+		}
+		return fn(c)
+	}
+}
+
+// Install the config on the commands so each command's flags are set from the config
+// after parsing the command line and before running the command's `Before`
+func (cfg *Config) Install(cmds []*cli.Command) {
+	walk(cmds, "", func(path string, cmd *cli.Command) {
+		cmd.Before = cfg.before(path, cmd.Before)
+	})
+}
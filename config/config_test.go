@@ -0,0 +1,217 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/config"
+	"github.com/bzimmer/gravl/internal"
+)
+
+const cfg = `
+queries:
+  commutes:
+    filter: .Commute
+    attribute: [.ID, .Name]
+    since: 2021-10-01
+defaults:
+  demo activities:
+    count: 25
+providers:
+  demo:
+    client-id: abc123
+`
+
+// command returns a provider-like command whose `activities` action verifies the flag values
+func command(expected map[string]any) func(*testing.T, string) *cli.Command {
+	return func(t *testing.T, _ string) *cli.Command {
+		a := assert.New(t)
+		return &cli.Command{
+			Name: "demo",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "demo-client-id", EnvVars: []string{"DEMO_CLIENT_ID"}},
+			},
+			Subcommands: []*cli.Command{
+				{
+					Name: "activities",
+					Flags: []cli.Flag{
+						&cli.StringFlag{Name: "query"},
+						&cli.StringFlag{Name: "filter", Aliases: []string{"f"}},
+						&cli.StringSliceFlag{Name: "attribute", Aliases: []string{"B"}},
+						&cli.StringFlag{Name: "since"},
+						&cli.IntFlag{Name: "count", Aliases: []string{"N"}, Value: 10},
+					},
+					Action: func(c *cli.Context) error {
+						for key, val := range expected {
+							switch z := val.(type) {
+							case []string:
+								a.Equal(z, c.StringSlice(key), key)
+							case int:
+								a.Equal(z, c.Int(key), key)
+							default:
+								a.Equal(z, c.String(key), key)
+							}
+						}
+						return nil
+					},
+				},
+			},
+		}
+	}
+}
+
+// install reads, validates, and installs the config as `gravl` does at startup
+func install(contents string) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		fs := gravl.Runtime(c).Fs
+		if err := afero.WriteFile(fs, "/gravl/config.yaml", []byte(contents), 0o600); err != nil {
+			return err
+		}
+		x, err := config.Read(fs, "/gravl/config.yaml")
+		if err != nil {
+			return err
+		}
+		if err = x.Validate(c.App.Commands); err != nil {
+			return err
+		}
+		x.Install(c.App.Commands)
+		return nil
+	}
+}
+
+func TestInstall(t *testing.T) {
+	tests := []struct {
+		harness  *internal.Harness
+		expected map[string]any
+	}{
+		{
+			harness: &internal.Harness{
+				Name:   "defaults",
+				Args:   []string{"gravl", "demo", "activities"},
+				Before: install(cfg),
+			},
+			expected: map[string]any{"count": 25, "demo-client-id": "abc123", "filter": ""},
+		},
+		{
+			harness: &internal.Harness{
+				Name:   "query",
+				Args:   []string{"gravl", "demo", "activities", "--query", "commutes"},
+				Before: install(cfg),
+			},
+			expected: map[string]any{
+				"count":     25,
+				"filter":    ".Commute",
+				"attribute": []string{".ID", ".Name"},
+				"since":     "2021-10-01T00:00:00Z",
+			},
+		},
+		{
+			harness: &internal.Harness{
+				Name:   "explicit flags override",
+				Args:   []string{"gravl", "demo", "--demo-client-id", "xyz", "activities", "--query", "commutes", "-N", "5", "-f", ".Trainer"},
+				Before: install(cfg),
+			},
+			expected: map[string]any{"count": 5, "demo-client-id": "xyz", "filter": ".Trainer"},
+		},
+		{
+			harness: &internal.Harness{
+				Name: "environment overrides",
+				Args: []string{"gravl", "demo", "activities"},
+				Before: gravl.Befores(func(_ *cli.Context) error {
+					t.Setenv("DEMO_CLIENT_ID", "env")
+					return nil
+				}, install(cfg)),
+			},
+			expected: map[string]any{"demo-client-id": "env"},
+		},
+		{
+			harness: &internal.Harness{
+				Name:   "unknown query",
+				Args:   []string{"gravl", "demo", "activities", "--query", "missing"},
+				Before: install(cfg),
+				Err:    "unknown query 'missing'",
+			},
+		},
+		{
+			harness: &internal.Harness{
+				Name:   "empty",
+				Args:   []string{"gravl", "demo", "activities"},
+				Before: install(""),
+			},
+			expected: map[string]any{"count": 10},
+		},
+		{
+			harness: &internal.Harness{
+				Name:   "invalid value",
+				Args:   []string{"gravl", "demo", "activities"},
+				Before: install("defaults: {demo activities: {count: many}}"),
+				Err:    "defaults for 'demo activities': invalid value for flag 'count'",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.harness.Name, func(t *testing.T) {
+			internal.Run(t, tt.harness, nil, command(tt.expected))
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name, cfg, err string
+	}{
+		{name: "valid", cfg: cfg},
+		{name: "unknown section", cfg: "aliases: {}", err: "field aliases not found"},
+		{name: "unknown command", cfg: "defaults: {demo activity: {count: 1}}", err: "defaults: unknown command 'demo activity'"},
+		{name: "unknown flag", cfg: "defaults: {demo activities: {cont: 1}}",
+			err: "defaults for 'demo activities': unknown flag 'cont'"},
+		{name: "query unknown flag", cfg: "queries: {x: {demo-client-id: 1}}", err: "query 'x': unknown flag 'demo-client-id'"},
+		{name: "unknown provider", cfg: "providers: {acme: {client-id: 1}}", err: "providers: unknown provider 'acme'"},
+		{name: "provider unknown flag", cfg: "providers: {demo: {client-secret: 1}}",
+			err: "provider 'demo': unknown flag 'demo-client-secret'"},
+		{name: "unsupported value", cfg: "queries: {x: {filter: {a: b}}}", err: "query 'x': unsupported value for flag 'filter'"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			a := assert.New(t)
+			x, err := config.Decode(strings.NewReader(tt.cfg))
+			if err == nil {
+				err = x.Validate([]*cli.Command{command(nil)(t, "")})
+			}
+			if tt.err == "" {
+				a.NoError(err)
+				return
+			}
+			a.Error(err)
+			a.Contains(err.Error(), tt.err)
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	fs := afero.NewMemMapFs()
+	x, err := config.Read(fs, "/missing/config.yaml")
+	a.Error(err)
+	a.Nil(x)
+
+	a.NoError(afero.WriteFile(fs, "/gravl/config.yaml", []byte("queries: ["), 0o600))
+	x, err = config.Read(fs, "/gravl/config.yaml")
+	a.Error(err)
+	a.Contains(err.Error(), "invalid config /gravl/config.yaml")
+	a.Nil(x)
+
+	path, err := config.Path("")
+	a.NoError(err)
+	a.True(strings.HasSuffix(path, "gravl/config.yaml"))
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Units of a service interval
+const (
+	Kilometers = "km"
+	Miles      = "mi"
+	Hours      = "h"
+)
+
+// Gear holds the maintenance intervals of bikes and the rules assigning gear to activities without a gear id
+type Gear struct {
+	Bikes []*Bike `yaml:"bikes"`
+	// Rules are evaluated in order, the first matching rule assigns its gear
+	Rules []*Rule `yaml:"rules"`
+}
+
+// Bike is a gear id and its components
+type Bike struct {
+	ID         string       `yaml:"id"`
+	Name       string       `yaml:"name"`
+	Components []*Component `yaml:"components"`
+}
+
+// Component is a part of a bike serviced at a regular interval
+type Component struct {
+	Name  string   `yaml:"name"`
+	Every Interval `yaml:"every"`
+	// Serviced is the date of the last service, usage is counted from this date
+	Serviced time.Time `yaml:"serviced"`
+}
+
+// Rule assigns the gear to activities without a gear id for which the filter expression is true
+type Rule struct {
+	Gear   string `yaml:"gear"`
+	Filter string `yaml:"filter"`
+}
+
+// Interval is a distance or duration between services, eg `3000km`, `2000mi`, or `100h`
+type Interval struct {
+	Value float64
+	Unit  string
+}
+
+// ParseInterval parses an interval of kilometers, miles, or hours
+func ParseInterval(s string) (Interval, error) {
+	for _, unit := range []string{Kilometers, Miles, Hours} {
+		val, ok := strings.CutSuffix(strings.TrimSpace(s), unit)
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if err != nil || v <= 0 {
+			break
+		}
+		return Interval{Value: v, Unit: unit}, nil
+	}
+	return Interval{}, fmt.Errorf("invalid interval '%s', expected a positive number of km, mi, or h", s)
+}
+
+// UnmarshalYAML parses the interval from a string
+func (i *Interval) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	if err := node.Decode(&s); err != nil {
+		return err
+	}
+	x, err := ParseInterval(s)
+	if err != nil {
+		return err
+	}
+	*i = x
+	return nil
+}
+
+// String formats the interval as parsed
+func (i Interval) String() string {
+	return strconv.FormatFloat(i.Value, 'f', -1, 64) + i.Unit
+}
+
+// Usage converts the distance in meters or duration in seconds to the unit of the interval
+func (i Interval) Usage(meters, seconds float64) float64 {
+	switch i.Unit {
+	case Kilometers:
+		return meters / 1000
+	case Miles:
+		return meters / 1609.344
+	default:
+		return seconds / 3600
+	}
+}
@@ -0,0 +1,78 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bzimmer/gravl/config"
+)
+
+func TestParseInterval(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		interval, unit, err string
+		value               float64
+	}{
+		{interval: "3000km", unit: config.Kilometers, value: 3000},
+		{interval: "2000 mi", unit: config.Miles, value: 2000},
+		{interval: "12.5h", unit: config.Hours, value: 12.5},
+		{interval: "3000", err: "invalid interval '3000'"},
+		{interval: "-10km", err: "invalid interval '-10km'"},
+		{interval: "tenkm", err: "invalid interval 'tenkm'"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.interval, func(t *testing.T) {
+			t.Parallel()
+			a := assert.New(t)
+			x, err := config.ParseInterval(tt.interval)
+			if tt.err != "" {
+				a.ErrorContains(err, tt.err)
+				return
+			}
+			a.NoError(err)
+			a.Equal(tt.unit, x.Unit)
+			a.Equal(tt.value, x.Value)
+		})
+	}
+}
+
+func TestIntervalUsage(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	a.Equal(16.09344, config.Interval{Value: 1, Unit: config.Kilometers}.Usage(16093.44, 7200))
+	a.InDelta(10.0, config.Interval{Value: 1, Unit: config.Miles}.Usage(16093.44, 7200), 1e-9)
+	a.Equal(2.0, config.Interval{Value: 1, Unit: config.Hours}.Usage(16093.44, 7200))
+	a.Equal("12.5h", config.Interval{Value: 12.5, Unit: config.Hours}.String())
+}
+
+func TestDecodeGear(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	x, err := config.Decode(strings.NewReader(`
+gear:
+  bikes:
+    - id: b123
+      name: Gravel
+      components:
+        - name: chain
+          every: 3000km
+          serviced: 2021-09-01
+  rules:
+    - gear: b123
+      filter: .Device == "Hammerhead Karoo 2"
+`))
+	a.NoError(err)
+	a.Len(x.Gear.Bikes, 1)
+	a.Equal("Gravel", x.Gear.Bikes[0].Name)
+	chain := x.Gear.Bikes[0].Components[0]
+	a.Equal(config.Interval{Value: 3000, Unit: config.Kilometers}, chain.Every)
+	a.Equal(time.Date(2021, time.September, 1, 0, 0, 0, 0, time.UTC), chain.Serviced)
+	a.Equal("b123", x.Gear.Rules[0].Gear)
+
+	_, err = config.Decode(strings.NewReader("gear: {bikes: [{id: b1, components: [{name: chain, every: 3000}]}]}"))
+	a.ErrorContains(err, "invalid interval '3000'")
+}
@@ -0,0 +1,225 @@
+package antonmedv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/bzimmer/gravl/eval"
+)
+
+// GroupKey is the key of the group value in an aggregate row
+const GroupKey = "group"
+
+var aggregateRE = regexp.MustCompile(`^(\w+)\((.*)\)$`)
+
+type aggregate struct {
+	name string
+	fn   string
+	ev   *evaluator
+}
+
+type aggregator struct {
+	group      *evaluator
+	aggregates []*aggregate
+}
+
+type group struct {
+	key  any
+	acts []any
+}
+
+// split the expression on commas not enclosed in parentheses, brackets, braces, or quotes
+func split(q string) []string {
+	var res []string
+	var depth int
+	var quote rune
+	start := 0
+	for i, r := range q {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '(' || r == '[' || r == '{':
+			depth++
+		case r == ')' || r == ']' || r == '}':
+			depth--
+		case r == ',' && depth == 0:
+			res = append(res, strings.TrimSpace(q[start:i]))
+			start = i + 1
+		}
+	}
+	return append(res, strings.TrimSpace(q[start:]))
+}
+
+func parseAggregate(q string, act any) (*aggregate, error) {
+	m := aggregateRE.FindStringSubmatch(q)
+	if m == nil {
+		return nil, fmt.Errorf("invalid aggregate '%s', expected FUNCTION(EXPRESSION)", q)
+	}
+	agg := &aggregate{name: q, fn: m[1]}
+	switch agg.fn {
+	case "count":
+		if strings.TrimSpace(m[2]) == "" {
+			return agg, nil
+		}
+	case "sum", "min", "max", "avg":
+		if strings.TrimSpace(m[2]) == "" {
+			return nil, fmt.Errorf("invalid aggregate '%s', missing expression", q)
+		}
+	default:
+		return nil, fmt.Errorf("unknown aggregate function '%s'", agg.fn)
+	}
+	ev, err := compile(fmt.Sprintf("map(Activities, %s)", closure(m[2])), act)
+	if err != nil {
+		return nil, err
+	}
+	agg.ev = ev
+	return agg, nil
+}
+
+// Aggregator compiles the group and aggregate expressions for activities of the same type as `act`
+//
+// The group expression is evaluated on each activity to determine its group, an empty expression
+// places all activities in a single group. The aggregates are a comma separated list of
+// `count()`, `count(EXPRESSION)`, `sum(EXPRESSION)`, `min(EXPRESSION)`, `max(EXPRESSION)`, or
+// `avg(EXPRESSION)`; `count()` is used if none are specified.
+func Aggregator(groupBy, aggregates string, act any) (eval.Aggregator, error) {
+	x := &aggregator{}
+	if groupBy != "" {
+		ev, err := compile(fmt.Sprintf("map(Activities, %s)", closure(groupBy)), act)
+		if err != nil {
+			return nil, err
+		}
+		x.group = ev
+	}
+	if strings.TrimSpace(aggregates) == "" {
+		aggregates = "count()"
+	}
+	for _, q := range split(aggregates) {
+		agg, err := parseAggregate(q, act)
+		if err != nil {
+			return nil, err
+		}
+		x.aggregates = append(x.aggregates, agg)
+	}
+	return x, nil
+}
+
+// groups partitions the activities by the group expression, preserving the order of first appearance
+func (x *aggregator) groups(acts []any) ([]*group, error) {
+	if x.group == nil {
+		return []*group{{acts: acts}}, nil
+	}
+	keys, err := x.group.run(acts...)
+	if err != nil {
+		return nil, err
+	}
+	var res []*group
+	index := make(map[string]*group)
+	for i, key := range keys {
+		id := fmt.Sprintf("%#v", key)
+		g, ok := index[id]
+		if !ok {
+			g = &group{key: key}
+			index[id] = g
+			res = append(res, g)
+		}
+		g.acts = append(g.acts, acts[i])
+	}
+	return res, nil
+}
+
+func (x *aggregator) Aggregate(_ context.Context, acts []any) ([]map[string]any, error) {
+	groups, err := x.groups(acts)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]map[string]any, 0, len(groups))
+	for _, g := range groups {
+		row := make(map[string]any, len(x.aggregates)+1)
+		if x.group != nil {
+			row[GroupKey] = g.key
+		}
+		for _, agg := range x.aggregates {
+			var val any
+			if val, err = agg.compute(g.acts); err != nil {
+				return nil, err
+			}
+			row[agg.name] = val
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func (agg *aggregate) compute(acts []any) (any, error) {
+	if agg.ev == nil {
+		return len(acts), nil
+	}
+	vals, err := agg.ev.run(acts...)
+	if err != nil {
+		return nil, err
+	}
+	if agg.fn == "count" {
+		var n int
+		for _, val := range vals {
+			b, ok := val.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%s: expected type `bool` found `%T`", agg.name, val)
+			}
+			if b {
+				n++
+			}
+		}
+		return n, nil
+	}
+	if len(vals) == 0 {
+		//nolint:nilnil // no value for an empty group
+		return nil, nil
+	}
+	var sum float64
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, val := range vals {
+		f, err := number(val)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", agg.name, err)
+		}
+		sum += f
+		lo, hi = math.Min(lo, f), math.Max(hi, f)
+	}
+	switch agg.fn {
+	case "sum":
+		return sum, nil
+	case "min":
+		return lo, nil
+	case "max":
+		return hi, nil
+	case "avg":
+		return sum / float64(len(vals)), nil
+	}
+	return nil, fmt.Errorf("unknown aggregate function '%s'", agg.fn)
+}
+
+var errNotNumeric = errors.New("not numeric")
+
+// number converts numeric values, including named types such as `unit.Length`, to float64
+func number(val any) (float64, error) {
+	v := reflect.ValueOf(val)
+	switch v.Kind() { //nolint:exhaustive // only numeric kinds are supported
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	}
+	return 0, fmt.Errorf("%w: `%T`", errNotNumeric, val)
+}
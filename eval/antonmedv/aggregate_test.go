@@ -0,0 +1,88 @@
+package antonmedv_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bzimmer/gravl/eval/antonmedv"
+)
+
+func TestAggregator(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	tests := []struct {
+		name, groupBy, aggregates, err string
+		rows                           []map[string]any
+	}{
+		{
+			name:    "count by type",
+			groupBy: ".Type",
+			rows: []map[string]any{
+				{"group": "Hike", "count()": 2},
+				{"group": "Ride", "count()": 3},
+				{"group": "Run", "count()": 1},
+			},
+		},
+		{
+			name:       "sum and max by year",
+			groupBy:    ".StartDateLocal.Year()",
+			aggregates: "sum(.Distance), max(.ElevationGain), count(.Type == 'Ride')",
+			rows: []map[string]any{
+				{"group": 2009, "sum(.Distance)": 900000.0, "max(.ElevationGain)": 150.0, "count(.Type == 'Ride')": 2},
+				{"group": 2010, "sum(.Distance)": 600000.0, "max(.ElevationGain)": 120.0, "count(.Type == 'Ride')": 1},
+				{"group": 2011, "sum(.Distance)": 600000.0, "max(.ElevationGain)": 180.0, "count(.Type == 'Ride')": 0},
+			},
+		},
+		{
+			name:       "no group",
+			aggregates: "min(.Distance), avg(.ElevationGain), count()",
+			rows: []map[string]any{
+				{"min(.Distance)": 100000.0, "avg(.ElevationGain)": 105.0, "count()": 6},
+			},
+		},
+		{
+			name:    "group by isoweek",
+			groupBy: "isoweek(.StartDateLocal)",
+			rows: []map[string]any{
+				{"group": antonmedv.ISOWeek{Year: 2009, Week: 46}, "count()": 1},
+				{"group": antonmedv.ISOWeek{Year: 2010, Week: 49}, "count()": 1},
+				{"group": antonmedv.ISOWeek{Year: 2009, Week: 2}, "count()": 1},
+				{"group": antonmedv.ISOWeek{Year: 2010, Week: 10}, "count()": 1},
+				{"group": antonmedv.ISOWeek{Year: 2009, Week: 15}, "count()": 1},
+				{"group": antonmedv.ISOWeek{Year: 2011, Week: 19}, "count()": 1},
+			},
+		},
+		{
+			name:       "commas in expressions",
+			aggregates: "sum(.ID in [1, 2] ? 10 : 1), count(.Type in ['Hike', 'Run'])",
+			rows: []map[string]any{
+				{"sum(.ID in [1, 2] ? 10 : 1)": 24.0, "count(.Type in ['Hike', 'Run'])": 3},
+			},
+		},
+		{name: "unknown function", aggregates: "median(.Distance)", err: "unknown aggregate function 'median'"},
+		{name: "missing expression", aggregates: "sum()", err: "missing expression"},
+		{name: "invalid aggregate", aggregates: ".Distance", err: "invalid aggregate '.Distance'"},
+		{name: "invalid group", groupBy: ".Typo", err: "has no field Typo"},
+		{name: "not numeric", aggregates: "sum(.Type)", err: "sum(.Type): not numeric"},
+		{name: "count not bool", aggregates: "count(.Type)", err: "expected type `bool`"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			agg, err := antonmedv.Aggregator(tt.groupBy, tt.aggregates, sample())
+			if err == nil {
+				var rows []map[string]any
+				rows, err = agg.Aggregate(t.Context(), activities())
+				if tt.err == "" {
+					a.NoError(err)
+					a.Equal(tt.rows, rows)
+					return
+				}
+			}
+			a.Error(err)
+			a.Contains(err.Error(), tt.err)
+		})
+	}
+}
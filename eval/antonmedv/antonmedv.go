@@ -2,14 +2,13 @@ package antonmedv
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
 	"strings"
-	"time"
 
-	"github.com/bzimmer/activity/strava"
 	"github.com/expr-lang/expr"
 	"github.com/expr-lang/expr/vm"
-	"github.com/martinlindhe/unit"
 
 	"github.com/bzimmer/gravl/eval"
 )
@@ -27,57 +26,64 @@ func closure(f string) string {
 	return f
 }
 
-type ISOWeek struct {
-	Year, Week int
-}
-
-func (w ISOWeek) String() string {
-	return fmt.Sprintf("[%04d %02d]", w.Year, w.Week)
-}
-
-func isoweek(t time.Time) ISOWeek {
-	year, week := t.ISOWeek()
-	return ISOWeek{year, week}
-}
-
-func fahrenheit(c float64) float64 {
-	return unit.FromCelsius(c).Fahrenheit()
-}
-
-func env(acts ...*strava.Activity) map[string]any {
-	return map[string]any{
-		"Activities": acts,
-		"isoweek":    isoweek,
-		"F":          fahrenheit,
+func env(typ reflect.Type, acts ...any) (map[string]any, error) {
+	vals := reflect.MakeSlice(reflect.SliceOf(typ), 0, len(acts))
+	for _, act := range acts {
+		val := reflect.ValueOf(act)
+		if !val.IsValid() || val.Type() != typ {
+			return nil, fmt.Errorf("expected type `%s` found `%T`", typ, act)
+		}
+		vals = reflect.Append(vals, val)
 	}
+	v := stdlib()
+	v["Activities"] = vals.Interface()
+	return v, nil
 }
 
 type evaluator struct {
+	typ     reflect.Type
 	program *vm.Program
 }
 
-func compile(q string) (*evaluator, error) {
-	pgm, err := expr.Compile(q, expr.Env(env()))
+// compile the expression for evaluation against activities of the same type as `act`,
+// allowing fields and functions to be checked before any activities are queried
+func compile(q string, act any) (*evaluator, error) {
+	typ := reflect.TypeOf(act)
+	if typ == nil {
+		return nil, errors.New("unknown activity type")
+	}
+	v, err := env(typ)
+	if err != nil {
+		return nil, err
+	}
+	pgm, err := expr.Compile(q, expr.Env(v))
 	if err != nil {
 		return nil, err
 	}
-	return &evaluator{pgm}, nil
+	return &evaluator{typ: typ, program: pgm}, nil
 }
 
-func Mapper(q string) (eval.Mapper, error) {
-	return compile(fmt.Sprintf("map(Activities, %s)", closure(q)))
+// Mapper compiles the expression for mapping activities of the same type as `act`
+func Mapper(q string, act any) (eval.Mapper, error) {
+	return compile(fmt.Sprintf("map(Activities, %s)", closure(q)), act)
 }
 
-func Filterer(q string) (eval.Filterer, error) {
-	return compile(fmt.Sprintf("filter(Activities, %s)", closure(q)))
+// Filterer compiles the expression for filtering activities of the same type as `act`
+func Filterer(q string, act any) (eval.Filterer, error) {
+	return compile(fmt.Sprintf("filter(Activities, %s)", closure(q)), act)
 }
 
-func Evaluator(q string) (eval.Evaluator, error) {
-	return compile(fmt.Sprintf("map(Activities, %s)", closure(q)))
+// Evaluator compiles the expression for evaluating activities of the same type as `act`
+func Evaluator(q string, act any) (eval.Evaluator, error) {
+	return compile(fmt.Sprintf("map(Activities, %s)", closure(q)), act)
 }
 
-func (x *evaluator) run(acts ...*strava.Activity) ([]any, error) {
-	out, err := expr.Run(x.program, env(acts...))
+func (x *evaluator) run(acts ...any) ([]any, error) {
+	v, err := env(x.typ, acts...)
+	if err != nil {
+		return nil, err
+	}
+	out, err := expr.Run(x.program, v)
 	if err != nil {
 		return nil, err
 	}
@@ -89,28 +95,24 @@ func (x *evaluator) run(acts ...*strava.Activity) ([]any, error) {
 	}
 }
 
-func (x *evaluator) Filter(_ context.Context, acts []*strava.Activity) ([]*strava.Activity, error) {
+func (x *evaluator) Filter(_ context.Context, acts []any) ([]any, error) {
 	res, err := x.run(acts...)
 	if err != nil {
 		return nil, err
 	}
-	p := make([]*strava.Activity, len(res))
 	for i := range res {
-		switch v := (res[i]).(type) {
-		case *strava.Activity:
-			p[i] = v
-		default:
-			return nil, fmt.Errorf("expected type `*strava.Activity` found `%T`", v)
+		if reflect.TypeOf(res[i]) != x.typ {
+			return nil, fmt.Errorf("expected type `%s` found `%T`", x.typ, res[i])
 		}
 	}
-	return p, nil
+	return res, nil
 }
 
-func (x *evaluator) Map(_ context.Context, acts []*strava.Activity) ([]any, error) {
+func (x *evaluator) Map(_ context.Context, acts []any) ([]any, error) {
 	return x.run(acts...)
 }
 
-func (x *evaluator) Bool(ctx context.Context, act *strava.Activity) (bool, error) {
+func (x *evaluator) Bool(ctx context.Context, act any) (bool, error) {
 	res, err := x.Eval(ctx, act)
 	if err != nil {
 		return false, err
@@ -123,7 +125,7 @@ func (x *evaluator) Bool(ctx context.Context, act *strava.Activity) (bool, error
 	}
 }
 
-func (x *evaluator) Eval(_ context.Context, act *strava.Activity) (any, error) {
+func (x *evaluator) Eval(_ context.Context, act any) (any, error) {
 	res, err := x.run(act)
 	if err != nil {
 		return nil, err
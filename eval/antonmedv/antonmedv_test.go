@@ -15,31 +15,36 @@ func TestInvalidExpression(t *testing.T) {
 	t.Parallel()
 	a := assert.New(t)
 	for _, expr := range []string{".Typo == 'Hike'", ""} {
-		f, err := antonmedv.Filterer(expr)
+		f, err := antonmedv.Filterer(expr, sample())
 		a.Nil(f)
 		a.Error(err)
-		m, err := antonmedv.Mapper(expr)
+		m, err := antonmedv.Mapper(expr, sample())
 		a.Nil(m)
 		a.Error(err)
-		e, err := antonmedv.Evaluator(expr)
+		e, err := antonmedv.Evaluator(expr, sample())
 		a.Nil(e)
 		a.Error(err)
 	}
 }
 
-func activities() []*strava.Activity {
-	return []*strava.Activity{
-		{ID: 1, Type: "Hike", Distance: 100000, ElevationGain: 30,
+// sample is the type of activity the expressions are compiled against
+func sample() any {
+	return (*strava.Activity)(nil)
+}
+
+func activities() []any {
+	return []any{
+		&strava.Activity{ID: 1, Type: "Hike", Distance: 100000, ElevationGain: 30,
 			StartDateLocal: time.Date(2009, time.November, 10, 8, 0, 0, 0, time.UTC)},
-		{ID: 2, Type: "Ride", Distance: 200000, ElevationGain: 60,
+		&strava.Activity{ID: 2, Type: "Ride", Distance: 200000, ElevationGain: 60,
 			StartDateLocal: time.Date(2010, time.December, 10, 8, 0, 0, 0, time.UTC)},
-		{ID: 3, Type: "Ride", Distance: 300000, ElevationGain: 90,
+		&strava.Activity{ID: 3, Type: "Ride", Distance: 300000, ElevationGain: 90,
 			StartDateLocal: time.Date(2009, time.January, 10, 8, 0, 0, 0, time.UTC)},
-		{ID: 4, Type: "Hike", Distance: 400000, ElevationGain: 120,
+		&strava.Activity{ID: 4, Type: "Hike", Distance: 400000, ElevationGain: 120,
 			StartDateLocal: time.Date(2010, time.March, 10, 8, 0, 0, 0, time.UTC)},
-		{ID: 5, Type: "Ride", Distance: 500000, ElevationGain: 150,
+		&strava.Activity{ID: 5, Type: "Ride", Distance: 500000, ElevationGain: 150,
 			StartDateLocal: time.Date(2009, time.April, 10, 8, 0, 0, 0, time.UTC)},
-		{ID: 6, Type: "Run", Distance: 600000, ElevationGain: 180,
+		&strava.Activity{ID: 6, Type: "Run", Distance: 600000, ElevationGain: 180,
 			StartDateLocal: time.Date(2011, time.May, 10, 8, 0, 0, 0, time.UTC)},
 	}
 }
@@ -51,7 +56,7 @@ func TestUserFunctions(t *testing.T) {
 	acts := activities()
 	a.Equal(6, len(acts))
 
-	q, err := antonmedv.Mapper("isoweek(.StartDateLocal)")
+	q, err := antonmedv.Mapper("isoweek(.StartDateLocal)", sample())
 	a.NoError(err)
 	vals, err := q.Map(t.Context(), acts)
 	a.NotNil(vals)
@@ -61,7 +66,7 @@ func TestUserFunctions(t *testing.T) {
 	a.Equal("[2009 02]", antonmedv.ISOWeek{Year: 2009, Week: 2}.String())
 
 	act := &strava.Activity{ID: 100, Type: "Hike", AverageTemperature: 1.3}
-	v, err := antonmedv.Evaluator("F(.AverageTemperature)")
+	v, err := antonmedv.Evaluator("F(.AverageTemperature)", sample())
 	a.NoError(err)
 	u, err := v.Eval(t.Context(), act)
 	a.NotNil(u)
@@ -76,14 +81,14 @@ func TestFilterer(t *testing.T) {
 	acts := activities()
 	a.Equal(6, len(acts))
 
-	q, err := antonmedv.Filterer(`.Type == "Ride"`)
+	q, err := antonmedv.Filterer(`.Type == "Ride"`, sample())
 	a.NoError(err)
 	vals, err := q.Filter(t.Context(), acts)
 	a.NotNil(vals)
 	a.NoError(err)
 	a.Equal(3, len(vals))
 
-	q, err = antonmedv.Filterer(`.Type == "Ride" && .StartDateLocal.Year() == 2010`)
+	q, err = antonmedv.Filterer(`.Type == "Ride" && .StartDateLocal.Year() == 2010`, sample())
 	a.NoError(err)
 	vals, err = q.Filter(t.Context(), acts)
 	a.NotNil(vals)
@@ -98,7 +103,7 @@ func TestMapper(t *testing.T) {
 	acts := activities()
 	a.Equal(6, len(acts))
 
-	q, err := antonmedv.Mapper(".Type")
+	q, err := antonmedv.Mapper(".Type", sample())
 	a.NoError(err)
 	vals, err := q.Map(t.Context(), acts)
 	a.NotNil(vals)
@@ -115,27 +120,60 @@ func TestEvaluator(t *testing.T) {
 	acts := activities()
 	a.Equal(6, len(acts))
 
-	q, err := antonmedv.Evaluator(`.Type == 'Hike'`)
+	q, err := antonmedv.Evaluator(`.Type == 'Hike'`, sample())
 	a.NoError(err)
 	val, err := q.Bool(t.Context(), acts[0])
 	a.NoError(err)
 	a.True(val)
 
-	q, err = antonmedv.Evaluator(`.Type`)
+	q, err = antonmedv.Evaluator(`.Type`, sample())
 	a.NoError(err)
 	val, err = q.Bool(t.Context(), acts[0])
 	a.Error(err)
 	a.False(val)
 
-	q, err = antonmedv.Evaluator(`.Type`)
+	q, err = antonmedv.Evaluator(`.Type`, sample())
 	a.NoError(err)
 	yal, err := q.Eval(t.Context(), acts[0])
 	a.NoError(err)
 	a.Equal("Hike", yal)
 
-	q, err = antonmedv.Evaluator(`[.Type, .Distance]`)
+	q, err = antonmedv.Evaluator(`[.Type, .Distance]`, sample())
 	a.NoError(err)
 	yal, err = q.Eval(t.Context(), acts[0])
 	a.NoError(err)
 	a.Equal([]any{"Hike", unit.Length(100000)}, yal)
 }
+
+func TestActivityTypes(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	type trip struct {
+		Name     string
+		Distance float64
+	}
+
+	q, err := antonmedv.Filterer(".Distance > 100", (*trip)(nil))
+	a.NoError(err)
+	vals, err := q.Filter(t.Context(), []any{&trip{Name: "a", Distance: 50}, &trip{Name: "b", Distance: 150}})
+	a.NoError(err)
+	a.Equal([]any{&trip{Name: "b", Distance: 150}}, vals)
+
+	// the fields of the activity type are checked at compile time
+	q, err = antonmedv.Filterer(".Type == 'Ride'", (*trip)(nil))
+	a.Error(err)
+	a.Nil(q)
+
+	// activities of a different type cannot be evaluated
+	e, err := antonmedv.Evaluator(".Name", (*trip)(nil))
+	a.NoError(err)
+	val, err := e.Eval(t.Context(), &strava.Activity{})
+	a.Error(err)
+	a.Nil(val)
+
+	// the type of the activity is required
+	e, err = antonmedv.Evaluator(".Name", nil)
+	a.Error(err)
+	a.Nil(e)
+}
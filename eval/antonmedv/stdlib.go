@@ -0,0 +1,257 @@
+package antonmedv
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"time"
+
+	"github.com/martinlindhe/unit"
+
+	"github.com/bzimmer/gravl/track"
+)
+
+var errCoordinates = errors.New("expected coordinates [lat, lng]")
+
+type ISOWeek struct {
+	Year, Week int
+}
+
+func (w ISOWeek) String() string {
+	return fmt.Sprintf("[%04d %02d]", w.Year, w.Week)
+}
+
+func isoweek(t time.Time) ISOWeek {
+	year, week := t.ISOWeek()
+	return ISOWeek{year, week}
+}
+
+func fahrenheit(c float64) float64 {
+	return unit.FromCelsius(c).Fahrenheit()
+}
+
+// length returns a function converting meters to another unit of length
+func length(f func(unit.Length) float64) func(any) (float64, error) {
+	return func(val any) (float64, error) {
+		m, err := number(val)
+		if err != nil {
+			return 0, err
+		}
+		return f(unit.Length(m)), nil
+	}
+}
+
+// speed returns a function converting meters per second to another unit of speed
+func speed(f func(unit.Speed) float64) func(any) (float64, error) {
+	return func(val any) (float64, error) {
+		mps, err := number(val)
+		if err != nil {
+			return 0, err
+		}
+		return f(unit.Speed(mps)), nil
+	}
+}
+
+// pace returns a function converting meters per second to the seconds needed to cover `meters`
+func pace(meters float64) func(any) (float64, error) {
+	return func(val any) (float64, error) {
+		mps, err := number(val)
+		if err != nil {
+			return 0, err
+		}
+		if mps <= 0 {
+			return 0, nil
+		}
+		return meters / mps, nil
+	}
+}
+
+// hms formats a duration in seconds (or a time.Duration) as H:MM:SS, or M:SS for less than an hour
+func hms(val any) (string, error) {
+	var secs float64
+	switch z := val.(type) {
+	case time.Duration:
+		secs = z.Seconds()
+	default:
+		var err error
+		if secs, err = number(val); err != nil {
+			return "", err
+		}
+	}
+	sign := ""
+	if secs < 0 {
+		sign, secs = "-", -secs
+	}
+	n := int64(math.Round(secs))
+	h, m, s := n/3600, (n%3600)/60, n%60
+	if h > 0 {
+		return fmt.Sprintf("%s%d:%02d:%02d", sign, h, m, s), nil
+	}
+	return fmt.Sprintf("%s%d:%02d", sign, m, s), nil
+}
+
+// coordinates returns the latitude and longitude of a point, either a two element array or slice
+// of numbers or a struct with `Lat` and `Lng` fields; ok is false if the point has no coordinates
+func coordinates(point any) (lat, lng float64, ok bool, err error) {
+	v := reflect.Indirect(reflect.ValueOf(point))
+	switch v.Kind() { //nolint:exhaustive // only slices, arrays, and structs are coordinates
+	case reflect.Invalid:
+		return 0, 0, false, nil
+	case reflect.Slice, reflect.Array:
+		switch v.Len() {
+		case 0:
+			return 0, 0, false, nil
+		case 2:
+		default:
+			return 0, 0, false, fmt.Errorf("%w: found %d values", errCoordinates, v.Len())
+		}
+		if lat, err = number(v.Index(0).Interface()); err != nil {
+			return 0, 0, false, err
+		}
+		if lng, err = number(v.Index(1).Interface()); err != nil {
+			return 0, 0, false, err
+		}
+		return lat, lng, true, nil
+	case reflect.Struct:
+		x, y := v.FieldByName("Lat"), v.FieldByName("Lng")
+		if x.IsValid() && y.IsValid() {
+			if lat, err = number(x.Interface()); err != nil {
+				return 0, 0, false, err
+			}
+			if lng, err = number(y.Interface()); err != nil {
+				return 0, 0, false, err
+			}
+			return lat, lng, true, nil
+		}
+	}
+	return 0, 0, false, fmt.Errorf("%w: found `%T`", errCoordinates, point)
+}
+
+// distance returns the great circle distance in meters between the point and the coordinates
+func distance(point any, lat, lng float64) (float64, error) {
+	x, y, ok, err := coordinates(point)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("%w: found no coordinates", errCoordinates)
+	}
+	return track.Haversine(x, y, lat, lng), nil
+}
+
+// near returns true if the point is within `meters` of the coordinates, false if the point has no coordinates
+func near(point any, lat, lng, meters float64) (bool, error) {
+	x, y, ok, err := coordinates(point)
+	if err != nil || !ok {
+		return false, err
+	}
+	return track.Haversine(x, y, lat, lng) <= meters, nil
+}
+
+// bbox returns true if the point lies within the bounding box, false if the point has no coordinates
+func bbox(point any, minLat, minLng, maxLat, maxLng float64) (bool, error) {
+	lat, lng, ok, err := coordinates(point)
+	if err != nil || !ok {
+		return false, err
+	}
+	return lat >= minLat && lat <= maxLat && lng >= minLng && lng <= maxLng, nil
+}
+
+// polygon returns true if the point lies within the polygon of [lat, lng] vertices, false if the
+// point has no coordinates
+func polygon(point any, vertices []any) (bool, error) {
+	lat, lng, ok, err := coordinates(point)
+	if err != nil || !ok {
+		return false, err
+	}
+	if len(vertices) < 3 {
+		return false, fmt.Errorf("expected at least 3 vertices found %d", len(vertices))
+	}
+	lats, lngs := make([]float64, len(vertices)), make([]float64, len(vertices))
+	for i := range vertices {
+		lats[i], lngs[i], ok, err = coordinates(vertices[i])
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, fmt.Errorf("%w: vertex %d has no coordinates", errCoordinates, i)
+		}
+	}
+	// ray casting: count the edges crossed by a ray extending east from the point
+	inside := false
+	for i, j := 0, len(vertices)-1; i < len(vertices); j, i = i, i+1 {
+		if (lats[i] > lat) != (lats[j] > lat) &&
+			lng < (lngs[j]-lngs[i])*(lat-lats[i])/(lats[j]-lats[i])+lngs[i] {
+			inside = !inside
+		}
+	}
+	return inside, nil
+}
+
+func weekday(t time.Time) string {
+	return t.Weekday().String()
+}
+
+func weekend(t time.Time) bool {
+	day := t.Weekday()
+	return day == time.Saturday || day == time.Sunday
+}
+
+func month(t time.Time) string {
+	return t.Month().String()
+}
+
+// imatches returns true if the string matches the regular expression ignoring case
+func imatches(s, pattern string) (bool, error) {
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(s), nil
+}
+
+// stdlib returns the functions available to all expressions
+//
+// Distances are in meters, speeds in meters per second, and durations in seconds, the units
+// used by the activity fields, with functions converting to more familiar units:
+//
+//	miles(m), km(m), feet(m)       meters to miles, kilometers, or feet
+//	mph(mps), kph(mps)             meters per second to miles or kilometers per hour
+//	pace(mps), pacemi(mps)         meters per second to seconds per kilometer or mile
+//	hms(secs)                      format seconds (or a duration) as H:MM:SS
+//	F(celsius)                     celsius to fahrenheit
+//	distance(point, lat, lng)      meters between a [lat, lng] point and the coordinates
+//	near(point, lat, lng, m)       true if the point is within m meters of the coordinates
+//	bbox(point, lat0, lng0, lat1, lng1)  true if the point is within the bounding box
+//	polygon(point, [[lat, lng], ...])    true if the point is within the polygon
+//	isoweek(time)                  the ISO year and week of the time
+//	weekday(time), month(time)     the name of the day of the week or month
+//	weekend(time)                  true if the time is on a Saturday or Sunday
+//	imatches(s, regex)             case insensitive regular expression match
+//
+// Points without coordinates (eg an indoor activity) are never near, within a bounding box,
+// or within a polygon while measuring their distance is an error.
+func stdlib() map[string]any {
+	return map[string]any{
+		"miles":    length(unit.Length.Miles),
+		"km":       length(unit.Length.Kilometers),
+		"feet":     length(unit.Length.Feet),
+		"mph":      speed(unit.Speed.MilesPerHour),
+		"kph":      speed(unit.Speed.KilometersPerHour),
+		"pace":     pace(float64(unit.Kilometer)),
+		"pacemi":   pace(float64(unit.Mile)),
+		"hms":      hms,
+		"F":        fahrenheit,
+		"distance": distance,
+		"near":     near,
+		"bbox":     bbox,
+		"polygon":  polygon,
+		"isoweek":  isoweek,
+		"weekday":  weekday,
+		"weekend":  weekend,
+		"month":    month,
+		"imatches": imatches,
+	}
+}
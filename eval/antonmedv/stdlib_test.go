@@ -0,0 +1,99 @@
+package antonmedv_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bzimmer/activity/strava"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bzimmer/gravl/eval/antonmedv"
+)
+
+func TestStdlib(t *testing.T) {
+	t.Parallel()
+
+	act := &strava.Activity{
+		ID:             1,
+		Name:           "Morning Ride to the Office",
+		Distance:       16093.44,
+		ElevationGain:  304.8,
+		MovingTime:     3723,
+		StartDateLocal: time.Date(2021, time.October, 2, 7, 30, 0, 0, time.UTC),
+	}
+	// a square around downtown seattle
+	square := "[[47.59, -122.35], [47.59, -122.32], [47.62, -122.32], [47.62, -122.35]]"
+
+	tests := []struct {
+		name string
+		expr string
+		res  any
+		err  string
+	}{
+		{name: "miles", expr: "miles(.Distance)", res: 10.0},
+		{name: "km", expr: "km(.Distance)", res: 16.09344},
+		{name: "feet", expr: "feet(.ElevationGain)", res: 1000.0},
+		{name: "miles int", expr: "miles(1609.344 * 2)", res: 2.0},
+		{name: "miles not numeric", expr: "miles(.Name)", err: "not numeric"},
+		{name: "mph", expr: "mph(4.4704)", res: 10.0},
+		{name: "kph", expr: "kph(10)", res: 36.0},
+		{name: "pace", expr: "pace(4)", res: 250.0},
+		{name: "pacemi", expr: "pacemi(1609.344 / 480)", res: 480.0},
+		{name: "pace zero", expr: "pace(0)", res: 0.0},
+		{name: "hms", expr: "hms(.MovingTime)", res: "1:02:03"},
+		{name: "hms minutes", expr: "hms(pace(4))", res: "4:10"},
+		{name: "hms duration", expr: "hms(duration('90m'))", res: "1:30:00"},
+		{name: "hms negative", expr: "hms(-61)", res: "-1:01"},
+		{name: "F", expr: "F(100)", res: 212.0},
+		{name: "distance", expr: "distance([47.6062, -122.3321], 47.6062, -122.3321)", res: 0.0},
+		{name: "distance km", expr: "km(distance([47.6062, -122.3321], 45.5152, -122.6784))", res: 234.0},
+		{name: "distance empty", expr: "distance([], 47.6, -122.3)", err: "found no coordinates"},
+		{name: "distance invalid", expr: "distance([1, 2, 3], 47.6, -122.3)", err: "found 3 values"},
+		{name: "distance not coordinates", expr: "distance(.Name, 47.6, -122.3)", err: "expected coordinates"},
+		{name: "near", expr: "near([47.6062, -122.3321], 47.6097, -122.3331, 500)", res: true},
+		{name: "not near", expr: "near([47.6062, -122.3321], 47.6097, -122.3331, 100)", res: false},
+		{name: "near empty", expr: "near([], 47.6097, -122.3331, 5000)", res: false},
+		{name: "bbox", expr: "bbox([47.6062, -122.3321], 47.5, -122.4, 47.7, -122.2)", res: true},
+		{name: "bbox outside", expr: "bbox([47.6062, -122.3321], 47.7, -122.4, 47.8, -122.2)", res: false},
+		{name: "bbox empty", expr: "bbox([], 47.5, -122.4, 47.7, -122.2)", res: false},
+		{name: "polygon", expr: "polygon([47.6062, -122.3321], " + square + ")", res: true},
+		{name: "polygon outside", expr: "polygon([47.6062, -122.3621], " + square + ")", res: false},
+		{name: "polygon empty", expr: "polygon([], " + square + ")", res: false},
+		{name: "polygon too few", expr: "polygon([47.6062, -122.3321], [[47.59, -122.35], [47.59, -122.32]])",
+			err: "expected at least 3 vertices found 2"},
+		{name: "isoweek", expr: "string(isoweek(.StartDateLocal))", res: "[2021 39]"},
+		{name: "weekday", expr: "weekday(.StartDateLocal)", res: "Saturday"},
+		{name: "weekend", expr: "weekend(.StartDateLocal)", res: true},
+		{name: "weekend monday", expr: "weekend(.StartDateLocal.Add(duration('48h')))", res: false},
+		{name: "month", expr: "month(.StartDateLocal)", res: "October"},
+		{name: "imatches", expr: "imatches(.Name, 'office$')", res: true},
+		{name: "imatches miss", expr: "imatches(.Name, '^evening')", res: false},
+		{name: "imatches invalid", expr: "imatches(.Name, '(')", err: "missing closing )"},
+		{name: "office commute", expr: "weekend(.StartDateLocal) && near([47.6062, -122.3321], 47.6097, -122.3331, 5000)", res: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			a := assert.New(t)
+			ev, err := antonmedv.Evaluator(tt.expr, sample())
+			if !a.NoError(err) {
+				return
+			}
+			res, err := ev.Eval(context.Background(), act)
+			if tt.err != "" {
+				a.Error(err)
+				a.Contains(err.Error(), tt.err)
+				return
+			}
+			a.NoError(err)
+			switch z := tt.res.(type) {
+			case float64:
+				a.InDelta(z, res, 0.05)
+			default:
+				a.Equal(z, res)
+			}
+		})
+	}
+}
@@ -2,27 +2,55 @@ package eval
 
 import (
 	"context"
-
-	"github.com/bzimmer/activity/strava"
+	"reflect"
+	"sort"
 )
 
 // Filterer performs activity filtering
 type Filterer interface {
 	// Filter the collection of activities by the expression returning those evaluating to true
-	Filter(ctx context.Context, acts []*strava.Activity) ([]*strava.Activity, error)
+	Filter(ctx context.Context, acts []any) ([]any, error)
 }
 
 // Mapper performs activity mapping
 type Mapper interface {
 	// Map over the collection of activities producing a slice of expression evaluation values
-	Map(ctx context.Context, acts []*strava.Activity) ([]any, error)
+	Map(ctx context.Context, acts []any) ([]any, error)
 }
 
 // Evaluator performs evaluations on activities
 type Evaluator interface {
 	// Bool performs an evaluation resulting in a boolean value
-	Bool(ctx context.Context, act *strava.Activity) (bool, error)
+	Bool(ctx context.Context, act any) (bool, error)
 
 	// Eval performs an evaluation on an activity with an arbitrary result
-	Eval(ctx context.Context, act *strava.Activity) (any, error)
+	Eval(ctx context.Context, act any) (any, error)
+}
+
+// Aggregator groups activities and computes aggregate values for each group
+type Aggregator interface {
+	// Aggregate the collection of activities producing one row per group
+	Aggregate(ctx context.Context, acts []any) ([]map[string]any, error)
+}
+
+// Fields returns the names of the exported fields available to expressions evaluated on the activity
+//
+// The activity is typically the zero value of a provider's activity type, eg `(*strava.Activity)(nil)`
+func Fields(act any) []string {
+	typ := reflect.TypeOf(act)
+	for typ != nil && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil
+	}
+	var fields []string
+	for _, f := range reflect.VisibleFields(typ) {
+		if f.Anonymous || !f.IsExported() {
+			continue
+		}
+		fields = append(fields, f.Name)
+	}
+	sort.Strings(fields)
+	return fields
 }
@@ -0,0 +1,214 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/track"
+)
+
+// inspection is the summary of an activity file or the reason it could not be decoded
+type inspection struct {
+	Filename string `json:"filename"`
+	*track.Summary
+	Error string `json:"error,omitempty"`
+}
+
+func decode(fs afero.Fs, path string) (*track.Track, error) {
+	fp, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	return track.Decode(fp)
+}
+
+func supported(path string) bool {
+	_, err := track.ToFormat(filepath.Ext(path))
+	return err == nil
+}
+
+// files returns the activity files for the argument, directories are walked for files with
+// a FIT, GPX, or TCX extension while files are returned regardless of extension
+func files(fs afero.Fs, name string) ([]string, error) {
+	var paths []string
+	err := afero.Walk(fs, name, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if path != name && !supported(path) {
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	return paths, err
+}
+
+func inspect(c *cli.Context) error {
+	if c.NArg() == 0 {
+		log.Warn().Msg("no args specified; exiting")
+		return nil
+	}
+	var invalid int
+	rt := gravl.Runtime(c)
+	for _, arg := range c.Args().Slice() {
+		paths, err := files(rt.Fs, arg)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			res := &inspection{Filename: path}
+			trk, err := decode(rt.Fs, path)
+			if err != nil {
+				invalid++
+				res.Error = err.Error()
+				rt.Metrics.IncrCounter([]string{c.Command.Name, "invalid"}, 1)
+				log.Error().Err(err).Str("path", path).Msg(c.Command.Name)
+			} else {
+				res.Summary = trk.Summarize()
+				rt.Metrics.IncrCounter([]string{c.Command.Name, "valid", string(trk.Format)}, 1)
+			}
+			if err = rt.Encoder.Encode(res); err != nil {
+				return err
+			}
+		}
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d invalid file(s)", invalid)
+	}
+	return nil
+}
+
+func inspectCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "inspect",
+		Usage:     "Inspect activity files",
+		ArgsUsage: "{FILE | DIRECTORY} ...",
+		Description: "Decode FIT, GPX, and TCX files and summarize the start time, duration, distance, " +
+			"elevation gain, device, sport, and available record channels. Files which cannot be decoded " +
+			"are reported and the command fails, making it useful to validate files before uploading.",
+		Action: inspect,
+	}
+}
+
+// output returns the path of the converted file
+func output(path string, format track.Format) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + "." + string(format)
+}
+
+// encode writes to a temporary file renamed once encoded so a failed conversion does not leave
+// a partial file or replace an existing one
+func encode(fs afero.Fs, path string, trk *track.Track, format track.Format) error {
+	tmp := path + ".tmp"
+	fp, err := fs.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = track.Encode(fp, trk, format)
+	if err = errors.Join(err, fp.Close()); err != nil {
+		return errors.Join(err, fs.Remove(tmp))
+	}
+	return fs.Rename(tmp, path)
+}
+
+func convert(c *cli.Context) error {
+	if c.NArg() == 0 {
+		log.Warn().Msg("no args specified; exiting")
+		return nil
+	}
+	format, err := track.ToFormat(c.String("to"))
+	if err != nil {
+		return err
+	}
+	if c.IsSet("output") && c.NArg() > 1 {
+		return errors.New("only one file can be converted when specifying an output")
+	}
+	rt := gravl.Runtime(c)
+	for _, path := range c.Args().Slice() {
+		dest := c.String("output")
+		if dest == "" {
+			dest = output(path, format)
+		}
+		if dest == path {
+			return fmt.Errorf("cannot convert %s to itself", path)
+		}
+		if _, err = rt.Fs.Stat(dest); err == nil && !c.Bool("overwrite") {
+			log.Error().Str("filename", dest).Msg("file exists and -o flag not specified")
+			return fmt.Errorf("%s: %w", dest, os.ErrExist)
+		}
+		var trk *track.Track
+		if trk, err = decode(rt.Fs, path); err != nil {
+			return err
+		}
+		if err = encode(rt.Fs, dest, trk, format); err != nil {
+			return err
+		}
+		rt.Metrics.IncrCounter([]string{c.Command.Name, string(trk.Format), string(format)}, 1)
+		log.Info().Str("src", path).Str("dst", dest).Msg(c.Command.Name)
+		if err = rt.Encoder.Encode(map[string]any{
+			"src":    path,
+			"dst":    dest,
+			"format": format,
+			"points": len(trk.Points),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func convertCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "convert",
+		Usage:     "Convert activity files between formats",
+		ArgsUsage: "FILE ...",
+		Description: "Convert FIT, GPX, and TCX files to another format, keeping timestamps, positions, elevation, " +
+			"heart rate, cadence, power, and temperature where the target format allows. Unless an output is " +
+			"specified the converted file is written next to the original with the extension of the new format. " +
+			"An existing file is replaced only with --overwrite.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "to",
+				Usage:    "The format of the converted file (fit, gpx, tcx)",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"O"},
+				Usage:   "The path of the converted file",
+			},
+			&cli.BoolFlag{
+				Name:    "overwrite",
+				Aliases: []string{"o"},
+				Value:   false,
+				Usage:   "Overwrite the converted file if it exists; fail otherwise",
+			},
+		},
+		Action: convert,
+	}
+}
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:        "file",
+		Category:    "activity",
+		Usage:       "Operate on local activity files",
+		Description: "Operate on local FIT, GPX, and TCX activity files",
+		Subcommands: []*cli.Command{
+			convertCommand(),
+			inspectCommand(),
+		},
+	}
+}
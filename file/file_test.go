@@ -0,0 +1,219 @@
+package file_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/file"
+	"github.com/bzimmer/gravl/internal"
+)
+
+const gpx = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx creator="gravl" xmlns="http://www.topografix.com/GPX/1/1">
+ <trk><name>Morning Ride</name><trkseg>
+  <trkpt lat="47.6000" lon="-122.3000"><ele>100</ele><time>2021-10-01T08:00:00Z</time></trkpt>
+  <trkpt lat="47.6010" lon="-122.3000"><ele>104</ele><time>2021-10-01T08:00:30Z</time></trkpt>
+ </trkseg></trk>
+</gpx>`
+
+func command(_ *testing.T, _ string) *cli.Command {
+	return file.Command()
+}
+
+// failingFs creates files which fail to write
+type failingFs struct {
+	afero.Fs
+}
+
+type failingFile struct {
+	afero.File
+}
+
+func (failingFile) Write(_ []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func (fs failingFs) Create(name string) (afero.File, error) {
+	fp, err := fs.Fs.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return failingFile{File: fp}, nil
+}
+
+func write(files map[string]string) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		fs := gravl.Runtime(c).Fs
+		if err := fs.MkdirAll("/rides", 0o755); err != nil {
+			return err
+		}
+		for name, contents := range files {
+			if err := afero.WriteFile(fs, name, []byte(contents), 0o644); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestInspect(t *testing.T) {
+	tests := []*internal.Harness{
+		{
+			Name: "no args",
+			Args: []string{"gravl", "file", "inspect"},
+		},
+		{
+			Name:   "file",
+			Args:   []string{"gravl", "file", "inspect", "/rides/ride.gpx"},
+			Before: write(map[string]string{"/rides/ride.gpx": gpx}),
+			Counters: map[string]int{
+				"gravl.inspect.valid.gpx": 1,
+			},
+		},
+		{
+			Name: "directory",
+			Args: []string{"gravl", "file", "inspect", "/rides"},
+			Before: write(map[string]string{
+				"/rides/ride.gpx":   gpx,
+				"/rides/ride.tcx":   "<TrainingCenterDatabase>",
+				"/rides/README.txt": "not an activity",
+			}),
+			Counters: map[string]int{
+				"gravl.inspect.valid.gpx": 1,
+				"gravl.inspect.invalid":   1,
+			},
+			Err: "1 invalid file(s)",
+		},
+		{
+			Name:   "unknown format",
+			Args:   []string{"gravl", "file", "inspect", "/rides/README.txt"},
+			Before: write(map[string]string{"/rides/README.txt": "not an activity"}),
+			Counters: map[string]int{
+				"gravl.inspect.invalid": 1,
+			},
+			Err: "1 invalid file(s)",
+		},
+		{
+			Name: "missing",
+			Args: []string{"gravl", "file", "inspect", "/rides/missing.fit"},
+			Err:  "file does not exist",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			internal.Run(t, tt, nil, command)
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	a := assert.New(t)
+	exists := func(path string) cli.AfterFunc {
+		return func(c *cli.Context) error {
+			data, err := afero.ReadFile(gravl.Runtime(c).Fs, path)
+			a.NoError(err)
+			a.NotEmpty(data)
+			return nil
+		}
+	}
+	tests := []*internal.Harness{
+		{
+			Name:   "gpx to fit",
+			Args:   []string{"gravl", "file", "convert", "--to", "fit", "/rides/ride.gpx"},
+			Before: write(map[string]string{"/rides/ride.gpx": gpx}),
+			After:  exists("/rides/ride.fit"),
+			Counters: map[string]int{
+				"gravl.convert.gpx.fit": 1,
+			},
+		},
+		{
+			Name:   "gpx to tcx with output",
+			Args:   []string{"gravl", "file", "convert", "--to", "tcx", "-O", "/rides/out.tcx", "/rides/ride.gpx"},
+			Before: write(map[string]string{"/rides/ride.gpx": gpx}),
+			After:  exists("/rides/out.tcx"),
+			Counters: map[string]int{
+				"gravl.convert.gpx.tcx": 1,
+			},
+		},
+		{
+			Name:   "existing output",
+			Args:   []string{"gravl", "file", "convert", "--to", "tcx", "-O", "/rides/out.tcx", "/rides/ride.gpx"},
+			Before: write(map[string]string{"/rides/ride.gpx": gpx, "/rides/out.tcx": "keep"}),
+			Err:    "/rides/out.tcx: file already exists",
+			After: func(c *cli.Context) error {
+				data, err := afero.ReadFile(gravl.Runtime(c).Fs, "/rides/out.tcx")
+				a.NoError(err)
+				a.Equal("keep", string(data))
+				return nil
+			},
+		},
+		{
+			Name:   "overwrite existing output",
+			Args:   []string{"gravl", "file", "convert", "--to", "tcx", "-o", "-O", "/rides/out.tcx", "/rides/ride.gpx"},
+			Before: write(map[string]string{"/rides/ride.gpx": gpx, "/rides/out.tcx": "replace"}),
+			After: func(c *cli.Context) error {
+				data, err := afero.ReadFile(gravl.Runtime(c).Fs, "/rides/out.tcx")
+				a.NoError(err)
+				a.Contains(string(data), "TrainingCenterDatabase")
+				return nil
+			},
+			Counters: map[string]int{
+				"gravl.convert.gpx.tcx": 1,
+			},
+		},
+		{
+			Name: "failed conversion",
+			Args: []string{"gravl", "file", "convert", "--to", "tcx", "-o", "-O", "/rides/out.tcx", "/rides/ride.gpx"},
+			Before: gravl.Befores(write(map[string]string{"/rides/ride.gpx": gpx, "/rides/out.tcx": "keep"}),
+				func(c *cli.Context) error {
+					gravl.Runtime(c).Fs = failingFs{Fs: gravl.Runtime(c).Fs}
+					return nil
+				}),
+			Err: "disk full",
+			After: func(c *cli.Context) error {
+				fs := gravl.Runtime(c).Fs
+				data, err := afero.ReadFile(fs, "/rides/out.tcx")
+				a.NoError(err)
+				a.Equal("keep", string(data))
+				_, err = fs.Stat("/rides/out.tcx.tmp")
+				a.Error(err)
+				return nil
+			},
+		},
+		{
+			Name:   "output with multiple files",
+			Args:   []string{"gravl", "file", "convert", "--to", "tcx", "-O", "/rides/out.tcx", "/rides/a.gpx", "/rides/b.gpx"},
+			Before: write(map[string]string{"/rides/a.gpx": gpx, "/rides/b.gpx": gpx}),
+			Err:    "only one file can be converted when specifying an output",
+		},
+		{
+			Name:   "same format",
+			Args:   []string{"gravl", "file", "convert", "--to", "gpx", "/rides/ride.gpx"},
+			Before: write(map[string]string{"/rides/ride.gpx": gpx}),
+			Err:    "cannot convert /rides/ride.gpx to itself",
+		},
+		{
+			Name: "unknown format",
+			Args: []string{"gravl", "file", "convert", "--to", "kml", "/rides/ride.gpx"},
+			Err:  "unknown format: 'kml'",
+		},
+		{
+			Name:   "invalid file",
+			Args:   []string{"gravl", "file", "convert", "--to", "gpx", "/rides/ride.fit"},
+			Before: write(map[string]string{"/rides/ride.fit": "not a fit file"}),
+			Err:    "unknown format",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			internal.Run(t, tt, nil, command)
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package format
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownFormat is returned when the output format is not supported
+var ErrUnknownFormat = errors.New("unknown format")
+
+// Encoder encodes results, encoders which buffer results write them when flushed
+type Encoder interface {
+	Encode(v any) error
+	Flush() error
+}
+
+// Formats returns the names of the supported output formats
+func Formats() []string {
+	return []string{"json", "ndjson", "csv", "table", "geojson"}
+}
+
+// New returns the encoder for the named format writing to `w`
+func New(w io.Writer, name string) (Encoder, error) {
+	switch name {
+	case "ndjson":
+		return &ndjsonEncoder{enc: json.NewEncoder(w)}, nil
+	case "json":
+		return &jsonEncoder{w: w}, nil
+	case "csv":
+		return &csvEncoder{w: w}, nil
+	case "table":
+		return &tableEncoder{w: w}, nil
+	case "geojson":
+		return &geojsonEncoder{w: w}, nil
+	}
+	return nil, fmt.Errorf("%w: '%s', expected one of %s", ErrUnknownFormat, name, strings.Join(Formats(), ", "))
+}
+
+// ndjsonEncoder writes each result as a JSON document on its own line
+type ndjsonEncoder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (x *ndjsonEncoder) Encode(v any) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.enc.Encode(v)
+}
+
+func (x *ndjsonEncoder) Flush() error {
+	return nil
+}
+
+// jsonEncoder writes all results as a single JSON array
+type jsonEncoder struct {
+	mu sync.Mutex
+	w  io.Writer
+	n  int
+}
+
+func (x *jsonEncoder) Encode(v any) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if x.n == 0 {
+		sep = "[\n"
+	}
+	x.n++
+	_, err = fmt.Fprintf(x.w, "%s%s", sep, data)
+	return err
+}
+
+func (x *jsonEncoder) Flush() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.n == 0 {
+		_, err := io.WriteString(x.w, "[]\n")
+		return err
+	}
+	x.n = 0
+	_, err := io.WriteString(x.w, "\n]\n")
+	return err
+}
+
+// columns names the values of results which are arrays, eg the `--attribute` expressions
+type columns struct {
+	names []string
+}
+
+func (x *columns) Columns(names []string) {
+	x.names = names
+}
+
+// row is a flattened result with the column names in document order
+type row struct {
+	keys []string
+	vals map[string]string
+}
+
+// flatten the result into a single row, nested objects and arrays are named with `.` separated
+// paths; for arrays the column names are used in place of the index
+func (x *columns) flatten(v any) (*row, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+	r := &row{vals: make(map[string]string)}
+	add := func(key, val string) {
+		if key == "" {
+			key = "value"
+		}
+		if _, ok := r.vals[key]; !ok {
+			r.keys = append(r.keys, key)
+		}
+		r.vals[key] = val
+	}
+	// a single object attribute, eg `{id: .ID, name: .Name}`, is flattened as the result
+	if vals, ok := v.([]any); ok && len(x.names) == 1 && len(vals) == 1 {
+		if _, scalar := scalar(vals[0]); !scalar {
+			return x.flatten(vals[0])
+		}
+	}
+	if err = walk(dec, "", x.names, add); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func scalar(v any) (string, bool) {
+	switch z := v.(type) {
+	case nil:
+		return "", true
+	case string:
+		return z, true
+	case bool:
+		return strconv.FormatBool(z), true
+	case json.Number:
+		return z.String(), true
+	case float64, float32, int, int64, int32, uint, uint64, uint32:
+		return fmt.Sprint(z), true
+	}
+	return "", false
+}
+
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// walk the next JSON value in the decoder calling `fn` for each scalar value
+func walk(dec *json.Decoder, prefix string, names []string, fn func(key, val string)) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		val, _ := scalar(tok)
+		fn(prefix, val)
+		return nil
+	}
+	switch delim {
+	case '{':
+		for dec.More() {
+			var key json.Token
+			if key, err = dec.Token(); err != nil {
+				return err
+			}
+			if err = walk(dec, join(prefix, fmt.Sprint(key)), nil, fn); err != nil {
+				return err
+			}
+		}
+	case '[':
+		for i := 0; dec.More(); i++ {
+			key := strconv.Itoa(i)
+			if prefix == "" && i < len(names) {
+				key = names[i]
+			}
+			if err = walk(dec, join(prefix, key), nil, fn); err != nil {
+				return err
+			}
+		}
+	}
+	// consume the closing delimiter
+	_, err = dec.Token()
+	return err
+}
+
+// header returns the union of the row keys in the order first seen
+func header(rows []*row) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, r := range rows {
+		for _, key := range r.keys {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// sorted returns the keys of the map in sorted order
+func sorted(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,141 @@
+package format_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/format"
+)
+
+type ride struct {
+	ID       int64   `json:"id"`
+	Name     string  `json:"name"`
+	Distance float64 `json:"distance"`
+	Gear     *struct {
+		Name string `json:"name"`
+	} `json:"gear,omitempty"`
+}
+
+func rides() []any {
+	return []any{
+		&ride{ID: 1, Name: "Morning Ride", Distance: 25000.5, Gear: &struct {
+			Name string `json:"name"`
+		}{Name: "Gravel"}},
+		&ride{ID: 2, Name: "Commute, the long way", Distance: 12000},
+	}
+}
+
+func TestFormat(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name, format string
+		columns      []string
+		values       []any
+		expected     string
+	}{
+		{
+			name:     "ndjson",
+			format:   "ndjson",
+			values:   rides(),
+			expected: "{\"id\":1,\"name\":\"Morning Ride\",\"distance\":25000.5,\"gear\":{\"name\":\"Gravel\"}}\n" + "{\"id\":2,\"name\":\"Commute, the long way\",\"distance\":12000}\n",
+		},
+		{
+			name:     "json",
+			format:   "json",
+			values:   []any{1, "two", map[string]int{"three": 3}},
+			expected: "[\n1,\n\"two\",\n{\"three\":3}\n]\n",
+		},
+		{
+			name:     "json empty",
+			format:   "json",
+			expected: "[]\n",
+		},
+		{
+			name:     "csv",
+			format:   "csv",
+			values:   rides(),
+			expected: "id,name,distance,gear.name\n1,Morning Ride,25000.5,Gravel\n2,\"Commute, the long way\",12000,\n",
+		},
+		{
+			name:     "csv union of columns",
+			format:   "csv",
+			values:   []any{rides()[1], rides()[0]},
+			expected: "id,name,distance,gear.name\n2,\"Commute, the long way\",12000,\n1,Morning Ride,25000.5,Gravel\n",
+		},
+		{
+			name:     "csv empty",
+			format:   "csv",
+			expected: "",
+		},
+		{
+			name:     "csv attributes",
+			format:   "csv",
+			columns:  []string{".ID", "miles(.Distance)"},
+			values:   []any{[]any{1, 15.53}, []any{2, 7.46}},
+			expected: ".ID,miles(.Distance)\n1,15.53\n2,7.46\n",
+		},
+		{
+			name:     "csv single object attribute",
+			format:   "csv",
+			columns:  []string{"{id: .ID, type: .Type}"},
+			values:   []any{[]any{map[string]any{"id": 1, "type": "Ride"}}},
+			expected: "id,type\n1,Ride\n",
+		},
+		{
+			name:     "csv scalars",
+			format:   "csv",
+			values:   []any{"a", "b"},
+			expected: "value\na\nb\n",
+		},
+		{
+			name:   "table",
+			format: "table",
+			values: rides(),
+			expected: "id  name                   distance  gear.name\n" +
+				"1   Morning Ride           25000.5   Gravel\n" +
+				"2   Commute, the long way  12000     \n",
+		},
+		{
+			name:     "table empty",
+			format:   "table",
+			expected: "",
+		},
+		{
+			name:     "geojson empty",
+			format:   "geojson",
+			expected: "{\"features\":[],\"type\":\"FeatureCollection\"}\n",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			a := assert.New(t)
+			var buf bytes.Buffer
+			enc, err := format.New(&buf, tt.format)
+			a.NoError(err)
+			if tt.columns != nil {
+				col, ok := enc.(gravl.Columnar)
+				a.True(ok)
+				col.Columns(tt.columns)
+			}
+			for _, v := range tt.values {
+				a.NoError(enc.Encode(v))
+			}
+			a.NoError(enc.Flush())
+			a.Equal(tt.expected, buf.String())
+		})
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	enc, err := format.New(&bytes.Buffer{}, "xml")
+	a.Nil(enc)
+	a.ErrorIs(err, format.ErrUnknownFormat)
+	a.Contains(err.Error(), "unknown format: 'xml', expected one of json, ndjson, csv, table, geojson")
+}
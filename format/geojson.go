@@ -0,0 +1,210 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+)
+
+var errInvalidPolyline = errors.New("invalid polyline")
+
+type geometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+type feature struct {
+	Type       string         `json:"type"`
+	Geometry   *geometry      `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+// geojsonEncoder writes all results as a GeoJSON FeatureCollection, each result is a feature
+// with a geometry from a polyline, latlng stream, track points, or start coordinates if available
+// and the scalar fields as properties
+type geojsonEncoder struct {
+	columns
+	mu       sync.Mutex
+	w        io.Writer
+	features []*feature
+}
+
+func (x *geojsonEncoder) Encode(v any) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err = dec.Decode(&doc); err != nil {
+		return err
+	}
+	f := &feature{Type: "Feature", Properties: make(map[string]any)}
+	switch z := doc.(type) {
+	case map[string]any:
+		if err = f.object(z); err != nil {
+			return err
+		}
+	case []any:
+		for i := range z {
+			if obj, ok := z[i].(map[string]any); ok {
+				if err = f.object(obj); err != nil {
+					return err
+				}
+				continue
+			}
+			name := "value"
+			if i < len(x.names) {
+				name = x.names[i]
+			}
+			f.Properties[name] = z[i]
+		}
+	default:
+		f.Properties["value"] = z
+	}
+	x.features = append(x.features, f)
+	return nil
+}
+
+func (x *geojsonEncoder) Flush() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	features := x.features
+	if features == nil {
+		features = []*feature{}
+	}
+	x.features = nil
+	enc := json.NewEncoder(x.w)
+	return enc.Encode(map[string]any{"type": "FeatureCollection", "features": features})
+}
+
+// object adds the scalar fields of the object as properties and the first geometry found
+func (f *feature) object(obj map[string]any) error {
+	for _, key := range sorted(obj) {
+		if key == "polyline" || key == "summary_polyline" {
+			continue
+		}
+		if _, ok := scalar(obj[key]); ok {
+			f.Properties[key] = obj[key]
+		}
+	}
+	if f.Geometry != nil {
+		return nil
+	}
+	g, err := geom(obj)
+	if err != nil {
+		return err
+	}
+	f.Geometry = g
+	return nil
+}
+
+// geom returns the geometry of the object, nil if the object has no geometry
+func geom(obj map[string]any) (*geometry, error) {
+	// strava activities and routes, or their map
+	for _, x := range []any{obj["map"], obj} {
+		m, ok := x.(map[string]any)
+		if !ok {
+			continue
+		}
+		for _, key := range []string{"polyline", "summary_polyline"} {
+			if s, ok := m[key].(string); ok && s != "" {
+				coords, err := polyline(s)
+				if err != nil {
+					return nil, err
+				}
+				return line(coords), nil
+			}
+		}
+	}
+	// strava streams
+	if s, ok := obj["latlng"].(map[string]any); ok {
+		if data, ok := s["data"].([]any); ok {
+			var coords [][2]float64
+			for i := range data {
+				if pt, ok := data[i].([]any); ok && len(pt) == 2 {
+					lat, _ := number(pt[0])
+					lng, _ := number(pt[1])
+					coords = append(coords, [2]float64{lng, lat})
+				}
+			}
+			return line(coords), nil
+		}
+	}
+	// rwgps trips and routes
+	if pts, ok := obj["track_points"].([]any); ok {
+		var coords [][2]float64
+		for i := range pts {
+			if pt, ok := pts[i].(map[string]any); ok {
+				lng, x := number(pt["x"])
+				lat, y := number(pt["y"])
+				if x && y {
+					coords = append(coords, [2]float64{lng, lat})
+				}
+			}
+		}
+		return line(coords), nil
+	}
+	if pt, ok := obj["start_latlng"].([]any); ok && len(pt) == 2 {
+		lat, _ := number(pt[0])
+		lng, _ := number(pt[1])
+		return &geometry{Type: "Point", Coordinates: [2]float64{lng, lat}}, nil
+	}
+	//nolint:nilnil // no geometry
+	return nil, nil
+}
+
+func line(coords [][2]float64) *geometry {
+	if len(coords) == 0 {
+		return nil
+	}
+	return &geometry{Type: "LineString", Coordinates: coords}
+}
+
+func number(v any) (float64, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+// polyline decodes an encoded polyline into [lng, lat] coordinates
+//
+// https://developers.google.com/maps/documentation/utilities/polylinealgorithm
+func polyline(s string) ([][2]float64, error) {
+	var lat, lng int
+	var coords [][2]float64
+	for i := 0; i < len(s); {
+		var delta [2]int
+		for j := range delta {
+			var result, shift int
+			for {
+				if i >= len(s) {
+					return nil, errInvalidPolyline
+				}
+				b := int(s[i]) - 63
+				i++
+				result |= (b & 0x1f) << shift
+				shift += 5
+				if b < 0x20 {
+					break
+				}
+			}
+			if result&1 != 0 {
+				delta[j] = ^(result >> 1)
+			} else {
+				delta[j] = result >> 1
+			}
+		}
+		lat, lng = lat+delta[0], lng+delta[1]
+		coords = append(coords, [2]float64{float64(lng) / 1e5, float64(lat) / 1e5})
+	}
+	return coords, nil
+}
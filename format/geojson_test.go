@@ -0,0 +1,107 @@
+package format_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/format"
+)
+
+type collection struct {
+	Type     string `json:"type"`
+	Features []struct {
+		Type     string `json:"type"`
+		Geometry *struct {
+			Type        string `json:"type"`
+			Coordinates any    `json:"coordinates"`
+		} `json:"geometry"`
+		Properties map[string]any `json:"properties"`
+	} `json:"features"`
+}
+
+func TestGeoJSON(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	var buf bytes.Buffer
+	enc, err := format.New(&buf, "geojson")
+	a.NoError(err)
+
+	// activity with a polyline
+	a.NoError(enc.Encode(map[string]any{
+		"id":   1,
+		"name": "Morning Ride",
+		"map":  map[string]any{"summary_polyline": "_p~iF~ps|U_ulLnnqC_mqNvxq`@"},
+	}))
+	// streams
+	a.NoError(enc.Encode(map[string]any{
+		"latlng": map[string]any{"data": [][2]float64{{47.6, -122.3}, {47.7, -122.4}}},
+	}))
+	// track points
+	a.NoError(enc.Encode(map[string]any{
+		"id":           3,
+		"track_points": []map[string]any{{"x": -122.3, "y": 47.6}, {"x": -122.4, "y": 47.7}, {"e": 100}},
+	}))
+	// starting point
+	a.NoError(enc.Encode(map[string]any{"id": 4, "start_latlng": []float64{47.6, -122.3}}))
+	// no geometry
+	a.NoError(enc.Encode("indoor"))
+	a.NoError(enc.Flush())
+
+	var fc collection
+	a.NoError(json.Unmarshal(buf.Bytes(), &fc))
+	a.Equal("FeatureCollection", fc.Type)
+	a.Len(fc.Features, 5)
+
+	f := fc.Features[0]
+	a.Equal("Feature", f.Type)
+	a.Equal("LineString", f.Geometry.Type)
+	a.Equal([]any{
+		[]any{-120.2, 38.5},
+		[]any{-120.95, 40.7},
+		[]any{-126.453, 43.252},
+	}, f.Geometry.Coordinates)
+	a.Equal(map[string]any{"id": 1.0, "name": "Morning Ride"}, f.Properties)
+
+	f = fc.Features[1]
+	a.Equal("LineString", f.Geometry.Type)
+	a.Equal([]any{[]any{-122.3, 47.6}, []any{-122.4, 47.7}}, f.Geometry.Coordinates)
+
+	f = fc.Features[2]
+	a.Equal("LineString", f.Geometry.Type)
+	a.Equal([]any{[]any{-122.3, 47.6}, []any{-122.4, 47.7}}, f.Geometry.Coordinates)
+
+	f = fc.Features[3]
+	a.Equal("Point", f.Geometry.Type)
+	a.Equal([]any{-122.3, 47.6}, f.Geometry.Coordinates)
+
+	f = fc.Features[4]
+	a.Nil(f.Geometry)
+	a.Equal(map[string]any{"value": "indoor"}, f.Properties)
+}
+
+func TestGeoJSONAttributes(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	var buf bytes.Buffer
+	enc, err := format.New(&buf, "geojson")
+	a.NoError(err)
+	col, ok := enc.(gravl.Columnar)
+	a.True(ok)
+	col.Columns([]string{".ID", ".Map"})
+	a.NoError(enc.Encode([]any{1, map[string]any{"polyline": "", "summary_polyline": "_p~iF~ps|U"}}))
+	a.Error(enc.Encode([]any{2, map[string]any{"polyline": "_p~iF~ps|"}}))
+	a.NoError(enc.Flush())
+
+	var fc collection
+	a.NoError(json.Unmarshal(buf.Bytes(), &fc))
+	a.Len(fc.Features, 1)
+	a.Equal(map[string]any{".ID": 1.0}, fc.Features[0].Properties)
+	a.Equal("LineString", fc.Features[0].Geometry.Type)
+	a.Equal([]any{[]any{-120.2, 38.5}}, fc.Features[0].Geometry.Coordinates)
+}
@@ -0,0 +1,98 @@
+package format
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// csvEncoder writes results as CSV once all results are encoded, the header is the union
+// of the columns of all results
+type csvEncoder struct {
+	columns
+	mu   sync.Mutex
+	w    io.Writer
+	rows []*row
+}
+
+func (x *csvEncoder) Encode(v any) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	r, err := x.flatten(v)
+	if err != nil {
+		return err
+	}
+	x.rows = append(x.rows, r)
+	return nil
+}
+
+func (x *csvEncoder) Flush() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if len(x.rows) == 0 {
+		return nil
+	}
+	keys := header(x.rows)
+	w := csv.NewWriter(x.w)
+	if err := w.Write(keys); err != nil {
+		return err
+	}
+	for _, r := range x.rows {
+		vals := make([]string, len(keys))
+		for i, key := range keys {
+			vals[i] = r.vals[key]
+		}
+		if err := w.Write(vals); err != nil {
+			return err
+		}
+	}
+	x.rows = nil
+	w.Flush()
+	return w.Error()
+}
+
+// tableEncoder writes results as an aligned table once all results are encoded
+type tableEncoder struct {
+	columns
+	mu   sync.Mutex
+	w    io.Writer
+	rows []*row
+}
+
+func (x *tableEncoder) Encode(v any) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	r, err := x.flatten(v)
+	if err != nil {
+		return err
+	}
+	x.rows = append(x.rows, r)
+	return nil
+}
+
+func (x *tableEncoder) Flush() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if len(x.rows) == 0 {
+		return nil
+	}
+	keys := header(x.rows)
+	tw := tabwriter.NewWriter(x.w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, strings.Join(keys, "\t")); err != nil {
+		return err
+	}
+	for _, r := range x.rows {
+		vals := make([]string, len(keys))
+		for i, key := range keys {
+			vals[i] = strings.NewReplacer("\t", " ", "\n", " ").Replace(r.vals[key])
+		}
+		if _, err := fmt.Fprintln(tw, strings.Join(vals, "\t")); err != nil {
+			return err
+		}
+	}
+	x.rows = nil
+	return tw.Flush()
+}
@@ -3,14 +3,18 @@ package blackhole
 import (
 	"context"
 	"strings"
+	"time"
 
 	"github.com/bzimmer/activity"
 	"github.com/urfave/cli/v2"
+
+	"github.com/bzimmer/gravl"
 )
 
 const (
-	Provider = "blackhole"
-	Data     = `<gpx xmlns="http://www.topografix.com/GPX/"></gpx>`
+	Provider   = "blackhole"
+	Data       = `<gpx xmlns="http://www.topografix.com/GPX/"></gpx>`
+	Activities = 3
 )
 
 type uploadable struct {
@@ -46,7 +50,7 @@ func (b *blackhole) Upload(_ context.Context, _ *activity.File) (activity.Upload
 // Status returns the processing status of a file
 func (b *blackhole) Status(_ context.Context, id activity.UploadID) (activity.Upload, error) {
 	defer func() { b.statuscnt++ }()
-	return &uploadable{id: id, done: b.status == b.statuscnt}, nil
+	return &uploadable{id: id, done: b.statuscnt >= b.status}, nil
 }
 
 func (b *blackhole) Export(_ context.Context, activityID int64) (*activity.Export, error) {
@@ -61,6 +65,38 @@ func (b *blackhole) Export(_ context.Context, activityID int64) (*activity.Expor
 	}, nil
 }
 
+// List returns `Activities` activities, one per day starting on 2021-10-01
+func (b *blackhole) List(_ context.Context, count int, before, after time.Time) ([]*gravl.ActivityRef, error) {
+	var refs []*gravl.ActivityRef
+	start := time.Date(2021, time.October, 1, 8, 0, 0, 0, time.UTC)
+	for i := range Activities {
+		if count > 0 && len(refs) == count {
+			break
+		}
+		ref := &gravl.ActivityRef{ID: int64(1000 + i), Name: "Foo", Start: start.AddDate(0, 0, i)}
+		if (!after.IsZero() && !ref.Start.After(after)) || (!before.IsZero() && !ref.Start.Before(before)) {
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// ExportRoute returns an empty course file in the format
+func (b *blackhole) ExportRoute(_ context.Context, _ int64, format activity.Format) (*activity.File, error) {
+	return &activity.File{
+		Format:   format,
+		Name:     "Bar",
+		Filename: "Bar." + format.String(),
+		Reader:   strings.NewReader(Data),
+	}, nil
+}
+
+// ImportRoute discards the file
+func (b *blackhole) ImportRoute(_ context.Context, file *activity.File) (*gravl.RouteRef, error) {
+	return &gravl.RouteRef{ID: "1", Name: file.Name}, nil
+}
+
 func Before(_ *cli.Context) error {
 	return nil
 }
@@ -72,3 +108,15 @@ func UploaderFunc(_ *cli.Context) (activity.Uploader, error) {
 func ExporterFunc(_ *cli.Context) (activity.Exporter, error) {
 	return &blackhole{}, nil
 }
+
+func ListerFunc(_ *cli.Context) (gravl.Lister, error) {
+	return &blackhole{}, nil
+}
+
+func RouteExporterFunc(_ *cli.Context) (gravl.RouteExporter, error) {
+	return &blackhole{}, nil
+}
+
+func RouteImporterFunc(_ *cli.Context) (gravl.RouteImporter, error) {
+	return &blackhole{}, nil
+}
@@ -36,4 +36,16 @@ func TestBlackhole(t *testing.T) {
 	uploader, err = blackhole.UploaderFunc(c)
 	a.NoError(err)
 	a.NotNil(uploader)
+
+	rexp, err := blackhole.RouteExporterFunc(c)
+	a.NoError(err)
+	file, err = rexp.ExportRoute(t.Context(), 1234, activity.FormatGPX)
+	a.NoError(err)
+	a.Equal("Bar.gpx", file.Filename)
+
+	rimp, err := blackhole.RouteImporterFunc(c)
+	a.NoError(err)
+	ref, err := rimp.ImportRoute(t.Context(), file)
+	a.NoError(err)
+	a.Equal("Bar", ref.Name)
 }
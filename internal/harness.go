@@ -2,15 +2,13 @@ package internal
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/fs"
 	"net/http"
 	"net/http/httptest"
 	"os"
-	"sync"
 	"testing"
 	"time"
 
@@ -23,7 +21,9 @@ import (
 	"golang.org/x/oauth2"
 
 	"github.com/bzimmer/gravl"
+	"github.com/bzimmer/gravl/auth"
 	"github.com/bzimmer/gravl/eval/antonmedv"
+	"github.com/bzimmer/gravl/format"
 )
 
 type Harness struct {
@@ -39,26 +39,21 @@ func runtime(app *cli.App) *gravl.Rt {
 	return app.Metadata[gravl.RuntimeKey].(*gravl.Rt) //nolint:errcheck // cannot happen
 }
 
-type encoder struct {
-	pool *sync.Pool
+// writer defers to the app's writer at the time of writing so tests may replace it
+type writer struct {
+	app *cli.App
 }
 
-func (enc encoder) Encode(v any) error {
-	if enc.pool == nil {
-		return nil
-	}
-	x, ok := enc.pool.Get().(*json.Encoder)
-	if !ok {
-		return errors.New("did not receive encoder from pool")
-	}
-	err := x.Encode(v)
-	if err == nil {
-		enc.pool.Put(x)
-	}
-	return err
+func (w writer) Write(p []byte) (int, error) {
+	return w.app.Writer.Write(p)
 }
 
 func initRuntime(c *cli.Context) error {
+	enc, err := format.New(writer{app: c.App}, c.String("format"))
+	if err != nil {
+		return err
+	}
+
 	cfg := metrics.DefaultConfig("gravl")
 	cfg.EnableRuntimeMetrics = false
 	cfg.TimerGranularity = time.Second
@@ -67,22 +62,26 @@ func initRuntime(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	var pool *sync.Pool
-	if c.Bool("json") {
-		pool = &sync.Pool{New: func() any { return json.NewEncoder(c.App.Writer) }}
-	}
+	fs := afero.NewMemMapFs()
 	c.App.Metadata = map[string]any{
 		gravl.RuntimeKey: &gravl.Rt{
-			Start:     time.Now(),
-			Metrics:   metric,
-			Sink:      sink,
-			Encoder:   &encoder{pool: pool},
-			Fs:        afero.NewMemMapFs(),
-			Filterer:  antonmedv.Filterer,
-			Evaluator: antonmedv.Evaluator,
-			Exporters: make(map[string]gravl.ExporterFunc),
-			Uploaders: make(map[string]gravl.UploaderFunc),
-			Endpoints: make(map[string]oauth2.Endpoint),
+			Start:          time.Now(),
+			Metrics:        metric,
+			Sink:           sink,
+			Encoder:        enc,
+			Fs:             fs,
+			Tokens:         auth.NewStore(fs, "/gravl"),
+			Filterer:       antonmedv.Filterer,
+			Evaluator:      antonmedv.Evaluator,
+			Aggregator:     antonmedv.Aggregator,
+			Exporters:      make(map[string]gravl.ExporterFunc),
+			Uploaders:      make(map[string]gravl.UploaderFunc),
+			Listers:        make(map[string]gravl.ListerFunc),
+			RouteExporters: make(map[string]gravl.RouteExporterFunc),
+			RouteImporters: make(map[string]gravl.RouteImporterFunc),
+			Endpoints:      make(map[string]oauth2.Endpoint),
+			Transports:     make(map[string]http.RoundTripper),
+			TokenStores:    make(map[string]gravl.TokenStore),
 		},
 	}
 	log.Info().Msg("initiated Runtime")
@@ -159,12 +158,12 @@ func NewTestApp(t *testing.T, tt *Harness, cmd *cli.Command) *cli.App {
 		Name:     tt.Name,
 		HelpName: tt.Name,
 		Before:   gravl.Befores(initRuntime, tt.Before),
-		After:    gravl.Afters(tt.After, walkfs, gravl.Stats, counters(t, tt.Counters)),
+		Writer:   io.Discard,
+		After:    gravl.Afters(gravl.Flush, tt.After, walkfs, gravl.Stats, counters(t, tt.Counters)),
 		Flags: []cli.Flag{
-			&cli.BoolFlag{
-				Name:    "json",
-				Aliases: []string{"j"},
-				Value:   false,
+			&cli.StringFlag{
+				Name:  "format",
+				Value: "ndjson",
 			},
 			&cli.BoolFlag{
 				Name:  "http-tracing",
@@ -175,6 +174,9 @@ func NewTestApp(t *testing.T, tt *Harness, cmd *cli.Command) *cli.App {
 				Name:    "timeout",
 				Aliases: []string{"t"},
 				Value:   time.Second * 10,
+			},
+			&cli.PathFlag{
+				Name: "config",
 			}},
 		Commands: []*cli.Command{cmd},
 	}
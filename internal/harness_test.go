@@ -1,9 +1,11 @@
 package internal_test
 
 import (
+	"bytes"
 	"errors"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/urfave/cli/v2"
 
 	"github.com/bzimmer/gravl"
@@ -49,7 +51,7 @@ func TestHarness(t *testing.T) {
 		},
 		{
 			Name:     "harness with err",
-			Args:     []string{"gravl", "--json", "foo"},
+			Args:     []string{"gravl", "foo"},
 			Err:      "foo err bar",
 			Counters: map[string]int{},
 			Before: func(c *cli.Context) error {
@@ -62,7 +64,7 @@ func TestHarness(t *testing.T) {
 		},
 		{
 			Name: "harness no sample value",
-			Args: []string{"gravl", "--json", "foo"},
+			Args: []string{"gravl", "foo"},
 			Err:  "cannot find sample",
 			Counters: map[string]int{
 				"does.not.exist": 1,
@@ -77,22 +79,37 @@ func TestHarness(t *testing.T) {
 	}
 }
 
-func TestEncodeJSON(t *testing.T) {
-	tests := []*internal.Harness{
-		{
-			Name:     "json encode",
-			Args:     []string{"gravl", "--json", "encode"},
-			Counters: map[string]int{},
-		},
+func TestEncode(t *testing.T) {
+	a := assert.New(t)
+	tests := []struct {
+		format, output string
+	}{
+		{format: "ndjson", output: "{\"hello\":\"world\"}\n{\"hello\":\"world\"}\n"},
+		{format: "json", output: "[\n{\"hello\":\"world\"},\n{\"hello\":\"world\"}\n]\n"},
 	}
 	for _, tt := range tests {
-		tt := tt
-		t.Run(tt.Name, func(t *testing.T) {
-			internal.Run(t, tt, nil, func(_ *testing.T, _ string) *cli.Command {
+		var buf bytes.Buffer
+		t.Run(tt.format, func(t *testing.T) {
+			internal.Run(t, &internal.Harness{
+				Name: tt.format,
+				Args: []string{"gravl", "--format", tt.format, "encode"},
+				Before: func(c *cli.Context) error {
+					c.App.Writer = &buf
+					return nil
+				},
+				After: func(_ *cli.Context) error {
+					a.Equal(tt.output, buf.String())
+					return nil
+				},
+			}, nil, func(_ *testing.T, _ string) *cli.Command {
 				return &cli.Command{
 					Name: "encode",
 					Action: func(c *cli.Context) error {
-						return gravl.Runtime(c).Encoder.Encode(map[string]string{"hello": "world"})
+						enc := gravl.Runtime(c).Encoder
+						if err := enc.Encode(map[string]string{"hello": "world"}); err != nil {
+							return err
+						}
+						return enc.Encode(map[string]string{"hello": "world"})
 					},
 				}
 			})
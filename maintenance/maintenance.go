@@ -0,0 +1,148 @@
+package maintenance
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/bzimmer/gravl/config"
+)
+
+// Activity is an activity's contribution to the usage of its gear
+type Activity struct {
+	// ID is the provider's activity id or the path of an activity file
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	Name   string `json:"name"`
+	Sport  string `json:"sport"`
+	Device string `json:"device"`
+	// GearID is empty if the activity has no gear
+	GearID string    `json:"gear_id"`
+	Start  time.Time `json:"start"`
+	// Distance in meters
+	Distance float64 `json:"distance"`
+	// Elevation gain in meters
+	Elevation float64 `json:"elevation"`
+	// Duration is the moving time in seconds
+	Duration float64 `json:"duration"`
+}
+
+// Usage is the total usage of a gear
+type Usage struct {
+	Gear       string `json:"gear"`
+	Name       string `json:"name"`
+	Activities int    `json:"activities"`
+	// Distance in meters
+	Distance float64 `json:"distance"`
+	// Elevation gain in meters
+	Elevation float64 `json:"elevation"`
+	// Duration in seconds
+	Duration float64 `json:"duration"`
+}
+
+// Service is the usage of a component since its last service
+type Service struct {
+	Gear      string `json:"gear"`
+	Name      string `json:"name"`
+	Component string `json:"component"`
+	// Serviced is nil if the component has no recorded service
+	Serviced *time.Time `json:"serviced,omitempty"`
+	Every    string     `json:"every"`
+	// Used and Remaining are in the unit of the interval
+	Used      float64 `json:"used"`
+	Remaining float64 `json:"remaining"`
+	Due       bool    `json:"due"`
+}
+
+func names(bikes []*config.Bike) map[string]string {
+	res := make(map[string]string, len(bikes))
+	for _, bike := range bikes {
+		res[bike.ID] = bike.Name
+	}
+	return res
+}
+
+// Totals returns the usage of each gear sorted by gear id, activities without gear are totaled
+// under an empty gear id
+func Totals(acts []*Activity, bikes []*config.Bike) []*Usage {
+	name := names(bikes)
+	usage := make(map[string]*Usage)
+	for _, act := range acts {
+		u, ok := usage[act.GearID]
+		if !ok {
+			u = &Usage{Gear: act.GearID, Name: name[act.GearID]}
+			usage[act.GearID] = u
+		}
+		u.Activities++
+		u.Distance += act.Distance
+		u.Elevation += act.Elevation
+		u.Duration += act.Duration
+	}
+	res := make([]*Usage, 0, len(usage))
+	for _, u := range usage {
+		u.Distance, u.Elevation, u.Duration = round(u.Distance), round(u.Elevation), round(u.Duration)
+		res = append(res, u)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Gear < res[j].Gear })
+	return res
+}
+
+// Services returns the usage of each component of the bikes since its last service, all activities
+// of the bike are counted if the component has no recorded service
+func Services(acts []*Activity, bikes []*config.Bike) []*Service {
+	var res []*Service
+	for _, bike := range bikes {
+		for _, comp := range bike.Components {
+			var meters, seconds float64
+			for _, act := range acts {
+				if act.GearID != bike.ID || act.Start.Before(comp.Serviced) {
+					continue
+				}
+				meters += act.Distance
+				seconds += act.Duration
+			}
+			used := comp.Every.Usage(meters, seconds)
+			s := &Service{
+				Gear:      bike.ID,
+				Name:      bike.Name,
+				Component: comp.Name,
+				Every:     comp.Every.String(),
+				Used:      round(used),
+				Remaining: round(comp.Every.Value - used),
+				Due:       used >= comp.Every.Value,
+			}
+			if !comp.Serviced.IsZero() {
+				s.Serviced = &comp.Serviced
+			}
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// Serviced returns the earliest last service of the components, zero if any component has
+// no recorded service
+func Serviced(bikes []*config.Bike) time.Time {
+	var earliest time.Time
+	for i, comp := range components(bikes) {
+		if comp.Serviced.IsZero() {
+			return time.Time{}
+		}
+		if i == 0 || comp.Serviced.Before(earliest) {
+			earliest = comp.Serviced
+		}
+	}
+	return earliest
+}
+
+func components(bikes []*config.Bike) []*config.Component {
+	var res []*config.Component
+	for _, bike := range bikes {
+		res = append(res, bike.Components...)
+	}
+	return res
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,83 @@
+package maintenance_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bzimmer/gravl/config"
+	"github.com/bzimmer/gravl/maintenance"
+)
+
+func date(month time.Month, day int) time.Time {
+	return time.Date(2021, month, day, 8, 0, 0, 0, time.UTC)
+}
+
+func activities() []*maintenance.Activity {
+	return []*maintenance.Activity{
+		{ID: "1", GearID: "b1", Start: date(time.August, 1), Distance: 100000, Elevation: 1000, Duration: 14400},
+		{ID: "2", GearID: "b1", Start: date(time.September, 1), Distance: 50000, Elevation: 500, Duration: 7200},
+		{ID: "3", GearID: "b2", Start: date(time.September, 2), Distance: 30000, Elevation: 200, Duration: 3600},
+		{ID: "4", Start: date(time.September, 3), Distance: 5000, Duration: 1800},
+	}
+}
+
+func bikes() []*config.Bike {
+	return []*config.Bike{
+		{
+			ID:   "b1",
+			Name: "Gravel",
+			Components: []*config.Component{
+				{Name: "chain", Every: config.Interval{Value: 120, Unit: config.Kilometers}},
+				{Name: "tires", Every: config.Interval{Value: 100, Unit: config.Kilometers}, Serviced: date(time.August, 15)},
+				{Name: "hubs", Every: config.Interval{Value: 5, Unit: config.Hours}, Serviced: date(time.July, 1)},
+			},
+		},
+		{ID: "b3", Name: "Track"},
+	}
+}
+
+func TestTotals(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	res := maintenance.Totals(activities(), bikes())
+	a.Len(res, 3)
+	a.Equal(&maintenance.Usage{Activities: 1, Distance: 5000, Duration: 1800}, res[0])
+	a.Equal(&maintenance.Usage{
+		Gear: "b1", Name: "Gravel", Activities: 2, Distance: 150000, Elevation: 1500, Duration: 21600}, res[1])
+	a.Equal("b2", res[2].Gear)
+	a.Empty(res[2].Name)
+	a.Empty(maintenance.Totals(nil, bikes()))
+}
+
+func TestServices(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	res := maintenance.Services(activities(), bikes())
+	a.Len(res, 3)
+	chain, tires, hubs := res[0], res[1], res[2]
+	a.Equal("chain", chain.Component)
+	a.Equal("Gravel", chain.Name)
+	a.Equal("120km", chain.Every)
+	a.Equal(150.0, chain.Used)
+	a.Equal(-30.0, chain.Remaining)
+	a.True(chain.Due)
+	a.Nil(chain.Serviced)
+	a.Equal(date(time.August, 15), *tires.Serviced)
+	a.Equal(50.0, tires.Used)
+	a.Equal(50.0, tires.Remaining)
+	a.False(tires.Due)
+	a.Equal(6.0, hubs.Used)
+	a.True(hubs.Due)
+}
+
+func TestServiced(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	a.True(maintenance.Serviced(bikes()).IsZero())
+	b := bikes()
+	b[0].Components[0].Serviced = date(time.September, 1)
+	a.Equal(date(time.July, 1), maintenance.Serviced(b))
+	a.True(maintenance.Serviced(nil).IsZero())
+}
@@ -1,8 +1,10 @@
 package gravl
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"net/http"
 	"time"
 
 	"github.com/bzimmer/activity"
@@ -33,6 +35,57 @@ func Token(n int) (string, error) {
 
 type ExporterFunc func(c *cli.Context) (activity.Exporter, error)
 type UploaderFunc func(c *cli.Context) (activity.Uploader, error)
+type ListerFunc func(c *cli.Context) (Lister, error)
+type RouteExporterFunc func(c *cli.Context) (RouteExporter, error)
+type RouteImporterFunc func(c *cli.Context) (RouteImporter, error)
+
+// RouteExporter exports planned routes as course files
+type RouteExporter interface {
+	// ExportRoute returns the route as a GPX or TCX file
+	ExportRoute(ctx context.Context, routeID int64, format activity.Format) (*activity.File, error)
+}
+
+// RouteRef identifies a route imported to a provider
+type RouteRef struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// RouteImporter imports course files as planned routes
+type RouteImporter interface {
+	// ImportRoute imports the file as a new route
+	ImportRoute(ctx context.Context, file *activity.File) (*RouteRef, error)
+}
+
+// ActivityRef identifies an activity available from a provider
+type ActivityRef struct {
+	ID    int64     `json:"id"`
+	Name  string    `json:"name"`
+	Start time.Time `json:"start"`
+}
+
+// Lister lists the activities available from a provider
+type Lister interface {
+	// List returns up to `count` (all if zero) activities started before `before` and after `after`,
+	// a zero time does not bound the range
+	List(ctx context.Context, count int, before, after time.Time) ([]*ActivityRef, error)
+}
+
+// TokenStore persists the oauth2 token of each provider across invocations
+type TokenStore interface {
+	// Token returns the provider's token or nil if none is stored
+	Token(provider string) (*oauth2.Token, error)
+	// Save the provider's token, replacing any previously stored token
+	Save(provider string, token *oauth2.Token) error
+	// Seed stores the provider's token from the flags, remembering it so it seeds the store only once
+	Seed(provider string, token *oauth2.Token) error
+	// Seeded returns true if the token from the flags last seeded the store
+	Seeded(provider string, token *oauth2.Token) (bool, error)
+	// Delete the provider's token returning true if a token was stored
+	Delete(provider string) (bool, error)
+	// Providers returns the names of the providers with a stored token
+	Providers() ([]string, error)
+}
 
 // Rt holds the gravl runtime
 type Rt struct {
@@ -49,9 +102,25 @@ type Rt struct {
 	// Endpoints
 	Endpoints map[string]oauth2.Endpoint
 
+	// Transports shared by all clients of a provider, see `activity.Transport`
+	Transports map[string]http.RoundTripper
+
+	// Tokens
+	Tokens TokenStore
+	// TokenStores replace the store of a provider's tokens, see `activity.Tokens`
+	TokenStores map[string]TokenStore
+
 	// Export / Upload
 	Exporters map[string]ExporterFunc
 	Uploaders map[string]UploaderFunc
+	Listers   map[string]ListerFunc
+
+	// Copy copies the activities from the source to the destination as `qp copy`
+	Copy func(c *cli.Context, from, to string, ids ...int64) error
+
+	// Routes
+	RouteExporters map[string]RouteExporterFunc
+	RouteImporters map[string]RouteImporterFunc
 
 	// IO
 	Fs      afero.Fs
@@ -61,9 +130,10 @@ type Rt struct {
 	Metrics *metrics.Metrics
 	Sink    *metrics.InmemSink
 
-	// Evaluation
-	Filterer  func(string) (eval.Filterer, error)
-	Evaluator func(string) (eval.Evaluator, error)
+	// Evaluation, expressions are compiled against the type of the activity argument
+	Filterer   func(string, any) (eval.Filterer, error)
+	Evaluator  func(string, any) (eval.Evaluator, error)
+	Aggregator func(string, string, any) (eval.Aggregator, error)
 }
 
 func Runtime(c *cli.Context) *Rt {
@@ -74,6 +144,25 @@ type Encoder interface {
 	Encode(v any) error
 }
 
+// Flusher is implemented by encoders which buffer results until all have been encoded
+type Flusher interface {
+	Flush() error
+}
+
+// Columnar is implemented by encoders with tabular output, the names label the values
+// of results which are arrays, eg the `--attribute` expressions
+type Columnar interface {
+	Columns(names []string)
+}
+
+// Flush the encoder if it buffers results
+func Flush(c *cli.Context) error {
+	if f, ok := Runtime(c).Encoder.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
 // Afters combines multiple `cli.AfterFunc`s into a single `cli.AfterFunc`
 func Afters(afs ...cli.AfterFunc) cli.AfterFunc {
 	return func(c *cli.Context) error {
@@ -114,6 +203,12 @@ func Stats(c *cli.Context) error {
 				Str("metric", key).
 				Msg("counters")
 		}
+		for key, val := range data[i].Gauges {
+			log.Info().
+				Float32("value", val.Value).
+				Str("metric", key).
+				Msg("gauges")
+		}
 		for key, val := range data[i].Samples {
 			as := val.AggregateSample
 			log.Info().
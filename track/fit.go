@@ -0,0 +1,565 @@
+package track
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// ErrInvalidFIT is returned when a FIT file is corrupt or truncated
+var ErrInvalidFIT = errors.New("invalid fit")
+
+// fitEpoch is the zero time of FIT timestamps (1989-12-31T00:00:00Z) in unix seconds
+const fitEpoch = 631065600
+
+// global message numbers
+const (
+	fitFileID     = 0
+	fitSport      = 12
+	fitSession    = 18
+	fitRecord     = 20
+	fitDeviceInfo = 23
+)
+
+// fieldTimestamp is the field number of the timestamp common to all messages
+const fieldTimestamp = 253
+
+type fitField struct {
+	num, size, base byte
+}
+
+type fitDefinition struct {
+	global  uint16
+	order   binary.ByteOrder
+	fields  []fitField
+	devSize int
+}
+
+// fitValue is a decoded field value, only the first element of an array is kept
+type fitValue struct {
+	u     uint64
+	i     int64
+	f     float64
+	s     string
+	valid bool
+}
+
+type fitMessage map[byte]fitValue
+
+type fitDecoder struct {
+	r         *bufio.Reader
+	crc       uint16
+	remaining uint32
+	defs      [16]*fitDefinition
+	timestamp uint32
+	track     *Track
+	product   string
+	creator   string
+}
+
+// DecodeFIT decodes a FIT activity file
+func DecodeFIT(r io.Reader) (*Track, error) {
+	d := &fitDecoder{r: bufio.NewReader(r), track: &Track{Format: FormatFIT}}
+	if err := d.header(); err != nil {
+		return nil, err
+	}
+	for d.remaining > 0 {
+		if err := d.record(); err != nil {
+			return nil, err
+		}
+	}
+	want := d.crc
+	var crc [2]byte
+	if err := d.read(crc[:]); err != nil {
+		return nil, err
+	}
+	if got := binary.LittleEndian.Uint16(crc[:]); got != want {
+		return nil, fmt.Errorf("%w: crc mismatch 0x%04x != 0x%04x", ErrInvalidFIT, got, want)
+	}
+	switch {
+	case d.product != "":
+		d.track.Device = d.product
+	case d.creator != "":
+		d.track.Device = d.creator
+	}
+	return d.track, nil
+}
+
+func (d *fitDecoder) read(p []byte) error {
+	if _, err := io.ReadFull(d.r, p); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("%w: truncated", ErrInvalidFIT)
+		}
+		return err
+	}
+	d.crc = fitCRC(d.crc, p)
+	return nil
+}
+
+// body reads bytes from the data records, tracking the bytes remaining
+func (d *fitDecoder) body(n int) ([]byte, error) {
+	if uint32(n) > d.remaining {
+		return nil, fmt.Errorf("%w: record exceeds data size", ErrInvalidFIT)
+	}
+	p := make([]byte, n)
+	if err := d.read(p); err != nil {
+		return nil, err
+	}
+	d.remaining -= uint32(n)
+	return p, nil
+}
+
+func (d *fitDecoder) header() error {
+	var size [1]byte
+	if err := d.read(size[:]); err != nil {
+		return err
+	}
+	if size[0] != 12 && size[0] != 14 {
+		return fmt.Errorf("%w: header size %d", ErrInvalidFIT, size[0])
+	}
+	hdr := make([]byte, size[0]-1)
+	if err := d.read(hdr); err != nil {
+		return err
+	}
+	if string(hdr[7:11]) != ".FIT" {
+		return fmt.Errorf("%w: missing signature", ErrInvalidFIT)
+	}
+	d.remaining = binary.LittleEndian.Uint32(hdr[3:7])
+	return nil
+}
+
+func (d *fitDecoder) record() error {
+	hdr, err := d.body(1)
+	if err != nil {
+		return err
+	}
+	h := hdr[0]
+	switch {
+	case h&0x80 != 0:
+		// compressed timestamp header
+		offset := uint32(h & 0x1f)
+		ts := (d.timestamp &^ 0x1f) + offset
+		if offset < d.timestamp&0x1f {
+			ts += 0x20
+		}
+		d.timestamp = ts
+		return d.data((h>>5)&0x03, true)
+	case h&0x40 != 0:
+		return d.definition(h&0x0f, h&0x20 != 0)
+	default:
+		return d.data(h&0x0f, false)
+	}
+}
+
+func (d *fitDecoder) definition(local byte, developer bool) error {
+	fixed, err := d.body(5)
+	if err != nil {
+		return err
+	}
+	def := &fitDefinition{order: binary.LittleEndian}
+	if fixed[1] == 1 {
+		def.order = binary.BigEndian
+	}
+	def.global = def.order.Uint16(fixed[2:4])
+	fields, err := d.body(3 * int(fixed[4]))
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(fields); i += 3 {
+		def.fields = append(def.fields, fitField{num: fields[i], size: fields[i+1], base: fields[i+2]})
+	}
+	if developer {
+		var n, devs []byte
+		if n, err = d.body(1); err != nil {
+			return err
+		}
+		if devs, err = d.body(3 * int(n[0])); err != nil {
+			return err
+		}
+		for i := 0; i < len(devs); i += 3 {
+			def.devSize += int(devs[i+1])
+		}
+	}
+	d.defs[local] = def
+	return nil
+}
+
+func (d *fitDecoder) data(local byte, compressed bool) error {
+	def := d.defs[local]
+	if def == nil {
+		return fmt.Errorf("%w: undefined local message %d", ErrInvalidFIT, local)
+	}
+	msg := make(fitMessage, len(def.fields))
+	for _, f := range def.fields {
+		p, err := d.body(int(f.size))
+		if err != nil {
+			return err
+		}
+		msg[f.num] = fitDecode(def.order, f.base, p)
+	}
+	if _, err := d.body(def.devSize); err != nil {
+		return err
+	}
+	if ts, ok := msg[fieldTimestamp]; ok && ts.valid {
+		d.timestamp = uint32(ts.u)
+	} else if compressed {
+		msg[fieldTimestamp] = fitValue{u: uint64(d.timestamp), valid: true}
+	}
+	switch def.global {
+	case fitFileID:
+		d.fileID(msg)
+	case fitDeviceInfo:
+		d.deviceInfo(msg)
+	case fitSession:
+		d.session(msg)
+	case fitSport:
+		if v := msg[0]; v.valid && d.track.Sport == "" {
+			d.track.Sport = fitSportName(v.u)
+		}
+	case fitRecord:
+		d.point(msg)
+	}
+	return nil
+}
+
+func (d *fitDecoder) fileID(msg fitMessage) {
+	if v := msg[8]; v.valid {
+		d.creator = v.s
+		return
+	}
+	if v := msg[1]; v.valid {
+		d.creator = fitManufacturer(v.u)
+		if p := msg[2]; p.valid {
+			d.creator = fmt.Sprintf("%s %d", d.creator, p.u)
+		}
+	}
+}
+
+func (d *fitDecoder) deviceInfo(msg fitMessage) {
+	// only the creator (device index 0) describes the recording device
+	if v := msg[0]; !v.valid || v.u != 0 {
+		return
+	}
+	switch {
+	case msg[27].valid:
+		d.product = msg[27].s
+	case msg[2].valid:
+		d.product = fitManufacturer(msg[2].u)
+		if p := msg[4]; p.valid {
+			d.product = fmt.Sprintf("%s %d", d.product, p.u)
+		}
+	}
+}
+
+func (d *fitDecoder) session(msg fitMessage) {
+	if v := msg[5]; v.valid {
+		d.track.Sport = fitSportName(v.u)
+	}
+	if v := msg[22]; v.valid {
+		d.track.Ascent += float64(v.u)
+	}
+}
+
+func (d *fitDecoder) point(msg fitMessage) {
+	p := &Point{}
+	if v := msg[fieldTimestamp]; v.valid {
+		p.Time = time.Unix(fitEpoch+int64(v.u), 0).UTC()
+	}
+	lat, lng := msg[0], msg[1]
+	if lat.valid && lng.valid {
+		p.Lat, p.Lng = semicircles(lat.i), semicircles(lng.i)
+		p.Channels |= ChannelPosition
+	}
+	if v := msg[78]; v.valid {
+		p.Elevation, p.Channels = float64(v.u)/5-500, p.Channels|ChannelElevation
+	} else if v = msg[2]; v.valid {
+		p.Elevation, p.Channels = float64(v.u)/5-500, p.Channels|ChannelElevation
+	}
+	if v := msg[73]; v.valid {
+		p.Speed, p.Channels = float64(v.u)/1000, p.Channels|ChannelSpeed
+	} else if v = msg[6]; v.valid {
+		p.Speed, p.Channels = float64(v.u)/1000, p.Channels|ChannelSpeed
+	}
+	if v := msg[5]; v.valid {
+		p.Distance, p.Channels = float64(v.u)/100, p.Channels|ChannelDistance
+	}
+	if v := msg[3]; v.valid {
+		p.HeartRate, p.Channels = float64(v.u), p.Channels|ChannelHeartRate
+	}
+	if v := msg[4]; v.valid {
+		p.Cadence, p.Channels = float64(v.u), p.Channels|ChannelCadence
+	}
+	if v := msg[7]; v.valid {
+		p.Power, p.Channels = float64(v.u), p.Channels|ChannelPower
+	}
+	if v := msg[13]; v.valid {
+		p.Temperature, p.Channels = float64(v.i), p.Channels|ChannelTemperature
+	}
+	d.track.Points = append(d.track.Points, p)
+}
+
+func semicircles(v int64) float64 {
+	return float64(v) * (180 / math.Pow(2, 31))
+}
+
+// fitDecode decodes the first element of the field, arrays are not supported
+func fitDecode(order binary.ByteOrder, base byte, p []byte) fitValue {
+	var v fitValue
+	switch base {
+	case 0x00, 0x02, 0x0a, 0x0d: // enum, uint8, uint8z, byte
+		if len(p) < 1 {
+			return v
+		}
+		v.u = uint64(p[0])
+		v.valid = (base == 0x0a && p[0] != 0) || (base != 0x0a && p[0] != 0xff)
+	case 0x01: // sint8
+		if len(p) < 1 {
+			return v
+		}
+		v.i = int64(int8(p[0]))
+		v.valid = p[0] != 0x7f
+	case 0x83: // sint16
+		if len(p) < 2 {
+			return v
+		}
+		x := order.Uint16(p)
+		v.i, v.valid = int64(int16(x)), x != 0x7fff
+	case 0x84, 0x8b: // uint16, uint16z
+		if len(p) < 2 {
+			return v
+		}
+		x := order.Uint16(p)
+		v.u, v.valid = uint64(x), (base == 0x84 && x != 0xffff) || (base == 0x8b && x != 0)
+	case 0x85: // sint32
+		if len(p) < 4 {
+			return v
+		}
+		x := order.Uint32(p)
+		v.i, v.valid = int64(int32(x)), x != 0x7fffffff
+	case 0x86, 0x8c: // uint32, uint32z
+		if len(p) < 4 {
+			return v
+		}
+		x := order.Uint32(p)
+		v.u, v.valid = uint64(x), (base == 0x86 && x != 0xffffffff) || (base == 0x8c && x != 0)
+	case 0x88: // float32
+		if len(p) < 4 {
+			return v
+		}
+		x := order.Uint32(p)
+		v.f, v.valid = float64(math.Float32frombits(x)), x != 0xffffffff
+	case 0x89: // float64
+		if len(p) < 8 {
+			return v
+		}
+		x := order.Uint64(p)
+		v.f, v.valid = math.Float64frombits(x), x != 0xffffffffffffffff
+	case 0x07: // string
+		n := 0
+		for n < len(p) && p[n] != 0 {
+			n++
+		}
+		v.s, v.valid = string(p[:n]), n > 0
+	}
+	return v
+}
+
+func fitSportName(v uint64) string {
+	switch v {
+	case 0:
+		return "generic"
+	case 1:
+		return "running"
+	case 2:
+		return "cycling"
+	case 4:
+		return "fitness_equipment"
+	case 5:
+		return "swimming"
+	case 10:
+		return "training"
+	case 11:
+		return "walking"
+	case 12:
+		return "cross_country_skiing"
+	case 13:
+		return "alpine_skiing"
+	case 15:
+		return "rowing"
+	case 17:
+		return "hiking"
+	}
+	return fmt.Sprintf("sport(%d)", v)
+}
+
+func fitManufacturer(v uint64) string {
+	switch v {
+	case 1:
+		return "garmin"
+	case 32:
+		return "wahoo_fitness"
+	case 255:
+		return "development"
+	case 260:
+		return "zwift"
+	case 289:
+		return "hammerhead"
+	}
+	return fmt.Sprintf("manufacturer(%d)", v)
+}
+
+// fitCRC updates the FIT crc-16 with the bytes
+func fitCRC(crc uint16, p []byte) uint16 {
+	table := [16]uint16{
+		0x0000, 0xcc01, 0xd801, 0x1400, 0xf001, 0x3c00, 0x2800, 0xe401,
+		0xa001, 0x6c00, 0x7800, 0xb401, 0x5000, 0x9c01, 0x8801, 0x4400,
+	}
+	for _, b := range p {
+		tmp := table[crc&0xf]
+		crc = (crc >> 4) & 0x0fff
+		crc = crc ^ tmp ^ table[b&0xf]
+		tmp = table[crc&0xf]
+		crc = (crc >> 4) & 0x0fff
+		crc = crc ^ tmp ^ table[(b>>4)&0xf]
+	}
+	return crc
+}
+
+// fitEncoder writes the data records of a FIT file
+type fitEncoder struct {
+	records bytes.Buffer
+}
+
+func (e *fitEncoder) definition(local byte, global uint16, fields ...fitField) {
+	e.records.WriteByte(0x40 | local)
+	e.records.Write([]byte{0, 0})
+	_ = binary.Write(&e.records, binary.LittleEndian, global)
+	e.records.WriteByte(byte(len(fields)))
+	for _, f := range fields {
+		e.records.Write([]byte{f.num, f.size, f.base})
+	}
+}
+
+func (e *fitEncoder) data(local byte, values ...any) {
+	e.records.WriteByte(local)
+	for _, v := range values {
+		_ = binary.Write(&e.records, binary.LittleEndian, v)
+	}
+}
+
+func (e *fitEncoder) encode(w io.Writer) error {
+	hdr := make([]byte, 14)
+	hdr[0], hdr[1] = 14, 0x20
+	binary.LittleEndian.PutUint16(hdr[2:4], 2132)
+	binary.LittleEndian.PutUint32(hdr[4:8], uint32(e.records.Len()))
+	copy(hdr[8:12], ".FIT")
+	binary.LittleEndian.PutUint16(hdr[12:14], fitCRC(0, hdr[:12]))
+	crc := fitCRC(fitCRC(0, hdr), e.records.Bytes())
+	for _, p := range [][]byte{hdr, e.records.Bytes(), {byte(crc), byte(crc >> 8)}} {
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fitTimestamp(t time.Time) uint32 {
+	if t.IsZero() {
+		return math.MaxUint32
+	}
+	return uint32(t.Unix() - fitEpoch)
+}
+
+// fitScaled returns the value scaled and offset as FIT stores it or the invalid value if not present
+func fitScaled(p *Point, c Channel, v, scale, offset float64) uint32 {
+	if !p.Has(c) {
+		return math.MaxUint32
+	}
+	return uint32(math.Round((v + offset) * scale))
+}
+
+// EncodeFIT encodes the track as a FIT activity file
+func EncodeFIT(w io.Writer, t *Track) error {
+	s := t.Summarize()
+	start, end := fitTimestamp(s.Start), fitTimestamp(s.Start.Add(time.Duration(s.Duration)*time.Second))
+	elapsed, distance := uint32(math.Round(s.Duration*1000)), uint32(math.Round(s.Distance*100))
+
+	e := &fitEncoder{}
+	// file_id: type, manufacturer, time_created, product_name
+	device := []byte(t.Device)
+	if len(device) > 254 {
+		device = device[:254]
+	}
+	e.definition(0, fitFileID,
+		fitField{0, 1, 0x00}, fitField{1, 2, 0x84}, fitField{4, 4, 0x86}, fitField{8, byte(len(device) + 1), 0x07})
+	e.data(0, uint8(4), uint16(255), start, append(device, 0))
+
+	e.definition(1, fitRecord,
+		fitField{253, 4, 0x86}, fitField{0, 4, 0x85}, fitField{1, 4, 0x85}, fitField{5, 4, 0x86},
+		fitField{78, 4, 0x86}, fitField{73, 4, 0x86}, fitField{3, 1, 0x02}, fitField{4, 1, 0x02},
+		fitField{7, 2, 0x84}, fitField{13, 1, 0x01})
+	for _, p := range t.Points {
+		lat, lng := int32(math.MaxInt32), int32(math.MaxInt32)
+		if p.Has(ChannelPosition) {
+			lat, lng = int32(math.Round(p.Lat/180*(1<<31))), int32(math.Round(p.Lng/180*(1<<31)))
+		}
+		hr, cad, power, temp := uint8(math.MaxUint8), uint8(math.MaxUint8), uint16(math.MaxUint16), int8(math.MaxInt8)
+		if p.Has(ChannelHeartRate) {
+			hr = uint8(math.Round(p.HeartRate))
+		}
+		if p.Has(ChannelCadence) {
+			cad = uint8(math.Round(p.Cadence))
+		}
+		if p.Has(ChannelPower) {
+			power = uint16(math.Round(p.Power))
+		}
+		if p.Has(ChannelTemperature) {
+			temp = int8(math.Round(p.Temperature))
+		}
+		e.data(1, fitTimestamp(p.Time), lat, lng,
+			fitScaled(p, ChannelDistance, p.Distance, 100, 0),
+			fitScaled(p, ChannelElevation, p.Elevation, 5, 500),
+			fitScaled(p, ChannelSpeed, p.Speed, 1000, 0),
+			hr, cad, power, temp)
+	}
+
+	// lap & session: timestamp, start_time, total_elapsed_time, total_timer_time, total_distance
+	summary := []fitField{{253, 4, 0x86}, {2, 4, 0x86}, {7, 4, 0x86}, {8, 4, 0x86}, {9, 4, 0x86}}
+	e.definition(2, 19, summary...)
+	e.data(2, end, start, elapsed, elapsed, distance)
+	// session adds sport and total_ascent
+	e.definition(3, fitSession, append(summary, fitField{5, 1, 0x00}, fitField{22, 2, 0x84})...)
+	e.data(3, end, start, elapsed, elapsed, distance, fitSportCode(t.Sport), uint16(math.Round(s.ElevationGain)))
+	// activity: timestamp, total_timer_time, num_sessions, type, event, event_type
+	e.definition(4, 34,
+		fitField{253, 4, 0x86}, fitField{0, 4, 0x86}, fitField{1, 2, 0x84},
+		fitField{2, 1, 0x00}, fitField{3, 1, 0x00}, fitField{4, 1, 0x00})
+	e.data(4, end, elapsed, uint16(1), uint8(0), uint8(26), uint8(1))
+	return e.encode(w)
+}
+
+// fitSportCode returns the FIT sport best matching the free form sport name
+func fitSportCode(sport string) uint8 {
+	s := strings.ToLower(sport)
+	switch {
+	case strings.Contains(s, "cycl"), strings.Contains(s, "bik"), strings.Contains(s, "ride"):
+		return 2
+	case strings.Contains(s, "run"):
+		return 1
+	case strings.Contains(s, "walk"):
+		return 11
+	case strings.Contains(s, "hik"):
+		return 17
+	case strings.Contains(s, "swim"):
+		return 5
+	case strings.Contains(s, "row"):
+		return 15
+	}
+	return 0
+}
@@ -0,0 +1,152 @@
+package track_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bzimmer/gravl/track"
+)
+
+// fitFile builds a FIT file from definition and data messages
+type fitFile struct {
+	records bytes.Buffer
+}
+
+func (f *fitFile) definition(local byte, global uint16, fields ...[3]byte) *fitFile {
+	f.records.WriteByte(0x40 | local)
+	f.records.Write([]byte{0, 0})
+	_ = binary.Write(&f.records, binary.LittleEndian, global)
+	f.records.WriteByte(byte(len(fields)))
+	for _, x := range fields {
+		f.records.Write(x[:])
+	}
+	return f
+}
+
+func (f *fitFile) data(header byte, values ...any) *fitFile {
+	f.records.WriteByte(header)
+	for _, v := range values {
+		_ = binary.Write(&f.records, binary.LittleEndian, v)
+	}
+	return f
+}
+
+func (f *fitFile) bytes() []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{14, 0x10, 0x08, 0x08})
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(f.records.Len()))
+	buf.WriteString(".FIT")
+	buf.Write([]byte{0, 0})
+	buf.Write(f.records.Bytes())
+	_ = binary.Write(&buf, binary.LittleEndian, fitCRC(buf.Bytes()))
+	return buf.Bytes()
+}
+
+func fitCRC(p []byte) uint16 {
+	table := [16]uint16{
+		0x0000, 0xcc01, 0xd801, 0x1400, 0xf001, 0x3c00, 0x2800, 0xe401,
+		0xa001, 0x6c00, 0x7800, 0xb401, 0x5000, 0x9c01, 0x8801, 0x4400,
+	}
+	var crc uint16
+	for _, b := range p {
+		for _, n := range []byte{b & 0xf, b >> 4} {
+			tmp := table[crc&0xf]
+			crc = (crc >> 4) & 0x0fff
+			crc = crc ^ tmp ^ table[n]
+		}
+	}
+	return crc
+}
+
+// fitTime is 2021-10-01T08:00:00Z in seconds since the FIT epoch
+const fitTime = uint32(1633075200 - 631065600)
+
+func semicircles(deg float64) int32 {
+	return int32(deg / 180 * (1 << 31))
+}
+
+func ride() []byte {
+	f := &fitFile{}
+	// file_id: manufacturer, product
+	f.definition(0, 0, [3]byte{1, 2, 0x84}, [3]byte{2, 2, 0x84})
+	f.data(0, uint16(289), uint16(2))
+	// record: timestamp, lat, lng, altitude, heart_rate, distance, power
+	f.definition(1, 20,
+		[3]byte{253, 4, 0x86}, [3]byte{0, 4, 0x85}, [3]byte{1, 4, 0x85},
+		[3]byte{2, 2, 0x84}, [3]byte{3, 1, 0x02}, [3]byte{5, 4, 0x86}, [3]byte{7, 2, 0x84})
+	lat, lng := semicircles(47.6), semicircles(-122.3)
+	f.data(1, fitTime, lat, lng, uint16((100+500)*5), uint8(120), uint32(0), uint16(200))
+	f.data(1, fitTime+10, lat+1000, lng, uint16((105+500)*5), uint8(0xff), uint32(5000), uint16(210))
+	// record without timestamp, sent with a compressed timestamp header
+	f.definition(2, 20, [3]byte{2, 2, 0x84}, [3]byte{5, 4, 0x86})
+	f.data(0x80|2<<5|byte((fitTime+20)&0x1f), uint16((103+500)*5), uint32(10000))
+	// session: sport, total_ascent
+	f.definition(3, 18, [3]byte{5, 1, 0x00}, [3]byte{22, 2, 0x84})
+	f.data(3, uint8(2), uint16(7))
+	return f.bytes()
+}
+
+func TestDecodeFIT(t *testing.T) {
+	a := assert.New(t)
+
+	trk, err := track.DecodeFIT(bytes.NewReader(ride()))
+	a.NoError(err)
+	a.NotNil(trk)
+	a.Equal(track.FormatFIT, trk.Format)
+	a.Equal("cycling", trk.Sport)
+	a.Equal("hammerhead 2", trk.Device)
+	a.Len(trk.Points, 3)
+
+	p := trk.Points[0]
+	a.Equal(time.Date(2021, time.October, 1, 8, 0, 0, 0, time.UTC), p.Time)
+	a.InDelta(47.6, p.Lat, 0.0001)
+	a.InDelta(-122.3, p.Lng, 0.0001)
+	a.InDelta(100.0, p.Elevation, 0.001)
+	a.Equal(120.0, p.HeartRate)
+	a.Equal(200.0, p.Power)
+	a.True(p.Has(track.ChannelHeartRate))
+	a.False(trk.Points[1].Has(track.ChannelHeartRate))
+
+	p = trk.Points[2]
+	a.Equal(time.Date(2021, time.October, 1, 8, 0, 20, 0, time.UTC), p.Time)
+	a.False(p.Has(track.ChannelPosition))
+	a.Equal(100.0, p.Distance)
+
+	s := trk.Summarize()
+	a.Equal(20.0, s.Duration)
+	a.Equal(100.0, s.Distance)
+	a.Equal(7.0, s.ElevationGain)
+	a.Equal([]string{"position", "elevation", "distance", "heartrate", "power"}, s.Channels)
+}
+
+func TestDecodeFITInvalid(t *testing.T) {
+	a := assert.New(t)
+
+	data := ride()
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{name: "empty", data: []byte{}, err: "invalid fit: truncated"},
+		{name: "header", data: []byte{0x01}, err: "invalid fit: header size 1"},
+		{name: "signature", data: append([]byte{14, 0, 0, 0, 0, 0, 0, 0, '.', 'F', 'O', 'O', 0, 0}, 0, 0), err: "missing signature"},
+		{name: "truncated", data: data[:len(data)-10], err: "invalid fit: truncated"},
+		{name: "crc", data: append(append([]byte{}, data[:len(data)-1]...), data[len(data)-1]^0xff), err: "crc mismatch"},
+		{name: "undefined", data: (&fitFile{}).data(5).bytes(), err: "undefined local message 5"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			trk, err := track.DecodeFIT(bytes.NewReader(tt.data))
+			a.Error(err)
+			a.ErrorIs(err, track.ErrInvalidFIT)
+			a.Contains(err.Error(), tt.err)
+			a.Nil(trk)
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package track
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+type gpxPoint struct {
+	Lat        *float64   `xml:"lat,attr"`
+	Lng        *float64   `xml:"lon,attr"`
+	Elevation  *float64   `xml:"ele"`
+	Time       *time.Time `xml:"time"`
+	Extensions struct {
+		Power       *float64 `xml:"power"`
+		HeartRate   *float64 `xml:"TrackPointExtension>hr"`
+		Cadence     *float64 `xml:"TrackPointExtension>cad"`
+		Temperature *float64 `xml:"TrackPointExtension>atemp"`
+		Speed       *float64 `xml:"TrackPointExtension>speed"`
+	} `xml:"extensions"`
+}
+
+type gpx struct {
+	XMLName  xml.Name `xml:"gpx"`
+	Creator  string   `xml:"creator,attr"`
+	Metadata struct {
+		Name string `xml:"name"`
+	} `xml:"metadata"`
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Type     string `xml:"type"`
+		Segments []struct {
+			Points []*gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+// DecodeGPX decodes a GPX activity file, all tracks and segments are concatenated
+func DecodeGPX(r io.Reader) (*Track, error) {
+	var doc gpx
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid gpx: %w", err)
+	}
+	t := &Track{Format: FormatGPX, Name: doc.Metadata.Name, Device: doc.Creator}
+	for _, trk := range doc.Tracks {
+		if t.Name == "" {
+			t.Name = trk.Name
+		}
+		if t.Sport == "" {
+			t.Sport = trk.Type
+		}
+		for _, seg := range trk.Segments {
+			for _, pt := range seg.Points {
+				t.Points = append(t.Points, pt.point())
+			}
+		}
+	}
+	return t, nil
+}
+
+func (pt *gpxPoint) point() *Point {
+	p := &Point{}
+	if pt.Time != nil {
+		p.Time = pt.Time.UTC()
+	}
+	if pt.Lat != nil && pt.Lng != nil {
+		p.Lat, p.Lng, p.Channels = *pt.Lat, *pt.Lng, p.Channels|ChannelPosition
+	}
+	set(&p.Elevation, pt.Elevation, &p.Channels, ChannelElevation)
+	set(&p.Power, pt.Extensions.Power, &p.Channels, ChannelPower)
+	set(&p.HeartRate, pt.Extensions.HeartRate, &p.Channels, ChannelHeartRate)
+	set(&p.Cadence, pt.Extensions.Cadence, &p.Channels, ChannelCadence)
+	set(&p.Temperature, pt.Extensions.Temperature, &p.Channels, ChannelTemperature)
+	set(&p.Speed, pt.Extensions.Speed, &p.Channels, ChannelSpeed)
+	return p
+}
+
+// set the value and channel if the value was present in the document
+func set(dst, src *float64, channels *Channel, c Channel) {
+	if src == nil {
+		return
+	}
+	*dst = *src
+	*channels |= c
+}
+
+type gpxTrackPointExtension struct {
+	Temperature *float64 `xml:"gpxtpx:atemp,omitempty"`
+	HeartRate   *float64 `xml:"gpxtpx:hr,omitempty"`
+	Cadence     *float64 `xml:"gpxtpx:cad,omitempty"`
+}
+
+type gpxExtensions struct {
+	Power *float64                `xml:"power,omitempty"`
+	TPX   *gpxTrackPointExtension `xml:"gpxtpx:TrackPointExtension,omitempty"`
+}
+
+type gpxOutPoint struct {
+	Lat        float64        `xml:"lat,attr"`
+	Lng        float64        `xml:"lon,attr"`
+	Elevation  *float64       `xml:"ele,omitempty"`
+	Time       *time.Time     `xml:"time,omitempty"`
+	Extensions *gpxExtensions `xml:"extensions,omitempty"`
+}
+
+type gpxOut struct {
+	XMLName  xml.Name `xml:"gpx"`
+	Version  string   `xml:"version,attr"`
+	Creator  string   `xml:"creator,attr"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	XmlnsTPX string   `xml:"xmlns:gpxtpx,attr"`
+	Track    struct {
+		Name   string         `xml:"name,omitempty"`
+		Type   string         `xml:"type,omitempty"`
+		Points []*gpxOutPoint `xml:"trkseg>trkpt"`
+	} `xml:"trk"`
+}
+
+// EncodeGPX encodes the track as a GPX 1.1 file
+//
+// GPX requires a position for every point so points without one are dropped; distance
+// and speed have no representation in GPX and are not encoded
+func EncodeGPX(w io.Writer, t *Track) error {
+	doc := &gpxOut{
+		Version:  "1.1",
+		Creator:  t.Device,
+		Xmlns:    "http://www.topografix.com/GPX/1/1",
+		XmlnsTPX: "http://www.garmin.com/xmlschemas/TrackPointExtension/v1",
+	}
+	if doc.Creator == "" {
+		doc.Creator = "gravl"
+	}
+	doc.Track.Name, doc.Track.Type = t.Name, t.Sport
+	for _, p := range t.Points {
+		if !p.Has(ChannelPosition) {
+			continue
+		}
+		pt := &gpxOutPoint{Lat: p.Lat, Lng: p.Lng, Elevation: get(p, ChannelElevation, p.Elevation)}
+		if !p.Time.IsZero() {
+			pt.Time = &p.Time
+		}
+		ext := &gpxExtensions{Power: get(p, ChannelPower, p.Power)}
+		tpx := &gpxTrackPointExtension{
+			Temperature: get(p, ChannelTemperature, p.Temperature),
+			HeartRate:   get(p, ChannelHeartRate, p.HeartRate),
+			Cadence:     get(p, ChannelCadence, p.Cadence),
+		}
+		if tpx.Temperature != nil || tpx.HeartRate != nil || tpx.Cadence != nil {
+			ext.TPX = tpx
+		}
+		if ext.Power != nil || ext.TPX != nil {
+			pt.Extensions = ext
+		}
+		doc.Track.Points = append(doc.Track.Points, pt)
+	}
+	return encodeXML(w, doc)
+}
+
+// get returns the value if the channel is present in the point, nil otherwise
+func get(p *Point, c Channel, v float64) *float64 {
+	if !p.Has(c) {
+		return nil
+	}
+	return &v
+}
+
+func encodeXML(w io.Writer, doc any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", " ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,59 @@
+package track_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bzimmer/gravl/track"
+)
+
+const gpx = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx creator="Hammerhead Karoo 2" xmlns="http://www.topografix.com/GPX/1/1"
+  xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1">
+ <trk>
+  <name>Morning Ride</name>
+  <type>cycling</type>
+  <trkseg>
+   <trkpt lat="47.6000" lon="-122.3000"><ele>100</ele><time>2021-10-01T08:00:00Z</time>
+    <extensions><power>200</power><gpxtpx:TrackPointExtension><gpxtpx:hr>101</gpxtpx:hr>` +
+	`<gpxtpx:cad>85</gpxtpx:cad></gpxtpx:TrackPointExtension></extensions></trkpt>
+   <trkpt lat="47.6010" lon="-122.3000"><ele>100.5</ele><time>2021-10-01T08:00:30Z</time></trkpt>
+  </trkseg>
+  <trkseg>
+   <trkpt lat="47.6020" lon="-122.3000"><ele>103</ele><time>2021-10-01T08:01:00Z</time></trkpt>
+  </trkseg>
+ </trk>
+</gpx>`
+
+func TestDecodeGPX(t *testing.T) {
+	a := assert.New(t)
+
+	trk, err := track.DecodeGPX(strings.NewReader(gpx))
+	a.NoError(err)
+	a.NotNil(trk)
+	a.Equal(track.FormatGPX, trk.Format)
+	a.Equal("Morning Ride", trk.Name)
+	a.Equal("cycling", trk.Sport)
+	a.Equal("Hammerhead Karoo 2", trk.Device)
+	a.Len(trk.Points, 3)
+
+	p := trk.Points[0]
+	a.Equal(time.Date(2021, time.October, 1, 8, 0, 0, 0, time.UTC), p.Time)
+	a.Equal(101.0, p.HeartRate)
+	a.Equal(85.0, p.Cadence)
+	a.Equal(200.0, p.Power)
+	a.False(trk.Points[1].Has(track.ChannelHeartRate))
+
+	s := trk.Summarize()
+	a.Equal(60.0, s.Duration)
+	a.InDelta(222.4, s.Distance, 0.1)
+	a.Equal(3.0, s.ElevationGain)
+	a.Equal([]string{"position", "elevation", "heartrate", "cadence", "power"}, s.Channels)
+
+	trk, err = track.DecodeGPX(strings.NewReader("<gpx><trk>"))
+	a.Error(err)
+	a.Nil(trk)
+}
@@ -0,0 +1,179 @@
+package track
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+type tcxPoint struct {
+	Time     *time.Time `xml:"Time"`
+	Position *struct {
+		Lat float64 `xml:"LatitudeDegrees"`
+		Lng float64 `xml:"LongitudeDegrees"`
+	} `xml:"Position"`
+	Elevation *float64 `xml:"AltitudeMeters"`
+	Distance  *float64 `xml:"DistanceMeters"`
+	HeartRate *float64 `xml:"HeartRateBpm>Value"`
+	Cadence   *float64 `xml:"Cadence"`
+	Speed     *float64 `xml:"Extensions>TPX>Speed"`
+	Power     *float64 `xml:"Extensions>TPX>Watts"`
+}
+
+type tcx struct {
+	XMLName    xml.Name `xml:"TrainingCenterDatabase"`
+	Activities []struct {
+		Sport   string `xml:"Sport,attr"`
+		Notes   string `xml:"Notes"`
+		Creator struct {
+			Name string `xml:"Name"`
+		} `xml:"Creator"`
+		Laps []struct {
+			Points []*tcxPoint `xml:"Track>Trackpoint"`
+		} `xml:"Lap"`
+	} `xml:"Activities>Activity"`
+}
+
+// DecodeTCX decodes a TCX activity file, all activities and laps are concatenated
+func DecodeTCX(r io.Reader) (*Track, error) {
+	var doc tcx
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid tcx: %w", err)
+	}
+	t := &Track{Format: FormatTCX}
+	for _, act := range doc.Activities {
+		if t.Name == "" {
+			t.Name = act.Notes
+		}
+		if t.Sport == "" {
+			t.Sport = act.Sport
+		}
+		if t.Device == "" {
+			t.Device = act.Creator.Name
+		}
+		for _, lap := range act.Laps {
+			for _, pt := range lap.Points {
+				t.Points = append(t.Points, pt.point())
+			}
+		}
+	}
+	return t, nil
+}
+
+func (pt *tcxPoint) point() *Point {
+	p := &Point{}
+	if pt.Time != nil {
+		p.Time = pt.Time.UTC()
+	}
+	if pt.Position != nil {
+		p.Lat, p.Lng, p.Channels = pt.Position.Lat, pt.Position.Lng, p.Channels|ChannelPosition
+	}
+	set(&p.Elevation, pt.Elevation, &p.Channels, ChannelElevation)
+	set(&p.Distance, pt.Distance, &p.Channels, ChannelDistance)
+	set(&p.HeartRate, pt.HeartRate, &p.Channels, ChannelHeartRate)
+	set(&p.Cadence, pt.Cadence, &p.Channels, ChannelCadence)
+	set(&p.Speed, pt.Speed, &p.Channels, ChannelSpeed)
+	set(&p.Power, pt.Power, &p.Channels, ChannelPower)
+	return p
+}
+
+type tcxOutPoint struct {
+	Time     time.Time `xml:"Time"`
+	Position *struct {
+		Lat float64 `xml:"LatitudeDegrees"`
+		Lng float64 `xml:"LongitudeDegrees"`
+	} `xml:"Position,omitempty"`
+	Elevation *float64 `xml:"AltitudeMeters,omitempty"`
+	Distance  *float64 `xml:"DistanceMeters,omitempty"`
+	HeartRate *struct {
+		Value int `xml:"Value"`
+	} `xml:"HeartRateBpm,omitempty"`
+	Cadence    *int `xml:"Cadence,omitempty"`
+	Extensions *struct {
+		Speed *float64 `xml:"ns3:TPX>ns3:Speed,omitempty"`
+		Power *int     `xml:"ns3:TPX>ns3:Watts,omitempty"`
+	} `xml:"Extensions,omitempty"`
+}
+
+type tcxOut struct {
+	XMLName  xml.Name `xml:"TrainingCenterDatabase"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	XmlnsNS3 string   `xml:"xmlns:ns3,attr"`
+	Activity struct {
+		Sport string    `xml:"Sport,attr"`
+		ID    time.Time `xml:"Id"`
+		Lap   struct {
+			StartTime     time.Time      `xml:"StartTime,attr"`
+			TotalTime     float64        `xml:"TotalTimeSeconds"`
+			Distance      float64        `xml:"DistanceMeters"`
+			Calories      int            `xml:"Calories"`
+			Intensity     string         `xml:"Intensity"`
+			TriggerMethod string         `xml:"TriggerMethod"`
+			Points        []*tcxOutPoint `xml:"Track>Trackpoint"`
+		} `xml:"Lap"`
+		Notes string `xml:"Notes,omitempty"`
+	} `xml:"Activities>Activity"`
+}
+
+// EncodeTCX encodes the track as a TCX file
+//
+// TCX requires a time for every point so points without one are dropped; temperature
+// has no representation in TCX and is not encoded
+func EncodeTCX(w io.Writer, t *Track) error {
+	s := t.Summarize()
+	doc := &tcxOut{
+		Xmlns:    "http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2",
+		XmlnsNS3: "http://www.garmin.com/xmlschemas/ActivityExtension/v2",
+	}
+	act := &doc.Activity
+	act.ID, act.Notes = s.Start, t.Name
+	switch fitSportCode(t.Sport) {
+	case 1:
+		act.Sport = "Running"
+	case 2:
+		act.Sport = "Biking"
+	default:
+		act.Sport = "Other"
+	}
+	act.Lap.StartTime, act.Lap.TotalTime, act.Lap.Distance = s.Start, s.Duration, s.Distance
+	act.Lap.Intensity, act.Lap.TriggerMethod = "Active", "Manual"
+	for _, p := range t.Points {
+		if p.Time.IsZero() {
+			continue
+		}
+		pt := &tcxOutPoint{
+			Time:      p.Time,
+			Elevation: get(p, ChannelElevation, p.Elevation),
+			Distance:  get(p, ChannelDistance, p.Distance),
+		}
+		if p.Has(ChannelPosition) {
+			pt.Position = &struct {
+				Lat float64 `xml:"LatitudeDegrees"`
+				Lng float64 `xml:"LongitudeDegrees"`
+			}{Lat: p.Lat, Lng: p.Lng}
+		}
+		if p.Has(ChannelHeartRate) {
+			pt.HeartRate = &struct {
+				Value int `xml:"Value"`
+			}{Value: int(math.Round(p.HeartRate))}
+		}
+		if p.Has(ChannelCadence) {
+			cad := int(math.Round(p.Cadence))
+			pt.Cadence = &cad
+		}
+		if p.Has(ChannelSpeed) || p.Has(ChannelPower) {
+			pt.Extensions = &struct {
+				Speed *float64 `xml:"ns3:TPX>ns3:Speed,omitempty"`
+				Power *int     `xml:"ns3:TPX>ns3:Watts,omitempty"`
+			}{Speed: get(p, ChannelSpeed, p.Speed)}
+			if p.Has(ChannelPower) {
+				power := int(math.Round(p.Power))
+				pt.Extensions.Power = &power
+			}
+		}
+		act.Lap.Points = append(act.Lap.Points, pt)
+	}
+	return encodeXML(w, doc)
+}
@@ -0,0 +1,51 @@
+package track_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bzimmer/gravl/track"
+)
+
+const tcx = `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2"
+  xmlns:ns3="http://www.garmin.com/xmlschemas/ActivityExtension/v2">
+ <Activities><Activity Sport="Biking"><Id>2021-10-01T08:00:00Z</Id><Lap StartTime="2021-10-01T08:00:00Z">
+  <Track>
+   <Trackpoint><Time>2021-10-01T08:00:00Z</Time><Position><LatitudeDegrees>47.6</LatitudeDegrees>` +
+	`<LongitudeDegrees>-122.3</LongitudeDegrees></Position><AltitudeMeters>100</AltitudeMeters>` +
+	`<DistanceMeters>0</DistanceMeters><HeartRateBpm><Value>101</Value></HeartRateBpm>` +
+	`<Extensions><ns3:TPX><ns3:Watts>180</ns3:Watts></ns3:TPX></Extensions></Trackpoint>
+   <Trackpoint><Time>2021-10-01T08:10:00Z</Time><Position><LatitudeDegrees>47.7</LatitudeDegrees>` +
+	`<LongitudeDegrees>-122.4</LongitudeDegrees></Position><AltitudeMeters>90</AltitudeMeters>` +
+	`<DistanceMeters>4321.5</DistanceMeters></Trackpoint>
+  </Track>
+ </Lap>
+ <Creator><Name>Zwift</Name></Creator></Activity></Activities>
+</TrainingCenterDatabase>`
+
+func TestDecodeTCX(t *testing.T) {
+	a := assert.New(t)
+
+	trk, err := track.DecodeTCX(strings.NewReader(tcx))
+	a.NoError(err)
+	a.NotNil(trk)
+	a.Equal(track.FormatTCX, trk.Format)
+	a.Equal("Biking", trk.Sport)
+	a.Equal("Zwift", trk.Device)
+	a.Len(trk.Points, 2)
+	a.Equal(180.0, trk.Points[0].Power)
+	a.Equal(101.0, trk.Points[0].HeartRate)
+
+	s := trk.Summarize()
+	a.Equal(600.0, s.Duration)
+	a.Equal(4321.5, s.Distance)
+	a.Equal(0.0, s.ElevationGain)
+	a.Equal([]string{"position", "elevation", "distance", "heartrate", "power"}, s.Channels)
+
+	trk, err = track.DecodeTCX(strings.NewReader("<TrainingCenterDatabase>"))
+	a.Error(err)
+	a.Nil(trk)
+}
@@ -0,0 +1,284 @@
+package track
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// ErrUnknownFormat is returned when the format of the file cannot be determined
+var ErrUnknownFormat = errors.New("unknown format")
+
+// Format of an activity file
+type Format string
+
+const (
+	FormatFIT Format = "fit"
+	FormatGPX Format = "gpx"
+	FormatTCX Format = "tcx"
+)
+
+// Channel identifies a recorded data channel
+type Channel uint
+
+const (
+	ChannelPosition Channel = 1 << iota
+	ChannelElevation
+	ChannelDistance
+	ChannelSpeed
+	ChannelHeartRate
+	ChannelCadence
+	ChannelPower
+	ChannelTemperature
+)
+
+// Channels is the ordered list of all channels
+func Channels() []Channel {
+	return []Channel{
+		ChannelPosition, ChannelElevation, ChannelDistance, ChannelSpeed,
+		ChannelHeartRate, ChannelCadence, ChannelPower, ChannelTemperature,
+	}
+}
+
+func (c Channel) String() string {
+	switch c {
+	case ChannelPosition:
+		return "position"
+	case ChannelElevation:
+		return "elevation"
+	case ChannelDistance:
+		return "distance"
+	case ChannelSpeed:
+		return "speed"
+	case ChannelHeartRate:
+		return "heartrate"
+	case ChannelCadence:
+		return "cadence"
+	case ChannelPower:
+		return "power"
+	case ChannelTemperature:
+		return "temperature"
+	}
+	return fmt.Sprintf("channel(%d)", uint(c))
+}
+
+// Point is a single recorded sample, only the values of the channels present are meaningful
+type Point struct {
+	Time time.Time
+	// Lat and Lng in degrees
+	Lat, Lng float64
+	// Elevation in meters
+	Elevation float64
+	// Distance in meters from the start of the track
+	Distance float64
+	// Speed in meters per second
+	Speed float64
+	// HeartRate in beats per minute
+	HeartRate float64
+	// Cadence in revolutions per minute
+	Cadence float64
+	// Power in watts
+	Power float64
+	// Temperature in degrees celsius
+	Temperature float64
+	// Channels present in the point
+	Channels Channel
+}
+
+// Has returns true if the channel is present in the point
+func (p *Point) Has(c Channel) bool {
+	return p.Channels&c != 0
+}
+
+// Track is the common in-memory model of an activity file
+type Track struct {
+	Format Format
+	Name   string
+	Sport  string
+	Device string
+	// Ascent in meters as reported by the device, zero if not reported
+	Ascent float64
+	Points []*Point
+}
+
+// Channels returns the channels present in any point of the track
+func (t *Track) Channels() Channel {
+	var c Channel
+	for _, p := range t.Points {
+		c |= p.Channels
+	}
+	return c
+}
+
+// Summary of a track
+type Summary struct {
+	Format   Format    `json:"format"`
+	Name     string    `json:"name,omitempty"`
+	Sport    string    `json:"sport,omitempty"`
+	Device   string    `json:"device,omitempty"`
+	Start    time.Time `json:"start"`
+	Points   int       `json:"points"`
+	Channels []string  `json:"channels"`
+	// Duration in seconds
+	Duration float64 `json:"duration"`
+	// Distance in meters
+	Distance float64 `json:"distance"`
+	// ElevationGain in meters
+	ElevationGain float64 `json:"elevation_gain"`
+}
+
+// Summarize the track
+func (t *Track) Summarize() *Summary {
+	s := &Summary{
+		Format:   t.Format,
+		Name:     t.Name,
+		Sport:    t.Sport,
+		Device:   t.Device,
+		Points:   len(t.Points),
+		Channels: []string{},
+	}
+	channels := t.Channels()
+	for _, c := range Channels() {
+		if channels&c != 0 {
+			s.Channels = append(s.Channels, c.String())
+		}
+	}
+	var first, last time.Time
+	for _, p := range t.Points {
+		if p.Time.IsZero() {
+			continue
+		}
+		if first.IsZero() {
+			first = p.Time
+		}
+		last = p.Time
+	}
+	s.Start = first
+	s.Duration = last.Sub(first).Seconds()
+	s.Distance = t.Distance()
+	s.ElevationGain = t.Ascent
+	if s.ElevationGain == 0 {
+		s.ElevationGain = t.ElevationGain()
+	}
+	return s
+}
+
+// Distance returns the distance of the track in meters, preferring the recorded
+// distance channel and falling back to the distance between points
+func (t *Track) Distance() float64 {
+	for i := len(t.Points) - 1; i >= 0; i-- {
+		if t.Points[i].Has(ChannelDistance) {
+			return t.Points[i].Distance
+		}
+	}
+	var total float64
+	var prev *Point
+	for _, p := range t.Points {
+		if !p.Has(ChannelPosition) {
+			continue
+		}
+		if prev != nil {
+			total += Haversine(prev.Lat, prev.Lng, p.Lat, p.Lng)
+		}
+		prev = p
+	}
+	return total
+}
+
+// hysteresis is the elevation change in meters required before a climb is counted,
+// smoothing the noise present in barometric and gps elevation
+const hysteresis = 1.0
+
+// ElevationGain returns the total climbing of the track in meters
+func (t *Track) ElevationGain() float64 {
+	var gain float64
+	var anchor *float64
+	for _, p := range t.Points {
+		if !p.Has(ChannelElevation) {
+			continue
+		}
+		ele := p.Elevation
+		switch {
+		case anchor == nil:
+			anchor = &ele
+		case ele-*anchor >= hysteresis:
+			gain += ele - *anchor
+			anchor = &ele
+		case ele < *anchor:
+			anchor = &ele
+		}
+	}
+	return gain
+}
+
+// Haversine returns the great circle distance in meters between two coordinates in degrees
+func Haversine(lat1, lng1, lat2, lng2 float64) float64 {
+	const earthRadius = 6371008.8
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dlat, dlng := rad(lat2-lat1), rad(lng2-lng1)
+	h := math.Pow(math.Sin(dlat/2), 2) + math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Pow(math.Sin(dlng/2), 2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// Sniff returns the format of the activity file from its leading bytes
+func Sniff(data []byte) (Format, error) {
+	switch {
+	case len(data) >= 12 && string(data[8:12]) == ".FIT":
+		return FormatFIT, nil
+	case bytes.Contains(data, []byte("<TrainingCenterDatabase")):
+		return FormatTCX, nil
+	case bytes.Contains(data, []byte("<gpx")):
+		return FormatGPX, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+// Decode the activity file, the format is determined from the contents
+func Decode(r io.Reader) (*Track, error) {
+	br := bufio.NewReaderSize(r, 4096)
+	head, err := br.Peek(1024)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	format, err := Sniff(head)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case FormatFIT:
+		return DecodeFIT(br)
+	case FormatGPX:
+		return DecodeGPX(br)
+	case FormatTCX:
+		return DecodeTCX(br)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// Encode the track in the format, channels the format cannot represent are dropped
+func Encode(w io.Writer, t *Track, format Format) error {
+	switch format {
+	case FormatFIT:
+		return EncodeFIT(w, t)
+	case FormatGPX:
+		return EncodeGPX(w, t)
+	case FormatTCX:
+		return EncodeTCX(w, t)
+	}
+	return fmt.Errorf("%w: '%s'", ErrUnknownFormat, format)
+}
+
+// ToFormat returns the format for the name, eg `gpx` or `.GPX`
+func ToFormat(name string) (Format, error) {
+	format := Format(strings.TrimPrefix(strings.ToLower(name), "."))
+	switch format {
+	case FormatFIT, FormatGPX, FormatTCX:
+		return format, nil
+	}
+	return "", fmt.Errorf("%w: '%s'", ErrUnknownFormat, name)
+}
@@ -0,0 +1,119 @@
+package track_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bzimmer/gravl/track"
+)
+
+func TestDecode(t *testing.T) {
+	a := assert.New(t)
+	tests := []struct {
+		name   string
+		data   []byte
+		format track.Format
+		err    string
+	}{
+		{name: "fit", data: ride(), format: track.FormatFIT},
+		{name: "gpx", data: []byte(gpx), format: track.FormatGPX},
+		{name: "tcx", data: []byte(tcx), format: track.FormatTCX},
+		{name: "unknown", data: []byte("hello"), err: "unknown format"},
+		{name: "empty", data: []byte{}, err: "unknown format"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			trk, err := track.Decode(bytes.NewReader(tt.data))
+			if tt.err != "" {
+				a.Error(err)
+				a.Contains(err.Error(), tt.err)
+				a.Nil(trk)
+				return
+			}
+			a.NoError(err)
+			a.Equal(tt.format, trk.Format)
+			a.NotEmpty(trk.Points)
+		})
+	}
+}
+
+func TestHaversine(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(0.0, track.Haversine(47.6, -122.3, 47.6, -122.3))
+	// one degree of latitude is ~111.2km
+	a.InDelta(111195.0, track.Haversine(47.0, -122.3, 48.0, -122.3), 1.0)
+}
+
+func TestChannel(t *testing.T) {
+	a := assert.New(t)
+	var names []string
+	for _, c := range track.Channels() {
+		names = append(names, c.String())
+	}
+	a.Equal("position elevation distance speed heartrate cadence power temperature", strings.Join(names, " "))
+	a.Equal("channel(1024)", track.Channel(1024).String())
+}
+
+func TestEncode(t *testing.T) {
+	a := assert.New(t)
+	src, err := track.Decode(bytes.NewReader(ride()))
+	a.NoError(err)
+	tests := []struct {
+		format   track.Format
+		channels []string
+	}{
+		// gpx drops the point without a position and has no distance channel
+		{format: track.FormatGPX, channels: []string{"position", "elevation", "heartrate", "power"}},
+		{format: track.FormatTCX, channels: []string{"position", "elevation", "distance", "heartrate", "power"}},
+		{format: track.FormatFIT, channels: []string{"position", "elevation", "distance", "heartrate", "power"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(string(tt.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			a.NoError(track.Encode(&buf, src, tt.format))
+			trk, err := track.Decode(&buf)
+			a.NoError(err)
+			a.Equal(tt.format, trk.Format)
+			a.Equal(src.Points[0].Time, trk.Points[0].Time)
+			a.InDelta(src.Points[0].Lat, trk.Points[0].Lat, 0.000001)
+			a.InDelta(src.Points[0].Lng, trk.Points[0].Lng, 0.000001)
+			a.InDelta(src.Points[1].Elevation, trk.Points[1].Elevation, 0.2)
+			a.Equal(src.Points[0].HeartRate, trk.Points[0].HeartRate)
+			a.Equal(src.Points[1].Power, trk.Points[1].Power)
+			a.Equal(tt.channels, trk.Summarize().Channels)
+		})
+	}
+	a.Error(track.Encode(&bytes.Buffer{}, src, track.Format("kml")))
+}
+
+func TestEncodeFITSummary(t *testing.T) {
+	a := assert.New(t)
+	src, err := track.DecodeGPX(strings.NewReader(gpx))
+	a.NoError(err)
+	var buf bytes.Buffer
+	a.NoError(track.EncodeFIT(&buf, src))
+	trk, err := track.DecodeFIT(&buf)
+	a.NoError(err)
+	a.Equal("cycling", trk.Sport)
+	a.Equal("Hammerhead Karoo 2", trk.Device)
+	a.Equal(3.0, trk.Ascent)
+	a.Equal(src.Summarize().Duration, trk.Summarize().Duration)
+	a.Equal(85.0, trk.Points[0].Cadence)
+}
+
+func TestToFormat(t *testing.T) {
+	a := assert.New(t)
+	for _, name := range []string{"fit", ".FIT", "Gpx", ".tcx"} {
+		format, err := track.ToFormat(name)
+		a.NoError(err)
+		a.NotEmpty(format)
+	}
+	format, err := track.ToFormat(".kml")
+	a.ErrorIs(err, track.ErrUnknownFormat)
+	a.Empty(format)
+}